@@ -9,7 +9,10 @@ export const MessageTypes = {
   START_RACE: "start_race",
   NAVIGATE: "navigate",
   FINISH: "finish",
+  HELLO: "hello",
+  WELCOME: "welcome",
   CURSOR: "cursor",
+  VIEWPORT: "viewport",
   ROOM_STATE: "room_state",
   PLAYER_JOINED: "player_joined",
   PLAYER_LEFT: "player_left",
@@ -17,6 +20,8 @@ export const MessageTypes = {
   PLAYER_UPDATE: "player_update",
   PLAYER_FINISH: "player_finish",
   CURSOR_UPDATE: "cursor_update",
+  MIGRATE: "migrate",
+  RESUME: "resume",
   ERROR: "error",
 } as const;
 
@@ -67,6 +72,20 @@ interface UseMultiplayerOptions {
 // Get WebSocket URL from environment variable, fallback to localhost for development
 const WS_URL = import.meta.env.VITE_WS_URL || "ws://localhost:8080/ws";
 
+const PROTOCOL_VERSION = 3;
+
+// Guests keep the identity the server hands out, so their stats survive
+// even where the guest cookie is blocked
+const IDENTITY_KEY = "wr-identity";
+
+function socketURL(base: string): string {
+  const identity = localStorage.getItem(IDENTITY_KEY);
+  if (!identity) return base;
+  const url = new URL(base);
+  url.searchParams.set("identity", identity);
+  return url.toString();
+}
+
 export function useMultiplayer(options: UseMultiplayerOptions = {}) {
   const [isConnected, setIsConnected] = useState(false);
   const [roomState, setRoomState] = useState<RoomState | null>(null);
@@ -75,6 +94,11 @@ export function useMultiplayer(options: UseMultiplayerOptions = {}) {
 
   const wsRef = useRef<WebSocket | null>(null);
   const reconnectTimeoutRef = useRef<number | null>(null);
+  // A draining server sends clients elsewhere with a token that resumes
+  // their place in the room there
+  const serverURLRef = useRef<string>(WS_URL);
+  const resumeTokenRef = useRef<string | null>(null);
+  const connectRef = useRef<(() => void) | null>(null);
   const optionsRef = useRef(options);
   const handleMessageRef = useRef<((message: WebSocketMessage) => void) | null>(null);
 
@@ -152,12 +176,32 @@ export function useMultiplayer(options: UseMultiplayerOptions = {}) {
         break;
       }
 
+      case MessageTypes.WELCOME: {
+        const { identity } = payload as { identity?: string };
+        if (identity) {
+          localStorage.setItem(IDENTITY_KEY, identity);
+        }
+        break;
+      }
+
       case MessageTypes.CURSOR_UPDATE: {
         const data = payload as CursorUpdate;
         optionsRef.current.onCursorUpdate?.(data);
         break;
       }
 
+      case MessageTypes.MIGRATE: {
+        const { url, token } = payload as { url: string; token?: string };
+        console.log("Server draining, moving to", url);
+        serverURLRef.current = url;
+        resumeTokenRef.current = token ?? null;
+        const old = wsRef.current;
+        wsRef.current = null;
+        old?.close();
+        connectRef.current?.();
+        break;
+      }
+
       case MessageTypes.ERROR: {
         const { error: errorMsg } = payload as { error: string };
         console.error("Server error:", errorMsg);
@@ -181,17 +225,24 @@ export function useMultiplayer(options: UseMultiplayerOptions = {}) {
       return;
     }
 
-    console.log("Connecting to WebSocket:", WS_URL);
-    const ws = new WebSocket(WS_URL);
+    console.log("Connecting to WebSocket:", serverURLRef.current);
+    const ws = new WebSocket(socketURL(serverURLRef.current));
     wsRef.current = ws;
 
     ws.onopen = () => {
       console.log("WebSocket connected");
+      ws.send(JSON.stringify({ type: MessageTypes.HELLO, payload: { version: PROTOCOL_VERSION } }));
+      if (resumeTokenRef.current) {
+        ws.send(JSON.stringify({ type: MessageTypes.RESUME, payload: { token: resumeTokenRef.current } }));
+        resumeTokenRef.current = null;
+      }
       setIsConnected(true);
       setError(null);
     };
 
     ws.onclose = () => {
+      // A socket left behind by a migration closing doesn't matter
+      if (wsRef.current !== ws && wsRef.current !== null) return;
       console.log("WebSocket disconnected");
       setIsConnected(false);
       // Don't null out immediately - let pending operations complete
@@ -220,6 +271,10 @@ export function useMultiplayer(options: UseMultiplayerOptions = {}) {
     };
   }, []);
 
+  useEffect(() => {
+    connectRef.current = connect;
+  }, [connect]);
+
   const sendMessage = useCallback((type: string, payload: unknown) => {
     const ws = wsRef.current;
     if (ws && ws.readyState === WebSocket.OPEN) {
@@ -266,7 +321,7 @@ export function useMultiplayer(options: UseMultiplayerOptions = {}) {
   }, [sendMessage]);
 
   const sendNavigate = useCallback((article: string) => {
-    sendMessage(MessageTypes.NAVIGATE, { article });
+    sendMessage(MessageTypes.NAVIGATE, { article, eventId: crypto.randomUUID() });
   }, [sendMessage]);
 
   const sendFinish = useCallback((time: number) => {
@@ -274,7 +329,11 @@ export function useMultiplayer(options: UseMultiplayerOptions = {}) {
   }, [sendMessage]);
 
   const sendCursor = useCallback((x: number, y: number, article: string, cursorType?: string, anchorId?: string, nextAnchorId?: string, sectionRatio?: number) => {
-    sendMessage(MessageTypes.CURSOR, { x, y, article, cursorType, anchorId, nextAnchorId, sectionRatio });
+    sendMessage(MessageTypes.CURSOR, { x, y, article, cursorType, anchorId, nextAnchorId, sectionRatio, clientTime: Date.now() });
+  }, [sendMessage]);
+
+  const sendViewport = useCallback((article: string, scrollY: number, height: number, pageHeight?: number) => {
+    sendMessage(MessageTypes.VIEWPORT, { article, scrollY, height, pageHeight });
   }, [sendMessage]);
 
   const disconnect = useCallback((sendLeave = false) => {
@@ -323,6 +382,7 @@ export function useMultiplayer(options: UseMultiplayerOptions = {}) {
     sendNavigate,
     sendFinish,
     sendCursor,
+    sendViewport,
   };
 }
 
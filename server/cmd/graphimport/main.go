@@ -0,0 +1,51 @@
+// Command graphimport builds the offline link graph index from Wikipedia's
+// SQL dumps (https://dumps.wikimedia.org/enwiki/latest/), e.g.
+//
+//	graphimport -page enwiki-latest-page.sql.gz \
+//		-pagelinks enwiki-latest-pagelinks.sql.gz \
+//		-linktarget enwiki-latest-linktarget.sql.gz \
+//		-redirect enwiki-latest-redirect.sql.gz \
+//		-out links.graph
+//
+// then point the server at it with graph.path in the config or GRAPH_PATH.
+// For other editions pass -lang with dumps from e.g. dewiki; the graph is
+// then only used for rooms racing on that language.
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/graph"
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+func main() {
+	var d graph.Dumps
+	flag.StringVar(&d.Language, "lang", "en", "language code of the wiki the dumps are from")
+	flag.StringVar(&d.Page, "page", "", "page table dump (required)")
+	flag.StringVar(&d.PageLinks, "pagelinks", "", "pagelinks table dump (required)")
+	flag.StringVar(&d.LinkTarget, "linktarget", "", "linktarget table dump, for dumps that reference targets by ID")
+	flag.StringVar(&d.Redirect, "redirect", "", "redirect table dump, so links through redirects count")
+	out := flag.String("out", "links.graph", "index file to write")
+	flag.Parse()
+
+	if d.Page == "" || d.PageLinks == "" {
+		flag.Usage()
+		log.Fatal("-page and -pagelinks are required")
+	}
+	if !wiki.SupportedLanguage(d.Language) {
+		log.Fatalf("Unsupported language %q", d.Language)
+	}
+
+	start := time.Now()
+	g, err := graph.Build(d, log.Printf)
+	if err != nil {
+		log.Fatalf("Failed to build link graph: %v", err)
+	}
+	if err := g.WriteFile(*out); err != nil {
+		log.Fatalf("Failed to write %s: %v", *out, err)
+	}
+	log.Printf("Wrote %s: %d articles, %d links in %s", *out, g.Articles(), g.LinkCount(), time.Since(start).Round(time.Second))
+}
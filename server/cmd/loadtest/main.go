@@ -0,0 +1,103 @@
+// Command loadtest runs simulated racers against a server and reports
+// message latencies, so hub performance can be compared between builds:
+//
+//	loadtest -url ws://localhost:8080/ws -rooms 250 -players 8 -duration 2m
+//
+// Whichever racer creates a room hosts it: once every racer has joined and
+// is ready, it starts the race, and it asks for a rematch when one ends.
+// Racers click through articles at -click intervals and stream cursors
+// every -cursor, like a browser tab would.
+// Navigate latency is measured from sending navigate to receiving the
+// racer's own player_update, so it includes the server's redirect lookup
+// on Wikipedia unless the server can't reach it.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+type options struct {
+	url      string
+	rooms    int
+	players  int
+	duration time.Duration
+	ramp     time.Duration
+	click    time.Duration
+	cursor   time.Duration
+	ping     time.Duration
+	timeout  time.Duration
+	prefix   string
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.url, "url", "ws://localhost:8080/ws", "server WebSocket URL")
+	flag.IntVar(&o.rooms, "rooms", 100, "rooms to race in")
+	flag.IntVar(&o.players, "players", 8, "racers per room")
+	flag.DurationVar(&o.duration, "duration", time.Minute, "how long to keep racing once every room has started")
+	flag.DurationVar(&o.ramp, "ramp", 10*time.Second, "spread room joins over this long")
+	flag.DurationVar(&o.click, "click", 3*time.Second, "average time between a racer's clicks")
+	flag.DurationVar(&o.cursor, "cursor", 100*time.Millisecond, "time between cursor updates, 0 for none")
+	flag.DurationVar(&o.ping, "ping", 5*time.Second, "time between heartbeat pings")
+	flag.DurationVar(&o.timeout, "timeout", 10*time.Second, "how long to wait for a reply before counting it as lost")
+	flag.StringVar(&o.prefix, "prefix", "", "room ID prefix, random if empty")
+	flag.Parse()
+
+	if o.rooms <= 0 || o.players <= 0 {
+		log.Fatal("-rooms and -players must be positive")
+	}
+	if o.prefix == "" {
+		o.prefix = fmt.Sprintf("LT%04d", time.Now().UnixNano()%10000)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	s := newStats()
+	log.Printf("Starting %d rooms of %d racers against %s", o.rooms, o.players, o.url)
+
+	var wg sync.WaitGroup
+	raceCtx, stopRacing := context.WithCancel(ctx)
+	for i := 0; i < o.rooms; i++ {
+		delay := time.Duration(0)
+		if o.rooms > 1 {
+			delay = o.ramp * time.Duration(i) / time.Duration(o.rooms-1)
+		}
+		roomID := fmt.Sprintf("%s-%d", o.prefix, i)
+		for j := 0; j < o.players; j++ {
+			r := &racer{opts: &o, stats: s, roomID: roomID, name: fmt.Sprintf("bot%d", j)}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.run(raceCtx, delay)
+			}()
+		}
+	}
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	deadline := time.After(o.ramp + o.duration)
+	start := time.Now()
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			s.progress(time.Since(start))
+		case <-deadline:
+			break loop
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	stopRacing()
+	wg.Wait()
+
+	s.report(os.Stdout, time.Since(start))
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Racers click around these articles. The room's end article isn't among
+// them, so races only end on an interrupt or a time limit.
+var articles = []string{
+	"Cat", "Dog", "Wolf", "Mammal", "Animal", "Biology", "Science", "Europe",
+	"France", "Paris", "Germany", "Berlin", "History", "World War II",
+	"United States", "New York City", "Music", "Rock music", "The Beatles",
+	"Physics", "Albert Einstein", "Mathematics", "Computer", "Internet",
+	"Moon", "Sun", "Earth", "Water", "Ocean", "Fish",
+}
+
+const (
+	startArticle = "Cat"
+	endArticle   = "Kevin Bacon"
+)
+
+type message struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// racer is one simulated player with its own connection
+type racer struct {
+	opts   *options
+	stats  *stats
+	roomID string
+	name   string
+
+	conn   *websocket.Conn
+	id     string
+	hostID string
+	rng    *rand.Rand
+
+	// In-flight requests, at most one of each
+	navigateAt time.Time
+	pingAt     time.Time
+	joinAt     time.Time
+	starting   bool // host sent start_race for the current round
+}
+
+func (r *racer) run(ctx context.Context, delay time.Duration) {
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return
+	}
+	r.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	start := time.Now()
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, r.opts.url, nil)
+	if err != nil {
+		r.stats.fail("connect")
+		return
+	}
+	r.stats.observe("connect", time.Since(start))
+	r.conn = conn
+	r.stats.connected(1)
+	defer r.stats.connected(-1)
+	defer conn.Close()
+
+	msgs := make(chan message, 64)
+	go r.read(ctx, msgs)
+
+	r.send("hello", map[string]interface{}{"version": 2, "features": []string{"cursor_batch"}})
+	r.joinAt = time.Now()
+	r.send("join_room", map[string]interface{}{
+		"roomId":       r.roomID,
+		"playerName":   r.name,
+		"startArticle": startArticle,
+		"endArticle":   endArticle,
+	})
+
+	var click, cursor <-chan time.Time
+	if r.opts.cursor > 0 {
+		t := time.NewTicker(r.opts.cursor)
+		defer t.Stop()
+		cursor = t.C
+	}
+	ping := time.NewTicker(r.opts.ping)
+	defer ping.Stop()
+	lost := time.NewTicker(time.Second)
+	defer lost.Stop()
+
+	racing := false
+	article := startArticle
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case m, ok := <-msgs:
+			if !ok {
+				if ctx.Err() == nil {
+					r.stats.fail("disconnect")
+				}
+				return
+			}
+			r.stats.received()
+			switch m.Type {
+			case "welcome":
+				var p struct{ ClientID string }
+				json.Unmarshal(m.Payload, &p)
+				r.id = p.ClientID
+			case "room_state", "room_reset":
+				var p struct{ HostID string }
+				json.Unmarshal(m.Payload, &p)
+				r.hostID = p.HostID
+				switch {
+				case m.Type == "room_reset":
+					racing, article, r.starting = false, startArticle, false
+				case !r.joinAt.IsZero():
+					r.stats.observe("join", time.Since(r.joinAt))
+					r.joinAt = time.Time{}
+				default:
+					continue
+				}
+				r.send("set_ready", map[string]bool{"ready": true})
+			case "ready_state":
+				var p struct {
+					AllReady bool
+					Players  map[string]bool
+				}
+				json.Unmarshal(m.Payload, &p)
+				if r.isHost() && !r.starting && p.AllReady && len(p.Players) >= r.opts.players {
+					r.starting = true
+					r.send("start_race", nil)
+				}
+			case "race_started":
+				racing = true
+				click = time.After(r.nextClick())
+			case "race_ended":
+				racing, click = false, nil
+				if r.isHost() {
+					r.send("rematch", nil)
+				}
+			case "player_update":
+				var p struct{ PlayerID string }
+				json.Unmarshal(m.Payload, &p)
+				if p.PlayerID == r.id && !r.navigateAt.IsZero() {
+					r.stats.observe("navigate", time.Since(r.navigateAt))
+					r.navigateAt = time.Time{}
+				}
+			case "rule_violation":
+				if !r.navigateAt.IsZero() {
+					r.stats.observe("navigate", time.Since(r.navigateAt))
+					r.navigateAt = time.Time{}
+				}
+				r.stats.fail("rule_violation")
+			case "pong":
+				if !r.pingAt.IsZero() {
+					r.stats.observe("ping", time.Since(r.pingAt))
+					r.pingAt = time.Time{}
+				}
+			case "error":
+				var p struct{ Code string }
+				json.Unmarshal(m.Payload, &p)
+				r.stats.fail("error " + p.Code)
+			}
+
+		case <-click:
+			click = time.After(r.nextClick())
+			if !racing || !r.navigateAt.IsZero() {
+				continue
+			}
+			article = articles[r.rng.Intn(len(articles))]
+			r.navigateAt = time.Now()
+			r.send("navigate", map[string]string{"article": article})
+
+		case <-cursor:
+			if racing {
+				r.send("cursor", map[string]interface{}{
+					"x":       r.rng.Float64() * 1200,
+					"y":       r.rng.Float64() * 4000,
+					"article": article,
+				})
+			}
+
+		case <-ping.C:
+			if r.pingAt.IsZero() {
+				r.pingAt = time.Now()
+				r.send("ping", nil)
+			}
+
+		case <-lost.C:
+			r.expire(&r.navigateAt, "navigate")
+			r.expire(&r.pingAt, "ping")
+			r.expire(&r.joinAt, "join")
+		}
+	}
+}
+
+// expire gives up on a request that has waited past the timeout
+func (r *racer) expire(sent *time.Time, name string) {
+	if !sent.IsZero() && time.Since(*sent) > r.opts.timeout {
+		r.stats.fail(name + " timeout")
+		*sent = time.Time{}
+	}
+}
+
+func (r *racer) isHost() bool {
+	return r.id != "" && r.hostID == r.id
+}
+
+// nextClick spreads clicks between half and one and a half times the
+// average, so racers don't move in lockstep
+func (r *racer) nextClick() time.Duration {
+	return r.opts.click/2 + time.Duration(r.rng.Int63n(int64(r.opts.click)+1))
+}
+
+func (r *racer) send(msgType string, payload interface{}) {
+	data, _ := json.Marshal(map[string]interface{}{"type": msgType, "payload": payload})
+	r.conn.SetWriteDeadline(time.Now().Add(r.opts.timeout))
+	if err := r.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		r.stats.fail("write")
+		return
+	}
+	r.stats.sent()
+}
+
+// read splits the server's newline-batched frames into messages until the
+// connection closes
+func (r *racer) read(ctx context.Context, msgs chan<- message) {
+	defer close(msgs)
+	for {
+		_, data, err := r.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		for _, line := range bytes.Split(data, []byte{'\n'}) {
+			var m message
+			if err := json.Unmarshal(line, &m); err != nil {
+				continue
+			}
+			select {
+			case msgs <- m:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
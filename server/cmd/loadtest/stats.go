@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// stats collects latency samples and counters from every racer
+type stats struct {
+	mu       sync.Mutex
+	samples  map[string][]time.Duration
+	failures map[string]int
+
+	conns    atomic.Int64
+	sentN    atomic.Int64
+	recvN    atomic.Int64
+	lastSent int64 // counters at the previous progress line
+	lastRecv int64
+	lastAt   time.Duration
+}
+
+func newStats() *stats {
+	return &stats{
+		samples:  make(map[string][]time.Duration),
+		failures: make(map[string]int),
+	}
+}
+
+func (s *stats) observe(name string, d time.Duration) {
+	s.mu.Lock()
+	s.samples[name] = append(s.samples[name], d)
+	s.mu.Unlock()
+}
+
+func (s *stats) fail(name string) {
+	s.mu.Lock()
+	s.failures[name]++
+	s.mu.Unlock()
+}
+
+func (s *stats) connected(delta int64) { s.conns.Add(delta) }
+func (s *stats) sent()                 { s.sentN.Add(1) }
+func (s *stats) received()             { s.recvN.Add(1) }
+
+// percentiles returns the p50, p90, p99 and max of a sorted copy of
+// samples
+func percentiles(samples []time.Duration) (p50, p90, p99, max time.Duration) {
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	at := func(q float64) time.Duration {
+		return sorted[int(q*float64(len(sorted)-1))]
+	}
+	return at(0.5), at(0.9), at(0.99), sorted[len(sorted)-1]
+}
+
+// progress logs throughput since the previous call and navigate latency
+// so far
+func (s *stats) progress(elapsed time.Duration) {
+	sent, recv := s.sentN.Load(), s.recvN.Load()
+	secs := (elapsed - s.lastAt).Seconds()
+	line := fmt.Sprintf("%s: %d connected, %.0f msg/s sent, %.0f msg/s received",
+		elapsed.Round(time.Second), s.conns.Load(),
+		float64(sent-s.lastSent)/secs, float64(recv-s.lastRecv)/secs)
+	s.lastSent, s.lastRecv, s.lastAt = sent, recv, elapsed
+
+	s.mu.Lock()
+	if nav := s.samples["navigate"]; len(nav) > 0 {
+		p50, _, p99, _ := percentiles(nav)
+		line += fmt.Sprintf(", navigate p50 %s p99 %s", round(p50), round(p99))
+	}
+	s.mu.Unlock()
+	log.Print(line)
+}
+
+// report writes the final latency table and failure counts
+func (s *stats) report(w io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintf(w, "\nRan for %s: %d messages sent, %d received\n\n",
+		elapsed.Round(time.Second), s.sentN.Load(), s.recvN.Load())
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "\tcount\tp50\tp90\tp99\tmax\t")
+	for _, name := range []string{"connect", "join", "navigate", "ping"} {
+		samples := s.samples[name]
+		if len(samples) == 0 {
+			continue
+		}
+		p50, p90, p99, max := percentiles(samples)
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t\n", name, len(samples), round(p50), round(p90), round(p99), round(max))
+	}
+	tw.Flush()
+
+	if len(s.failures) == 0 {
+		return
+	}
+	names := make([]string, 0, len(s.failures))
+	for name := range s.failures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "\nFailures:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s: %d\n", name, s.failures[name])
+	}
+}
+
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
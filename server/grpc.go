@@ -0,0 +1,37 @@
+package main
+
+import (
+	"log"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/config"
+	"github.com/markotsymbaluk/wiki-racing/internal/grpcapi"
+	"github.com/markotsymbaluk/wiki-racing/internal/hub"
+)
+
+// serveGRPC starts the gRPC listener for headless clients. It uses the
+// static TLS certificate when one is configured and plain text otherwise.
+func serveGRPC(port string, s config.TLSConfig, h *hub.Hub) error {
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(grpcapi.MaxMessageSize),
+	}
+	if s.CertFile != "" && s.KeyFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(s.CertFile, s.KeyFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	lis, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer(opts...)
+	grpcapi.Register(srv, h)
+	log.Printf("gRPC server starting on :%s", port)
+	return srv.Serve(lis)
+}
@@ -0,0 +1,141 @@
+package achievement
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/stats"
+	"github.com/markotsymbaluk/wiki-racing/internal/store"
+)
+
+const collection = "achievements"
+
+// Achievement is a milestone a player unlocks once
+type Achievement struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Race is what rules see after a player's race: the result, the articles
+// they visited, and their lifetime profile including this race
+type Race struct {
+	Result   stats.Result
+	Path     []string
+	Lifetime stats.Profile
+}
+
+type rule struct {
+	Achievement
+	check func(Race) bool
+}
+
+// rules are evaluated in order, so unlocks from one race are reported in
+// this order too
+var rules = []rule{
+	{Achievement{"first_finish", "Reached the End", "Finish a race"}, func(r Race) bool {
+		return r.Result.Finished
+	}},
+	{Achievement{"first_win", "Victory", "Win a race against another player"}, func(r Race) bool {
+		return r.Lifetime.Wins >= 1
+	}},
+	{Achievement{"ten_wins", "Champion", "Win 10 races"}, func(r Race) bool {
+		return r.Lifetime.Wins >= 10
+	}},
+	{Achievement{"fifty_races", "Regular", "Play 50 races"}, func(r Race) bool {
+		return r.Lifetime.Races >= 50
+	}},
+	{Achievement{"few_clicks", "Shortcut", "Finish a race in under 5 clicks"}, func(r Race) bool {
+		return r.Result.Finished && r.Result.Clicks < 5
+	}},
+	{Achievement{"speed_run", "Speed Runner", "Finish a race in under a minute"}, func(r Race) bool {
+		return r.Result.Finished && r.Result.Time < time.Minute.Milliseconds()
+	}},
+	{Achievement{"philosopher", "All Roads", "Visit the Philosophy article during a race"}, func(r Race) bool {
+		if r.Result.Language != "en" {
+			return false
+		}
+		for _, article := range r.Path {
+			if strings.EqualFold(strings.ReplaceAll(article, "_", " "), "Philosophy") {
+				return true
+			}
+		}
+		return false
+	}},
+}
+
+// Unlock is an achievement a player has earned
+type Unlock struct {
+	Achievement
+	UnlockedAt time.Time `json:"unlockedAt"`
+	RoomID     string    `json:"roomId,omitempty"` // race that earned it
+}
+
+// earned is the stored form of an unlock, keyed by achievement ID
+type earned struct {
+	At     time.Time `json:"at"`
+	RoomID string    `json:"roomId,omitempty"`
+}
+
+// Service evaluates rules after races and stores each player's unlocks
+type Service struct {
+	store *store.Store
+	mu    sync.Mutex
+}
+
+// NewService creates an achievement service backed by s
+func NewService(s *store.Store) *Service {
+	return &Service{store: s}
+}
+
+// Evaluate checks a finished race against every rule the player hasn't
+// unlocked yet, saving and returning the new unlocks. player is the same
+// key the stats service uses.
+func (s *Service) Evaluate(player string, race Race) ([]Unlock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlocked := make(map[string]earned)
+	if _, err := s.store.Get(collection, player, &unlocked); err != nil {
+		return nil, err
+	}
+
+	var unlocks []Unlock
+	now := time.Now()
+	for _, r := range rules {
+		if _, ok := unlocked[r.ID]; ok || !r.check(race) {
+			continue
+		}
+		unlocked[r.ID] = earned{At: now, RoomID: race.Result.RoomID}
+		unlocks = append(unlocks, Unlock{Achievement: r.Achievement, UnlockedAt: now, RoomID: race.Result.RoomID})
+	}
+	if len(unlocks) == 0 {
+		return nil, nil
+	}
+	if err := s.store.Put(collection, player, unlocked); err != nil {
+		return nil, err
+	}
+	return unlocks, nil
+}
+
+// Unlocked returns a player's achievements, oldest first. Achievements
+// whose rule has since been removed are left out.
+func (s *Service) Unlocked(player string) ([]Unlock, error) {
+	unlocked := make(map[string]earned)
+	if _, err := s.store.Get(collection, player, &unlocked); err != nil {
+		return nil, err
+	}
+
+	list := make([]Unlock, 0, len(unlocked))
+	for _, r := range rules {
+		if e, ok := unlocked[r.ID]; ok {
+			list = append(list, Unlock{Achievement: r.Achievement, UnlockedAt: e.At, RoomID: e.RoomID})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].UnlockedAt.Before(list[j].UnlockedAt)
+	})
+	return list, nil
+}
@@ -0,0 +1,106 @@
+// Package analytics aggregates race paths into community statistics, such
+// as which articles routes pass through most.
+package analytics
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/store"
+)
+
+const (
+	collection = "hot_articles"
+	maxTracked = 5000 // articles counted per edition before rare ones are dropped
+)
+
+// HotArticle is an intermediate article and how many paths went through it
+type HotArticle struct {
+	Article string `json:"article"`
+	Paths   int    `json:"paths"`
+}
+
+// index is the persisted popularity count for one Wikipedia edition
+type index struct {
+	Paths  int            `json:"paths"`  // paths counted
+	Counts map[string]int `json:"counts"` // paths through each article
+}
+
+// Service counts how often articles appear in the middle of race paths
+type Service struct {
+	store *store.Store
+	mu    sync.Mutex
+}
+
+// NewService creates an analytics service backed by s
+func NewService(s *store.Store) *Service {
+	return &Service{store: s}
+}
+
+// Record counts the intermediate articles of a race's paths on one
+// edition. The start and end articles are left out since every path has
+// them, and an article counts once per path however often it was revisited.
+func (s *Service) Record(language, start, end string, paths [][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var idx index
+	if _, err := s.store.Get(collection, language, &idx); err != nil {
+		return err
+	}
+	if idx.Counts == nil {
+		idx.Counts = make(map[string]int)
+	}
+	for _, path := range paths {
+		seen := make(map[string]bool, len(path))
+		for _, article := range path {
+			if article == start || article == end || seen[article] {
+				continue
+			}
+			seen[article] = true
+			idx.Counts[article]++
+		}
+		idx.Paths++
+	}
+	idx.trim()
+	return s.store.Put(collection, language, idx)
+}
+
+// trim forgets the least-counted articles once there are too many
+func (idx *index) trim() {
+	if len(idx.Counts) <= maxTracked {
+		return
+	}
+	ranked := idx.top(len(idx.Counts))
+	for _, a := range ranked[maxTracked:] {
+		delete(idx.Counts, a.Article)
+	}
+}
+
+func (idx index) top(limit int) []HotArticle {
+	articles := make([]HotArticle, 0, len(idx.Counts))
+	for article, n := range idx.Counts {
+		articles = append(articles, HotArticle{Article: article, Paths: n})
+	}
+	sort.Slice(articles, func(i, j int) bool {
+		a, b := articles[i], articles[j]
+		if a.Paths != b.Paths {
+			return a.Paths > b.Paths
+		}
+		return a.Article < b.Article
+	})
+	if len(articles) > limit {
+		articles = articles[:limit]
+	}
+	return articles
+}
+
+// HotArticles returns the limit articles most paths on an edition went
+// through, and how many paths were counted
+func (s *Service) HotArticles(language string, limit int) ([]HotArticle, int, error) {
+	var idx index
+	if _, err := s.store.Get(collection, language, &idx); err != nil {
+		return nil, 0, err
+	}
+	return idx.top(limit), idx.Paths, nil
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/hub"
+	"github.com/markotsymbaluk/wiki-racing/internal/moderation"
+)
+
+type kickRequest struct {
+	ClientID string `json:"clientId"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type broadcastRequest struct {
+	hub.Announcement
+	RoomID string `json:"roomId,omitempty"` // only this room, everyone if empty
+}
+
+type drainRequest struct {
+	URL string `json:"url"` // WebSocket URL of the instance taking over
+}
+
+type banRequest struct {
+	Kind   moderation.Kind `json:"kind"`
+	Value  string          `json:"value"`
+	Reason string          `json:"reason,omitempty"`
+	// DurationSeconds makes the ban temporary; 0 bans permanently
+	DurationSeconds int `json:"durationSeconds,omitempty"`
+}
+
+// adminAuthorized checks the admin bearer token. An empty token disables
+// the admin endpoints, which answer 404 as if they weren't there.
+func (s *Server) adminAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	if s.adminToken == "" {
+		writeError(w, http.StatusNotFound, "not found")
+		return false
+	}
+	if !bearerMatches(r, s.adminToken) {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return false
+	}
+	return true
+}
+
+// handleAdminRooms serves GET on /api/admin/rooms with every room's live
+// state, private rooms included
+func (s *Server) handleAdminRooms(w http.ResponseWriter, r *http.Request) {
+	if !s.adminAuthorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.hub.RoomStatuses())
+}
+
+// handleAdminRoomEvents serves GET on /api/admin/rooms/{id}/events with
+// the room's audit log. ?since=seq returns only newer entries, for polling.
+func (s *Server) handleAdminRoomEvents(w http.ResponseWriter, r *http.Request) {
+	if !s.adminAuthorized(w, r) {
+		return
+	}
+
+	id, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/admin/rooms/"), "/")
+	if id == "" || strings.Trim(rest, "/") != "events" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	since := 0
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "since must be a sequence number")
+			return
+		}
+		since = n
+	}
+	events, err := s.hub.RoomEvents(id, since)
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+// handleAdminClients serves GET on /api/admin/clients with every open
+// connection
+func (s *Server) handleAdminClients(w http.ResponseWriter, r *http.Request) {
+	if !s.adminAuthorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.hub.Clients())
+}
+
+// handleAdminKick serves POST on /api/admin/kick, closing a connection
+func (s *Server) handleAdminKick(w http.ResponseWriter, r *http.Request) {
+	if !s.adminAuthorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req kickRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ClientID == "" {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := s.hub.Kick(req.ClientID, req.Reason); err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminBroadcast serves POST (announce) and DELETE (unpin) on
+// /api/admin/broadcast. Announcements go to everyone or to one room.
+func (s *Server) handleAdminBroadcast(w http.ResponseWriter, r *http.Request) {
+	if !s.adminAuthorized(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var req broadcastRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Message) == "" {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if req.Pinned && req.RoomID != "" {
+			writeError(w, http.StatusBadRequest, "pinned announcements go to everyone")
+			return
+		}
+		if err := s.hub.Announce(req.RoomID, req.Announcement); err != nil {
+			writeError(w, statusFor(err), err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		s.hub.ClearAnnouncement()
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleAdminDrain serves POST on /api/admin/drain, moving every client
+// to another instance ahead of a shutdown
+func (s *Server) handleAdminDrain(w http.ResponseWriter, r *http.Request) {
+	if !s.adminAuthorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req drainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == "" {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	n, err := s.hub.Drain(req.URL)
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"migrated": n})
+}
+
+// handleBans serves GET (list) and POST (ban) on /api/admin/bans
+func (s *Server) handleBans(w http.ResponseWriter, r *http.Request) {
+	if !s.adminAuthorized(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.moderation.List())
+
+	case http.MethodPost:
+		var req banRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.DurationSeconds < 0 {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		ban := moderation.Ban{Kind: req.Kind, Value: req.Value, Reason: req.Reason}
+		if req.DurationSeconds > 0 {
+			expires := time.Now().Add(time.Duration(req.DurationSeconds) * time.Second)
+			ban.ExpiresAt = &expires
+		}
+		ban, err := s.moderation.Ban(ban)
+		if err != nil {
+			writeError(w, statusFor(err), err.Error())
+			return
+		}
+		writeJSON(w, http.StatusCreated, ban)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleBan serves DELETE on /api/admin/bans/{kind}/{value}
+func (s *Server) handleBan(w http.ResponseWriter, r *http.Request) {
+	if !s.adminAuthorized(w, r) {
+		return
+	}
+
+	kind, value, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/admin/bans/"), "/")
+	if !ok || value == "" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if err := s.moderation.Unban(moderation.Kind(kind), value); err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
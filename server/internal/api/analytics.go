@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultHotArticles = 20
+	maxHotArticles     = 200
+)
+
+// handleHotArticles serves GET /api/analytics/hot-articles, the hub pages
+// most race paths on an edition pass through
+func (s *Server) handleHotArticles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	client, ok := s.wikiFor(w, r)
+	if !ok {
+		return
+	}
+	limit := defaultHotArticles
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+	if limit > maxHotArticles {
+		limit = maxHotArticles
+	}
+
+	articles, paths, err := s.hub.HotArticles(client.Lang(), limit)
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"language": client.Lang(),
+		"paths":    paths,
+		"articles": articles,
+	})
+}
@@ -0,0 +1,330 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/auth"
+	"github.com/markotsymbaluk/wiki-racing/internal/edge"
+	"github.com/markotsymbaluk/wiki-racing/internal/hub"
+	"github.com/markotsymbaluk/wiki-racing/internal/moderation"
+	"github.com/markotsymbaluk/wiki-racing/internal/push"
+	"github.com/markotsymbaluk/wiki-racing/internal/rating"
+	"github.com/markotsymbaluk/wiki-racing/internal/social"
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+// Config wires the API server to the rest of the application
+type Config struct {
+	Hub  *hub.Hub
+	Auth *auth.Service
+	Wiki *wiki.Client
+	// Moderation stores server-wide bans managed through the admin API
+	Moderation *moderation.Service
+	// Push stores Web Push subscriptions. Nil turns the push API off.
+	Push *push.Service
+	// Token is required as a bearer token for requests that create,
+	// close or schedule rooms. Empty refuses every one of them.
+	Token string
+	// AdminToken is required as a bearer token for the admin API. Empty
+	// disables the admin API.
+	AdminToken string
+	// Pprof serves runtime profiles under /debug/pprof behind AdminToken
+	Pprof bool
+	// Signer signs race result exports
+	Signer *auth.ResultSigner
+	// OAuthCallbackBase is this server's public address, which OAuth
+	// providers redirect back to
+	OAuthCallbackBase string
+	// ClientURL is the web client players return to after an OAuth login
+	ClientURL string
+	// Edge resolves client addresses behind proxies and limits CORS
+	// origins. Nil trusts no proxies and allows any origin.
+	Edge *edge.Policy
+}
+
+// Server exposes REST endpoints for managing the hub without a WebSocket
+type Server struct {
+	hub   *hub.Hub
+	auth  *auth.Service
+	wiki  *wiki.Client
+	token string
+
+	moderation *moderation.Service
+	push       *push.Service
+	adminToken string
+	pprof      bool
+	signer     *auth.ResultSigner
+	oauthBase  string
+	clientURL  string
+	edge       *edge.Policy
+
+	searchLimiter     *rateLimiter
+	articleLimiter    *rateLimiter
+	difficultyLimiter *rateLimiter
+	overlayLimiter    *rateLimiter
+	overlays          overlayStreams
+}
+
+// New creates an API server
+func New(cfg Config) *Server {
+	return &Server{
+		hub:   cfg.Hub,
+		auth:  cfg.Auth,
+		wiki:  cfg.Wiki,
+		token: cfg.Token,
+
+		moderation: cfg.Moderation,
+		push:       cfg.Push,
+		adminToken: cfg.AdminToken,
+		pprof:      cfg.Pprof,
+		signer:     cfg.Signer,
+		oauthBase:  strings.TrimRight(cfg.OAuthCallbackBase, "/"),
+		clientURL:  strings.TrimRight(cfg.ClientURL, "/"),
+		edge:       cfg.Edge,
+
+		// Autocomplete fires on keystrokes, so allow short bursts
+		searchLimiter:  newRateLimiter(5, 15),
+		articleLimiter: newRateLimiter(10, 30),
+		// Each lookup runs a path search over the whole graph
+		difficultyLimiter: newRateLimiter(2, 5),
+		// Overlays are long-lived, so only connecting is limited
+		overlayLimiter: newRateLimiter(0.2, 5),
+		overlays:       overlayStreams{count: make(map[string]int)},
+	}
+}
+
+// Register mounts the API routes on mux
+func (s *Server) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/api/rooms", s.withCORS(s.handleRooms))
+	mux.HandleFunc("/api/rooms/", s.withCORS(s.handleRoom))
+	mux.HandleFunc("/api/schedule", s.withCORS(s.handleSchedule))
+	mux.HandleFunc("/api/schedule/", s.withCORS(s.handleScheduledRace))
+	mux.HandleFunc("/api/auth/register", s.withCORS(s.handleRegister))
+	mux.HandleFunc("/api/auth/login", s.withCORS(s.handleLogin))
+	mux.HandleFunc("/api/auth/me", s.withCORS(s.handleMe))
+	mux.HandleFunc("/api/auth/providers", s.withCORS(s.handleProviders))
+	mux.HandleFunc("/api/auth/oauth/", s.handleOAuth)
+	mux.HandleFunc("/api/players/", s.withCORS(s.handlePlayerStats))
+	mux.HandleFunc("/api/races/", s.withCORS(s.handleRaceExport))
+	mux.HandleFunc("/api/races/public-key", s.withCORS(s.handlePublicKey))
+	mux.HandleFunc("/api/seed", s.withCORS(s.handleSeed))
+	mux.HandleFunc("/api/seed/", s.withCORS(s.handleDecodeSeed))
+	mux.HandleFunc("/api/search", s.withCORS(s.limit(s.searchLimiter, s.handleSearch)))
+	mux.HandleFunc("/api/article/", s.withCORS(s.limit(s.articleLimiter, s.handleArticle)))
+	mux.HandleFunc("/api/difficulty", s.withCORS(s.limit(s.difficultyLimiter, s.handleDifficulty)))
+	mux.HandleFunc("/api/analytics/hot-articles", s.withCORS(s.handleHotArticles))
+	mux.HandleFunc("/api/leaderboard", s.withCORS(s.handleLeaderboard))
+	mux.HandleFunc("/api/seasons", s.withCORS(s.handleSeasons))
+	mux.HandleFunc("/api/friends", s.withCORS(s.handleFriends))
+	mux.HandleFunc("/api/friends/", s.withCORS(s.handleFriends))
+	mux.HandleFunc("/api/friends/requests", s.withCORS(s.handleFriendRequests))
+	mux.HandleFunc("/api/friends/requests/", s.withCORS(s.handleFriendRequests))
+	mux.HandleFunc("/api/push/key", s.withCORS(s.handlePushKey))
+	mux.HandleFunc("/api/push/subscriptions", s.withCORS(s.handlePushSubscriptions))
+	mux.HandleFunc("/api/admin/rooms", s.withCORS(s.handleAdminRooms))
+	mux.HandleFunc("/api/admin/rooms/", s.withCORS(s.handleAdminRoomEvents))
+	mux.HandleFunc("/api/admin/clients", s.withCORS(s.handleAdminClients))
+	mux.HandleFunc("/api/admin/kick", s.withCORS(s.handleAdminKick))
+	mux.HandleFunc("/api/admin/broadcast", s.withCORS(s.handleAdminBroadcast))
+	mux.HandleFunc("/api/admin/drain", s.withCORS(s.handleAdminDrain))
+	mux.HandleFunc("/api/admin/bans", s.withCORS(s.handleBans))
+	mux.HandleFunc("/api/admin/bans/", s.withCORS(s.handleBan))
+	mux.HandleFunc("/api/admin/events", s.withCORS(s.handleAdminEvents))
+	mux.HandleFunc("/api/admin/events/", s.withCORS(s.handleAdminEvent))
+	if s.pprof {
+		s.registerPprof(mux)
+	}
+}
+
+// handleRooms serves GET (list) and POST (create) on /api/rooms
+func (s *Server) handleRooms(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.hub.PublicRooms())
+
+	case http.MethodPost:
+		if !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		var opts hub.RoomOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		room, err := s.hub.CreateRoom(opts)
+		if err != nil {
+			writeError(w, statusFor(err), err.Error())
+			return
+		}
+		writeJSON(w, http.StatusCreated, room)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleRoom serves GET and DELETE on /api/rooms/{id}, invites on
+// /api/rooms/{id}/invite and the stream overlay on /api/rooms/{id}/overlay
+func (s *Server) handleRoom(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/rooms/"), "/")
+	if roomID, ok := strings.CutSuffix(id, "/invite"); ok && roomID != "" && !strings.Contains(roomID, "/") {
+		s.handleInvite(w, r, roomID)
+		return
+	}
+	if roomID, ok := strings.CutSuffix(id, "/overlay"); ok && roomID != "" && !strings.Contains(roomID, "/") {
+		s.limit(s.overlayLimiter, func(w http.ResponseWriter, r *http.Request) {
+			s.handleOverlay(w, r, roomID)
+		})(w, r)
+		return
+	}
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		room, err := s.hub.Room(id)
+		if err != nil {
+			writeError(w, statusFor(err), err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, room)
+
+	case http.MethodDelete:
+		if !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		if err := s.hub.CloseRoom(id); err != nil {
+			writeError(w, statusFor(err), err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// wikiFor picks the Wikipedia edition from the lang query parameter,
+// English when absent. Unsupported codes are rejected with a 400.
+func (s *Server) wikiFor(w http.ResponseWriter, r *http.Request) (*wiki.Client, bool) {
+	lang := r.URL.Query().Get("lang")
+	if lang != "" && !wiki.SupportedLanguage(lang) {
+		writeError(w, http.StatusBadRequest, hub.ErrInvalidLanguage.Error())
+		return nil, false
+	}
+	return s.wiki.Language(lang), true
+}
+
+// authorized checks the room API's bearer token. Without a token
+// configured nothing is authorized, so a missing setting can't leave room
+// management open.
+func (s *Server) authorized(r *http.Request) bool {
+	return bearerMatches(r, s.token)
+}
+
+// bearerMatches reports whether the request carries token as its bearer
+// token, comparing in constant time. An empty token never matches.
+func bearerMatches(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	got := r.Header.Get("Authorization")
+	return subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+token)) == 1
+}
+
+// statusFor maps hub errors to HTTP status codes
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, hub.ErrRoomNotFound),
+		errors.Is(err, hub.ErrClientNotFound),
+		errors.Is(err, hub.ErrNoEventLog),
+		errors.Is(err, hub.ErrRaceNotFound),
+		errors.Is(err, hub.ErrScheduleNotFound),
+		errors.Is(err, hub.ErrEventNotFound),
+		errors.Is(err, rating.ErrSeasonNotFound),
+		errors.Is(err, auth.ErrAccountNotFound),
+		errors.Is(err, social.ErrNoRequest),
+		errors.Is(err, social.ErrNotFriends),
+		errors.Is(err, push.ErrNotSubscribed),
+		errors.Is(err, moderation.ErrBanNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, hub.ErrRoomExists),
+		errors.Is(err, hub.ErrScheduleClosed):
+		return http.StatusConflict
+	case errors.Is(err, hub.ErrRoomLimit),
+		errors.Is(err, hub.ErrDraining),
+		errors.Is(err, wiki.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, hub.ErrInvalidMode),
+		errors.Is(err, hub.ErrInvalidLanguage),
+		errors.Is(err, hub.ErrInvalidArticle),
+		errors.Is(err, hub.ErrInvalidSeed),
+		errors.Is(err, hub.ErrInvalidPassword),
+		errors.Is(err, hub.ErrInvalidInvite),
+		errors.Is(err, hub.ErrInvalidSeverity),
+		errors.Is(err, hub.ErrInvalidTarget),
+		errors.Is(err, hub.ErrInvalidTheme),
+		errors.Is(err, hub.ErrInvalidSchedule),
+		errors.Is(err, moderation.ErrInvalidBan),
+		errors.Is(err, auth.ErrInvalidUsername),
+		errors.Is(err, auth.ErrWeakPassword),
+		errors.Is(err, social.ErrSelf),
+		errors.Is(err, push.ErrInvalidSubscription):
+		return http.StatusBadRequest
+	case errors.Is(err, auth.ErrUsernameTaken),
+		errors.Is(err, auth.ErrIdentityLinked),
+		errors.Is(err, social.ErrAlreadyFriends),
+		errors.Is(err, social.ErrListFull):
+		return http.StatusConflict
+	case errors.Is(err, hub.ErrWrongPassword):
+		return http.StatusForbidden
+	case errors.Is(err, auth.ErrInvalidCredentials),
+		errors.Is(err, auth.ErrInvalidToken):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// withCORS allows browser lobbies on the configured origins to call the
+// API
+func (s *Server) withCORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := s.edge.CORSOrigin(r)
+		if origin != "*" {
+			w.Header().Add("Vary", "Origin")
+		}
+		if origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+auth.GuestHeader)
+		w.Header().Set("Access-Control-Expose-Headers", signatureHeader)
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
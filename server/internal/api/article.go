@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+// handleArticle serves sanitized article HTML so the client renders every
+// page through the game server
+func (s *Server) handleArticle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	// Use the raw path so titles containing an encoded slash ("AC%2FDC")
+	// stay one segment
+	title, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/api/article/"))
+	if err != nil || strings.TrimSpace(title) == "" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	client, ok := s.wikiFor(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	page, err := client.ArticleHTML(ctx, title)
+	if errors.Is(err, wiki.ErrMissingArticle) {
+		writeError(w, http.StatusNotFound, "article not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Article fetch for %q failed: %v", title, err)
+		writeError(w, http.StatusBadGateway, "article unavailable")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, http.StatusOK, page)
+}
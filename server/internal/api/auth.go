@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/auth"
+)
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type sessionResponse struct {
+	Token   string      `json:"token"`
+	Account accountView `json:"account"`
+}
+
+// accountView is the public part of an account
+type accountView struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func viewAccount(a auth.Account) accountView {
+	return accountView{ID: a.ID, Username: a.Username, CreatedAt: a.CreatedAt}
+}
+
+// handleRegister creates an account and starts a session
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var c credentials
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	account, err := s.auth.Register(c.Username, c.Password)
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	s.startSession(w, http.StatusCreated, account)
+}
+
+// handleLogin starts a session for an existing account
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var c credentials
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	account, err := s.auth.Login(c.Username, c.Password)
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	s.startSession(w, http.StatusOK, account)
+}
+
+// handleMe returns the account behind the current session
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	account, err := s.currentAccount(r)
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, viewAccount(account))
+}
+
+// currentAccount resolves the session token on a request
+func (s *Server) currentAccount(r *http.Request) (auth.Account, error) {
+	claims, err := s.auth.Verify(auth.TokenFromRequest(r))
+	if err != nil {
+		return auth.Account{}, err
+	}
+	return s.auth.Account(claims.Subject)
+}
+
+// startSession returns a token and also sets it as a cookie for browsers
+func (s *Server) startSession(w http.ResponseWriter, status int, account auth.Account) {
+	token := s.auth.IssueToken(account)
+	s.setSessionCookie(w, token)
+	writeJSON(w, status, sessionResponse{Token: token, Account: viewAccount(account)})
+}
+
+func (s *Server) setSessionCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.SessionCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int((30 * 24 * time.Hour).Seconds()),
+	})
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/graph"
+	"github.com/markotsymbaluk/wiki-racing/internal/hub"
+)
+
+// handleDifficulty scores a start/end pair from the link graph, or with
+// only a tier given, picks a random pair in that tier
+func (s *Server) handleDifficulty(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	client, ok := s.wikiFor(w, r)
+	if !ok {
+		return
+	}
+	lang := client.Lang()
+
+	q := r.URL.Query()
+	start := strings.TrimSpace(q.Get("start"))
+	end := strings.TrimSpace(q.Get("end"))
+
+	var d graph.Difficulty
+	var err error
+	switch {
+	case start != "" && end != "":
+		d, err = s.hub.Difficulty(lang, start, end)
+	case start == "" && end == "" && q.Get("tier") != "":
+		var tier graph.Tier
+		if tier, err = graph.ParseTier(q.Get("tier")); err == nil {
+			d, err = s.hub.RandomPair(lang, tier)
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "pass start and end, or a tier")
+		return
+	}
+
+	switch {
+	case errors.Is(err, hub.ErrNoGraph):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, graph.ErrInvalidTier):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, graph.ErrUnknownArticle), errors.Is(err, graph.ErrNoPath):
+		writeError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, d)
+	}
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/hub"
+)
+
+// signatureHeader carries the Ed25519 signature of an export's exact body,
+// checked against the key from /api/races/public-key
+const signatureHeader = "X-Race-Signature"
+
+// handleRaceExport serves GET /api/races/{id}/export?format=csv|json, a
+// race's results as a download for organizers keeping their own records.
+// JSON is the default. The body is signed, see signatureHeader.
+func (s *Server) handleRaceExport(w http.ResponseWriter, r *http.Request) {
+	id, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/races/"), "/")
+	if id == "" || strings.Trim(rest, "/") != "export" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		writeError(w, http.StatusBadRequest, "format must be csv or json")
+		return
+	}
+
+	record, err := s.hub.Race(id)
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+
+	var body bytes.Buffer
+	contentType := "application/json"
+	if format == "json" {
+		json.NewEncoder(&body).Encode(record)
+	} else {
+		contentType = "text/csv; charset=utf-8"
+		writeRaceCSV(&body, record)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="race-%s.%s"`, record.ID, format))
+	if s.signer != nil {
+		w.Header().Set(signatureHeader, s.signer.Sign(body.Bytes()))
+	}
+	w.Write(body.Bytes())
+}
+
+// handlePublicKey serves GET /api/races/public-key, the key that export
+// signatures verify against
+func (s *Server) handlePublicKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.signer == nil {
+		writeError(w, http.StatusNotFound, "exports aren't signed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"algorithm": "ed25519",
+		"publicKey": s.signer.PublicKey(),
+		"header":    signatureHeader,
+	})
+}
+
+// writeRaceCSV writes one row per player. Paths are joined with " > ",
+// which can't appear in an article title.
+func writeRaceCSV(w io.Writer, record hub.RaceRecord) {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"race_id", "room_id", "mode", "language", "start_article", "end_article", "ended_at",
+		"rank", "player", "account_id", "finished", "dnf", "time_ms", "clicks", "score", "path",
+	})
+	for _, res := range record.Results {
+		rank := ""
+		if res.Rank > 0 {
+			rank = strconv.Itoa(res.Rank)
+		}
+		cw.Write([]string{
+			record.ID, record.RoomID, string(record.Mode), record.Language,
+			record.StartArticle, record.EndArticle, record.EndedAt.UTC().Format(time.RFC3339),
+			rank, res.PlayerName, res.AccountID,
+			strconv.FormatBool(res.Finished), strconv.FormatBool(res.DNF),
+			strconv.FormatInt(res.Time, 10), strconv.Itoa(res.Clicks), strconv.FormatInt(res.Score, 10),
+			strings.Join(res.Path, " > "),
+		})
+	}
+	cw.Flush()
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// handleFriends serves the signed-in player's friend list:
+//
+//	GET    /api/friends       friends with presence, and pending requests
+//	DELETE /api/friends/{id}  unfriend, or withdraw a request
+func (s *Server) handleFriends(w http.ResponseWriter, r *http.Request) {
+	account, err := s.currentAccount(r)
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/friends"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		list, err := s.hub.Friends(account.ID)
+		if err != nil {
+			writeError(w, statusFor(err), err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	case id != "" && !strings.Contains(id, "/") && r.Method == http.MethodDelete:
+		if err := s.hub.RemoveFriend(account.ID, id); err != nil {
+			writeError(w, statusFor(err), err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case id == "" || strings.Contains(id, "/"):
+		writeError(w, http.StatusNotFound, "not found")
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleFriendRequests manages friend requests:
+//
+//	POST /api/friends/requests                {"username": ...} sends one
+//	POST /api/friends/requests/{id}/accept    accepts one
+//	POST /api/friends/requests/{id}/decline   declines one
+func (s *Server) handleFriendRequests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	account, err := s.currentAccount(r)
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/friends/requests"), "/")
+	if rest == "" {
+		var req struct {
+			Username string `json:"username"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+			writeError(w, http.StatusBadRequest, "username is required")
+			return
+		}
+		target, err := s.auth.AccountByName(req.Username)
+		if err != nil {
+			writeError(w, statusFor(err), err.Error())
+			return
+		}
+		if err := s.hub.RequestFriend(account.ID, target.ID); err != nil {
+			writeError(w, statusFor(err), err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	from, action, _ := strings.Cut(rest, "/")
+	if action != "accept" && action != "decline" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if err := s.hub.AnswerFriend(account.ID, from, action == "accept"); err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type inviteRequest struct {
+	Password   string `json:"password,omitempty"`   // needed for locked rooms without the API token
+	TTLSeconds int    `json:"ttlSeconds,omitempty"` // a day if 0, at most a week
+}
+
+// handleInvite serves POST on /api/rooms/{id}/invite. Anyone who knows a
+// room's password can invite others to it; callers presenting the API
+// token don't need the password.
+func (s *Server) handleInvite(w http.ResponseWriter, r *http.Request, roomID string) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req inviteRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+
+	invite, err := s.hub.CreateInvite(roomID, req.Password, time.Duration(req.TTLSeconds)*time.Second, s.authorized(r))
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, invite)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/rating"
+)
+
+const (
+	defaultLeaderboard = 50
+	maxLeaderboard     = 500
+)
+
+// handleLeaderboard serves GET /api/leaderboard, the top rated players of
+// the running season, or of an ended one with ?season={id}
+func (s *Server) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	limit := defaultLeaderboard
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+	if limit > maxLeaderboard {
+		limit = maxLeaderboard
+	}
+
+	if id := r.URL.Query().Get("season"); id != "" {
+		archive, err := s.hub.SeasonLeaderboard(id, limit)
+		if err != nil {
+			writeError(w, statusFor(err), err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, archive)
+		return
+	}
+	_, current := s.hub.Seasons()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"season":  current,
+		"entries": s.hub.Leaderboard(limit),
+	})
+}
+
+// handleSeasons serves GET /api/seasons, every configured season and the
+// one running now
+func (s *Server) handleSeasons(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	seasons, current := s.hub.Seasons()
+	if seasons == nil {
+		seasons = []rating.Season{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"seasons": seasons,
+		"current": current,
+	})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/auth"
+)
+
+// handleProviders lists the OAuth providers players can log in with
+func (s *Server) handleProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"providers": s.auth.Providers()})
+}
+
+// handleOAuth serves /api/auth/oauth/{provider}, which sends the browser
+// to the provider, and /api/auth/oauth/{provider}/callback, where it comes
+// back. Signed-in players who start a login link the new identity to
+// their account instead of getting a new one.
+func (s *Server) handleOAuth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	name, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/auth/oauth/"), "/")
+	switch rest {
+	case "":
+		s.startOAuth(w, r, name)
+	case "callback":
+		s.finishOAuth(w, r, name)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) startOAuth(w http.ResponseWriter, r *http.Request, name string) {
+	st := auth.OAuthState{Provider: name, Redirect: safeRedirect(r.URL.Query().Get("redirect"))}
+	if account, err := s.currentAccount(r); err == nil {
+		st.LinkAccount = account.ID
+	}
+
+	target, cookie, err := s.auth.StartOAuth(st, s.oauthCallback(name))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	http.SetCookie(w, cookie)
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func (s *Server) finishOAuth(w http.ResponseWriter, r *http.Request, name string) {
+	q := r.URL.Query()
+	st, err := s.auth.CheckOAuthState(q.Get("state"), r)
+	if err != nil || st.Provider != name {
+		s.oauthFailed(w, r, auth.ErrOAuthState)
+		return
+	}
+	if q.Get("code") == "" {
+		// The player cancelled on the provider's consent screen
+		s.oauthFailed(w, r, auth.ErrOAuthFailed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+	account, err := s.auth.FinishOAuth(ctx, st, q.Get("code"), s.oauthCallback(name))
+	if err != nil {
+		s.oauthFailed(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: auth.OAuthCookie, Path: "/", MaxAge: -1})
+	s.setSessionCookie(w, s.auth.IssueToken(account))
+	http.Redirect(w, r, s.clientURL+st.Redirect, http.StatusFound)
+}
+
+// oauthFailed sends the player back to the client's login page with the
+// reason, since a JSON error would strand them on a blank page
+func (s *Server) oauthFailed(w http.ResponseWriter, r *http.Request, err error) {
+	msg := err.Error()
+	if !errors.Is(err, auth.ErrOAuthState) && !errors.Is(err, auth.ErrOAuthFailed) &&
+		!errors.Is(err, auth.ErrIdentityLinked) && !errors.Is(err, auth.ErrUsernameTaken) {
+		log.Printf("OAuth login failed: %v", err)
+		msg = "login failed, try again"
+	}
+	http.Redirect(w, r, s.clientURL+"/auth?error="+url.QueryEscape(msg), http.StatusFound)
+}
+
+func (s *Server) oauthCallback(name string) string {
+	return s.oauthBase + "/api/auth/oauth/" + url.PathEscape(name) + "/callback"
+}
+
+// safeRedirect keeps post-login redirects on the client's own paths
+func safeRedirect(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.Contains(path, "\\") {
+		return "/profile"
+	}
+	return path
+}
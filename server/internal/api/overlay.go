@@ -0,0 +1,111 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/hub"
+)
+
+const (
+	// overlayInterval is how often an overlay stream checks for changes
+	overlayInterval = time.Second
+	// overlayKeepAlive is how often an idle stream sends a comment, so
+	// proxies don't time it out
+	overlayKeepAlive = 15 * time.Second
+	// maxOverlayStreams caps concurrent overlay streams per address
+	maxOverlayStreams = 4
+)
+
+// overlayStreams counts open overlay streams per client address
+type overlayStreams struct {
+	mu    sync.Mutex
+	count map[string]int
+}
+
+// acquire takes a stream slot for ip, reporting false when it has none left
+func (o *overlayStreams) acquire(ip string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.count[ip] >= maxOverlayStreams {
+		return false
+	}
+	o.count[ip]++
+	return true
+}
+
+func (o *overlayStreams) release(ip string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.count[ip]--; o.count[ip] <= 0 {
+		delete(o.count, ip)
+	}
+}
+
+// handleOverlay serves GET on /api/rooms/{id}/overlay: a Server-Sent
+// Events stream of the room's overlay for OBS browser sources. It needs no
+// account, only ?password= for locked rooms. Each change is sent as an
+// "overlay" event, and a "closed" event ends the stream when the room
+// goes away.
+func (s *Server) handleOverlay(w http.ResponseWriter, r *http.Request, roomID string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	if err := s.hub.CheckRoomPassword(roomID, r.URL.Query().Get("password")); err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	ip := s.edge.ClientIP(r)
+	if !s.overlays.acquire(ip) {
+		writeError(w, http.StatusTooManyRequests, "too many overlay streams")
+		return
+	}
+	defer s.overlays.release(ip)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // unbuffered behind nginx
+	w.WriteHeader(http.StatusOK)
+	// Browser sources reconnect on their own; ask them not to hammer
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(overlayInterval)
+	defer ticker.Stop()
+	var last []byte
+	lastSent := time.Now()
+	for {
+		overlay, err := s.hub.Overlay(roomID)
+		if errors.Is(err, hub.ErrRoomNotFound) {
+			fmt.Fprint(w, "event: closed\ndata: {}\n\n")
+			flusher.Flush()
+			return
+		}
+		if data, _ := json.Marshal(overlay); !bytes.Equal(data, last) {
+			fmt.Fprintf(w, "event: overlay\ndata: %s\n\n", data)
+			flusher.Flush()
+			last, lastSent = data, time.Now()
+		} else if time.Since(lastSent) >= overlayKeepAlive {
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+			lastSent = time.Now()
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
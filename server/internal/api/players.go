@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/achievement"
+	"github.com/markotsymbaluk/wiki-racing/internal/hub"
+	"github.com/markotsymbaluk/wiki-racing/internal/rating"
+	"github.com/markotsymbaluk/wiki-racing/internal/stats"
+)
+
+// playerStats is a player's profile with their rating and the achievements
+// they've unlocked
+type playerStats struct {
+	stats.Profile
+	Rating       rating.Summary       `json:"rating"`
+	Achievements []achievement.Unlock `json:"achievements"`
+}
+
+// handlePlayerStats serves GET /api/players/{id}/stats, where id is an
+// account ID, a guest's "guest:" profile ID from room_state, or "me" for
+// the signed-in player or guest
+func (s *Server) handlePlayerStats(w http.ResponseWriter, r *http.Request) {
+	id, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/players/"), "/")
+	if id == "" || strings.Trim(rest, "/") != "stats" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if id == "me" {
+		if account, err := s.currentAccount(r); err == nil {
+			id = account.ID
+		} else if guestID, ok := s.auth.GuestID(r); ok {
+			id = hub.GuestProfilePrefix + guestID
+		} else {
+			writeError(w, statusFor(err), err.Error())
+			return
+		}
+	}
+	if guestID, ok := strings.CutPrefix(id, hub.GuestProfilePrefix); ok {
+		s.writeGuestStats(w, guestID)
+		return
+	}
+	account, err := s.auth.Account(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "player not found")
+		return
+	}
+
+	profile, ok := s.hub.PlayerStats(account.ID)
+	if !ok {
+		profile = emptyProfile()
+	}
+	// Stats keep the name from the last race; the account's is current
+	profile.Name = account.Username
+
+	unlocks, err := s.hub.PlayerAchievements(account.ID)
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, playerStats{
+		Profile:      profile,
+		Rating:       s.hub.AccountRating(account.ID),
+		Achievements: unlocks,
+	})
+}
+
+// writeGuestStats serves a guest's profile. Guests only exist once they
+// have raced, so one without stats is not found.
+func (s *Server) writeGuestStats(w http.ResponseWriter, guestID string) {
+	profile, ok := s.hub.GuestStats(guestID)
+	if !ok {
+		writeError(w, http.StatusNotFound, "player not found")
+		return
+	}
+	unlocks, err := s.hub.GuestAchievements(guestID)
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, playerStats{
+		Profile:      profile,
+		Rating:       s.hub.GuestRating(guestID),
+		Achievements: unlocks,
+	})
+}
+
+func emptyProfile() stats.Profile {
+	return stats.Profile{
+		Fastest:        []stats.Result{},
+		FavoriteStarts: []stats.StartCount{},
+		Recent:         []stats.Result{},
+	}
+}
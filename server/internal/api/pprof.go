@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// registerPprof mounts the runtime profiles behind the admin token, e.g.
+//
+//	curl -H "Authorization: Bearer $ADMIN_TOKEN" \
+//		'https://host/debug/pprof/profile?seconds=30' > cpu.pprof
+//	go tool pprof -http=: cpu.pprof
+//
+// Profiles reveal internals and cost CPU, so they stay off unless enabled.
+func (s *Server) registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", s.adminOnly(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", s.adminOnly(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", s.adminOnly(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", s.adminOnly(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", s.adminOnly(pprof.Trace))
+}
+
+// adminOnly wraps a handler that has no admin check of its own
+func (s *Server) adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.adminAuthorized(w, r) {
+			next(w, r)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/push"
+)
+
+// handlePushKey returns the VAPID public key browsers subscribe with
+func (s *Server) handlePushKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.push == nil {
+		writeError(w, http.StatusNotFound, "push notifications are off")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"publicKey": s.push.PublicKey()})
+}
+
+// handlePushSubscriptions manages the signed-in player's browsers:
+//
+//	POST   /api/push/subscriptions  a PushSubscription's JSON, subscribes it
+//	DELETE /api/push/subscriptions  {"endpoint": ...}, unsubscribes it
+func (s *Server) handlePushSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.push == nil {
+		writeError(w, http.StatusNotFound, "push notifications are off")
+		return
+	}
+	account, err := s.currentAccount(r)
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+
+	var sub push.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil || sub.Endpoint == "" {
+		writeError(w, http.StatusBadRequest, "endpoint is required")
+		return
+	}
+	if r.Method == http.MethodPost {
+		err = s.push.Subscribe(account.ID, sub)
+	} else {
+		err = s.push.Unsubscribe(account.ID, sub.Endpoint)
+	}
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a per-IP token bucket
+type rateLimiter struct {
+	rate    float64 // tokens added per second
+	burst   float64
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate, burst float64) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: burst, buckets: make(map[string]*bucket)}
+}
+
+// allow takes a token for key, reporting false when the bucket is empty
+func (l *rateLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		// Forget idle clients so the map doesn't grow without bound
+		if len(l.buckets) > 10000 {
+			l.buckets = make(map[string]*bucket)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// limit rejects requests from clients over l's rate with 429. Clients
+// behind a trusted proxy are told apart by their forwarded address.
+func (s *Server) limit(l *rateLimiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !l.allow(s.edge.ClientIP(r)) {
+			writeError(w, http.StatusTooManyRequests, "rate limited")
+			return
+		}
+		next(w, r)
+	}
+}
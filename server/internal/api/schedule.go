@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/hub"
+)
+
+// handleSchedule serves GET (list) and POST (schedule) on /api/schedule
+func (s *Server) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		races, err := s.hub.ScheduledRaces()
+		if err != nil {
+			writeError(w, statusFor(err), err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, races)
+
+	case http.MethodPost:
+		if !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		var opts hub.ScheduleOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		race, err := s.hub.ScheduleRace(opts)
+		if err != nil {
+			writeError(w, statusFor(err), err.Error())
+			return
+		}
+		writeJSON(w, http.StatusCreated, race)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleScheduledRace serves GET and DELETE (cancel) on
+// /api/schedule/{id}, and POST (register) and DELETE (unregister) on
+// /api/schedule/{id}/register for the signed-in player
+func (s *Server) handleScheduledRace(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/schedule/"), "/")
+	if raceID, ok := strings.CutSuffix(id, "/register"); ok && raceID != "" && !strings.Contains(raceID, "/") {
+		s.handleRaceRegistration(w, r, raceID)
+		return
+	}
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		race, err := s.hub.ScheduledRace(id)
+		if err != nil {
+			writeError(w, statusFor(err), err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, race)
+
+	case http.MethodDelete:
+		if !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		if err := s.hub.CancelScheduledRace(id); err != nil {
+			writeError(w, statusFor(err), err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) handleRaceRegistration(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	account, err := s.currentAccount(r)
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	race, err := s.hub.RegisterForRace(id, account.ID, r.Method == http.MethodPost)
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, race)
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSearchLimit = 8
+	maxSearchLimit     = 20
+)
+
+// handleSearch proxies article autocomplete to Wikipedia so browsers don't
+// have to call it directly
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	client, ok := s.wikiFor(w, r)
+	if !ok {
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeJSON(w, http.StatusOK, []string{})
+		return
+	}
+
+	limit := defaultSearchLimit
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	titles, err := client.Search(ctx, q, limit)
+	if err != nil {
+		log.Printf("Search for %q failed: %v", q, err)
+		writeError(w, http.StatusBadGateway, "search unavailable")
+		return
+	}
+	writeJSON(w, http.StatusOK, titles)
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/hub"
+)
+
+// handleSeed serves POST on /api/seed, turning a race into a shareable
+// code:
+//
+//	{"startArticle": "Cat", "endArticle": "Kevin Bacon", "config": {"noBackButton": true}}
+func (s *Server) handleSeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var seed hub.Seed
+	if err := json.NewDecoder(r.Body).Decode(&seed); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	code, err := hub.NewSeed(seed)
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"code": code})
+}
+
+// handleDecodeSeed serves GET on /api/seed/{code}, showing the race a
+// code starts before anyone joins with it
+func (s *Server) handleDecodeSeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	code := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/seed/"), "/")
+	seed, err := hub.DecodeSeed(code)
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, seed)
+}
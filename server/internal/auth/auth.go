@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/store"
+)
+
+const (
+	// SessionCookie carries the session token for browser clients
+	SessionCookie = "wr_session"
+	tokenTTL      = 30 * 24 * time.Hour
+	minPassword   = 8
+
+	accountsCollection  = "accounts"
+	usernamesCollection = "usernames"
+)
+
+// Errors returned by the auth service
+var (
+	ErrInvalidUsername    = errors.New("username must be 3-20 letters, digits, '_' or '-'")
+	ErrWeakPassword       = errors.New("password must be at least 8 characters")
+	ErrUsernameTaken      = errors.New("username already taken")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrAccountNotFound    = errors.New("no player with that username")
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,20}$`)
+
+// Account is a registered player
+type Account struct {
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash []byte    `json:"passwordHash,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Claims are the verified contents of a session token
+type Claims struct {
+	Subject  string `json:"sub"`
+	Username string `json:"name"`
+	Expires  int64  `json:"exp"`
+}
+
+// Service registers accounts and issues HS256 JWT session tokens
+type Service struct {
+	store     *store.Store
+	secret    []byte
+	providers map[string]provider // enabled OAuth providers by name
+	mu        sync.Mutex          // serializes registrations so usernames stay unique
+}
+
+// NewService creates an auth service. If secret is empty a random one is
+// generated, so tokens will not survive a restart.
+func NewService(s *store.Store, secret string) *Service {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		rand.Read(key)
+		log.Println("AUTH_SECRET not set, sessions will be invalidated on restart")
+	}
+	return &Service{store: s, secret: key}
+}
+
+// Register creates a new account
+func (s *Service) Register(username, password string) (Account, error) {
+	if !usernamePattern.MatchString(username) {
+		return Account{}, ErrInvalidUsername
+	}
+	if len(password) < minPassword {
+		return Account{}, ErrWeakPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return Account{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var existing string
+	if found, err := s.store.Get(usernamesCollection, strings.ToLower(username), &existing); err != nil {
+		return Account{}, err
+	} else if found {
+		return Account{}, ErrUsernameTaken
+	}
+
+	account := Account{
+		ID:           uuid.New().String(),
+		Username:     username,
+		PasswordHash: hash,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.store.Put(accountsCollection, account.ID, account); err != nil {
+		return Account{}, err
+	}
+	if err := s.store.Put(usernamesCollection, strings.ToLower(username), account.ID); err != nil {
+		return Account{}, err
+	}
+	return account, nil
+}
+
+// Login checks a username and password
+func (s *Service) Login(username, password string) (Account, error) {
+	var id string
+	found, err := s.store.Get(usernamesCollection, strings.ToLower(username), &id)
+	if err != nil {
+		return Account{}, err
+	}
+	if !found {
+		return Account{}, ErrInvalidCredentials
+	}
+
+	account, err := s.Account(id)
+	if err != nil {
+		return Account{}, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword(account.PasswordHash, []byte(password)) != nil {
+		return Account{}, ErrInvalidCredentials
+	}
+	return account, nil
+}
+
+// Account loads an account by ID
+func (s *Service) Account(id string) (Account, error) {
+	var account Account
+	found, err := s.store.Get(accountsCollection, id, &account)
+	if err != nil {
+		return Account{}, err
+	}
+	if !found {
+		return Account{}, ErrInvalidToken
+	}
+	return account, nil
+}
+
+// AccountByName loads an account by username, ignoring case
+func (s *Service) AccountByName(username string) (Account, error) {
+	var id string
+	found, err := s.store.Get(usernamesCollection, strings.ToLower(username), &id)
+	if err != nil {
+		return Account{}, err
+	}
+	if !found {
+		return Account{}, ErrAccountNotFound
+	}
+	return s.Account(id)
+}
+
+// IssueToken creates a signed session token for an account
+func (s *Service) IssueToken(account Account) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(Claims{
+		Subject:  account.ID,
+		Username: account.Username,
+		Expires:  time.Now().Add(tokenTTL).Unix(),
+	})
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return unsigned + "." + s.sign(unsigned)
+}
+
+// Verify checks a token's signature and expiry
+func (s *Service) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(s.sign(parts[0]+"."+parts[1])), []byte(parts[2])) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	if time.Now().Unix() > claims.Expires {
+		return Claims{}, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (s *Service) sign(data string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// CookieAuthenticated reports whether a request carries the session or
+// guest cookie, which may identify it whatever else it sends
+func CookieAuthenticated(r *http.Request) bool {
+	for _, name := range []string{SessionCookie, GuestCookie} {
+		if _, err := r.Cookie(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenFromRequest extracts a session token from the Authorization header,
+// the session cookie, or a "token" query parameter (for WebSocket upgrades,
+// where browsers cannot set headers)
+func TokenFromRequest(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+	if c, err := r.Cookie(SessionCookie); err == nil {
+		return c.Value
+	}
+	return r.URL.Query().Get("token")
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// GuestCookie carries the signed guest ID for players without accounts
+	GuestCookie = "wr_guest"
+	// GuestHeader carries the same identity for clients that keep it
+	// themselves, e.g. where third-party cookies are blocked
+	GuestHeader = "X-Guest-Identity"
+	guestTTL    = 365 * 24 * time.Hour
+)
+
+// GuestIdentity returns the token that proves a guest ID, the value of
+// the guest cookie
+func (s *Service) GuestIdentity(id string) string {
+	return id + "." + s.sign("guest:"+id)
+}
+
+// VerifyGuest returns the guest ID a token made by GuestIdentity proves
+func (s *Service) VerifyGuest(token string) (string, bool) {
+	id, sig, ok := strings.Cut(token, ".")
+	if !ok || id == "" || !hmac.Equal([]byte(s.sign("guest:"+id)), []byte(sig)) {
+		return "", false
+	}
+	return id, true
+}
+
+// GuestID returns the verified guest ID on a request, if any. An identity
+// the client sends itself, in the X-Guest-Identity header or an
+// "identity" query parameter (for WebSocket upgrades), wins over the
+// cookie.
+func (s *Service) GuestID(r *http.Request) (string, bool) {
+	token := r.Header.Get(GuestHeader)
+	if token == "" {
+		token = r.URL.Query().Get("identity")
+	}
+	if token == "" {
+		c, err := r.Cookie(GuestCookie)
+		if err != nil {
+			return "", false
+		}
+		token = c.Value
+	}
+	return s.VerifyGuest(token)
+}
+
+// NewGuest creates a guest ID and the cookie that carries it
+func (s *Service) NewGuest() (string, *http.Cookie) {
+	id := uuid.New().String()
+	return id, &http.Cookie{
+		Name:     GuestCookie,
+		Value:    s.GuestIdentity(id),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(guestTTL.Seconds()),
+	}
+}
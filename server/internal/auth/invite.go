@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IssueInvite signs a token admitting whoever holds it to a room until
+// expires
+func (s *Service) IssueInvite(roomID string, expires time.Time) string {
+	claims := base64.RawURLEncoding.EncodeToString([]byte(roomID)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return claims + "." + s.sign("invite:"+claims)
+}
+
+// VerifyInvite checks an invite's signature and expiry and returns the
+// room it admits to
+func (s *Service) VerifyInvite(token string) (string, error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return "", ErrInvalidToken
+	}
+	claims, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(s.sign("invite:"+claims)), []byte(sig)) {
+		return "", ErrInvalidToken
+	}
+
+	encodedID, expiry, ok := strings.Cut(claims, ".")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", ErrInvalidToken
+	}
+	roomID, err := base64.RawURLEncoding.DecodeString(encodedID)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	return string(roomID), nil
+}
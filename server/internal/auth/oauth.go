@@ -0,0 +1,369 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// OAuthCookie binds an OAuth state to the browser that started the login
+	OAuthCookie = "wr_oauth"
+	oauthTTL    = 10 * time.Minute
+
+	identitiesCollection = "identities"
+)
+
+// Errors returned by OAuth logins
+var (
+	ErrUnknownProvider = errors.New("unknown login provider")
+	ErrOAuthState      = errors.New("login expired or was started in another browser, try again")
+	ErrOAuthFailed     = errors.New("login provider rejected the sign-in")
+	ErrIdentityLinked  = errors.New("that login is already linked to another account")
+)
+
+// provider describes one OAuth 2.0 identity provider
+type provider struct {
+	authURL  string
+	tokenURL string
+	userURL  string
+	scope    string
+	// user decodes the provider's profile response into a stable ID and a
+	// display name
+	user func(raw []byte) (id, name string, err error)
+
+	clientID     string
+	clientSecret string
+}
+
+// providers are the supported identity providers, enabled by EnableProvider
+var providers = map[string]provider{
+	"google": {
+		authURL:  "https://accounts.google.com/o/oauth2/v2/auth",
+		tokenURL: "https://oauth2.googleapis.com/token",
+		userURL:  "https://openidconnect.googleapis.com/v1/userinfo",
+		scope:    "openid profile",
+		user: func(raw []byte) (string, string, error) {
+			var u struct {
+				Sub  string `json:"sub"`
+				Name string `json:"given_name"`
+			}
+			err := json.Unmarshal(raw, &u)
+			return u.Sub, u.Name, err
+		},
+	},
+	"discord": {
+		authURL:  "https://discord.com/oauth2/authorize",
+		tokenURL: "https://discord.com/api/oauth2/token",
+		userURL:  "https://discord.com/api/users/@me",
+		scope:    "identify",
+		user: func(raw []byte) (string, string, error) {
+			var u struct {
+				ID       string `json:"id"`
+				Username string `json:"username"`
+			}
+			err := json.Unmarshal(raw, &u)
+			return u.ID, u.Username, err
+		},
+	},
+	"github": {
+		authURL:  "https://github.com/login/oauth/authorize",
+		tokenURL: "https://github.com/login/oauth/access_token",
+		userURL:  "https://api.github.com/user",
+		scope:    "read:user",
+		user: func(raw []byte) (string, string, error) {
+			var u struct {
+				ID    int64  `json:"id"`
+				Login string `json:"login"`
+			}
+			err := json.Unmarshal(raw, &u)
+			if u.ID == 0 {
+				return "", u.Login, err
+			}
+			return fmt.Sprint(u.ID), u.Login, err
+		},
+	},
+}
+
+// OAuthState is what a login carries through the provider round trip
+type OAuthState struct {
+	Provider string `json:"p"`
+	// LinkAccount is set when a signed-in player adds a login to their
+	// existing account, keeping its profile and rating
+	LinkAccount string `json:"l,omitempty"`
+	Redirect    string `json:"r,omitempty"` // client path to return to
+	Nonce       string `json:"n"`
+	Expires     int64  `json:"e"`
+}
+
+// Identity links a provider account to a player account
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	AccountID string    `json:"accountId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// EnableProvider turns on logins through a supported provider
+func (s *Service) EnableProvider(name, clientID, clientSecret string) error {
+	p, ok := providers[name]
+	if !ok {
+		return ErrUnknownProvider
+	}
+	p.clientID, p.clientSecret = clientID, clientSecret
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.providers == nil {
+		s.providers = make(map[string]provider)
+	}
+	s.providers[name] = p
+	return nil
+}
+
+// Providers lists the enabled login providers
+func (s *Service) Providers() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Service) provider(name string) (provider, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.providers[name]
+	return p, ok
+}
+
+// StartOAuth begins a login, returning the provider URL to send the player
+// to and the nonce cookie that must come back with the callback
+func (s *Service) StartOAuth(st OAuthState, callbackURL string) (string, *http.Cookie, error) {
+	p, ok := s.provider(st.Provider)
+	if !ok {
+		return "", nil, ErrUnknownProvider
+	}
+	st.Nonce = uuid.New().String()
+	st.Expires = time.Now().Add(oauthTTL).Unix()
+	raw, _ := json.Marshal(st)
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	state := payload + "." + s.sign("oauth:"+payload)
+
+	q := url.Values{
+		"client_id":     {p.clientID},
+		"redirect_uri":  {callbackURL},
+		"response_type": {"code"},
+		"scope":         {p.scope},
+		"state":         {state},
+	}
+	cookie := &http.Cookie{
+		Name:     OAuthCookie,
+		Value:    st.Nonce,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(oauthTTL.Seconds()),
+	}
+	return p.authURL + "?" + q.Encode(), cookie, nil
+}
+
+// CheckOAuthState verifies a callback's state against the request's nonce
+// cookie
+func (s *Service) CheckOAuthState(state string, r *http.Request) (OAuthState, error) {
+	payload, sig, ok := strings.Cut(state, ".")
+	if !ok || !hmac.Equal([]byte(s.sign("oauth:"+payload)), []byte(sig)) {
+		return OAuthState{}, ErrOAuthState
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return OAuthState{}, ErrOAuthState
+	}
+	var st OAuthState
+	if err := json.Unmarshal(raw, &st); err != nil {
+		return OAuthState{}, ErrOAuthState
+	}
+	c, err := r.Cookie(OAuthCookie)
+	if err != nil || c.Value != st.Nonce || time.Now().Unix() > st.Expires {
+		return OAuthState{}, ErrOAuthState
+	}
+	return st, nil
+}
+
+// FinishOAuth exchanges a callback code for the player's provider
+// identity, then logs them into the linked account. Unknown identities
+// are linked to st.LinkAccount when set, or get a new account.
+func (s *Service) FinishOAuth(ctx context.Context, st OAuthState, code, callbackURL string) (Account, error) {
+	p, ok := s.provider(st.Provider)
+	if !ok {
+		return Account{}, ErrUnknownProvider
+	}
+	token, err := p.exchange(ctx, code, callbackURL)
+	if err != nil {
+		return Account{}, err
+	}
+	subject, name, err := p.fetchUser(ctx, token)
+	if err != nil {
+		return Account{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := st.Provider + ":" + subject
+	var identity Identity
+	found, err := s.store.Get(identitiesCollection, key, &identity)
+	if err != nil {
+		return Account{}, err
+	}
+	switch {
+	case found && st.LinkAccount != "" && identity.AccountID != st.LinkAccount:
+		return Account{}, ErrIdentityLinked
+	case found:
+		return s.Account(identity.AccountID)
+	}
+
+	var account Account
+	if st.LinkAccount != "" {
+		if account, err = s.Account(st.LinkAccount); err != nil {
+			return Account{}, err
+		}
+	} else if account, err = s.createOAuthAccount(name); err != nil {
+		return Account{}, err
+	}
+	identity = Identity{Provider: st.Provider, Subject: subject, AccountID: account.ID, CreatedAt: time.Now()}
+	if err := s.store.Put(identitiesCollection, key, identity); err != nil {
+		return Account{}, err
+	}
+	return account, nil
+}
+
+var usernameInvalid = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// createOAuthAccount makes a passwordless account named after the
+// provider profile, adding a number when the name is taken. Caller must
+// hold s.mu.
+func (s *Service) createOAuthAccount(name string) (Account, error) {
+	base := usernameInvalid.ReplaceAllString(name, "")
+	if len(base) > 15 {
+		base = base[:15]
+	}
+	if len(base) < 3 {
+		base = "player"
+	}
+
+	username := base
+	for attempt := 0; ; attempt++ {
+		var existing string
+		found, err := s.store.Get(usernamesCollection, strings.ToLower(username), &existing)
+		if err != nil {
+			return Account{}, err
+		}
+		if !found {
+			break
+		}
+		if attempt == 10 {
+			return Account{}, ErrUsernameTaken
+		}
+		n, _ := rand.Int(rand.Reader, big.NewInt(10000))
+		username = fmt.Sprintf("%s-%04d", base, n)
+	}
+
+	account := Account{
+		ID:        uuid.New().String(),
+		Username:  username,
+		CreatedAt: time.Now(),
+	}
+	if err := s.store.Put(accountsCollection, account.ID, account); err != nil {
+		return Account{}, err
+	}
+	if err := s.store.Put(usernamesCollection, strings.ToLower(username), account.ID); err != nil {
+		return Account{}, err
+	}
+	return account, nil
+}
+
+// exchange trades an authorization code for an access token
+func (p provider) exchange(ctx context.Context, code, callbackURL string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {callbackURL},
+		"client_id":     {p.clientID},
+		"client_secret": {p.clientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// GitHub answers form-encoded unless asked for JSON
+	req.Header.Set("Accept", "application/json")
+
+	raw, err := doOAuth(req)
+	if err != nil {
+		return "", err
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(raw, &token); err != nil || token.AccessToken == "" {
+		return "", ErrOAuthFailed
+	}
+	return token.AccessToken, nil
+}
+
+// fetchUser loads the signed-in provider profile
+func (p provider) fetchUser(ctx context.Context, token string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.userURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	raw, err := doOAuth(req)
+	if err != nil {
+		return "", "", err
+	}
+	id, name, err := p.user(raw)
+	if err != nil || id == "" {
+		return "", "", ErrOAuthFailed
+	}
+	return id, name, nil
+}
+
+func doOAuth(req *http.Request) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrOAuthFailed
+	}
+	return raw, nil
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+)
+
+// ErrInvalidSigningKey is returned for signing keys that aren't a
+// base64 Ed25519 seed
+var ErrInvalidSigningKey = errors.New("signing key must be a base64 Ed25519 seed")
+
+// ResultSigner signs exported race results with an Ed25519 key, so
+// community leaderboards can check a claimed result against the server's
+// public key without trusting whoever submits it
+type ResultSigner struct {
+	key ed25519.PrivateKey
+}
+
+// NewResultSigner loads the key from a base64 seed. Without one a key is
+// generated, and results exported before a restart stop verifying.
+func NewResultSigner(seed string) (*ResultSigner, error) {
+	if seed == "" {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("SIGNING_KEY not set, exported results will stop verifying on restart")
+		return &ResultSigner{key: key}, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(seed)
+	if err != nil || len(raw) != ed25519.SeedSize {
+		return nil, ErrInvalidSigningKey
+	}
+	return &ResultSigner{key: ed25519.NewKeyFromSeed(raw)}, nil
+}
+
+// Sign returns the base64 signature of data
+func (s *ResultSigner) Sign(data []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, data))
+}
+
+// PublicKey returns the base64 public key signatures verify against
+func (s *ResultSigner) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey))
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IssueResume signs a token that lets a migrating client take over its
+// player in a room on another instance until expires. Instances must
+// share the auth secret for it to verify.
+func (s *Service) IssueResume(roomID, playerID string, expires time.Time) string {
+	claims := base64.RawURLEncoding.EncodeToString([]byte(roomID)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(playerID)) + "." +
+		strconv.FormatInt(expires.Unix(), 10)
+	return claims + "." + s.sign("resume:"+claims)
+}
+
+// VerifyResume checks a resume token's signature and expiry and returns
+// the room and player it resumes
+func (s *Service) VerifyResume(token string) (roomID, playerID string, err error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return "", "", ErrInvalidToken
+	}
+	claims, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(s.sign("resume:"+claims)), []byte(sig)) {
+		return "", "", ErrInvalidToken
+	}
+
+	parts := strings.Split(claims, ".")
+	if len(parts) != 3 {
+		return "", "", ErrInvalidToken
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", "", ErrInvalidToken
+	}
+	room, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", "", ErrInvalidToken
+	}
+	player, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", "", ErrInvalidToken
+	}
+	return string(room), string(player), nil
+}
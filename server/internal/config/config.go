@@ -0,0 +1,410 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every server tunable. Values come from defaults, then an
+// optional YAML file, then environment variables, in that order.
+type Config struct {
+	Port    string        `yaml:"port"`
+	Storage StorageConfig `yaml:"storage"`
+	Auth    AuthConfig    `yaml:"auth"`
+	Rooms   RoomsConfig   `yaml:"rooms"`
+	TLS     TLSConfig     `yaml:"tls"`
+	Graph   GraphConfig   `yaml:"graph"`
+	// LinkCache keeps article link lists fetched from the Wikipedia API
+	LinkCache LinkCacheConfig `yaml:"linkCache"`
+	// Announcement is shown to every client as it connects
+	Announcement AnnouncementConfig `yaml:"announcement"`
+	Webhooks     WebhooksConfig     `yaml:"webhooks"`
+	Discord      DiscordConfig      `yaml:"discord"`
+	// HeartbeatTimeout closes connections that stay silent this long
+	HeartbeatTimeout time.Duration     `yaml:"heartbeatTimeout"`
+	Compression      CompressionConfig `yaml:"compression"`
+	Debug            DebugConfig       `yaml:"debug"`
+	Recording        RecordingConfig   `yaml:"recording"`
+	// GRPCPort serves the game protocol over gRPC for headless clients.
+	// Empty leaves it off.
+	GRPCPort string `yaml:"grpcPort"`
+	// Proxy lists the reverse proxies trusted to report client addresses
+	Proxy ProxyConfig `yaml:"proxy"`
+	// CORS limits which browser origins may call the API and open sockets
+	CORS CORSConfig `yaml:"cors"`
+	// Tracing exports a span per inbound message and broadcast
+	Tracing TracingConfig `yaml:"tracing"`
+	// Seasons splits ranked play into seasons with their own leaderboards
+	Seasons SeasonsConfig `yaml:"seasons"`
+	// Push sends Web Push notifications to players who aren't connected
+	Push PushConfig `yaml:"push"`
+	// Events are recurring community races, like an hourly blitz. More
+	// can be added through the admin API.
+	Events []EventConfig `yaml:"events"`
+}
+
+// StorageConfig selects the persistent store
+type StorageConfig struct {
+	// DSN is the path of the JSON store file. Empty keeps data in memory.
+	DSN string `yaml:"dsn"`
+}
+
+// AuthConfig holds secrets for sessions and the management API
+type AuthConfig struct {
+	Secret   string `yaml:"secret"`   // signs session tokens and guest cookies
+	APIToken string `yaml:"apiToken"` // required to create or close rooms over REST
+	// AdminToken is required for the moderation API, which is off when empty
+	AdminToken string      `yaml:"adminToken"`
+	OAuth      OAuthConfig `yaml:"oauth"`
+	// SigningKey is a base64 Ed25519 seed that signs exported race
+	// results. A fresh key is made on startup when empty.
+	SigningKey string `yaml:"signingKey"`
+}
+
+// OAuthConfig enables logging in with existing Google, Discord or GitHub
+// identities. Providers without a client ID stay off.
+type OAuthConfig struct {
+	// CallbackBase is this server's public address; register
+	// {callbackBase}/api/auth/oauth/{provider}/callback with each provider
+	CallbackBase string `yaml:"callbackBase"`
+	// ClientURL is the web client players return to after logging in
+	ClientURL string      `yaml:"clientUrl"`
+	Google    OAuthClient `yaml:"google"`
+	Discord   OAuthClient `yaml:"discord"`
+	GitHub    OAuthClient `yaml:"github"`
+}
+
+// OAuthClient holds one provider's app credentials
+type OAuthClient struct {
+	ClientID     string `yaml:"clientId"`
+	ClientSecret string `yaml:"clientSecret"`
+}
+
+// RoomsConfig limits room sizes and counts
+type RoomsConfig struct {
+	MaxPlayers int `yaml:"maxPlayers"`
+	MaxRooms   int `yaml:"maxRooms"` // 0 means unlimited
+	MatchSize  int `yaml:"matchSize"`
+	// IdleTimeout forfeits racers who send nothing for this long, 0 to
+	// never forfeit
+	IdleTimeout time.Duration `yaml:"idleTimeout"`
+}
+
+// TLSConfig enables built-in TLS for self-hosting
+type TLSConfig struct {
+	Domains  []string `yaml:"domains"` // Let's Encrypt hostnames, enables autocert
+	CacheDir string   `yaml:"cacheDir"`
+	CertFile string   `yaml:"certFile"` // static certificate, used instead of autocert
+	KeyFile  string   `yaml:"keyFile"`
+}
+
+// GraphConfig points at an offline link graph built by cmd/graphimport
+type GraphConfig struct {
+	// Path of the index file. Empty uses the Wikipedia API for links.
+	Path string `yaml:"path"`
+}
+
+// LinkCacheConfig sizes the cache of link lists used to check moves and
+// give hints when there is no offline graph. Zero values select defaults.
+type LinkCacheConfig struct {
+	TTL            time.Duration `yaml:"ttl"`            // 6h if 0
+	MaxEntries     int           `yaml:"maxEntries"`     // lists in memory, 20000 if 0
+	Path           string        `yaml:"path"`           // bbolt file on disk, memory only if empty
+	MaxDiskEntries int           `yaml:"maxDiskEntries"` // lists on disk, 500000 if 0
+}
+
+// AnnouncementConfig pins a message for all players, e.g. planned
+// maintenance. An empty message pins nothing.
+type AnnouncementConfig struct {
+	Message  string `yaml:"message"`
+	Severity string `yaml:"severity"` // info, warning or critical
+}
+
+// WebhooksConfig lists endpoints notified when public races start, finish
+// or are abandoned
+type WebhooksConfig struct {
+	URLs   []string `yaml:"urls"`
+	Secret string   `yaml:"secret"` // signs each body with HMAC-SHA256 when set
+}
+
+// DiscordConfig enables the /race slash command. It's off unless the
+// application ID and public key are set.
+type DiscordConfig struct {
+	ApplicationID string `yaml:"applicationId"`
+	PublicKey     string `yaml:"publicKey"`
+	BotToken      string `yaml:"botToken"`
+	GuildID       string `yaml:"guildId"`   // register the command in one server only
+	PublicURL     string `yaml:"publicUrl"` // web client address for join links
+}
+
+// CompressionConfig tunes permessage-deflate on WebSocket connections
+type CompressionConfig struct {
+	Level     int `yaml:"level"`     // 1 is fastest, 9 smallest, 0 turns compression off
+	Threshold int `yaml:"threshold"` // frames smaller than this many bytes go uncompressed
+}
+
+// RecordingConfig uploads room event logs to an S3-compatible bucket in
+// gzipped chunks for long-term replay storage. It's off unless a bucket
+// is set. For Google Cloud Storage use https://storage.googleapis.com with
+// an HMAC key and region "auto".
+type RecordingConfig struct {
+	Endpoint  string `yaml:"endpoint"` // AWS S3 if empty
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"` // object key prefix, e.g. "replays"
+	AccessKey string `yaml:"accessKey"`
+	SecretKey string `yaml:"secretKey"`
+}
+
+// ProxyConfig describes the reverse proxies in front of the server, like
+// Railway's edge. Their X-Forwarded-For and X-Real-IP headers are used for
+// logging, rate limiting and bans; anyone else's are ignored.
+type ProxyConfig struct {
+	TrustedProxies []string `yaml:"trustedProxies"` // CIDRs or single IPs
+}
+
+// CORSConfig lists the web client origins, e.g. https://wikispeedrun.org.
+// Empty or "*" allows any origin, but sockets authenticated by cookie
+// are only accepted from listed origins and the server's own.
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+}
+
+// TracingConfig sends OpenTelemetry spans to an OTLP gRPC receiver such
+// as an OpenTelemetry Collector. It's off unless an endpoint is set.
+type TracingConfig struct {
+	Endpoint    string  `yaml:"endpoint"`    // host:port, e.g. otel-collector:4317
+	Insecure    bool    `yaml:"insecure"`    // plaintext instead of TLS
+	SampleRatio float64 `yaml:"sampleRatio"` // fraction of traces kept, 0 keeps all
+}
+
+// SeasonsConfig schedules ranked seasons. Each season's leaderboard is
+// archived when it ends, and ratings are pulled toward the default by
+// SoftReset when the next begins. No seasons leaves ratings running as one.
+type SeasonsConfig struct {
+	SoftReset float64        `yaml:"softReset"` // 0 keeps ratings, 1 resets them fully
+	List      []SeasonConfig `yaml:"list"`
+}
+
+// SeasonConfig is one season. Seasons shouldn't overlap.
+type SeasonConfig struct {
+	ID    string    `yaml:"id"` // used in archive URLs, e.g. "2026-s1"
+	Name  string    `yaml:"name"`
+	Start time.Time `yaml:"start"`
+	End   time.Time `yaml:"end"`
+}
+
+// PushConfig is the server's VAPID key pair for Web Push, base64url
+// encoded as `npx web-push generate-vapid-keys` prints it. It's off
+// unless the keys are set.
+type PushConfig struct {
+	PublicKey  string `yaml:"publicKey"`
+	PrivateKey string `yaml:"privateKey"`
+	Subject    string `yaml:"subject"` // mailto: or https: contact for push services
+}
+
+// EventConfig is a recurring event, run as a scheduled race each time
+// Cron fires. Leave the articles empty for a fresh random pair each time.
+type EventConfig struct {
+	ID           string `yaml:"id"`   // keeps the event's place in the schedule across restarts
+	Name         string `yaml:"name"` // shown as the race title and in webhooks
+	Cron         string `yaml:"cron"` // five fields in UTC, e.g. "0 * * * *"
+	OpenMinutes  int    `yaml:"openMinutes"`
+	MinPlayers   int    `yaml:"minPlayers"`
+	Mode         string `yaml:"mode"`
+	Language     string `yaml:"language"`
+	StartArticle string `yaml:"startArticle"`
+	EndArticle   string `yaml:"endArticle"`
+	Tier         string `yaml:"tier"` // easy, medium or hard random pairs, with the link graph
+}
+
+// DebugConfig exposes profiling for diagnosing production load
+type DebugConfig struct {
+	// Pprof serves /debug/pprof to holders of the admin token
+	Pprof bool `yaml:"pprof"`
+}
+
+// Default returns the configuration used when nothing is set
+func Default() Config {
+	return Config{
+		Port:    "8080",
+		Storage: StorageConfig{DSN: "data/store.json"},
+		Rooms: RoomsConfig{
+			MaxPlayers:  8,
+			MatchSize:   2,
+			IdleTimeout: 3 * time.Minute,
+		},
+		TLS:              TLSConfig{CacheDir: "data/certs"},
+		HeartbeatTimeout: 60 * time.Second,
+		Compression:      CompressionConfig{Level: 1, Threshold: 512},
+		Seasons:          SeasonsConfig{SoftReset: 0.5},
+	}
+}
+
+// Load reads the YAML file at path, if it exists, and applies environment
+// overrides. A missing file is not an error so env-only deployments keep
+// working.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := yaml.Unmarshal(raw, &cfg); err != nil {
+				return cfg, fmt.Errorf("parsing %s: %w", path, err)
+			}
+		case !os.IsNotExist(err):
+			return cfg, err
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides fields from environment variables. PORT is set by
+// Railway, so env always wins over the file.
+func (c *Config) applyEnv() error {
+	strs := map[string]*string{
+		"PORT":          &c.Port,
+		"GRPC_PORT":     &c.GRPCPort,
+		"STORE_PATH":    &c.Storage.DSN,
+		"AUTH_SECRET":   &c.Auth.Secret,
+		"API_TOKEN":     &c.Auth.APIToken,
+		"ADMIN_TOKEN":   &c.Auth.AdminToken,
+		"SIGNING_KEY":   &c.Auth.SigningKey,
+		"TLS_CACHE_DIR": &c.TLS.CacheDir,
+		"TLS_CERT_FILE": &c.TLS.CertFile,
+		"TLS_KEY_FILE":  &c.TLS.KeyFile,
+		"GRAPH_PATH":    &c.Graph.Path,
+
+		"LINK_CACHE_PATH":  &c.LinkCache.Path,
+		"TRACING_ENDPOINT": &c.Tracing.Endpoint,
+
+		"ANNOUNCEMENT":          &c.Announcement.Message,
+		"ANNOUNCEMENT_SEVERITY": &c.Announcement.Severity,
+		"WEBHOOK_SECRET":        &c.Webhooks.Secret,
+
+		"VAPID_PUBLIC_KEY":  &c.Push.PublicKey,
+		"VAPID_PRIVATE_KEY": &c.Push.PrivateKey,
+		"VAPID_SUBJECT":     &c.Push.Subject,
+
+		"RECORDING_ENDPOINT":   &c.Recording.Endpoint,
+		"RECORDING_REGION":     &c.Recording.Region,
+		"RECORDING_BUCKET":     &c.Recording.Bucket,
+		"RECORDING_PREFIX":     &c.Recording.Prefix,
+		"RECORDING_ACCESS_KEY": &c.Recording.AccessKey,
+		"RECORDING_SECRET_KEY": &c.Recording.SecretKey,
+
+		"DISCORD_APPLICATION_ID": &c.Discord.ApplicationID,
+		"DISCORD_PUBLIC_KEY":     &c.Discord.PublicKey,
+		"DISCORD_BOT_TOKEN":      &c.Discord.BotToken,
+		"DISCORD_GUILD_ID":       &c.Discord.GuildID,
+		"PUBLIC_URL":             &c.Discord.PublicURL,
+
+		"OAUTH_CALLBACK_BASE":         &c.Auth.OAuth.CallbackBase,
+		"OAUTH_CLIENT_URL":            &c.Auth.OAuth.ClientURL,
+		"OAUTH_GOOGLE_CLIENT_ID":      &c.Auth.OAuth.Google.ClientID,
+		"OAUTH_GOOGLE_CLIENT_SECRET":  &c.Auth.OAuth.Google.ClientSecret,
+		"OAUTH_DISCORD_CLIENT_ID":     &c.Auth.OAuth.Discord.ClientID,
+		"OAUTH_DISCORD_CLIENT_SECRET": &c.Auth.OAuth.Discord.ClientSecret,
+		"OAUTH_GITHUB_CLIENT_ID":      &c.Auth.OAuth.GitHub.ClientID,
+		"OAUTH_GITHUB_CLIENT_SECRET":  &c.Auth.OAuth.GitHub.ClientSecret,
+	}
+	for key, field := range strs {
+		if v, ok := os.LookupEnv(key); ok {
+			*field = v
+		}
+	}
+
+	ints := map[string]*int{
+		"MAX_PLAYERS": &c.Rooms.MaxPlayers,
+		"MAX_ROOMS":   &c.Rooms.MaxRooms,
+		"MATCH_SIZE":  &c.Rooms.MatchSize,
+
+		"LINK_CACHE_MAX_ENTRIES":      &c.LinkCache.MaxEntries,
+		"LINK_CACHE_MAX_DISK_ENTRIES": &c.LinkCache.MaxDiskEntries,
+
+		"COMPRESSION_LEVEL":     &c.Compression.Level,
+		"COMPRESSION_THRESHOLD": &c.Compression.Threshold,
+	}
+	for key, field := range ints {
+		if v, ok := os.LookupEnv(key); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			*field = n
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"HEARTBEAT_TIMEOUT": &c.HeartbeatTimeout,
+		"IDLE_TIMEOUT":      &c.Rooms.IdleTimeout,
+		"LINK_CACHE_TTL":    &c.LinkCache.TTL,
+	}
+	for key, field := range durations {
+		if v, ok := os.LookupEnv(key); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			*field = d
+		}
+	}
+
+	bools := map[string]*bool{
+		"PPROF":            &c.Debug.Pprof,
+		"TRACING_INSECURE": &c.Tracing.Insecure,
+	}
+	for key, field := range bools {
+		if v, ok := os.LookupEnv(key); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			*field = b
+		}
+	}
+
+	floats := map[string]*float64{
+		"TRACING_SAMPLE_RATIO": &c.Tracing.SampleRatio,
+		"SEASON_SOFT_RESET":    &c.Seasons.SoftReset,
+	}
+	for key, field := range floats {
+		if v, ok := os.LookupEnv(key); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			*field = f
+		}
+	}
+
+	lists := map[string]*[]string{
+		"TLS_DOMAIN":   &c.TLS.Domains,
+		"WEBHOOK_URLS": &c.Webhooks.URLs,
+
+		"TRUSTED_PROXIES": &c.Proxy.TrustedProxies,
+		"CORS_ORIGINS":    &c.CORS.AllowedOrigins,
+	}
+	for key, field := range lists {
+		if v, ok := os.LookupEnv(key); ok {
+			*field = nil
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*field = append(*field, item)
+				}
+			}
+		}
+	}
+	return nil
+}
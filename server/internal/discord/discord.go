@@ -0,0 +1,281 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/hub"
+	"github.com/markotsymbaluk/wiki-racing/internal/webhook"
+)
+
+const (
+	apiBase   = "https://discord.com/api/v10"
+	userAgent = "DiscordBot (https://github.com/mrktsm/wikispeedrun, 1.0)"
+
+	// maxBodySize bounds interaction payloads, which are a few KB at most
+	maxBodySize = 64 * 1024
+	// createTimeout bounds article validation for a slash command; the
+	// reply is deferred, so Discord waits up to 15 minutes
+	createTimeout = 20 * time.Second
+)
+
+// Interaction and response types from the Discord API
+const (
+	interactionPing    = 1
+	interactionCommand = 2
+
+	responsePong     = 1
+	responseDeferred = 5
+)
+
+// Config holds the Discord application's credentials
+type Config struct {
+	ApplicationID string
+	PublicKey     string // hex Ed25519 key that signs interaction requests
+	BotToken      string // posts standings and registers the slash command
+	GuildID       string // registers the command in one server instead of globally
+	// PublicURL is where the web client is served, for join links
+	PublicURL string
+}
+
+// Bot answers the /race slash command and reports standings for the rooms
+// it created back to the channel the command came from
+type Bot struct {
+	hub       *hub.Hub
+	cfg       Config
+	publicKey ed25519.PublicKey
+	client    *http.Client
+
+	mu       sync.Mutex
+	channels map[string]string // room ID -> Discord channel ID
+}
+
+// New creates a bot and subscribes it to the hub's race events. It fails
+// if the public key isn't a valid Ed25519 key.
+func New(h *hub.Hub, cfg Config) (*Bot, error) {
+	key, err := hex.DecodeString(cfg.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("discord public key must be 64 hex characters")
+	}
+	b := &Bot{
+		hub:       h,
+		cfg:       cfg,
+		publicKey: key,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		channels:  make(map[string]string),
+	}
+	h.OnRaceEvent(b.onRaceEvent)
+	return b, nil
+}
+
+// Register mounts the interactions endpoint on mux. Point the Discord
+// application's Interactions Endpoint URL at /api/discord/interactions.
+func (b *Bot) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/api/discord/interactions", b.handleInteraction)
+}
+
+type interaction struct {
+	Type      int    `json:"type"`
+	Token     string `json:"token"`
+	ChannelID string `json:"channel_id"`
+	Data      struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+}
+
+func (i interaction) option(name string) string {
+	for _, o := range i.Data.Options {
+		if o.Name == name {
+			return o.Value
+		}
+	}
+	return ""
+}
+
+func (b *Bot) handleInteraction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	// Discord rejects endpoints that accept unsigned requests
+	sig, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	timestamp := r.Header.Get("X-Signature-Timestamp")
+	if err != nil || !ed25519.Verify(b.publicKey, append([]byte(timestamp), body...), sig) {
+		http.Error(w, "invalid request signature", http.StatusUnauthorized)
+		return
+	}
+
+	var in interaction
+	if err := json.Unmarshal(body, &in); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case in.Type == interactionPing:
+		writeJSON(w, map[string]int{"type": responsePong})
+	case in.Type == interactionCommand && in.Data.Name == "race":
+		// Validating articles calls Wikipedia, which can outlast the
+		// three seconds Discord allows, so acknowledge first and edit
+		// the reply once the room exists
+		writeJSON(w, map[string]int{"type": responseDeferred})
+		go b.createRoom(in)
+	default:
+		http.Error(w, "unknown interaction", http.StatusBadRequest)
+	}
+}
+
+// createRoom makes a room for a /race command and replies with its link
+func (b *Bot) createRoom(in interaction) {
+	ctx, cancel := context.WithTimeout(context.Background(), createTimeout)
+	defer cancel()
+
+	var reply string
+	room, err := b.hub.CreateRoom(hub.RoomOptions{
+		StartArticle: in.option("start"),
+		EndArticle:   in.option("end"),
+		Mode:         in.option("mode"),
+		Language:     in.option("language"),
+	})
+	if err != nil {
+		reply = "Couldn't create a room: " + err.Error()
+	} else {
+		b.mu.Lock()
+		b.channels[room.ID] = in.ChannelID
+		b.mu.Unlock()
+		reply = fmt.Sprintf("**%s → %s** (%s)\nJoin the race: %s",
+			room.StartArticle, room.EndArticle, room.Mode, b.joinLink(room.ID))
+	}
+
+	path := fmt.Sprintf("/webhooks/%s/%s/messages/@original", b.cfg.ApplicationID, in.Token)
+	if err := b.call(ctx, http.MethodPatch, path, map[string]string{"content": reply}); err != nil {
+		log.Printf("Discord reply to /race failed: %v", err)
+	}
+}
+
+func (b *Bot) joinLink(roomID string) string {
+	return strings.TrimRight(b.cfg.PublicURL, "/") + "/race-lobby?code=" + url.QueryEscape(roomID)
+}
+
+// onRaceEvent posts the result of races in rooms the bot created. It runs
+// with room locks held, so the post happens on its own goroutine.
+func (b *Bot) onRaceEvent(e webhook.Event) {
+	race, ok := e.Data.(hub.RaceEvent)
+	if !ok || e.Type == hub.EventRaceStarted {
+		return
+	}
+
+	b.mu.Lock()
+	channel, ok := b.channels[race.RoomID]
+	if ok && race.Reason == hub.RaceAbandonedRoomClosed {
+		delete(b.channels, race.RoomID)
+	}
+	b.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	content := standingsMessage(e.Content, race.Standings)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), createTimeout)
+		defer cancel()
+		path := "/channels/" + channel + "/messages"
+		if err := b.call(ctx, http.MethodPost, path, map[string]string{"content": content}); err != nil {
+			log.Printf("Discord standings for room %s failed: %v", race.RoomID, err)
+		}
+	}()
+}
+
+// standingsMessage formats final standings under the event summary
+func standingsMessage(summary string, standings []hub.Standing) string {
+	var sb strings.Builder
+	sb.WriteString(summary)
+	for _, s := range standings {
+		if s.DNF {
+			fmt.Fprintf(&sb, "\n- %s: DNF", s.PlayerName)
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%d. %s: %.1fs, %d clicks", s.Rank, s.PlayerName, float64(s.Time)/1000, s.Clicks)
+	}
+	return sb.String()
+}
+
+// RegisterCommands creates or updates the /race slash command
+func (b *Bot) RegisterCommands(ctx context.Context) error {
+	path := "/applications/" + b.cfg.ApplicationID + "/commands"
+	if b.cfg.GuildID != "" {
+		path = "/applications/" + b.cfg.ApplicationID + "/guilds/" + b.cfg.GuildID + "/commands"
+	}
+	option := func(name, description string, required bool) map[string]interface{} {
+		return map[string]interface{}{"type": 3, "name": name, "description": description, "required": required}
+	}
+	mode := option("mode", "How finishers are ranked", false)
+	mode["choices"] = []map[string]string{
+		{"name": "Fastest time", "value": string(hub.ModeTime)},
+		{"name": "Fewest clicks", "value": string(hub.ModeClicks)},
+		{"name": "Hybrid", "value": string(hub.ModeHybrid)},
+	}
+	commands := []map[string]interface{}{{
+		"name":        "race",
+		"description": "Create a Wikipedia speedrun room",
+		"options": []map[string]interface{}{
+			option("start", "Start article", true),
+			option("end", "Target article", true),
+			mode,
+			option("language", "Wikipedia language code, e.g. de", false),
+		},
+	}}
+	return b.call(ctx, http.MethodPut, path, commands)
+}
+
+// call makes an authenticated Discord API request with a JSON body
+func (b *Bot) call(ctx context.Context, method, path string, body interface{}) error {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, apiBase+path, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Authorization", "Bot "+b.cfg.BotToken)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("discord API %s %s: %s: %s", method, path, resp.Status, msg)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
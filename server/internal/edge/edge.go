@@ -0,0 +1,153 @@
+// Package edge holds the server's view of the network in front of it:
+// which reverse proxies are trusted to report client addresses, and which
+// browser origins may call the API and open WebSockets.
+package edge
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Policy resolves client addresses and checks origins. A nil Policy
+// trusts no proxies and allows every origin.
+type Policy struct {
+	trusted []*net.IPNet
+	origins map[string]bool // nil allows any
+}
+
+// New builds a policy from CIDRs (bare IPs are taken as single hosts) and
+// allowed origins like "https://wikispeedrun.org". No origins, or "*",
+// allows any.
+func New(trustedProxies, allowedOrigins []string) (*Policy, error) {
+	p := &Policy{}
+	for _, cidr := range trustedProxies {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", cidr, err)
+		}
+		p.trusted = append(p.trusted, n)
+	}
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			p.origins = nil
+			break
+		}
+		if p.origins == nil {
+			p.origins = make(map[string]bool)
+		}
+		p.origins[strings.TrimRight(origin, "/")] = true
+	}
+	return p, nil
+}
+
+// ClientIP returns the address of the client behind a request. The
+// forwarding headers are only believed when the connection comes from a
+// trusted proxy, and X-Forwarded-For is read right to left so a client
+// can't spoof an address by sending its own header.
+func (p *Policy) ClientIP(r *http.Request) string {
+	addr := remoteIP(r.RemoteAddr)
+	if p == nil || !p.trusts(addr) {
+		return addr
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := normalize(strings.TrimSpace(hops[i]))
+		if hop == "" {
+			continue
+		}
+		if !p.trusts(hop) {
+			return hop
+		}
+		addr = hop
+	}
+	if real := normalize(strings.TrimSpace(r.Header.Get("X-Real-IP"))); real != "" {
+		return real
+	}
+	return addr
+}
+
+// AllowOrigin reports whether a browser on origin may connect. Requests
+// without an Origin header aren't from a browser and are allowed.
+func (p *Policy) AllowOrigin(origin string) bool {
+	if p == nil || p.origins == nil || origin == "" {
+		return true
+	}
+	return p.origins[origin]
+}
+
+// AllowCookies reports whether a browser request may be authenticated by
+// its cookies. Unlike AllowOrigin, an open policy only trusts the
+// server's own origin here, so another site can't open a socket that
+// rides a player's session.
+func (p *Policy) AllowCookies(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return p != nil && p.origins[origin]
+}
+
+// CORSOrigin is the Access-Control-Allow-Origin value for a request, or
+// "" when its origin isn't allowed
+func (p *Policy) CORSOrigin(r *http.Request) string {
+	if p == nil || p.origins == nil {
+		return "*"
+	}
+	if origin := r.Header.Get("Origin"); p.origins[origin] {
+		return origin
+	}
+	return ""
+}
+
+func (p *Policy) trusts(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range p.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP strips the port from a connection's remote address
+func remoteIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// normalize returns a forwarded address in canonical form, or "" if it
+// isn't an IP. Some proxies include a port.
+func normalize(addr string) string {
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip.String()
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
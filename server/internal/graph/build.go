@@ -0,0 +1,197 @@
+package graph
+
+import (
+	"encoding/binary"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Dumps names the SQL dump files (optionally gzipped) an index is built
+// from. Page and PageLinks are required. LinkTarget is needed for dumps
+// from 2024 on, where pagelinks refers to targets by ID instead of title,
+// and Redirect lets links through redirect pages count. Language is the
+// edition's code ("de" for dewiki), defaulting to English.
+type Dumps struct {
+	Language   string
+	Page       string
+	PageLinks  string
+	LinkTarget string
+	Redirect   string
+}
+
+// Build reads the dumps into a graph of main-namespace articles. It holds
+// every link in memory while sorting, so the full English dump needs a
+// machine with plenty of RAM; the resulting index is much smaller.
+func Build(d Dumps, logf func(format string, args ...interface{})) (*Graph, error) {
+	// Pages: article IDs and titles, with redirects set aside
+	articles := make(map[uint32]string)
+	redirectPages := make(map[uint32]string)
+	err := scanDump(d.Page, []string{"page_id", "page_namespace", "page_title", "page_is_redirect"}, func(v []string) error {
+		if v[1] != "0" {
+			return nil
+		}
+		id, err := strconv.ParseUint(v[0], 10, 32)
+		if err != nil {
+			return nil
+		}
+		if v[3] == "1" {
+			redirectPages[uint32(id)] = dumpTitle(v[2])
+		} else {
+			articles[uint32(id)] = dumpTitle(v[2])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logf("Read %d articles and %d redirects", len(articles), len(redirectPages))
+
+	g := &Graph{lang: d.Language, titles: make([]string, 0, len(articles))}
+	for _, title := range articles {
+		g.titles = append(g.titles, title)
+	}
+	sort.Strings(g.titles)
+	nodeOf := make(map[uint32]uint32, len(articles))
+	for id, title := range articles {
+		nodeOf[id] = uint32(sort.SearchStrings(g.titles, title))
+	}
+	articles = nil
+
+	if d.Redirect != "" {
+		err := scanDump(d.Redirect, []string{"rd_from", "rd_namespace", "rd_title"}, func(v []string) error {
+			id, err := strconv.ParseUint(v[0], 10, 32)
+			if err != nil || v[1] != "0" {
+				return nil
+			}
+			title, ok := redirectPages[uint32(id)]
+			if !ok {
+				return nil
+			}
+			if target, ok := g.article(dumpTitle(v[2])); ok {
+				g.redirects = append(g.redirects, redirect{title: title, target: target})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(g.redirects, func(i, j int) bool {
+			return g.redirects[i].title < g.redirects[j].title
+		})
+		logf("Resolved %d redirects", len(g.redirects))
+	}
+	redirectPages = nil
+
+	// Newer dumps name link targets in a separate table
+	var targets map[uint64]uint32
+	columns := []string{"pl_from", "pl_from_namespace", "pl_namespace", "pl_title"}
+	if d.LinkTarget != "" {
+		targets = make(map[uint64]uint32)
+		err := scanDump(d.LinkTarget, []string{"lt_id", "lt_namespace", "lt_title"}, func(v []string) error {
+			id, err := strconv.ParseUint(v[0], 10, 64)
+			if err != nil || v[1] != "0" {
+				return nil
+			}
+			if node, ok := g.Lookup(dumpTitle(v[2])); ok {
+				targets[id] = node
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		logf("Read %d link targets", len(targets))
+		columns = []string{"pl_from", "pl_from_namespace", "pl_target_id"}
+	}
+
+	// Each edge packs from<<32 | to so sorting groups them by source
+	var edges []uint64
+	err = scanDump(d.PageLinks, columns, func(v []string) error {
+		if v[1] != "0" {
+			return nil
+		}
+		id, err := strconv.ParseUint(v[0], 10, 32)
+		if err != nil {
+			return nil
+		}
+		from, ok := nodeOf[uint32(id)]
+		if !ok {
+			return nil
+		}
+
+		var to uint32
+		if targets != nil {
+			targetID, err := strconv.ParseUint(v[2], 10, 64)
+			if err != nil {
+				return nil
+			}
+			if to, ok = targets[targetID]; !ok {
+				return nil
+			}
+		} else {
+			if v[2] != "0" {
+				return nil
+			}
+			if to, ok = g.Lookup(dumpTitle(v[3])); !ok {
+				return nil
+			}
+		}
+		if from != to {
+			edges = append(edges, uint64(from)<<32|uint64(to))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	nodeOf, targets = nil, nil
+
+	edges = sortUnique(edges)
+	g.links = len(edges)
+	g.out = encodeAdjacency(len(g.titles), edges)
+	for i, e := range edges {
+		edges[i] = e<<32 | e>>32
+	}
+	g.in = encodeAdjacency(len(g.titles), sortUnique(edges))
+	logf("Indexed %d links", g.links)
+
+	return g, nil
+}
+
+// article finds an exact (non-redirect) title
+func (g *Graph) article(title string) (uint32, bool) {
+	i := sort.SearchStrings(g.titles, title)
+	if i < len(g.titles) && g.titles[i] == title {
+		return uint32(i), true
+	}
+	return 0, false
+}
+
+// dumpTitle converts a dump's underscored title to display form
+func dumpTitle(title string) string {
+	return strings.ReplaceAll(title, "_", " ")
+}
+
+func sortUnique(edges []uint64) []uint64 {
+	slices.Sort(edges)
+	return slices.Compact(edges)
+}
+
+// encodeAdjacency packs edges sorted by (from, to) into delta-encoded lists
+func encodeAdjacency(n int, edges []uint64) adjacency {
+	a := adjacency{offsets: make([]uint64, n+1)}
+	var buf [binary.MaxVarintLen64]byte
+	i := 0
+	for node := 0; node < n; node++ {
+		var prev uint64
+		for ; i < len(edges) && edges[i]>>32 == uint64(node); i++ {
+			to := edges[i] & 0xffffffff
+			a.data = append(a.data, buf[:binary.PutUvarint(buf[:], to-prev)]...)
+			prev = to
+		}
+		a.offsets[node+1] = uint64(len(a.data))
+	}
+	return a
+}
@@ -0,0 +1,179 @@
+package graph
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+)
+
+// Tier buckets difficulty scores for players picking a random race
+type Tier string
+
+const (
+	TierEasy   Tier = "easy"
+	TierMedium Tier = "medium"
+	TierHard   Tier = "hard"
+)
+
+// ErrInvalidTier is returned for unknown tier names
+var ErrInvalidTier = errors.New("difficulty must be easy, medium or hard")
+
+// pairAttempts bounds how many candidates RandomPair scores per call
+const pairAttempts = 40
+
+// ParseTier validates a tier name from a request
+func ParseTier(s string) (Tier, error) {
+	switch t := Tier(s); t {
+	case TierEasy, TierMedium, TierHard:
+		return t, nil
+	}
+	return "", ErrInvalidTier
+}
+
+// TierOf buckets a score. Easy races are two clicks to a well-linked
+// target; hard ones take four or more, or three to an obscure page.
+func TierOf(score float64) Tier {
+	switch {
+	case score < 3:
+		return TierEasy
+	case score < 4:
+		return TierMedium
+	default:
+		return TierHard
+	}
+}
+
+// Difficulty describes how hard a start/end pair is to race
+type Difficulty struct {
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+	Path  []string `json:"path"`
+	// Distance is the number of clicks on the shortest route
+	Distance int `json:"distance"`
+	// StartLinks and EndBacklinks are the branching factors at either end:
+	// few links out of the start or into the end make a race harder
+	StartLinks   int     `json:"startLinks"`
+	EndBacklinks int     `json:"endBacklinks"`
+	Score        float64 `json:"score"`
+	Tier         Tier    `json:"tier"`
+}
+
+// Difficulty scores a pair. The score is the shortest-path length plus up
+// to 1.5 for poorly connected endpoints, so it mostly tracks the click
+// count while separating pairs with the same distance.
+func (g *Graph) Difficulty(from, to string) (Difficulty, error) {
+	path, err := g.ShortestPath(from, to)
+	if err != nil {
+		return Difficulty{}, err
+	}
+	src, _ := g.Lookup(from)
+	dst, _ := g.Lookup(to)
+
+	d := Difficulty{
+		Start:        g.titles[src],
+		End:          g.titles[dst],
+		Path:         path,
+		Distance:     len(path) - 1,
+		StartLinks:   g.out.degree(src),
+		EndBacklinks: g.in.degree(dst),
+	}
+	d.Score = float64(d.Distance) + rarity(d.EndBacklinks) + rarity(d.StartLinks)/2
+	d.Score = math.Round(d.Score*100) / 100
+	d.Tier = TierOf(d.Score)
+	return d, nil
+}
+
+// rarity maps a link count to 0 (a thousand or more) through 1 (none)
+func rarity(links int) float64 {
+	return 1 - math.Min(math.Log10(float64(links+1))/3, 1)
+}
+
+// RandomPair picks a start/end pair in the given tier. Easy and medium
+// targets come from a short random walk off the start, since a uniformly
+// random pair is usually three or four clicks apart; hard targets are
+// uniformly random. When no candidate lands in the tier the closest one is
+// returned.
+func (g *Graph) RandomPair(tier Tier) (Difficulty, error) {
+	walk := map[Tier]int{TierEasy: 2, TierMedium: 3}[tier]
+	want := map[Tier]float64{TierEasy: 2, TierMedium: 3.5, TierHard: 4.5}[tier]
+
+	var best Difficulty
+	found := false
+	for i := 0; i < pairAttempts; i++ {
+		src := g.randomNode(g.out)
+		if src < 0 {
+			return Difficulty{}, ErrNoPath
+		}
+		var dst int
+		if walk > 0 {
+			dst = g.randomWalk(uint32(src), walk)
+		} else {
+			dst = g.randomNode(g.in)
+		}
+		if dst < 0 || dst == src {
+			continue
+		}
+
+		d, err := g.Difficulty(g.titles[src], g.titles[dst])
+		if err != nil {
+			continue
+		}
+		if d.Tier == tier {
+			return d, nil
+		}
+		if !found || math.Abs(d.Score-want) < math.Abs(best.Score-want) {
+			best, found = d, true
+		}
+	}
+	if !found {
+		return Difficulty{}, ErrNoPath
+	}
+	return best, nil
+}
+
+// randomNode picks a node with at least one neighbour in adj, or -1
+func (g *Graph) randomNode(adj adjacency) int {
+	if len(g.titles) == 0 {
+		return -1
+	}
+	for i := 0; i < 100; i++ {
+		id := uint32(rand.Intn(len(g.titles)))
+		if adj.degree(id) > 0 {
+			return int(id)
+		}
+	}
+	return -1
+}
+
+// randomWalk follows up to steps random links from id, stopping early at
+// dead ends, and returns where it ended
+func (g *Graph) randomWalk(id uint32, steps int) int {
+	for i := 0; i < steps; i++ {
+		n := g.out.degree(id)
+		if n == 0 {
+			break
+		}
+		pick := rand.Intn(n)
+		g.out.neighbors(id, func(next uint32) bool {
+			if pick == 0 {
+				id = next
+				return false
+			}
+			pick--
+			return true
+		})
+	}
+	return int(id)
+}
+
+// degree counts a node's neighbours. Every uvarint ends with the one byte
+// that has the high bit clear, so counting those avoids decoding.
+func (a adjacency) degree(id uint32) int {
+	n := 0
+	for _, b := range a.data[a.offsets[id]:a.offsets[id+1]] {
+		if b < 0x80 {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,199 @@
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// openDump opens a dump file, decompressing .gz files on the fly
+func openDump(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+// scanDump reads a MySQL table dump and calls fn with the named columns of
+// every row, in the order asked for. Column positions come from the dump's
+// CREATE TABLE statement, so it copes with schema changes between dumps.
+func scanDump(path string, columns []string, fn func(values []string) error) error {
+	rc, err := openDump(path)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	r := bufio.NewReaderSize(rc, 4<<20)
+	var header []string
+	var wanted []int // output slot per table column, or -1
+	values := make([]string, len(columns))
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			switch {
+			case bytes.HasPrefix(line, []byte("CREATE TABLE")):
+				header = header[:0]
+				wanted = nil
+			case wanted == nil && bytes.HasPrefix(line, []byte("  `")):
+				name := line[3:]
+				if end := bytes.IndexByte(name, '`'); end >= 0 {
+					header = append(header, string(name[:end]))
+				}
+			case bytes.HasPrefix(line, []byte("INSERT INTO ")):
+				if wanted == nil {
+					slots, err := columnSlots(header, columns)
+					if err != nil {
+						return fmt.Errorf("%s: %w", path, err)
+					}
+					wanted = slots
+				}
+				if err := parseInsert(line, wanted, values, fn); err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// columnSlots maps each table column to its position in the requested list
+func columnSlots(header, columns []string) ([]int, error) {
+	slots := make([]int, len(header))
+	for i := range slots {
+		slots[i] = -1
+	}
+	for j, col := range columns {
+		found := false
+		for i, name := range header {
+			if name == col {
+				slots[i] = j
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("dump has no column %q", col)
+		}
+	}
+	return slots, nil
+}
+
+// parseInsert walks the value tuples of one extended INSERT statement
+func parseInsert(line []byte, slots []int, values []string, fn func([]string) error) error {
+	i := bytes.Index(line, []byte(" VALUES "))
+	if i < 0 {
+		return fmt.Errorf("malformed INSERT")
+	}
+	i += len(" VALUES ")
+
+	for i < len(line) && line[i] == '(' {
+		i++
+		for col := 0; ; col++ {
+			var value string
+			var err error
+			value, i, err = parseValue(line, i, col < len(slots) && slots[col] >= 0)
+			if err != nil {
+				return err
+			}
+			if col < len(slots) && slots[col] >= 0 {
+				values[slots[col]] = value
+			}
+			if i >= len(line) {
+				return fmt.Errorf("truncated INSERT")
+			}
+			if line[i] == ')' {
+				i++
+				break
+			}
+			i++ // comma
+		}
+		if err := fn(values); err != nil {
+			return err
+		}
+		if i < len(line) && line[i] == ',' {
+			i++
+		}
+	}
+	return nil
+}
+
+// parseValue reads one SQL literal starting at i and returns it along
+// with the index of the following comma or closing paren. Values that
+// aren't needed are skipped without allocating.
+func parseValue(line []byte, i int, keep bool) (string, int, error) {
+	if i < len(line) && line[i] == '\'' {
+		i++
+		var sb strings.Builder
+		for i < len(line) {
+			c := line[i]
+			switch c {
+			case '\\':
+				if i+1 >= len(line) {
+					return "", i, fmt.Errorf("truncated escape")
+				}
+				i++
+				if keep {
+					sb.WriteByte(unescape(line[i]))
+				}
+			case '\'':
+				return sb.String(), i + 1, nil
+			default:
+				if keep {
+					sb.WriteByte(c)
+				}
+			}
+			i++
+		}
+		return "", i, fmt.Errorf("unterminated string")
+	}
+
+	start := i
+	for i < len(line) && line[i] != ',' && line[i] != ')' {
+		i++
+	}
+	value := ""
+	if keep {
+		if value = string(line[start:i]); value == "NULL" {
+			value = ""
+		}
+	}
+	return value, i, nil
+}
+
+func unescape(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case '0':
+		return 0
+	case 'Z':
+		return 0x1a
+	}
+	return c
+}
@@ -0,0 +1,176 @@
+package graph
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+// magic starts every index file; the last byte is the format version.
+// Version 2 added the language code after the header; version 1 files are
+// English.
+const magic = "WRGRAPH\x02"
+
+// maxTitleBytes guards against corrupt length prefixes when loading
+const maxTitleBytes = 1024
+
+// Load reads an index written by WriteFile
+func Load(path string) (*Graph, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, 1<<20)
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	last := len(magic) - 1
+	if string(header[:last]) != magic[:last] {
+		return nil, errors.New("graph: not a link graph index")
+	}
+	version := header[last]
+	if version == 0 || version > magic[last] {
+		return nil, fmt.Errorf("graph: unsupported index version %d", version)
+	}
+
+	g := &Graph{lang: wiki.DefaultLanguage}
+	if version >= 2 {
+		if g.lang, err = readString(r); err != nil {
+			return nil, err
+		}
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	g.titles = make([]string, n)
+	for i := range g.titles {
+		if g.titles[i], err = readString(r); err != nil {
+			return nil, err
+		}
+	}
+
+	nr, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	g.redirects = make([]redirect, nr)
+	for i := range g.redirects {
+		if g.redirects[i].title, err = readString(r); err != nil {
+			return nil, err
+		}
+		target, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if target >= n {
+			return nil, fmt.Errorf("graph: redirect %q points past the last article", g.redirects[i].title)
+		}
+		g.redirects[i].target = uint32(target)
+	}
+
+	links, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	g.links = int(links)
+	if g.out, err = readAdjacency(r, int(n)); err != nil {
+		return nil, err
+	}
+	if g.in, err = readAdjacency(r, int(n)); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// WriteFile saves the graph as an index, replacing path atomically
+func (g *Graph) WriteFile(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	w := bufio.NewWriterSize(f, 1<<20)
+	w.WriteString(magic)
+	writeString(w, g.Language())
+	writeUvarint(w, uint64(len(g.titles)))
+	for _, t := range g.titles {
+		writeString(w, t)
+	}
+	writeUvarint(w, uint64(len(g.redirects)))
+	for _, rd := range g.redirects {
+		writeString(w, rd.title)
+		writeUvarint(w, uint64(rd.target))
+	}
+	writeUvarint(w, uint64(g.links))
+	writeAdjacency(w, g.out)
+	writeAdjacency(w, g.in)
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readAdjacency reads per-node byte lengths followed by the encoded lists
+func readAdjacency(r *bufio.Reader, n int) (adjacency, error) {
+	a := adjacency{offsets: make([]uint64, n+1)}
+	for i := 0; i < n; i++ {
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return adjacency{}, err
+		}
+		a.offsets[i+1] = a.offsets[i] + size
+	}
+	a.data = make([]byte, a.offsets[n])
+	if _, err := io.ReadFull(r, a.data); err != nil {
+		return adjacency{}, err
+	}
+	return a, nil
+}
+
+func writeAdjacency(w *bufio.Writer, a adjacency) {
+	for i := 0; i+1 < len(a.offsets); i++ {
+		writeUvarint(w, a.offsets[i+1]-a.offsets[i])
+	}
+	w.Write(a.data)
+}
+
+func readString(r *bufio.Reader) (string, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	if size > maxTitleBytes {
+		return "", errors.New("graph: corrupt title length")
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func writeString(w *bufio.Writer, s string) {
+	writeUvarint(w, uint64(len(s)))
+	w.WriteString(s)
+}
+
+func writeUvarint(w *bufio.Writer, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
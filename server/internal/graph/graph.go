@@ -0,0 +1,232 @@
+// Package graph holds an offline copy of Wikipedia's article link graph,
+// built from the SQL dumps by cmd/graphimport, so links can be checked and
+// routes planned without calling the public API.
+package graph
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+// maxPathVisits bounds how many articles one path search may visit
+const maxPathVisits = 2000000
+
+var (
+	// ErrUnknownArticle is returned for titles missing from the index
+	ErrUnknownArticle = errors.New("article not in link graph")
+	// ErrNoPath is returned when no route is found within the search budget
+	ErrNoPath = errors.New("no path found")
+)
+
+// Graph is a read-only article link graph. Node IDs index the sorted title
+// list, and redirects resolve to the node they point at.
+type Graph struct {
+	lang      string // Wikipedia edition the dumps came from
+	titles    []string
+	redirects []redirect // sorted by title
+	out       adjacency  // links from each article
+	in        adjacency  // links to each article
+	links     int
+}
+
+type redirect struct {
+	title  string
+	target uint32
+}
+
+// adjacency stores each node's neighbours as ascending IDs, delta encoded
+// as uvarints, so the full English graph fits in a few gigabytes
+type adjacency struct {
+	offsets []uint64 // len(titles)+1 byte offsets into data
+	data    []byte
+}
+
+// neighbors calls fn with each neighbour of id until fn returns false
+func (a adjacency) neighbors(id uint32, fn func(uint32) bool) {
+	data := a.data[a.offsets[id]:a.offsets[id+1]]
+	var prev uint64
+	for len(data) > 0 {
+		delta, n := binary.Uvarint(data)
+		data = data[n:]
+		prev += delta
+		if !fn(uint32(prev)) {
+			return
+		}
+	}
+}
+
+// Language returns the code of the Wikipedia edition the graph was built
+// from
+func (g *Graph) Language() string {
+	if g.lang == "" {
+		return wiki.DefaultLanguage
+	}
+	return g.lang
+}
+
+// Articles returns how many articles the graph holds
+func (g *Graph) Articles() int {
+	return len(g.titles)
+}
+
+// LinkCount returns how many article-to-article links the graph holds
+func (g *Graph) LinkCount() int {
+	return g.links
+}
+
+// Lookup returns the node for a title, following redirects
+func (g *Graph) Lookup(title string) (uint32, bool) {
+	title = wiki.NormalizeTitleIn(g.Language(), title)
+	if i := sort.SearchStrings(g.titles, title); i < len(g.titles) && g.titles[i] == title {
+		return uint32(i), true
+	}
+	i := sort.Search(len(g.redirects), func(i int) bool {
+		return g.redirects[i].title >= title
+	})
+	if i < len(g.redirects) && g.redirects[i].title == title {
+		return g.redirects[i].target, true
+	}
+	return 0, false
+}
+
+// Title returns the canonical title of a node
+func (g *Graph) Title(id uint32) string {
+	return g.titles[id]
+}
+
+// Canonical resolves a title through redirects, reporting whether the
+// graph knows it
+func (g *Graph) Canonical(title string) (string, bool) {
+	id, ok := g.Lookup(title)
+	if !ok {
+		return "", false
+	}
+	return g.titles[id], true
+}
+
+// Links returns the articles a page links to
+func (g *Graph) Links(title string) ([]string, error) {
+	id, ok := g.Lookup(title)
+	if !ok {
+		return nil, ErrUnknownArticle
+	}
+	var titles []string
+	g.out.neighbors(id, func(n uint32) bool {
+		titles = append(titles, g.titles[n])
+		return true
+	})
+	return titles, nil
+}
+
+// LinksHere returns the articles that link to a page
+func (g *Graph) LinksHere(title string) ([]string, error) {
+	id, ok := g.Lookup(title)
+	if !ok {
+		return nil, ErrUnknownArticle
+	}
+	var titles []string
+	g.in.neighbors(id, func(n uint32) bool {
+		titles = append(titles, g.titles[n])
+		return true
+	})
+	return titles, nil
+}
+
+// Linked reports whether from links directly to to. Titles the graph
+// doesn't know count as linked, since the dump may predate new articles.
+func (g *Graph) Linked(from, to string) bool {
+	src, ok := g.Lookup(from)
+	if !ok {
+		return true
+	}
+	dst, ok := g.Lookup(to)
+	if !ok {
+		return true
+	}
+	found := false
+	g.out.neighbors(src, func(n uint32) bool {
+		if n >= dst {
+			found = n == dst
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// ShortestPath finds a shortest chain of links between two articles with a
+// bidirectional breadth-first search, always expanding the smaller
+// frontier. The result includes both endpoints.
+func (g *Graph) ShortestPath(from, to string) ([]string, error) {
+	src, ok := g.Lookup(from)
+	if !ok {
+		return nil, ErrUnknownArticle
+	}
+	dst, ok := g.Lookup(to)
+	if !ok {
+		return nil, ErrUnknownArticle
+	}
+	if src == dst {
+		return []string{g.titles[src]}, nil
+	}
+
+	// Each side maps a visited node to the node it was reached from
+	const root = ^uint32(0)
+	forward := map[uint32]uint32{src: root}
+	backward := map[uint32]uint32{dst: root}
+	forwardFrontier := []uint32{src}
+	backwardFrontier := []uint32{dst}
+
+	for len(forwardFrontier) > 0 && len(backwardFrontier) > 0 {
+		expandForward := len(forwardFrontier) <= len(backwardFrontier)
+		frontier, seen, other, adj := backwardFrontier, backward, forward, g.in
+		if expandForward {
+			frontier, seen, other, adj = forwardFrontier, forward, backward, g.out
+		}
+
+		var next []uint32
+		meet, met := uint32(0), false
+		for _, id := range frontier {
+			adj.neighbors(id, func(n uint32) bool {
+				if _, ok := seen[n]; ok {
+					return true
+				}
+				seen[n] = id
+				if _, ok := other[n]; ok {
+					meet, met = n, true
+					return false
+				}
+				next = append(next, n)
+				return true
+			})
+			if met {
+				return g.joinPath(forward, backward, meet, root), nil
+			}
+			if len(forward)+len(backward) > maxPathVisits {
+				return nil, ErrNoPath
+			}
+		}
+
+		if expandForward {
+			forwardFrontier = next
+		} else {
+			backwardFrontier = next
+		}
+	}
+	return nil, ErrNoPath
+}
+
+// joinPath stitches the two search trees together at the meeting node
+func (g *Graph) joinPath(forward, backward map[uint32]uint32, meet, root uint32) []string {
+	var path []string
+	for id := meet; id != root; id = forward[id] {
+		path = append([]string{g.titles[id]}, path...)
+	}
+	for id := backward[meet]; id != root; id = backward[id] {
+		path = append(path, g.titles[id])
+	}
+	return path
+}
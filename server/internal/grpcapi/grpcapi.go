@@ -0,0 +1,123 @@
+// Package grpcapi serves the game protocol over gRPC, see
+// proto/wikirace/v1/game.proto. Messages keep the WebSocket's JSON
+// envelopes, wrapped in google.protobuf.BytesValue, so no generated code
+// is needed on either side.
+package grpcapi
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/auth"
+	"github.com/markotsymbaluk/wiki-racing/internal/hub"
+)
+
+// MaxMessageSize matches the WebSocket read limit
+const MaxMessageSize = 512 * 1024
+
+// GameServer is the Game service
+type GameServer interface {
+	Play(grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "wikirace.v1.Game",
+	HandlerType: (*GameServer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Play",
+		Handler:       playHandler,
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+	Metadata: "wikirace/v1/game.proto",
+}
+
+// Register adds the Game service on s, backed by h
+func Register(s *grpc.Server, h *hub.Hub) {
+	s.RegisterService(&serviceDesc, &server{hub: h})
+}
+
+type server struct {
+	hub *hub.Hub
+}
+
+func playHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GameServer).Play(stream)
+}
+
+// Play runs one player connection for the life of the stream
+func (s *server) Play(stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	err := hub.ServeStream(ctx, s.hub, conn{stream}, identify(stream))
+
+	var closed *hub.StreamClosed
+	switch {
+	case errors.Is(err, hub.ErrDraining):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.As(err, &closed):
+		return status.Error(codeFor(closed.Code), closed.Reason)
+	case ctx.Err() != nil:
+		return status.FromContextError(ctx.Err()).Err()
+	default:
+		// The client closed its side, or the hub dropped the client
+		return nil
+	}
+}
+
+// identify reads the caller's address and credentials from the stream
+func identify(stream grpc.ServerStream) hub.StreamIdentity {
+	var who hub.StreamIdentity
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		who.Addr = p.Addr.String()
+		if host, _, err := net.SplitHostPort(who.Addr); err == nil {
+			who.Addr = host
+		}
+	}
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	if v := md.Get("authorization"); len(v) > 0 {
+		who.Token = strings.TrimPrefix(v[0], "Bearer ")
+	}
+	if v := md.Get(strings.ToLower(auth.GuestHeader)); len(v) > 0 {
+		who.GuestIdentity = v[0]
+	}
+	return who
+}
+
+// codeFor maps the WebSocket close codes the hub uses to gRPC codes
+func codeFor(closeCode int) codes.Code {
+	switch closeCode {
+	case hub.CloseBanned, hub.CloseKicked:
+		return codes.PermissionDenied
+	case hub.CloseRateLimited, hub.CloseSlowClient:
+		return codes.ResourceExhausted
+	case hub.CloseUnsupportedProtocol:
+		return codes.FailedPrecondition
+	default:
+		return codes.Aborted
+	}
+}
+
+// conn adapts a Play stream to hub.StreamConn
+type conn struct {
+	stream grpc.ServerStream
+}
+
+func (c conn) Recv() ([]byte, error) {
+	var frame wrapperspb.BytesValue
+	if err := c.stream.RecvMsg(&frame); err != nil {
+		return nil, err
+	}
+	return frame.Value, nil
+}
+
+func (c conn) Send(data []byte) error {
+	return c.stream.SendMsg(wrapperspb.Bytes(data))
+}
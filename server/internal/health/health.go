@@ -0,0 +1,131 @@
+// Package health serves liveness and readiness probes for orchestrators.
+// Liveness only says the process is serving HTTP; readiness runs every
+// dependency check and fails if any does, so traffic is held back from
+// instances that can't run races.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds each check so a hung dependency fails readiness
+// instead of hanging the probe
+const checkTimeout = 3 * time.Second
+
+// Check is one dependency of readiness
+type Check struct {
+	Name string
+	Run  func(context.Context) error
+	// CacheFor reuses a result this long, for checks that call out to
+	// services that shouldn't see every probe
+	CacheFor time.Duration
+}
+
+// Result is a check's outcome in the readiness response
+type Result struct {
+	Status    string    `json:"status"` // "ok" or "fail"
+	Error     string    `json:"error,omitempty"`
+	LatencyMs int64     `json:"latencyMs"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Checker runs the checks for the readiness probe
+type Checker struct {
+	checks  []Check
+	started time.Time
+
+	mu     sync.Mutex
+	cached map[string]Result
+}
+
+// New creates a checker for checks
+func New(checks ...Check) *Checker {
+	return &Checker{
+		checks:  checks,
+		started: time.Now(),
+		cached:  make(map[string]Result),
+	}
+}
+
+// Live serves the liveness probe, which passes whenever the server can
+// answer at all
+func (c *Checker) Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":        "ok",
+		"uptimeSeconds": int64(time.Since(c.started).Seconds()),
+	})
+}
+
+// Ready serves the readiness probe: 200 when every check passes and 503
+// otherwise, with each check's result either way
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request) {
+	results := make(map[string]Result, len(c.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			res := c.run(r.Context(), check)
+			mu.Lock()
+			results[check.Name] = res
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	for _, res := range results {
+		if res.Status != "ok" {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, code, map[string]interface{}{
+		"status": status,
+		"checks": results,
+	})
+}
+
+// run runs one check, or returns its cached result if still fresh
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	if check.CacheFor > 0 {
+		c.mu.Lock()
+		res, ok := c.cached[check.Name]
+		c.mu.Unlock()
+		if ok && time.Since(res.CheckedAt) < check.CacheFor {
+			return res
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	start := time.Now()
+	err := check.Run(ctx)
+	res := Result{
+		Status:    "ok",
+		LatencyMs: time.Since(start).Milliseconds(),
+		CheckedAt: start.UTC(),
+	}
+	if err != nil {
+		res.Status = "fail"
+		res.Error = err.Error()
+	}
+
+	if check.CacheFor > 0 {
+		c.mu.Lock()
+		c.cached[check.Name] = res
+		c.mu.Unlock()
+	}
+	return res
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,145 @@
+package hub
+
+import (
+	"encoding/json"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// roomMailboxSize is how many commands may queue for a room before
+// senders wait
+const roomMailboxSize = 256
+
+// roomHandler handles a message sent to the sender's room. It runs on the
+// room's goroutine, so commands for one room apply one at a time in the
+// order they arrived.
+type roomHandler func(h *Hub, room *Room, client *Client, payload json.RawMessage)
+
+// roomPreparer does the slow part of a room command, such as Wikipedia
+// lookups, on the sender's goroutine so it doesn't hold up the room. It
+// returns the part that changes the room, to run on the room's goroutine,
+// or nil if the command was rejected.
+type roomPreparer func(h *Hub, room *Room, client *Client, payload json.RawMessage) func()
+
+var roomHandlers = map[string]roomHandler{
+	MsgTypeLeaveRoom: func(h *Hub, room *Room, client *Client, _ json.RawMessage) {
+		h.removeClientFromRoom(room, client)
+	},
+	MsgTypeFinish:      (*Hub).handleFinish,
+	MsgTypeSetReady:    (*Hub).handleSetReady,
+	MsgTypeSetTeam:     (*Hub).handleSetTeam,
+	MsgTypeAddBot:      (*Hub).handleAddBot,
+	MsgTypeRemoveBot:   (*Hub).handleRemoveBot,
+	MsgTypeUsePowerUp:  (*Hub).handleUsePowerUp,
+	MsgTypeSetHandicap: (*Hub).handleSetHandicap,
+	MsgTypeKickPlayer:  (*Hub).handleKickPlayer,
+	MsgTypePauseRace: func(h *Hub, room *Room, client *Client, _ json.RawMessage) {
+		h.handlePauseRace(room, client)
+	},
+	MsgTypeResumeRace: func(h *Hub, room *Room, client *Client, _ json.RawMessage) {
+		h.handleResumeRace(room, client)
+	},
+	MsgTypeForfeit: func(h *Hub, room *Room, client *Client, _ json.RawMessage) {
+		h.handleForfeit(room, client)
+	},
+	MsgTypeRequestSync: func(h *Hub, room *Room, client *Client, payload json.RawMessage) {
+		h.handleRequestSync(room, client, payload)
+	},
+	MsgTypeRequestJoin: func(h *Hub, room *Room, client *Client, _ json.RawMessage) {
+		h.handleRequestJoinRace(room, client)
+	},
+	MsgTypeApproveJoin:   (*Hub).handleApproveJoinRace,
+	MsgTypeSetAppearance: (*Hub).handleSetAppearance,
+	MsgTypeVote:          (*Hub).handleVote,
+	MsgTypeBanPair:       (*Hub).handleBanPair,
+	MsgTypeStartSeries:   (*Hub).handleStartSeries,
+}
+
+var roomPreparers = map[string]roomPreparer{
+	MsgTypeUpdateRoom: (*Hub).prepareUpdateRoom,
+	MsgTypeStartRace:  (*Hub).prepareStartRace,
+	MsgTypeNavigate:   (*Hub).prepareNavigate,
+	MsgTypeRematch:    (*Hub).prepareRematch,
+	MsgTypeStartVote:  (*Hub).prepareStartVote,
+}
+
+// quietWithoutRoom are room messages dropped without an error when the
+// sender isn't in a room, since clients send them on their own schedule
+var quietWithoutRoom = map[string]bool{
+	MsgTypeLeaveRoom: true,
+	MsgTypeNavigate:  true,
+	MsgTypeFinish:    true,
+	MsgTypeForfeit:   true,
+}
+
+// routeToRoom hands a room message to the sender's room, reporting false
+// for messages the hub handles itself
+func (h *Hub) routeToRoom(client *Client, msg Message, span trace.Span) bool {
+	handle, isHandler := roomHandlers[msg.Type]
+	prepare, isPreparer := roomPreparers[msg.Type]
+	if !isHandler && !isPreparer {
+		return false
+	}
+
+	room := client.currentRoom()
+	if room == nil {
+		span.End()
+		if !quietWithoutRoom[msg.Type] {
+			client.sendError(CodeRoomNotFound, "Room not found")
+		}
+		return true
+	}
+	if isPreparer {
+		if apply := prepare(h, room, client, msg.Payload); apply != nil {
+			room.post(room.traced(span, apply))
+		} else {
+			span.End()
+		}
+		return true
+	}
+	room.post(room.traced(span, func() { handle(h, room, client, msg.Payload) }))
+	return true
+}
+
+// post queues fn to run on the room's goroutine after everything posted
+// before it. It waits while the mailbox is full and drops fn once the room
+// has closed.
+func (r *Room) post(fn func()) {
+	select {
+	case r.mailbox <- fn:
+	case <-r.done:
+	}
+}
+
+// runMailbox is the room's actor loop. Commands run one at a time; they
+// still take room.mu because timers, bots and admin reads share the
+// room's state.
+func (r *Room) runMailbox() {
+	for {
+		select {
+		case fn := <-r.mailbox:
+			fn()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// currentRoom returns the room the client is in, if any
+func (c *Client) currentRoom() *Room {
+	return c.room.Load()
+}
+
+// currentRoomID returns the ID of the room the client is in, or ""
+func (c *Client) currentRoomID() string {
+	if room := c.currentRoom(); room != nil {
+		return room.ID
+	}
+	return ""
+}
+
+// leftRoom clears the client's room if it is still room, so a late leave
+// from an old room doesn't undo joining a new one
+func (c *Client) leftRoom(room *Room) {
+	c.room.CompareAndSwap(room, nil)
+}
@@ -0,0 +1,111 @@
+package hub
+
+import (
+	"errors"
+	"log"
+)
+
+// ErrClientNotFound is returned when an operator targets a connection
+// that has already gone away
+var ErrClientNotFound = errors.New("client not found")
+
+// RoomStatus is a room snapshot plus the live state operators need
+type RoomStatus struct {
+	RoomSnapshot
+	Ended     bool  `json:"ended"`
+	Paused    bool  `json:"paused"`
+	ElapsedMs int64 `json:"elapsedMs"`
+	Connected int   `json:"connected"` // players with an open connection
+}
+
+// ClientInfo describes one open connection
+type ClientInfo struct {
+	ID          string    `json:"id"`
+	Addr        string    `json:"addr"`
+	RoomID      string    `json:"roomId,omitempty"`
+	AccountID   string    `json:"accountId,omitempty"`
+	AccountName string    `json:"accountName,omitempty"`
+	GuestID     string    `json:"guestId,omitempty"`
+	Encoding    string    `json:"encoding"`
+	Features    []Feature `json:"features"`
+	Browsing    bool      `json:"browsing"`
+	Queued      int       `json:"queued"` // messages waiting in the send queue
+	Drops       int32     `json:"drops"`  // consecutive messages dropped
+}
+
+// RoomStatuses returns the live state of every room, including private ones
+func (h *Hub) RoomStatuses() []RoomStatus {
+	rooms := h.rooms.all()
+	statuses := make([]RoomStatus, 0, len(rooms))
+	for _, room := range rooms {
+		room.mu.RLock()
+		status := RoomStatus{
+			RoomSnapshot: room.snapshot(),
+			Ended:        room.Ended,
+			Paused:       room.Paused,
+			ElapsedMs:    room.elapsed(),
+		}
+		for _, p := range room.Players {
+			if p.client != nil {
+				status.Connected++
+			}
+		}
+		room.mu.RUnlock()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Clients lists every open connection
+func (h *Hub) Clients() []ClientInfo {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	h.browseMu.Lock()
+	defer h.browseMu.Unlock()
+
+	clients := make([]ClientInfo, 0, len(h.clients))
+	for c := range h.clients {
+		info := ClientInfo{
+			ID:          c.id,
+			Addr:        c.addr,
+			RoomID:      c.currentRoomID(),
+			AccountID:   c.accountID,
+			AccountName: c.accountName,
+			GuestID:     c.guestID,
+			Encoding:    "json",
+			Features:    c.featureNames(),
+			Browsing:    h.browsers[c],
+			Queued:      len(c.send),
+			Drops:       c.drops.Load(),
+		}
+		if c.encoding == encodingMsgpack {
+			info.Encoding = subprotocolMsgpack
+		}
+		clients = append(clients, info)
+	}
+	return clients
+}
+
+// Kick closes a client's connection with CloseKicked. Its player leaves
+// their room the same way as on any other disconnect.
+func (h *Hub) Kick(clientID, reason string) error {
+	h.mu.RLock()
+	var target *Client
+	for c := range h.clients {
+		if c.id == clientID {
+			target = c
+			break
+		}
+	}
+	h.mu.RUnlock()
+
+	if target == nil {
+		return ErrClientNotFound
+	}
+	if reason == "" {
+		reason = "kicked by an operator"
+	}
+	log.Printf("Kicking client %s: %s", clientID, reason)
+	go target.disconnect(CloseKicked, reason)
+	return nil
+}
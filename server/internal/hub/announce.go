@@ -0,0 +1,101 @@
+package hub
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// Severity tells clients how prominently to show an announcement
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"  // e.g. an upcoming restart
+	SeverityCritical Severity = "critical" // e.g. a restart happening now
+)
+
+// ErrInvalidSeverity is returned for unknown announcement severities
+var ErrInvalidSeverity = errors.New("severity must be info, warning or critical")
+
+// Announcement is an operator message shown to players
+type Announcement struct {
+	Message  string   `json:"message"`
+	Severity Severity `json:"severity,omitempty"` // info if empty
+	// Pinned announcements are also sent to every client that connects
+	// later, until replaced or cleared
+	Pinned bool `json:"pinned,omitempty"`
+}
+
+func (a Announcement) message() Message {
+	return Message{
+		Type: MsgTypeAnnouncement,
+		Payload: mustMarshal(map[string]interface{}{
+			"message":  a.Message,
+			"severity": a.Severity,
+			"pinned":   a.Pinned,
+			"sentAt":   time.Now().UnixMilli(),
+		}),
+	}
+}
+
+// parseSeverity validates a severity, defaulting to info
+func parseSeverity(s Severity) (Severity, bool) {
+	switch s {
+	case "":
+		return SeverityInfo, true
+	case SeverityInfo, SeverityWarning, SeverityCritical:
+		return s, true
+	}
+	return "", false
+}
+
+// Announce sends an announcement to every connected client, or only to
+// the players in roomID when it is set. Pinned announcements can't target
+// a room.
+func (h *Hub) Announce(roomID string, a Announcement) error {
+	severity, ok := parseSeverity(a.Severity)
+	if !ok {
+		return ErrInvalidSeverity
+	}
+	a.Severity = severity
+	msg := a.message()
+
+	if roomID != "" {
+		room, exists := h.rooms.get(roomID)
+		if !exists {
+			return ErrRoomNotFound
+		}
+		h.broadcastToRoom(room, msg, nil)
+		log.Printf("Announcement (%s) to room %s: %s", a.Severity, roomID, a.Message)
+		return nil
+	}
+	log.Printf("Announcement (%s) to all clients: %s", a.Severity, a.Message)
+
+	f := newFrames(msg)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if a.Pinned {
+		h.pinned = &a
+	}
+	for client := range h.clients {
+		client.sendFrames(f)
+	}
+	return nil
+}
+
+// ClearAnnouncement unpins the current announcement, if any
+func (h *Hub) ClearAnnouncement() {
+	h.mu.Lock()
+	h.pinned = nil
+	h.mu.Unlock()
+}
+
+// sendPinned sends the pinned announcement to a newly connected client.
+// Caller must hold h.mu.
+func (h *Hub) sendPinned(client *Client) {
+	if h.pinned != nil {
+		client.sendMessage(h.pinned.message())
+	}
+}
@@ -0,0 +1,80 @@
+package hub
+
+import (
+	"encoding/json"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	colorPattern  = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+	avatarPattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+)
+
+// maxEmojiRunes allows ZWJ sequences like families and flags with modifiers
+const maxEmojiRunes = 10
+
+// Appearance is how the UI draws a racer, picked by the client. Each
+// field is optional: Color is a #rrggbb hex color, Avatar the ID of one
+// of the client's avatars, and Emoji a single emoji.
+type Appearance struct {
+	Color  string `json:"color,omitempty"`
+	Avatar string `json:"avatar,omitempty"`
+	Emoji  string `json:"emoji,omitempty"`
+}
+
+// valid reports whether every field that is set is well formed
+func (a Appearance) valid() bool {
+	return (a.Color == "" || colorPattern.MatchString(a.Color)) &&
+		(a.Avatar == "" || avatarPattern.MatchString(a.Avatar)) &&
+		(a.Emoji == "" || isEmoji(a.Emoji))
+}
+
+// isEmoji accepts symbols plus the joiners, selectors and modifiers that
+// combine them, so text can't be smuggled in as an emoji
+func isEmoji(s string) bool {
+	if utf8.RuneCountInString(s) > maxEmojiRunes {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.So, unicode.Sk):
+		case r == 0x200D, r == 0xFE0F, r == 0x20E3: // ZWJ, emoji presentation, keycap
+		case r >= 0xE0020 && r <= 0xE007F: // tags in subdivision flags
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// handleSetAppearance changes a player's appearance and tells the room
+func (h *Hub) handleSetAppearance(room *Room, client *Client, payload json.RawMessage) {
+	var p Appearance
+	if err := json.Unmarshal(payload, &p); err != nil {
+		client.sendError(CodeBadRequest, "Invalid appearance payload")
+		return
+	}
+	if !p.valid() {
+		client.sendError(CodeInvalidSettings, "Invalid color, avatar or emoji")
+		return
+	}
+
+	room.mu.Lock()
+	player, exists := room.Players[client.id]
+	if !exists {
+		room.mu.Unlock()
+		return
+	}
+	player.Appearance = p
+	room.mu.Unlock()
+
+	h.broadcastToRoom(room, Message{
+		Type: MsgTypeAppearance,
+		Payload: mustMarshal(struct {
+			PlayerID string `json:"playerId"`
+			Appearance
+		}{client.id, p}),
+	}, nil)
+}
@@ -0,0 +1,62 @@
+package hub
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// resyncAfterDrops consecutive dropped messages mark a client as out of
+	// sync; it is sent a state_resync snapshot once its queue drains
+	resyncAfterDrops = 16
+	// disconnectAfterDrops consecutive drops close the connection with
+	// CloseSlowClient so the client reconnects and rejoins from scratch
+	disconnectAfterDrops = 256
+)
+
+// recordSent resets the drop counter after a successful enqueue and sends
+// a pending resync once there is room for it
+func (c *Client) recordSent() {
+	c.drops.Store(0)
+	if len(c.send) < cap(c.send)/2 && c.needsResync.CompareAndSwap(true, false) {
+		go c.hub.resyncClient(c)
+	}
+}
+
+// recordDrop applies the backpressure policy after a message was dropped
+func (c *Client) recordDrop() {
+	switch c.drops.Add(1) {
+	case resyncAfterDrops:
+		log.Printf("Client %s is dropping messages, scheduling resync", c.id)
+		c.needsResync.Store(true)
+	case disconnectAfterDrops:
+		log.Printf("Client %s is too slow, disconnecting", c.id)
+		go c.disconnect(CloseSlowClient, "send queue overflow")
+	}
+}
+
+// disconnect closes the connection with a close code. readPump then fails
+// and unregisters the client as usual. Streams end with a StreamClosed
+// carrying the code instead.
+func (c *Client) disconnect(code int, reason string) {
+	if c.cancel != nil {
+		c.cancel(&StreamClosed{Code: code, Reason: reason})
+		return
+	}
+	msg := websocket.FormatCloseMessage(code, reason)
+	c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+	c.conn.Close()
+}
+
+// resyncClient sends the full room state to a client that missed updates
+func (h *Hub) resyncClient(c *Client) {
+	room := c.currentRoom()
+	if room == nil {
+		return
+	}
+
+	// What it missed is unknown, so it gets everything
+	h.queueResync(room, c, 0)
+}
@@ -0,0 +1,94 @@
+package hub
+
+import (
+	"encoding/json"
+	"log"
+)
+
+type KickPlayerPayload struct {
+	PlayerID string `json:"playerId"`
+	Ban      bool   `json:"ban,omitempty"` // also keep them from rejoining this room
+}
+
+// ban adds a player to the room's ban list, keyed like ratings: by
+// account, by the guest cookie that reconnects guests, or by name for
+// cookieless clients. Bans last as long as the room. Caller must hold
+// room.mu.
+func (r *Room) ban(p *Player) {
+	if r.banned == nil {
+		r.banned = make(map[string]bool)
+	}
+	r.banned[p.ratingKey()] = true
+}
+
+// isBanned reports whether a joining client is on the room's ban list.
+// Caller must hold room.mu.
+func (r *Room) isBanned(client *Client, name string) bool {
+	return r.banned[client.ratingKey(name)]
+}
+
+// handleKickPlayer lets the host remove a player, optionally banning them
+// from coming back. Players kicked mid-race are forfeited and their
+// connection detached so the standings still list them.
+func (h *Hub) handleKickPlayer(room *Room, client *Client, payload json.RawMessage) {
+	var p KickPlayerPayload
+	if err := json.Unmarshal(payload, &p); err != nil || p.PlayerID == "" {
+		client.sendError(CodeBadRequest, "Invalid kick_player payload")
+		return
+	}
+
+	if !isHost(room, client) {
+		client.sendError(CodeNotHost, "Only host can kick players")
+		return
+	}
+
+	room.mu.Lock()
+	player, exists := room.Players[p.PlayerID]
+	switch {
+	case !exists || player.virtual():
+		room.mu.Unlock()
+		client.sendError(CodeNotFound, "Player not found")
+		return
+	case player.ID == client.id:
+		room.mu.Unlock()
+		client.sendError(CodeNotAllowed, "You can't kick yourself")
+		return
+	}
+	if p.Ban {
+		room.ban(player)
+	}
+	target := player.client
+	player.client = nil
+	started := room.Started
+	if !started {
+		room.leaveTeam(player)
+		delete(room.Players, p.PlayerID)
+	}
+	name := player.Name
+	room.mu.Unlock()
+	if target != nil {
+		target.leftRoom(room)
+	}
+
+	log.Printf("Player %s kicked from room %s (banned: %t)", name, room.ID, p.Ban)
+
+	if target != nil {
+		target.sendMessage(Message{
+			Type: MsgTypeKicked,
+			Payload: mustMarshal(map[string]interface{}{
+				"roomId": room.ID,
+				"banned": p.Ban,
+			}),
+		})
+	}
+	if started {
+		h.forfeitPlayer(room, p.PlayerID, "kicked")
+		return
+	}
+	h.broadcastToRoom(room, Message{
+		Type: MsgTypePlayerLeft,
+		Payload: mustMarshal(map[string]string{
+			"playerId": p.PlayerID,
+		}),
+	}, nil)
+}
@@ -0,0 +1,117 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+)
+
+// benchRoom builds a hub with one room of players whose connections are
+// replaced by goroutines draining their send queues. delivered counts the
+// frames those goroutines have taken.
+func benchRoom(b *testing.B, players int) (h *Hub, room *Room, clients []*Client, delivered *atomic.Int64) {
+	b.Helper()
+	h = New(Options{MaxPlayers: players})
+	room, err := newRoom("BENCH", "", RoomOptions{StartArticle: "Cat", EndArticle: "Kevin Bacon"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := h.rooms.add(room, 0); err != nil {
+		b.Fatal(err)
+	}
+	delivered = new(atomic.Int64)
+	for i := 0; i < players; i++ {
+		c := &Client{hub: h, send: make(chan []byte, 256), id: fmt.Sprintf("player-%d", i)}
+		room.Players[c.id] = newPlayer(c, fmt.Sprintf("Player %d", i), room.StartArticle)
+		c.room.Store(room)
+		clients = append(clients, c)
+		go func() {
+			for range c.send {
+				delivered.Add(1)
+			}
+		}()
+	}
+	room.HostID = clients[0].id
+	b.Cleanup(func() {
+		room.stop()
+		for _, c := range clients {
+			c.close()
+		}
+	})
+	return h, room, clients, delivered
+}
+
+// waitDelivered spins until the drain goroutines have seen n frames
+func waitDelivered(delivered *atomic.Int64, n int64) {
+	for delivered.Load() < n {
+		runtime.Gosched()
+	}
+}
+
+// BenchmarkBroadcastToRoom measures a player_update reaching every player,
+// from queueing it to the last send queue taking it
+func BenchmarkBroadcastToRoom(b *testing.B) {
+	for _, players := range []int{8, 64, 256} {
+		b.Run(fmt.Sprintf("players=%d", players), func(b *testing.B) {
+			h, room, _, delivered := benchRoom(b, players)
+			msg := Message{
+				Type: MsgTypePlayerUpdate,
+				Payload: mustMarshal(map[string]interface{}{
+					"playerId":       "player-0",
+					"currentArticle": "Wolf",
+					"clicks":         3,
+				}),
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h.broadcastToRoom(room, msg, nil)
+				waitDelivered(delivered, int64(i+1)*int64(players))
+			}
+		})
+	}
+}
+
+// BenchmarkHandleMessage measures the hub's side of common race traffic.
+// Messages that change the room are timed until their broadcast reaches
+// every player, like BenchmarkBroadcastToRoom. Navigate skips the
+// Wikipedia lookups and measures applying the click.
+func BenchmarkHandleMessage(b *testing.B) {
+	b.Run("cursor", func(b *testing.B) {
+		h, _, clients, _ := benchRoom(b, 8)
+		msg := Message{Type: MsgTypeCursor, Payload: mustMarshal(CursorPayload{X: 120, Y: 480, Article: "Cat"})}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			h.HandleMessage(clients[i%len(clients)], msg)
+		}
+	})
+
+	b.Run("set_ready", func(b *testing.B) {
+		h, _, clients, delivered := benchRoom(b, 8)
+		payloads := []json.RawMessage{mustMarshal(SetReadyPayload{Ready: true}), mustMarshal(SetReadyPayload{Ready: false})}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			// Each client alternates so every message changes its state
+			client := clients[i%len(clients)]
+			h.HandleMessage(client, Message{Type: MsgTypeSetReady, Payload: payloads[(i/len(clients))%2]})
+			waitDelivered(delivered, int64(i+1)*int64(len(clients)))
+		}
+	})
+
+	b.Run("navigate", func(b *testing.B) {
+		h, room, clients, delivered := benchRoom(b, 8)
+		articles := []string{"Dog", "Wolf", "Mammal", "Animal"}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			client := clients[i%len(clients)]
+			p := NavigatePayload{Article: articles[i%len(articles)]}
+			room.post(func() { h.navigate(room, client, p, nil, nil, -1) })
+			waitDelivered(delivered, int64(i+1)*int64(len(clients)))
+		}
+	})
+}
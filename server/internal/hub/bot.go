@@ -0,0 +1,267 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BotDifficulty sets how quickly a bot clicks through its route
+type BotDifficulty string
+
+const (
+	BotEasy   BotDifficulty = "easy"
+	BotMedium BotDifficulty = "medium"
+	BotHard   BotDifficulty = "hard"
+)
+
+// botPace is the average time a bot spends on each article before
+// clicking on. Each click varies by up to a quarter either way.
+var botPace = map[BotDifficulty]time.Duration{
+	BotEasy:   15 * time.Second,
+	BotMedium: 9 * time.Second,
+	BotHard:   5 * time.Second,
+}
+
+// botRouteTimeout bounds the shortest-path search a bot runs at race start
+const botRouteTimeout = 30 * time.Second
+
+type AddBotPayload struct {
+	Difficulty string `json:"difficulty,omitempty"`
+}
+
+type RemoveBotPayload struct {
+	PlayerID string `json:"playerId"`
+}
+
+// parseDifficulty validates a requested difficulty, defaulting to medium
+func parseDifficulty(s string) (BotDifficulty, bool) {
+	if s == "" {
+		return BotMedium, true
+	}
+	_, ok := botPace[BotDifficulty(s)]
+	return BotDifficulty(s), ok
+}
+
+// handleAddBot seats a bot opponent in the host's room
+func (h *Hub) handleAddBot(room *Room, client *Client, payload json.RawMessage) {
+	var p AddBotPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		client.sendError(CodeBadRequest, "Invalid bot payload")
+		return
+	}
+	difficulty, ok := parseDifficulty(p.Difficulty)
+	if !ok {
+		client.sendError(CodeInvalidSettings, "Invalid bot difficulty")
+		return
+	}
+
+	if !isHost(room, client) {
+		client.sendError(CodeNotHost, "Only host can add bots")
+		return
+	}
+
+	room.mu.Lock()
+	switch {
+	case room.Started:
+		room.mu.Unlock()
+		client.sendError(CodeRaceStarted, "Cannot add bots after race has started")
+		return
+	case room.Config.Relay:
+		room.mu.Unlock()
+		client.sendError(CodeNotAllowed, "Bots can't join relay races")
+		return
+	case len(room.Players) >= h.maxPlayers:
+		room.mu.Unlock()
+		client.sendError(CodeRoomFull, "Room is full")
+		return
+	}
+	id := "bot:" + uuid.New().String()[:8]
+	bot := &Player{
+		ID:             id,
+		Name:           "Bot (" + string(difficulty) + ")",
+		CurrentArticle: room.StartArticle,
+		Path:           []string{room.StartArticle},
+		Ready:          true,
+		Bot:            true,
+		Difficulty:     difficulty,
+	}
+	room.Players[id] = bot
+	room.mu.Unlock()
+
+	h.broadcastToRoom(room, Message{
+		Type:    MsgTypePlayerJoined,
+		Payload: mustMarshal(bot),
+	}, nil)
+}
+
+// handleRemoveBot takes a bot back out of the host's room
+func (h *Hub) handleRemoveBot(room *Room, client *Client, payload json.RawMessage) {
+	var p RemoveBotPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		client.sendError(CodeBadRequest, "Invalid bot payload")
+		return
+	}
+
+	if !isHost(room, client) {
+		client.sendError(CodeNotHost, "Only host can remove bots")
+		return
+	}
+
+	room.mu.Lock()
+	bot, exists := room.Players[p.PlayerID]
+	if !exists || !bot.Bot || room.Started {
+		room.mu.Unlock()
+		return
+	}
+	delete(room.Players, p.PlayerID)
+	room.mu.Unlock()
+
+	h.broadcastToRoom(room, Message{
+		Type: MsgTypePlayerLeft,
+		Payload: mustMarshal(map[string]string{
+			"playerId": p.PlayerID,
+		}),
+	}, nil)
+}
+
+// runBot plans a shortest route through the room's checkpoints to the end
+// article, then clicks along it at the bot's pace. A bot that can't find
+// a route forfeits.
+func (h *Hub) runBot(room *Room, id string) {
+	room.mu.RLock()
+	bot, exists := room.Players[id]
+	if !exists {
+		room.mu.RUnlock()
+		return
+	}
+	pace := botPace[bot.Difficulty]
+	lang := room.Language
+	targets := append([]string{room.StartArticle}, room.Config.Checkpoints...)
+	targets = append(targets, room.EndArticle)
+	room.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), botRouteTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-room.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	route, err := h.botRoute(ctx, lang, targets)
+	if err != nil {
+		log.Printf("Bot %s in room %s found no route: %v", id, room.ID, err)
+		h.forfeitVirtual(room, id)
+		return
+	}
+
+	for i, article := range route[1:] {
+		jitter := time.Duration(rand.Int63n(int64(pace)/2)) - pace/4
+		room.mu.RLock()
+		at := room.elapsed() + (pace + jitter).Milliseconds()
+		room.mu.RUnlock()
+		if !h.waitRaceTime(room, at) {
+			return
+		}
+		// A frozen bot waits out the freeze like a player would
+		room.mu.RLock()
+		frozenFor := time.Until(bot.frozenUntil)
+		room.mu.RUnlock()
+		if frozenFor > 0 {
+			time.Sleep(frozenFor)
+		}
+		if !h.moveVirtual(room, id, article, i == len(route)-2) {
+			return
+		}
+	}
+}
+
+// botRoute joins shortest paths between consecutive targets into one route
+func (h *Hub) botRoute(ctx context.Context, lang string, targets []string) ([]string, error) {
+	route := []string{targets[0]}
+	for i := 1; i < len(targets); i++ {
+		leg, err := h.shortestPath(ctx, lang, targets[i-1], targets[i])
+		if err != nil {
+			return nil, err
+		}
+		route = append(route, leg[1:]...)
+	}
+	return route, nil
+}
+
+// forfeitVirtual drops a bot from the race
+func (h *Hub) forfeitVirtual(room *Room, id string) {
+	room.mu.Lock()
+	player, exists := room.Players[id]
+	if !exists || room.Ended || player.Finished || player.Forfeited {
+		room.mu.Unlock()
+		return
+	}
+	player.Forfeited = true
+	name := player.Name
+	room.mu.Unlock()
+
+	h.broadcastToRoom(room, Message{
+		Type: MsgTypePlayerForfeit,
+		Payload: mustMarshal(map[string]interface{}{
+			"playerId":   id,
+			"playerName": name,
+		}),
+	}, nil)
+}
+
+// moveVirtual advances a ghost or bot one article and broadcasts it like a
+// live navigate, finishing the player if this is their last step. It
+// reports false once the player should stop moving, including when they
+// run out of clicks; how far they were left isn't measured.
+func (h *Hub) moveVirtual(room *Room, id, article string, finish bool) bool {
+	room.mu.Lock()
+	player, exists := room.Players[id]
+	if !exists || room.Ended || player.Finished || player.Forfeited || player.OutOfClicks {
+		room.mu.Unlock()
+		return false
+	}
+	player.CurrentArticle = article
+	player.Clicks++
+	player.Path = append(player.Path, article)
+	var finishMsg *Message
+	out := false
+	if finish {
+		msg := room.markFinished(player)
+		finishMsg = &msg
+	} else {
+		out = room.spendBudget(player, -1)
+	}
+	update := room.progressMessage(player)
+	room.mu.Unlock()
+
+	h.broadcastToRoom(room, update, nil)
+	if finishMsg != nil {
+		h.broadcastToRoom(room, *finishMsg, nil)
+	}
+	return !out
+}
+
+// virtual reports whether the player is a ghost or bot rather than a
+// connected person
+func (p *Player) virtual() bool {
+	return p.Ghost || p.Bot
+}
+
+// botIDs lists the room's bots. Caller must hold room.mu.
+func (r *Room) botIDs() []string {
+	var ids []string
+	for id, p := range r.Players {
+		if p.Bot {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
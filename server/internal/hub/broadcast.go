@@ -0,0 +1,148 @@
+package hub
+
+import "go.opentelemetry.io/otel/trace"
+
+// roomBroadcastBuffer is how many broadcasts may queue before senders wait
+const roomBroadcastBuffer = 256
+
+type roomBroadcast struct {
+	msg     Message
+	exclude *Client
+	// cursors are a cursor_batch's entries, sent as separate
+	// cursor_update messages to clients without FeatureCursorBatch
+	cursors []CursorUpdate
+	// transient batches are superseded by the next one, so they aren't
+	// worth numbering or replaying
+	transient bool
+
+	// to sends msg to this client only, in order with the broadcasts.
+	// With resync set it carries no msg and catches the client up on
+	// everything after since instead.
+	to     *Client
+	resync bool
+	since  uint64
+
+	span trace.Span // from traceBroadcast, nil for untraced broadcasts
+}
+
+// broadcastToRoom queues msg for every connected player except exclude,
+// and the room's fan-out goroutine does the encoding and sending. It
+// doesn't take the room lock itself, but it waits once roomBroadcastBuffer
+// messages are queued and the fan-out needs the lock to drain them, so
+// callers holding room.mu rely on the buffer never filling. Paths that can
+// send in bursts broadcast after unlocking instead.
+func (h *Hub) broadcastToRoom(room *Room, msg Message, exclude *Client) {
+	room.events.add(EventOut, "", msg)
+	span := h.traceBroadcast(room, msg)
+	select {
+	case room.broadcasts <- roomBroadcast{msg: msg, exclude: exclude, span: span}:
+	case <-room.done:
+		// Room closed, nobody left to tell
+		span.End()
+	}
+}
+
+// runBroadcasts is the room's fan-out loop. Each message is encoded once
+// per wire format and handed to clients without blocking, so one slow
+// client can't stall the rest of the room.
+func (r *Room) runBroadcasts() {
+	for {
+		select {
+		case b := <-r.broadcasts:
+			r.deliver(b)
+		case <-r.done:
+			// Flush what was queued before the room closed, e.g. room_closed
+			for {
+				select {
+				case b := <-r.broadcasts:
+					r.deliver(b)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Room) deliver(b roomBroadcast) {
+	if b.to != nil {
+		r.deliverTo(b)
+		return
+	}
+	if !b.transient {
+		r.seq++
+		b.msg.Seq = r.seq
+		r.remember(b.msg)
+	}
+
+	f := newFrames(b.msg)
+	var updates []*frames
+	recipients := r.recipients(b.exclude)
+	if b.span != nil {
+		b.span.SetAttributes(attrRecipients.Int(len(recipients)))
+		defer b.span.End()
+	}
+	for _, client := range recipients {
+		if b.cursors == nil || client.has(FeatureCursorBatch) {
+			client.sendFrames(f)
+			continue
+		}
+		if updates == nil {
+			updates = make([]*frames, len(b.cursors))
+			for i, c := range b.cursors {
+				updates[i] = newFrames(Message{Type: MsgTypeCursorUpdate, Payload: mustMarshal(c)})
+			}
+		}
+		for i, c := range b.cursors {
+			if c.PlayerID != client.id {
+				client.sendFrames(updates[i])
+			}
+		}
+	}
+}
+
+// recipients lists the connected clients in the room, minus exclude
+func (r *Room) recipients(exclude *Client) []*Client {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clients := make([]*Client, 0, len(r.Players)+len(r.Spectators))
+	for _, player := range r.Players {
+		// Skip if player has no client (disconnected, waiting to rejoin)
+		if player.client != nil && player.client != exclude {
+			clients = append(clients, player.client)
+		}
+	}
+	for _, s := range r.Spectators {
+		if s.client != exclude {
+			clients = append(clients, s.client)
+		}
+	}
+	return clients
+}
+
+// stop shuts down the room's fan-out goroutine and race timer
+func (r *Room) stop() {
+	r.stopOnce.Do(func() {
+		r.mu.Lock()
+		if r.timer != nil {
+			r.timer.Stop()
+			r.timer = nil
+		}
+		r.mu.Unlock()
+		close(r.done)
+	})
+}
+
+// deleteRoom removes a room from the hub and stops it. The caller marks
+// it closed first so late joiners don't land in it.
+func (h *Hub) deleteRoom(room *Room) {
+	room.mu.RLock()
+	h.notifyRaceAbandoned(room)
+	room.mu.RUnlock()
+	room.stop()
+	h.archiveLog(room)
+	h.recordChunk(room)
+	h.forgetRoom(room)
+	h.rooms.remove(room)
+}
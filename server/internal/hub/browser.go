@@ -0,0 +1,50 @@
+package hub
+
+import "time"
+
+// roomListInterval is how often browsing clients receive room_list_update
+const roomListInterval = 5 * time.Second
+
+// handleListRooms replies with the public lobby list and subscribes the
+// client to periodic updates until it joins a room
+func (h *Hub) handleListRooms(client *Client) {
+	h.browseMu.Lock()
+	h.browsers[client] = true
+	h.browseMu.Unlock()
+
+	client.sendMessage(roomListMessage(h.GetLobbies()))
+}
+
+// stopBrowsing unsubscribes a client from room list updates
+func (h *Hub) stopBrowsing(client *Client) {
+	h.browseMu.Lock()
+	delete(h.browsers, client)
+	h.browseMu.Unlock()
+}
+
+// broadcastRoomList pushes the current lobby list to every browsing client
+func (h *Hub) broadcastRoomList() {
+	h.browseMu.Lock()
+	browsing := len(h.browsers) > 0
+	h.browseMu.Unlock()
+	if !browsing {
+		return
+	}
+
+	f := newFrames(roomListMessage(h.GetLobbies()))
+
+	h.browseMu.Lock()
+	defer h.browseMu.Unlock()
+	for client := range h.browsers {
+		client.sendFrames(f)
+	}
+}
+
+func roomListMessage(lobbies []LobbyInfo) Message {
+	return Message{
+		Type: MsgTypeRoomListUpdate,
+		Payload: mustMarshal(map[string]interface{}{
+			"rooms": lobbies,
+		}),
+	}
+}
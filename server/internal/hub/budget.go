@@ -0,0 +1,98 @@
+package hub
+
+import (
+	"context"
+	"strconv"
+)
+
+// maxClickBudget caps host-configured click budgets
+const maxClickBudget = 50
+
+// clickBudget returns the clicks each racer gets, or 0 for no limit
+func (c RoomConfig) clickBudget() int {
+	switch {
+	case c.ClickBudget <= 0:
+		return 0
+	case c.ClickBudget > maxClickBudget:
+		return maxClickBudget
+	}
+	return c.ClickBudget
+}
+
+// budgetCheck rejects room setups a click budget can't support, returning
+// the reason or "". Shortfalls are measured to the end article, which
+// checkpoints would make meaningless. Caller must hold room.mu.
+func (r *Room) budgetCheck() string {
+	if r.Config.clickBudget() > 0 && (r.Config.Relay || len(r.Config.Checkpoints) > 0) {
+		return "Click budgets can't be used with checkpoints or relay"
+	}
+	return ""
+}
+
+// lastClick reports whether the player's next click spends the rest of
+// their budget. Caller must hold room.mu.
+func (r *Room) lastClick(p *Player) bool {
+	budget := r.Config.clickBudget()
+	return r.Started && budget > 0 && p.Clicks == budget-1
+}
+
+// checkBudget rejects a click once the player has used their budget.
+// Caller must hold room.mu.
+func (r *Room) checkBudget(p *Player, article string) *RuleViolation {
+	budget := r.Config.clickBudget()
+	if !r.Started || budget == 0 || p.Clicks < budget {
+		return nil
+	}
+	return &RuleViolation{
+		Rule:    RuleClickBudget,
+		Article: article,
+		Message: "You've used all " + strconv.Itoa(budget) + " clicks",
+	}
+}
+
+// spendBudget ends the run of a player who has used their last click
+// without reaching the target. shortfall is the link distance they were
+// left from it, -1 if unknown. Caller must hold room.mu.
+func (r *Room) spendBudget(p *Player, shortfall int) bool {
+	budget := r.Config.clickBudget()
+	if !r.Started || budget == 0 || p.Clicks < budget || p.Finished {
+		return false
+	}
+	p.OutOfClicks = true
+	p.Shortfall = shortfall
+	return true
+}
+
+// measureShortfall counts the clicks still needed from an article to the
+// target, or -1 without a route. It can take API round trips, so it runs
+// before the room applies the click.
+func (h *Hub) measureShortfall(ctx context.Context, lang, article, target string) int {
+	path, err := h.shortestPath(ctx, lang, article, target)
+	if err != nil {
+		return -1
+	}
+	return len(path) - 1
+}
+
+// closer reports whether a ran out of clicks nearer the target than b.
+// Unknown distances come last, and ties go to whoever ran out first.
+func closer(a, b *Player) bool {
+	if a.Shortfall != b.Shortfall {
+		switch {
+		case a.Shortfall < 0:
+			return false
+		case b.Shortfall < 0:
+			return true
+		}
+		return a.Shortfall < b.Shortfall
+	}
+	return lastStep(a) < lastStep(b)
+}
+
+// lastStep is the race time of a player's latest click
+func lastStep(p *Player) int64 {
+	if len(p.steps) == 0 {
+		return 0
+	}
+	return p.steps[len(p.steps)-1].At
+}
@@ -0,0 +1,64 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+// maxCheckpoints caps how many intermediate targets a race can have
+const maxCheckpoints = 10
+
+// validateCheckpoints resolves a room's checkpoints to canonical titles.
+// Checkpoints can't repeat the start or end article or appear twice in a
+// row, since either would be reached for free.
+func (h *Hub) validateCheckpoints(lang string, checkpoints []string, start, end string) ([]string, error) {
+	if len(checkpoints) > maxCheckpoints {
+		return nil, fmt.Errorf("%w: at most %d checkpoints are allowed", ErrInvalidArticle, maxCheckpoints)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resolved := make([]string, 0, len(checkpoints))
+	prev := start
+	for _, title := range checkpoints {
+		if wiki.NormalizeTitleIn(lang, title) == "" {
+			return nil, fmt.Errorf("%w: checkpoints can't be empty", ErrInvalidArticle)
+		}
+		article, err := h.resolveArticle(ctx, lang, title)
+		if err != nil {
+			return nil, err
+		}
+		if prev != "" && wiki.SameArticleIn(lang, article, prev) {
+			return nil, fmt.Errorf("%w: checkpoint %q follows the same article", ErrInvalidArticle, title)
+		}
+		resolved = append(resolved, article)
+		prev = article
+	}
+	if end != "" && len(resolved) > 0 && wiki.SameArticleIn(lang, prev, end) {
+		return nil, fmt.Errorf("%w: the last checkpoint can't be the end article", ErrInvalidArticle)
+	}
+	return resolved, nil
+}
+
+// advanceCheckpoint moves the player past their next checkpoint if article
+// is it. Checkpoints only count in order, so reaching a later one early
+// does nothing. Caller must hold room.mu.
+func (r *Room) advanceCheckpoint(player *Player, article string) bool {
+	checkpoints := r.Config.Checkpoints
+	if player.Checkpoint >= len(checkpoints) || !wiki.SameArticleIn(r.Language, article, checkpoints[player.Checkpoint]) {
+		return false
+	}
+	player.Checkpoint++
+	return true
+}
+
+// reachedTarget reports whether the player is on their end article with
+// every checkpoint behind them. Caller must hold room.mu.
+func (r *Room) reachedTarget(player *Player) bool {
+	return player.Checkpoint >= len(r.Config.Checkpoints) &&
+		wiki.SameArticleIn(r.playerLanguage(player), player.CurrentArticle, r.playerTarget(player))
+}
@@ -1,55 +1,125 @@
 package hub
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/auth"
 )
 
 const (
 	writeWait      = 10 * time.Second
-	pongWait       = 60 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
 	maxMessageSize = 512 * 1024
+
+	// Defaults for the heartbeat: a ping is sent every pingPeriod and the
+	// connection is considered dead if nothing arrives within pongWait
+	defaultPongWait = 60 * time.Second
 )
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow all origins for development
-		// In production, you can restrict this by checking the Origin header
-		// For Railway deployment, we'll allow all origins since Railway handles routing
-		return true
-	},
+	Subprotocols:    []string{subprotocolMsgpack},
+	// CheckOrigin is set from the hub's edge policy, see upgraderFor
 }
 
 // Client represents a WebSocket connection
 type Client struct {
-	hub    *Hub
-	conn   *websocket.Conn
-	send   chan []byte
-	id     string
-	roomID string
+	hub         *Hub
+	conn        *websocket.Conn
+	send        chan []byte
+	id          string
+	room        atomic.Pointer[Room]
+	addr        string // remote IP, for moderation
+	accountID   string // set when the connection carries a valid session token
+	accountName string
+	guestID     string // signed guest identity for players without accounts
+	encoding    encoding
+	features    atomic.Uint32 // Feature bits granted by hello
+	deflate     bool          // permessage-deflate was negotiated
+	compress    atomic.Bool   // compress large frames, see compressNext
+
+	// cancel ends a connection made through ServeStream, nil on WebSocket
+	cancel context.CancelCauseFunc
+
+	// closed guards send so late broadcasts can't write to a closed channel
+	closed  bool
+	closeMu sync.RWMutex
+
+	drops       atomic.Int32 // consecutive messages dropped on a full queue
+	needsResync atomic.Bool
+	rtt         atomic.Int64 // smoothed heartbeat round trip in ms, see latency.go
+
+	flood floodGuard
 }
 
 // ServeWs handles WebSocket requests from clients
 func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Println("Upgrade error:", err)
+	if hub.draining.Load() {
+		http.Error(w, ErrDraining.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	// Browsers send cookies along with cross-origin upgrades, so only the
+	// origins we know may use them
+	if hub.auth != nil && auth.CookieAuthenticated(r) && !hub.edge.AllowCookies(r) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
 		return
 	}
-
 	client := &Client{
 		hub:  hub,
-		conn: conn,
 		send: make(chan []byte, 256),
 		id:   uuid.New().String(),
+		addr: hub.edge.ClientIP(r),
+	}
+
+	// Signed-in players keep their identity across connections; everyone
+	// else gets a signed guest cookie so reloads don't lose their identity
+	var header http.Header
+	if hub.auth != nil {
+		if claims, err := hub.auth.Verify(auth.TokenFromRequest(r)); err == nil {
+			client.accountID = claims.Subject
+			client.accountName = claims.Username
+		} else if id, ok := hub.auth.GuestID(r); ok {
+			client.guestID = id
+		} else {
+			id, cookie := hub.auth.NewGuest()
+			client.guestID = id
+			header = http.Header{"Set-Cookie": {cookie.String()}}
+		}
+	}
+
+	conn, err := hub.upgraderFor().Upgrade(w, r, header)
+	if err != nil {
+		log.Println("Upgrade error:", err)
+		return
+	}
+	client.conn = conn
+	client.setupCompression(r)
+
+	// Banned players are closed with CloseBanned before they reach the
+	// hub. Browsers can't see an HTTP status on a failed upgrade, so
+	// refusing it would look like a network error.
+	if hub.moderation != nil {
+		if ban, ok := hub.moderation.Check(client.addr, client.accountID, client.guestID); ok {
+			log.Printf("Rejected banned connection (%s %s)", ban.Kind, ban.Value)
+			client.disconnect(CloseBanned, "banned")
+			return
+		}
+	}
+
+	// Clients opt into binary MessagePack via the WebSocket subprotocol,
+	// or ?encoding=msgpack where subprotocols are awkward to set
+	if conn.Subprotocol() == subprotocolMsgpack || r.URL.Query().Get("encoding") == subprotocolMsgpack {
+		client.encoding = encodingMsgpack
 	}
 
 	hub.register <- client
@@ -64,39 +134,57 @@ func (c *Client) readPump() {
 		c.conn.Close()
 	}()
 
+	pongWait := c.hub.pongWait
 	c.conn.SetReadLimit(maxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.conn.SetPongHandler(func(string) error {
+	c.conn.SetPongHandler(func(payload string) error {
 		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		c.recordPong(payload)
 		return nil
 	})
 
 	for {
 		_, data, err := c.conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				log.Printf("Client %s missed heartbeat for %s, closing", c.id, pongWait)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("Read error: %v", err)
 			}
 			break
 		}
 
-		var msg Message
-		if err := json.Unmarshal(data, &msg); err != nil {
+		// Any inbound frame proves the connection is alive
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		msg, err := decodeMessage(data, c.encoding)
+		if err != nil {
 			log.Printf("Invalid message: %v", err)
 			continue
 		}
 
+		if !c.admit() {
+			continue
+		}
 		c.hub.HandleMessage(c, msg)
 	}
 }
 
 func (c *Client) writePump() {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(c.hub.pingPeriod)
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
 	}()
 
+	// Measure latency straight away rather than a heartbeat from now, so
+	// it's known by the time the player queues
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := c.conn.WriteMessage(websocket.PingMessage, pingPayload()); err != nil {
+		return
+	}
+
 	for {
 		select {
 		case message, ok := <-c.send:
@@ -106,17 +194,36 @@ func (c *Client) writePump() {
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
+			if c.encoding == encodingMsgpack {
+				// Binary frames can't be newline-batched, send one per message
+				c.compressNext(len(message))
+				if err := c.conn.WriteMessage(websocket.BinaryMessage, message); err != nil {
+					return
+				}
+				continue
 			}
-			w.Write(message)
 
-			// Batch queued messages
+			// Batch queued messages, sizing the frame first so the
+			// compression threshold applies to the whole batch
+			batch := [][]byte{message}
+			size := len(message)
 			n := len(c.send)
 			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.send)
+				next := <-c.send
+				batch = append(batch, next)
+				size += 1 + len(next)
+			}
+			c.compressNext(size)
+
+			w, err := c.conn.NextWriter(websocket.TextMessage)
+			if err != nil {
+				return
+			}
+			for i, m := range batch {
+				if i > 0 {
+					w.Write([]byte{'\n'})
+				}
+				w.Write(m)
 			}
 
 			if err := w.Close(); err != nil {
@@ -125,7 +232,7 @@ func (c *Client) writePump() {
 
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if err := c.conn.WriteMessage(websocket.PingMessage, pingPayload()); err != nil {
 				return
 			}
 		}
@@ -133,27 +240,57 @@ func (c *Client) writePump() {
 }
 
 func (c *Client) sendMessage(msg Message) {
-	data, err := json.Marshal(msg)
+	c.sendFrames(newFrames(msg))
+}
+
+// sendFrames queues a message in the client's negotiated encoding
+func (c *Client) sendFrames(f *frames) {
+	data, err := f.get(c.encoding)
 	if err != nil {
 		return
 	}
+
+	c.closeMu.RLock()
+	defer c.closeMu.RUnlock()
+	if c.closed {
+		return
+	}
 	select {
 	case c.send <- data:
+		c.recordSent()
 	default:
 		// Buffer full
+		c.recordDrop()
 	}
 }
 
-func (c *Client) sendError(errMsg string) {
-	c.sendMessage(Message{
-		Type:    MsgTypeError,
-		Payload: mustMarshal(map[string]string{"error": errMsg}),
-	})
+// close shuts the send channel, which makes writePump close the connection
+func (c *Client) close() {
+	c.closeMu.Lock()
+	defer c.closeMu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
 }
 
+// displayName returns the account name for signed-in clients, or the
+// name the guest asked for
+func (c *Client) displayName(requested string) string {
+	if c.accountName != "" {
+		return c.accountName
+	}
+	return requested
+}
 
-
-
-
-
-
+// sendError tells the client a message was rejected. errMsg is shown to
+// players; code is for clients to act on.
+func (c *Client) sendError(code ErrorCode, errMsg string) {
+	c.sendMessage(Message{
+		Type: MsgTypeError,
+		Payload: mustMarshal(map[string]interface{}{
+			"code":  code,
+			"error": errMsg,
+		}),
+	})
+}
@@ -0,0 +1,45 @@
+package hub
+
+import "time"
+
+// raceClockInterval is how often running races broadcast race_clock
+const raceClockInterval = 5 * time.Second
+
+// watchRaceClock keeps every client's race timer on the server's, however
+// far their own clock drifts or however late they joined
+func (h *Hub) watchRaceClock() {
+	ticker := time.NewTicker(raceClockInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, room := range h.rooms.all() {
+			room.mu.RLock()
+			if !room.Started || room.Ended || room.Paused {
+				room.mu.RUnlock()
+				continue
+			}
+			msg := room.clockMessage()
+			room.mu.RUnlock()
+
+			// A tick is stale once the next one is out, so it isn't
+			// sequenced
+			select {
+			case room.broadcasts <- roomBroadcast{msg: msg, transient: true}:
+			case <-room.done:
+			}
+		}
+	}
+}
+
+// clockMessage builds a race_clock with the authoritative elapsed time,
+// and the time left when the race has a limit. Caller must hold room.mu.
+func (r *Room) clockMessage() Message {
+	clock := map[string]interface{}{
+		"elapsed":    r.elapsed(),
+		"serverTime": time.Now().UnixMilli(),
+	}
+	if limit := r.Config.timeLimit(); limit > 0 {
+		clock["remaining"] = max(limit.Milliseconds()-r.elapsed(), 0)
+	}
+	return Message{Type: MsgTypeRaceClock, Payload: mustMarshal(clock)}
+}
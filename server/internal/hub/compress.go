@@ -0,0 +1,57 @@
+package hub
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultCompressionThreshold skips compressing messages smaller than
+// this many bytes, where deflate costs more CPU than it saves bandwidth
+const defaultCompressionThreshold = 512
+
+// upgraderFor returns the upgrader for the hub's compression settings and
+// allowed origins
+func (h *Hub) upgraderFor() *websocket.Upgrader {
+	up := upgrader
+	up.EnableCompression = h.compressionLevel > 0
+	up.CheckOrigin = func(r *http.Request) bool {
+		return h.edge.AllowOrigin(r.Header.Get("Origin"))
+	}
+	return &up
+}
+
+// offersDeflate reports whether the handshake requests permessage-deflate,
+// which the upgrader accepts whenever compression is enabled
+func offersDeflate(r *http.Request) bool {
+	for _, v := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, ext := range strings.Split(v, ",") {
+			name, _, _ := strings.Cut(ext, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setupCompression records whether deflate was negotiated for a new
+// connection and turns it on at the hub's level. Clients that send hello
+// keep it only if they list FeatureCompression.
+func (c *Client) setupCompression(r *http.Request) {
+	if c.hub.compressionLevel == 0 || !offersDeflate(r) {
+		return
+	}
+	c.deflate = true
+	c.conn.SetCompressionLevel(c.hub.compressionLevel)
+	c.compress.Store(true)
+}
+
+// compressNext sets whether the next frame of size bytes is compressed.
+// Only writePump may call it.
+func (c *Client) compressNext(size int) {
+	if c.deflate {
+		c.conn.EnableWriteCompression(c.compress.Load() && size >= c.hub.compressionThreshold)
+	}
+}
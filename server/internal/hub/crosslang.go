@@ -0,0 +1,127 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+// localizedPair is a race's start and end articles on one edition
+type localizedPair struct {
+	StartArticle string `json:"startArticle"`
+	EndArticle   string `json:"endArticle"`
+}
+
+// playerLanguage is the edition a player races on. Caller must hold
+// room.mu.
+func (r *Room) playerLanguage(p *Player) string {
+	if p.Language != "" {
+		return p.Language
+	}
+	return r.Language
+}
+
+// playerStart is the start article on the player's edition. Caller must
+// hold room.mu.
+func (r *Room) playerStart(p *Player) string {
+	if p.StartArticle != "" {
+		return p.StartArticle
+	}
+	return r.StartArticle
+}
+
+// playerTarget is the end article on the player's edition. Caller must
+// hold room.mu.
+func (r *Room) playerTarget(p *Player) string {
+	if p.EndArticle != "" {
+		return p.EndArticle
+	}
+	return r.EndArticle
+}
+
+// crossLanguageCheck rejects room setups a cross-language race can't
+// support, returning the reason or "". Caller must hold room.mu.
+func (r *Room) crossLanguageCheck() string {
+	if !r.Config.CrossLanguage {
+		return ""
+	}
+	if r.Config.Relay || len(r.Config.Checkpoints) > 0 {
+		return "Cross-language races can't use checkpoints or relay"
+	}
+	if r.StartArticle == "" || r.EndArticle == "" {
+		return "Pick start and end articles first"
+	}
+	return ""
+}
+
+// localizeRace resolves the room's articles to every other edition its
+// players race on, through interlanguage links. It's called before the
+// race starts, outside the lock, since each edition costs two API calls;
+// the error names the first edition missing an equivalent page.
+func (h *Hub) localizeRace(room *Room) (map[string]localizedPair, error) {
+	room.mu.RLock()
+	from, start, end := room.Language, room.StartArticle, room.EndArticle
+	langs := make(map[string]bool)
+	for _, p := range room.Players {
+		if p.Language != "" && p.Language != from {
+			langs[p.Language] = true
+		}
+	}
+	room.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := h.wikiFor(from)
+	pairs := make(map[string]localizedPair, len(langs)+1)
+	pairs[from] = localizedPair{StartArticle: start, EndArticle: end}
+	for lang := range langs {
+		localStart, err := client.LangLink(ctx, start, lang)
+		if err != nil {
+			return nil, langLinkError(err, start, lang)
+		}
+		localEnd, err := client.LangLink(ctx, end, lang)
+		if err != nil {
+			return nil, langLinkError(err, end, lang)
+		}
+		pairs[lang] = localizedPair{StartArticle: localStart, EndArticle: localEnd}
+	}
+	return pairs, nil
+}
+
+func langLinkError(err error, title, lang string) error {
+	if errors.Is(err, wiki.ErrNoLangLink) {
+		return fmt.Errorf("%w: %q has no %s Wikipedia article", ErrInvalidArticle, title, lang)
+	}
+	log.Printf("Interlanguage lookup for %q (%s) failed: %v", title, lang, err)
+	return errors.New("couldn't reach Wikipedia to match articles, try again")
+}
+
+// applyLocalized moves every player onto their edition's start article.
+// It fails if the articles changed or a player joined on an edition the
+// pairs don't cover while they were being resolved. Caller must hold
+// room.mu.
+func (r *Room) applyLocalized(pairs map[string]localizedPair) bool {
+	if pairs[r.Language] != (localizedPair{StartArticle: r.StartArticle, EndArticle: r.EndArticle}) {
+		return false
+	}
+	for _, p := range r.Players {
+		if _, ok := pairs[r.playerLanguage(p)]; !ok {
+			return false
+		}
+	}
+	for _, p := range r.Players {
+		if p.Language == "" || p.Language == r.Language {
+			continue
+		}
+		pair := pairs[p.Language]
+		p.StartArticle, p.EndArticle = pair.StartArticle, pair.EndArticle
+		p.CurrentArticle = pair.StartArticle
+		p.Path = []string{pair.StartArticle}
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package hub
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// cursorFlushInterval batches cursor traffic at 20 Hz
+const cursorFlushInterval = 50 * time.Millisecond
+
+// CursorPayload is a client's cursor sample. ClientTime (ms on the
+// sender's clock) and the velocity in pixels a second are optional; with
+// them receivers can interpolate between samples instead of jumping.
+type CursorPayload struct {
+	X            float64 `json:"x"`
+	Y            float64 `json:"y"`
+	Article      string  `json:"article"`
+	CursorType   string  `json:"cursorType,omitempty"`
+	AnchorId     string  `json:"anchorId,omitempty"`
+	NextAnchorId string  `json:"nextAnchorId,omitempty"`
+	SectionRatio float64 `json:"sectionRatio,omitempty"`
+	ClientTime   int64   `json:"clientTime,omitempty"`
+	VX           float64 `json:"vx,omitempty"`
+	VY           float64 `json:"vy,omitempty"`
+}
+
+// CursorUpdate is one player's cursor position within a cursor_batch.
+// ServerTime is when the server received the sample, in Unix ms, so
+// receivers can space samples by arrival even without ClientTime.
+type CursorUpdate struct {
+	PlayerID     string  `json:"playerId"`
+	PlayerName   string  `json:"playerName"`
+	X            float64 `json:"x"`
+	Y            float64 `json:"y"`
+	Article      string  `json:"article"`
+	CursorType   string  `json:"cursorType"`
+	AnchorId     string  `json:"anchorId"`
+	NextAnchorId string  `json:"nextAnchorId"`
+	SectionRatio float64 `json:"sectionRatio"`
+	ClientTime   int64   `json:"clientTime,omitempty"`
+	ServerTime   int64   `json:"serverTime"`
+	VX           float64 `json:"vx,omitempty"`
+	VY           float64 `json:"vy,omitempty"`
+	Appearance
+}
+
+func (h *Hub) handleCursor(room *Room, client *Client, payload json.RawMessage) {
+	var p CursorPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return
+	}
+
+	room.mu.RLock()
+	player, exists := room.Players[client.id]
+	hiding := room.hiding(client.id)
+	room.mu.RUnlock()
+
+	// The hider's cursor would give away their article
+	if !exists || hiding {
+		return
+	}
+
+	room.touch(client.id)
+
+	// Keep only the latest position, the next flush sends it
+	room.cursorMu.Lock()
+	if room.pendingCursors == nil {
+		room.pendingCursors = make(map[string]CursorUpdate)
+	}
+	room.pendingCursors[client.id] = CursorUpdate{
+		PlayerID:     client.id,
+		PlayerName:   player.Name,
+		X:            p.X,
+		Y:            p.Y,
+		Article:      p.Article,
+		CursorType:   p.CursorType,
+		AnchorId:     p.AnchorId,
+		NextAnchorId: p.NextAnchorId,
+		SectionRatio: p.SectionRatio,
+		ClientTime:   p.ClientTime,
+		ServerTime:   time.Now().UnixMilli(),
+		VX:           p.VX,
+		VY:           p.VY,
+		Appearance:   player.Appearance,
+	}
+	room.cursorMu.Unlock()
+}
+
+// flushCursors periodically sends each room's coalesced cursor positions
+// as a single cursor_batch. Clients skip the entry with their own ID.
+// Clients that didn't negotiate FeatureCursorBatch get the entries as
+// separate cursor_update messages, minus their own.
+func (h *Hub) flushCursors() {
+	ticker := time.NewTicker(cursorFlushInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, room := range h.rooms.all() {
+			room.cursorMu.Lock()
+			pending := room.pendingCursors
+			room.pendingCursors = nil
+			room.cursorMu.Unlock()
+
+			if len(pending) == 0 {
+				continue
+			}
+
+			cursors := make([]CursorUpdate, 0, len(pending))
+			for _, c := range pending {
+				cursors = append(cursors, c)
+			}
+			msg := Message{
+				Type: MsgTypeCursorBatch,
+				Payload: mustMarshal(map[string]interface{}{
+					"cursors": cursors,
+				}),
+			}
+			select {
+			case room.broadcasts <- roomBroadcast{msg: msg, cursors: cursors, transient: true}:
+			case <-room.done:
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/graph"
+)
+
+// ErrNoGraph is returned by features that need an offline link graph for
+// the requested edition
+var ErrNoGraph = errors.New("no link graph loaded for this language")
+
+// Difficulty scores a start/end pair on an edition from the link graph
+func (h *Hub) Difficulty(lang, start, end string) (graph.Difficulty, error) {
+	g := h.graphFor(lang)
+	if g == nil {
+		return graph.Difficulty{}, ErrNoGraph
+	}
+	return g.Difficulty(start, end)
+}
+
+// RandomPair picks a scored start/end pair in a difficulty tier
+func (h *Hub) RandomPair(lang string, tier graph.Tier) (graph.Difficulty, error) {
+	g := h.graphFor(lang)
+	if g == nil {
+		return graph.Difficulty{}, ErrNoGraph
+	}
+	return g.RandomPair(tier)
+}
+
+// randomPair picks articles for a race. A tier is honoured when the link
+// graph covers the edition; otherwise, or without a tier, any two random
+// articles from the API will do.
+func (h *Hub) randomPair(ctx context.Context, lang string, tier graph.Tier) (string, string, error) {
+	if g := h.graphFor(lang); tier != "" && g != nil {
+		d, err := g.RandomPair(tier)
+		if err == nil {
+			return d.Start, d.End, nil
+		}
+		log.Printf("No %s pair from the link graph: %v", tier, err)
+	}
+	titles, err := h.wikiFor(lang).RandomArticles(ctx, 2)
+	if err != nil {
+		return "", "", err
+	}
+	return titles[0], titles[1], nil
+}
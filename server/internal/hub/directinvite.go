@@ -0,0 +1,173 @@
+package hub
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/markotsymbaluk/wiki-racing/internal/push"
+)
+
+const (
+	// directInviteTTL is how long a friend has to answer and use an invite
+	directInviteTTL = 2 * time.Minute
+	// pushInviteTTL is longer, for friends who get the invite as a push
+	// notification and have to open the game first
+	pushInviteTTL = 10 * time.Minute
+)
+
+// directInvite is an invitation sent to one friend. Its token is random
+// rather than signed, so it can be spent once by that friend only.
+type directInvite struct {
+	roomID  string
+	from    *Client
+	to      string // invitee's account ID
+	expires time.Time
+	// accepted is set once the invitee answers; join_room then spends it
+	accepted bool
+}
+
+type InvitePlayerPayload struct {
+	AccountID string `json:"accountId"`
+}
+
+type InviteAnswerPayload struct {
+	Token string `json:"token"`
+}
+
+// handleInvitePlayer sends a friend an invitation to the sender's room,
+// as a push notification if they aren't connected
+func (h *Hub) handleInvitePlayer(client *Client, payload json.RawMessage) {
+	var p InvitePlayerPayload
+	if err := json.Unmarshal(payload, &p); err != nil || p.AccountID == "" {
+		client.sendError(CodeBadRequest, "Invalid invite_player payload")
+		return
+	}
+	if client.accountID == "" {
+		client.sendError(CodeNotAllowed, "Sign in to invite friends")
+		return
+	}
+	room := client.currentRoom()
+	if room == nil {
+		client.sendError(CodeNotAllowed, "Join a room before inviting friends")
+		return
+	}
+	friends, err := h.social.AreFriends(client.accountID, p.AccountID)
+	if err != nil {
+		log.Printf("Failed to check friends of %s: %v", client.accountID, err)
+		client.sendError(CodeTryAgain, "Couldn't send the invite, try again")
+		return
+	}
+	if !friends {
+		client.sendError(CodeNotAllowed, "You can only invite friends")
+		return
+	}
+	online := len(h.accountClients()[p.AccountID]) > 0
+	if !online && h.push == nil {
+		client.sendError(CodeNotAllowed, "That friend isn't online")
+		return
+	}
+
+	room.mu.RLock()
+	roomID, fromName := room.ID, client.displayName("")
+	if player, ok := room.Players[client.id]; ok {
+		fromName = player.Name
+	}
+	room.mu.RUnlock()
+
+	token := uuid.New().String()
+	ttl := directInviteTTL
+	if !online {
+		ttl = pushInviteTTL
+	}
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	h.directMu.Lock()
+	h.pruneDirectInvites()
+	h.directInvites[token] = &directInvite{roomID: roomID, from: client, to: p.AccountID, expires: expires}
+	h.directMu.Unlock()
+
+	invite := map[string]interface{}{
+		"token":         token,
+		"roomId":        roomID,
+		"fromAccountId": client.accountID,
+		"fromName":      fromName,
+		"expiresAt":     expires,
+	}
+	if !online {
+		// The client answers with invite_accept once it's opened
+		h.push.Send(p.AccountID, push.Notification{
+			Type:  "room_invite",
+			Title: fromName + " invited you to a race",
+			Body:  "Join before the invite expires",
+			URL:   "/race-lobby?code=" + url.QueryEscape(roomID),
+			Data:  invite,
+		})
+		return
+	}
+	h.sendToAccount(p.AccountID, Message{Type: MsgTypePlayerInvited, Payload: mustMarshal(invite)})
+}
+
+// handleInviteAnswer records the invitee's answer and tells the inviter.
+// An accepted invite is then spent by join_room with the token as invite;
+// a declined one is dropped.
+func (h *Hub) handleInviteAnswer(client *Client, payload json.RawMessage, accept bool) {
+	var p InviteAnswerPayload
+	if err := json.Unmarshal(payload, &p); err != nil || p.Token == "" {
+		client.sendError(CodeBadRequest, "Invalid invite answer payload")
+		return
+	}
+
+	h.directMu.Lock()
+	h.pruneDirectInvites()
+	invite := h.directInvites[p.Token]
+	if invite == nil || invite.to != client.accountID || invite.accepted {
+		h.directMu.Unlock()
+		client.sendError(CodeInvalidInvite, "This invite is invalid or has expired")
+		return
+	}
+	if accept {
+		invite.accepted = true
+	} else {
+		delete(h.directInvites, p.Token)
+	}
+	h.directMu.Unlock()
+
+	invite.from.sendMessage(Message{
+		Type: MsgTypeInviteAnswered,
+		Payload: mustMarshal(map[string]interface{}{
+			"accountId": client.accountID,
+			"username":  client.accountName,
+			"roomId":    invite.roomID,
+			"accepted":  accept,
+		}),
+	})
+}
+
+// spendDirectInvite uses up an accepted invite addressed to the client and
+// returns its room. ok is false for tokens that aren't direct invites.
+func (h *Hub) spendDirectInvite(client *Client, token string) (roomID string, ok bool, err error) {
+	h.directMu.Lock()
+	defer h.directMu.Unlock()
+	h.pruneDirectInvites()
+	invite, ok := h.directInvites[token]
+	if !ok {
+		return "", false, nil
+	}
+	if invite.to != client.accountID || !invite.accepted {
+		return "", true, ErrInvalidInvite
+	}
+	delete(h.directInvites, token)
+	return invite.roomID, true, nil
+}
+
+// pruneDirectInvites drops expired invites. Caller must hold h.directMu.
+func (h *Hub) pruneDirectInvites() {
+	now := time.Now()
+	for token, invite := range h.directInvites {
+		if now.After(invite.expires) {
+			delete(h.directInvites, token)
+		}
+	}
+}
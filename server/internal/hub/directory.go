@@ -0,0 +1,119 @@
+package hub
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+// roomShards is how many locks the room directory is split over, so
+// lookups and room creation rarely contend across rooms
+const roomShards = 32
+
+type roomShard struct {
+	mu    sync.RWMutex
+	rooms map[string]*Room
+}
+
+// roomDirectory maps room IDs to rooms. It is the only room state shared
+// across rooms; everything else lives in the room and is changed by its
+// actor.
+type roomDirectory struct {
+	shards [roomShards]roomShard
+	count  atomic.Int64
+}
+
+func newRoomDirectory() *roomDirectory {
+	d := &roomDirectory{}
+	for i := range d.shards {
+		d.shards[i].rooms = make(map[string]*Room)
+	}
+	return d
+}
+
+func (d *roomDirectory) shard(id string) *roomShard {
+	f := fnv.New32a()
+	f.Write([]byte(id))
+	return &d.shards[f.Sum32()%roomShards]
+}
+
+func (d *roomDirectory) get(id string) (*Room, bool) {
+	s := d.shard(id)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	room, ok := s.rooms[id]
+	return room, ok
+}
+
+// add registers room under its ID. It fails with ErrRoomExists if the ID
+// is taken, or ErrRoomLimit if limit rooms already exist; 0 is unlimited.
+func (d *roomDirectory) add(room *Room, limit int) error {
+	s := d.shard(room.ID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.rooms[room.ID]; exists {
+		return ErrRoomExists
+	}
+	if n := d.count.Add(1); limit > 0 && n > int64(limit) {
+		d.count.Add(-1)
+		return ErrRoomLimit
+	}
+	s.rooms[room.ID] = room
+	return nil
+}
+
+// remove unregisters room, unless its ID already belongs to a newer room
+func (d *roomDirectory) remove(room *Room) {
+	s := d.shard(room.ID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rooms[room.ID] == room {
+		delete(s.rooms, room.ID)
+		d.count.Add(-1)
+	}
+}
+
+func (d *roomDirectory) len() int {
+	return int(d.count.Load())
+}
+
+// all returns every registered room. Rooms added or removed during the
+// call may or may not be included.
+func (d *roomDirectory) all() []*Room {
+	rooms := make([]*Room, 0, d.len())
+	for i := range d.shards {
+		s := &d.shards[i]
+		s.mu.RLock()
+		for _, room := range s.rooms {
+			rooms = append(rooms, room)
+		}
+		s.mu.RUnlock()
+	}
+	return rooms
+}
+
+// addWithCode registers a room under a fresh random code, building it
+// once the code is known
+func (d *roomDirectory) addWithCode(limit int, build func(id string) (*Room, error)) (*Room, error) {
+	for {
+		id := newRoomCode()
+		if _, taken := d.get(id); taken {
+			continue
+		}
+		room, err := build(id)
+		if err != nil {
+			return nil, err
+		}
+		switch err := d.add(room, limit); err {
+		case nil:
+			return room, nil
+		case ErrRoomExists:
+			room.stop()
+		default:
+			room.stop()
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package hub
+
+import (
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// encoding is the wire format negotiated for a client at connect time
+type encoding int
+
+const (
+	encodingJSON encoding = iota
+	encodingMsgpack
+	numEncodings
+)
+
+// subprotocolMsgpack is the WebSocket subprotocol clients request to
+// receive binary MessagePack frames instead of JSON text
+const subprotocolMsgpack = "msgpack"
+
+// wireMessage mirrors Message with a decoded payload so it can be
+// re-encoded as native MessagePack
+type wireMessage struct {
+	Type    string      `msgpack:"type"`
+	Payload interface{} `msgpack:"payload"`
+	Seq     uint64      `msgpack:"seq,omitempty"`
+}
+
+// encodeMessage serializes msg in the given format
+func encodeMessage(msg Message, enc encoding) ([]byte, error) {
+	if enc != encodingMsgpack {
+		return json.Marshal(msg)
+	}
+
+	var payload interface{}
+	if len(msg.Payload) > 0 {
+		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+			return nil, err
+		}
+	}
+	return msgpack.Marshal(wireMessage{Type: msg.Type, Payload: payload, Seq: msg.Seq})
+}
+
+// decodeMessage parses an inbound frame in the given format
+func decodeMessage(data []byte, enc encoding) (Message, error) {
+	var msg Message
+	if enc != encodingMsgpack {
+		err := json.Unmarshal(data, &msg)
+		return msg, err
+	}
+
+	var wire wireMessage
+	if err := msgpack.Unmarshal(data, &wire); err != nil {
+		return msg, err
+	}
+	payload, err := json.Marshal(wire.Payload)
+	if err != nil {
+		return msg, err
+	}
+	return Message{Type: wire.Type, Payload: payload}, nil
+}
+
+// frames lazily encodes one message into each wire format, so a broadcast
+// marshals at most once per format no matter how many clients receive it
+type frames struct {
+	msg  Message
+	data [numEncodings][]byte
+	err  [numEncodings]error
+	done [numEncodings]bool
+}
+
+func newFrames(msg Message) *frames {
+	return &frames{msg: msg}
+}
+
+func (f *frames) get(enc encoding) ([]byte, error) {
+	if !f.done[enc] {
+		f.data[enc], f.err[enc] = encodeMessage(f.msg, enc)
+		f.done[enc] = true
+	}
+	return f.data[enc], f.err[enc]
+}
@@ -0,0 +1,80 @@
+package hub
+
+import "errors"
+
+// ErrorCode identifies an error message so clients can react to it
+// without parsing the human-readable text
+type ErrorCode string
+
+const (
+	CodeBadRequest      ErrorCode = "BAD_REQUEST" // malformed payload
+	CodeRoomNotFound    ErrorCode = "ROOM_NOT_FOUND"
+	CodeRoomFull        ErrorCode = "ROOM_FULL"
+	CodeServerFull      ErrorCode = "SERVER_FULL"
+	CodeBanned          ErrorCode = "BANNED"
+	CodeNotHost         ErrorCode = "NOT_HOST"
+	CodeNotReady        ErrorCode = "NOT_READY"
+	CodeRaceStarted     ErrorCode = "RACE_STARTED"
+	CodeRaceNotRunning  ErrorCode = "RACE_NOT_RUNNING"
+	CodeRacePaused      ErrorCode = "RACE_PAUSED"
+	CodeRaceInProgress  ErrorCode = "RACE_IN_PROGRESS"
+	CodeInvalidArticle  ErrorCode = "INVALID_ARTICLE"
+	CodeInvalidLanguage ErrorCode = "INVALID_LANGUAGE"
+	CodeInvalidMode     ErrorCode = "INVALID_MODE"
+	CodeInvalidSettings ErrorCode = "INVALID_SETTINGS"
+	CodeInvalidSeed     ErrorCode = "INVALID_SEED"
+	CodeWrongPassword   ErrorCode = "WRONG_PASSWORD"
+	CodeInvalidInvite   ErrorCode = "INVALID_INVITE"
+	CodeInvalidResume   ErrorCode = "INVALID_RESUME"
+	CodeNotFound        ErrorCode = "NOT_FOUND" // a player or ghost the message names
+	CodeNotAllowed      ErrorCode = "NOT_ALLOWED"
+	CodePowerUp         ErrorCode = "POWER_UP_UNAVAILABLE"
+	CodeRateLimited     ErrorCode = "RATE_LIMITED"
+	CodeOldVersion      ErrorCode = "UNSUPPORTED_VERSION"
+	CodeTryAgain        ErrorCode = "TRY_AGAIN" // a transient failure; retrying may work
+)
+
+// WebSocket close codes in the private range. Clients should reconnect
+// and rejoin after CloseSlowClient, and stay disconnected after the rest.
+const (
+	// CloseSlowClient is sent to clients whose send queue stays full
+	CloseSlowClient = 4000
+	// CloseKicked is sent to clients an operator disconnects
+	CloseKicked = 4001
+	// CloseRateLimited is sent to clients that keep flooding messages
+	// after being rate limited
+	CloseRateLimited = 4002
+	// CloseBanned is sent to clients matching a server-wide ban
+	CloseBanned = 4003
+	// CloseUnsupportedProtocol is sent to clients whose protocol version
+	// is too old to serve
+	CloseUnsupportedProtocol = 4004
+)
+
+// codeFor picks the error code for an error returned by hub validation
+func codeFor(err error) ErrorCode {
+	switch {
+	case errors.Is(err, ErrInvalidArticle):
+		return CodeInvalidArticle
+	case errors.Is(err, ErrInvalidLanguage):
+		return CodeInvalidLanguage
+	case errors.Is(err, ErrInvalidMode):
+		return CodeInvalidMode
+	case errors.Is(err, ErrInvalidSeed):
+		return CodeInvalidSeed
+	case errors.Is(err, ErrInvalidPassword), errors.Is(err, ErrInvalidTheme):
+		return CodeInvalidSettings
+	case errors.Is(err, ErrWrongPassword):
+		return CodeWrongPassword
+	case errors.Is(err, ErrInvalidInvite):
+		return CodeInvalidInvite
+	case errors.Is(err, ErrRoomNotFound):
+		return CodeRoomNotFound
+	case errors.Is(err, ErrGhostNotFound), errors.Is(err, ErrRaceNotFound):
+		return CodeNotFound
+	case errors.Is(err, ErrRoomLimit):
+		return CodeServerFull
+	default:
+		return CodeTryAgain
+	}
+}
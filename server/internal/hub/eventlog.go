@@ -0,0 +1,149 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRoomEvents caps a room's log; the oldest entries are dropped
+	// first, which shows up as a gap in Seq. The log trims once it is a
+	// quarter over, so long races don't copy it on every entry.
+	maxRoomEvents = 5000
+	// closedRoomLogs is how many closed rooms keep their log for admins
+	// looking into a report after the fact
+	closedRoomLogs = 50
+)
+
+// ErrNoEventLog is returned for rooms with no recorded log
+var ErrNoEventLog = errors.New("no event log for that room")
+
+// Event directions
+const (
+	EventIn  = "in"  // a client message the hub processed
+	EventOut = "out" // a message the hub broadcast to the room
+)
+
+// RoomEvent is one entry in a room's audit log
+type RoomEvent struct {
+	Seq       int             `json:"seq"`
+	At        time.Time       `json:"at"`
+	Direction string          `json:"direction"`
+	Type      string          `json:"type"`
+	ClientID  string          `json:"clientId,omitempty"` // sender of an incoming message
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// eventLog is a room's append-only record of traffic. It has its own
+// lock, taken after any other, so entries can be added with or without
+// room.mu held.
+type eventLog struct {
+	mu     sync.Mutex
+	next   int
+	events []RoomEvent
+
+	// Upload progress when recording is on, see recordChunk
+	opened   time.Time // when the first entry was logged
+	uploaded int       // Seq of the last entry uploaded
+	chunks   int
+}
+
+// unlogged are high-frequency messages that would drown out the rest
+var unlogged = map[string]bool{
+	MsgTypeCursor:       true,
+	MsgTypeCursorUpdate: true,
+	MsgTypeCursorBatch:  true,
+	MsgTypeViewport:     true,
+	MsgTypeViewports:    true,
+	MsgTypePing:         true,
+	MsgTypePong:         true,
+	MsgTypeRequestSync:  true,
+	MsgTypeStateResync:  true,
+}
+
+func (l *eventLog) add(direction, clientID string, msg Message) {
+	if unlogged[msg.Type] {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.next == 0 {
+		l.opened = time.Now()
+	}
+	l.next++
+	l.events = append(l.events, RoomEvent{
+		Seq:       l.next,
+		At:        time.Now(),
+		Direction: direction,
+		Type:      msg.Type,
+		ClientID:  clientID,
+		Payload:   msg.Payload,
+	})
+	if len(l.events) > maxRoomEvents+maxRoomEvents/4 {
+		l.events = append(l.events[:0:0], l.events[len(l.events)-maxRoomEvents:]...)
+	}
+}
+
+// since returns the entries after seq, oldest first
+func (l *eventLog) since(seq int) []RoomEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	events := make([]RoomEvent, 0, len(l.events))
+	for _, e := range l.events {
+		if e.Seq > seq {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// logIncoming records a client message against the room it's in
+func (h *Hub) logIncoming(client *Client, msg Message) {
+	if room := client.currentRoom(); room != nil {
+		if msg.Type == MsgTypeJoinRoom || msg.Type == MsgTypeRejoinRoom {
+			msg.Payload = withoutPassword(msg.Payload)
+		}
+		room.events.add(EventIn, client.id, msg)
+	}
+}
+
+// archiveLog keeps a closing room's log, forgetting the oldest archived
+// room past closedRoomLogs
+func (h *Hub) archiveLog(room *Room) {
+	h.logsMu.Lock()
+	defer h.logsMu.Unlock()
+
+	if h.closedLogs == nil {
+		h.closedLogs = make(map[string]*eventLog)
+	}
+	if _, ok := h.closedLogs[room.ID]; !ok {
+		h.closedOrder = append(h.closedOrder, room.ID)
+	}
+	h.closedLogs[room.ID] = &room.events
+	if len(h.closedOrder) > closedRoomLogs {
+		delete(h.closedLogs, h.closedOrder[0])
+		h.closedOrder = h.closedOrder[1:]
+	}
+}
+
+// RoomEvents returns a live or recently closed room's log entries after
+// seq, oldest first
+func (h *Hub) RoomEvents(roomID string, seq int) ([]RoomEvent, error) {
+	var log *eventLog
+	if room, ok := h.rooms.get(roomID); ok {
+		log = &room.events
+	} else {
+		h.logsMu.Lock()
+		log = h.closedLogs[roomID]
+		h.logsMu.Unlock()
+	}
+
+	if log == nil {
+		return nil, ErrNoEventLog
+	}
+	return log.since(seq), nil
+}
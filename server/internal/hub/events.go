@@ -0,0 +1,220 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/markotsymbaluk/wiki-racing/internal/cron"
+	"github.com/markotsymbaluk/wiki-racing/internal/graph"
+)
+
+const (
+	// eventCollection is the store collection holding recurring events
+	eventCollection = "events"
+	// eventInterval is how often recurring events are checked
+	eventInterval = 15 * time.Second
+	// eventLead is how long before its room opens an occurrence is
+	// scheduled, so it shows up in the schedule for players to register
+	eventLead = 30 * time.Minute
+)
+
+// ErrEventNotFound is returned for recurring events that don't exist
+var ErrEventNotFound = errors.New("event not found")
+
+// RecurringEvent runs a scheduled race every time its cron expression
+// fires, e.g. an hourly blitz or a weekend final. Occurrences without
+// articles or a theme get a random pair, from Tier when the link graph is
+// loaded.
+type RecurringEvent struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Cron        string      `json:"cron"` // five fields in UTC, e.g. "0 * * * *"
+	OpenMinutes int         `json:"openMinutes,omitempty"`
+	MinPlayers  int         `json:"minPlayers,omitempty"`
+	Tier        graph.Tier  `json:"tier,omitempty"`
+	Room        RoomOptions `json:"room"`
+	// Next is the next occurrence not scheduled yet
+	Next time.Time `json:"next"`
+}
+
+// AddEvent creates or replaces a recurring event. Replacing one with the
+// same expression keeps its next occurrence, so restarting with the same
+// config doesn't schedule an occurrence twice.
+func (h *Hub) AddEvent(e RecurringEvent) (RecurringEvent, error) {
+	schedule, err := cron.Parse(e.Cron)
+	if err != nil {
+		return RecurringEvent{}, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	switch {
+	case e.Name == "" || len(e.Name) > maxTitleLength:
+		return RecurringEvent{}, fmt.Errorf("%w: a name of up to %d characters is required", ErrInvalidSchedule, maxTitleLength)
+	case e.OpenMinutes < 0 || e.OpenMinutes > int(maxOpenBefore.Minutes()):
+		return RecurringEvent{}, fmt.Errorf("%w: rooms open between 1 and %d minutes ahead", ErrInvalidSchedule, int(maxOpenBefore.Minutes()))
+	case e.MinPlayers < 0 || e.MinPlayers > h.maxPlayers:
+		return RecurringEvent{}, fmt.Errorf("%w: the minimum must be between 1 and %d players", ErrInvalidSchedule, h.maxPlayers)
+	case e.Room.Password != "":
+		return RecurringEvent{}, fmt.Errorf("%w: scheduled races can't have a password", ErrInvalidSchedule)
+	case (e.Room.StartArticle == "") != (e.Room.EndArticle == ""):
+		return RecurringEvent{}, fmt.Errorf("%w: set both articles, or neither for a random pair", ErrInvalidSchedule)
+	}
+	if _, ok := parseMode(e.Room.Mode); !ok {
+		return RecurringEvent{}, ErrInvalidMode
+	}
+	if _, ok := parseLanguage(e.Room.Language); !ok {
+		return RecurringEvent{}, ErrInvalidLanguage
+	}
+	if e.Tier != "" {
+		if _, err := graph.ParseTier(string(e.Tier)); err != nil {
+			return RecurringEvent{}, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+	}
+	if e.Room.Theme == nil && e.Room.StartArticle != "" {
+		start, end, err := h.validateArticles(e.Room.Language, e.Room.StartArticle, e.Room.EndArticle)
+		if err != nil {
+			return RecurringEvent{}, err
+		}
+		e.Room.StartArticle, e.Room.EndArticle = start, end
+	}
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	e.Room.ID, e.Room.Private = "", false
+
+	h.scheduleMu.Lock()
+	defer h.scheduleMu.Unlock()
+	var existing RecurringEvent
+	found, err := h.store.Get(eventCollection, e.ID, &existing)
+	if err != nil {
+		return RecurringEvent{}, err
+	}
+	if found && existing.Cron == e.Cron && !existing.Next.IsZero() {
+		e.Next = existing.Next
+	} else {
+		e.Next = schedule.Next(time.Now().UTC())
+	}
+	if e.Next.IsZero() {
+		return RecurringEvent{}, fmt.Errorf("%w: %q never fires", ErrInvalidSchedule, e.Cron)
+	}
+	if err := h.store.Put(eventCollection, e.ID, e); err != nil {
+		return RecurringEvent{}, err
+	}
+	log.Printf("Event %q runs on %q, next at %s", e.Name, e.Cron, e.Next.Format(time.RFC3339))
+	return e, nil
+}
+
+// Events lists recurring events by name
+func (h *Hub) Events() ([]RecurringEvent, error) {
+	events := []RecurringEvent{}
+	err := h.store.Each(eventCollection, func(_ string, raw json.RawMessage) error {
+		var e RecurringEvent
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+		events = append(events, e)
+		return nil
+	})
+	sort.Slice(events, func(i, j int) bool { return events[i].Name < events[j].Name })
+	return events, err
+}
+
+// RemoveEvent stops a recurring event. Occurrences already scheduled
+// still run.
+func (h *Hub) RemoveEvent(id string) error {
+	h.scheduleMu.Lock()
+	defer h.scheduleMu.Unlock()
+	found, err := h.store.Get(eventCollection, id, &RecurringEvent{})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrEventNotFound
+	}
+	return h.store.Delete(eventCollection, id)
+}
+
+// watchEvents schedules each recurring event's next occurrence as it
+// comes up
+func (h *Hub) watchEvents() {
+	ticker := time.NewTicker(eventInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		events, err := h.Events()
+		if err != nil {
+			log.Printf("Failed to load events: %v", err)
+			continue
+		}
+		for _, e := range events {
+			h.runEvent(e, now.UTC())
+		}
+	}
+}
+
+// runEvent schedules an event's next occurrence once it's within
+// eventLead of opening. Occurrences missed while the server was down are
+// skipped.
+func (h *Hub) runEvent(e RecurringEvent, now time.Time) {
+	schedule, err := cron.Parse(e.Cron)
+	if err != nil {
+		log.Printf("Event %q has a bad expression: %v", e.Name, err)
+		return
+	}
+	next := e.Next
+	if !next.After(now) {
+		next = schedule.Next(now)
+	}
+	due := next
+	if next.Equal(e.Next) {
+		open := e.OpenMinutes
+		if open == 0 {
+			open = int(defaultOpenBefore.Minutes())
+		}
+		if now.Before(next.Add(-time.Duration(open)*time.Minute - eventLead)) {
+			return
+		}
+		due = schedule.Next(next)
+		h.scheduleOccurrence(e)
+	}
+
+	h.scheduleMu.Lock()
+	defer h.scheduleMu.Unlock()
+	var current RecurringEvent
+	if found, err := h.store.Get(eventCollection, e.ID, &current); err != nil || !found || !current.Next.Equal(e.Next) {
+		// Removed or replaced in the meantime
+		return
+	}
+	current.Next = due
+	if err := h.store.Put(eventCollection, e.ID, current); err != nil {
+		log.Printf("Failed to save event %q: %v", e.Name, err)
+	}
+}
+
+// scheduleOccurrence schedules the race for an event's next occurrence,
+// drawing its articles now unless they're fixed or themed
+func (h *Hub) scheduleOccurrence(e RecurringEvent) {
+	room := e.Room
+	if room.Theme == nil && room.StartArticle == "" {
+		start, end, err := h.candidatePair(room.Language, nil, e.Tier)
+		if err != nil {
+			log.Printf("Event %q skipped at %s, no articles: %v", e.Name, e.Next.Format(time.RFC3339), err)
+			return
+		}
+		room.StartArticle, room.EndArticle = start, end
+	}
+	race, err := h.scheduleRace(ScheduleOptions{
+		Title:       e.Name,
+		StartsAt:    e.Next,
+		OpenMinutes: e.OpenMinutes,
+		MinPlayers:  e.MinPlayers,
+		Room:        room,
+	}, e.ID)
+	if err != nil {
+		log.Printf("Event %q skipped at %s: %v", e.Name, e.Next.Format(time.RFC3339), err)
+		return
+	}
+	log.Printf("Event %q scheduled as race %s", e.Name, race.ID)
+}
@@ -0,0 +1,66 @@
+package hub
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// Clients may send messageRate messages a second on average, with
+	// bursts of up to messageBurst. Cursor updates count, so this sits
+	// above the web client's fastest cursor rate of ~60 a second.
+	messageRate  = 80
+	messageBurst = 160
+	// floodLimit consecutive rate-limited messages close the connection
+	// with CloseRateLimited
+	floodLimit = 200
+)
+
+// floodGuard is a client's inbound token bucket. It is only used from
+// readPump, so it needs no lock.
+type floodGuard struct {
+	tokens   float64
+	last     time.Time
+	limited  int       // consecutive messages rejected
+	notified time.Time // last RATE_LIMITED error sent
+}
+
+// allow takes a token, reporting false when the client is over its rate
+func (g *floodGuard) allow(now time.Time) bool {
+	if g.last.IsZero() {
+		g.tokens = messageBurst
+	} else {
+		g.tokens += now.Sub(g.last).Seconds() * messageRate
+		if g.tokens > messageBurst {
+			g.tokens = messageBurst
+		}
+	}
+	g.last = now
+
+	if g.tokens < 1 {
+		g.limited++
+		return false
+	}
+	g.tokens--
+	g.limited = 0
+	return true
+}
+
+// admit applies the flood policy to an inbound message, reporting whether
+// it should be handled. Rejected clients hear about it at most once a
+// second, and persistent flooders are disconnected.
+func (c *Client) admit() bool {
+	now := time.Now()
+	if c.flood.allow(now) {
+		return true
+	}
+	switch {
+	case c.flood.limited == floodLimit:
+		log.Printf("Client %s kept flooding, disconnecting", c.id)
+		go c.disconnect(CloseRateLimited, "rate limited")
+	case now.Sub(c.flood.notified) >= time.Second:
+		c.flood.notified = now
+		c.sendError(CodeRateLimited, "You're sending messages too fast")
+	}
+	return false
+}
@@ -0,0 +1,251 @@
+package hub
+
+import (
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/push"
+)
+
+// presenceInterval is how often friends are told about presence changes
+const presenceInterval = 2 * time.Second
+
+// Presence is what a signed-in player is up to, as their friends see it
+type Presence string
+
+const (
+	PresenceOffline Presence = "offline"
+	PresenceOnline  Presence = "online"   // connected, not in a room
+	PresenceInLobby Presence = "in_lobby" // in a room waiting to race
+	PresenceInRace  Presence = "in_race"
+)
+
+// presenceRank orders presences so an account connected from several
+// tabs shows the busiest one
+var presenceRank = map[Presence]int{
+	PresenceOffline: 0,
+	PresenceOnline:  1,
+	PresenceInLobby: 2,
+	PresenceInRace:  3,
+}
+
+// Friend is one entry in a friend list
+type Friend struct {
+	AccountID string   `json:"accountId"`
+	Username  string   `json:"username,omitempty"`
+	Status    Presence `json:"status"`
+}
+
+// FriendList is an account's friends with their presence, and its pending
+// requests
+type FriendList struct {
+	Friends  []Friend `json:"friends"`
+	Incoming []Friend `json:"incoming"`
+	Outgoing []Friend `json:"outgoing"`
+}
+
+// clientPresence works out what a client is doing
+func clientPresence(c *Client) Presence {
+	room := c.currentRoom()
+	if room == nil {
+		return PresenceOnline
+	}
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+	if room.Started && !room.Ended {
+		return PresenceInRace
+	}
+	return PresenceInLobby
+}
+
+// accountClients groups connected clients by account
+func (h *Hub) accountClients() map[string][]*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	clients := make(map[string][]*Client)
+	for c := range h.clients {
+		if c.accountID != "" {
+			clients[c.accountID] = append(clients[c.accountID], c)
+		}
+	}
+	return clients
+}
+
+// presences returns every signed-in account's presence; accounts missing
+// from the map are offline
+func presences(clients map[string][]*Client) map[string]Presence {
+	result := make(map[string]Presence, len(clients))
+	for account, cs := range clients {
+		best := PresenceOffline
+		for _, c := range cs {
+			if p := clientPresence(c); presenceRank[p] > presenceRank[best] {
+				best = p
+			}
+		}
+		result[account] = best
+	}
+	return result
+}
+
+// Presence returns an account's current presence
+func (h *Hub) Presence(accountID string) Presence {
+	if p, ok := presences(h.accountClients())[accountID]; ok {
+		return p
+	}
+	return PresenceOffline
+}
+
+// watchPresence pushes friend_status to online friends whenever an
+// account's presence changes. Polling keeps joins, leaves, race starts
+// and disconnects from each needing a hook.
+func (h *Hub) watchPresence() {
+	ticker := time.NewTicker(presenceInterval)
+	defer ticker.Stop()
+
+	last := make(map[string]Presence)
+	for range ticker.C {
+		clients := h.accountClients()
+		current := presences(clients)
+		for account, p := range current {
+			if last[account] != p {
+				h.notifyFriends(clients, account, p)
+			}
+		}
+		for account := range last {
+			if _, ok := current[account]; !ok {
+				h.notifyFriends(clients, account, PresenceOffline)
+			}
+		}
+		last = current
+	}
+}
+
+// notifyFriends sends an account's presence to its friends' connections
+func (h *Hub) notifyFriends(clients map[string][]*Client, account string, p Presence) {
+	list, err := h.social.Get(account)
+	if err != nil {
+		log.Printf("Failed to load friends of %s: %v", account, err)
+		return
+	}
+	msg := friendStatusMessage(account, p)
+	for _, friend := range list.Friends {
+		for _, c := range clients[friend] {
+			c.sendMessage(msg)
+		}
+	}
+}
+
+func friendStatusMessage(account string, p Presence) Message {
+	return Message{
+		Type:    MsgTypeFriendStatus,
+		Payload: mustMarshal(map[string]interface{}{"accountId": account, "status": p}),
+	}
+}
+
+// sendToAccount sends a message to every connection of an account
+func (h *Hub) sendToAccount(account string, msg Message) {
+	for _, c := range h.accountClients()[account] {
+		c.sendMessage(msg)
+	}
+}
+
+// Friends returns an account's friend list with presence
+func (h *Hub) Friends(accountID string) (FriendList, error) {
+	list, err := h.social.Get(accountID)
+	if err != nil {
+		return FriendList{}, err
+	}
+	current := presences(h.accountClients())
+	view := func(ids []string) []Friend {
+		friends := make([]Friend, 0, len(ids))
+		for _, id := range ids {
+			status, ok := current[id]
+			if !ok {
+				status = PresenceOffline
+			}
+			friends = append(friends, Friend{AccountID: id, Username: h.username(id), Status: status})
+		}
+		return friends
+	}
+	return FriendList{
+		Friends:  view(list.Friends),
+		Incoming: view(list.Incoming),
+		Outgoing: view(list.Outgoing),
+	}, nil
+}
+
+// RequestFriend sends a friend request, or accepts one going the other
+// way, and tells the other account if they're online
+func (h *Hub) RequestFriend(from, to string) error {
+	accepted, err := h.social.Request(from, to)
+	if err != nil {
+		return err
+	}
+	if accepted {
+		h.announceFriendship(from, to)
+		return nil
+	}
+	h.sendToAccount(to, Message{
+		Type:    MsgTypeFriendRequest,
+		Payload: mustMarshal(Friend{AccountID: from, Username: h.username(from), Status: h.Presence(from)}),
+	})
+	return nil
+}
+
+// AnswerFriend accepts or declines a friend request
+func (h *Hub) AnswerFriend(accountID, from string, accept bool) error {
+	if !accept {
+		return h.social.Decline(accountID, from)
+	}
+	if err := h.social.Accept(accountID, from); err != nil {
+		return err
+	}
+	h.announceFriendship(accountID, from)
+	return nil
+}
+
+// RemoveFriend ends a friendship or withdraws a request
+func (h *Hub) RemoveFriend(accountID, friend string) error {
+	return h.social.Remove(accountID, friend)
+}
+
+// announceFriendship sends new friends each other's presence
+func (h *Hub) announceFriendship(a, b string) {
+	h.sendToAccount(a, friendStatusMessage(b, h.Presence(b)))
+	h.sendToAccount(b, friendStatusMessage(a, h.Presence(a)))
+}
+
+// username looks up an account's name, "" if accounts aren't enabled
+func (h *Hub) username(accountID string) string {
+	if h.auth == nil {
+		return ""
+	}
+	account, err := h.auth.Account(accountID)
+	if err != nil {
+		return ""
+	}
+	return account.Username
+}
+
+// NotifyStarting reminds the accounts registered for a race that it's
+// about to start. Connected players see the room in the lobby, so only
+// those who aren't connected get a push notification.
+func (h *Hub) NotifyStarting(accountIDs []string, roomID, title string, startsAt time.Time) {
+	if h.push == nil {
+		return
+	}
+	connected := h.accountClients()
+	for _, id := range accountIDs {
+		if len(connected[id]) > 0 {
+			continue
+		}
+		h.push.Send(id, push.Notification{
+			Type:  "race_starting",
+			Title: title + " is about to start",
+			Body:  "Starts at " + startsAt.UTC().Format("15:04 UTC"),
+			URL:   "/race-lobby?code=" + url.QueryEscape(roomID),
+			Data:  map[string]interface{}{"roomId": roomID, "startsAt": startsAt},
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package hub
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ghostCollection is the store collection holding recorded ghosts
+const ghostCollection = "ghosts"
+
+// ErrGhostNotFound is returned when a requested ghost isn't recorded
+var ErrGhostNotFound = errors.New("ghost not found")
+
+// GhostStep is one navigation in a recorded run, timed from the race start
+type GhostStep struct {
+	Article string `json:"article"`
+	At      int64  `json:"at"` // ms since the race started
+}
+
+// Ghost is a finished player's timed path, replayed as a virtual player
+// so later racers can compete against it
+type Ghost struct {
+	ID           string      `json:"id"`
+	PlayerName   string      `json:"playerName"`
+	StartArticle string      `json:"startArticle"`
+	EndArticle   string      `json:"endArticle"`
+	Checkpoints  []string    `json:"checkpoints,omitempty"`
+	Mode         GameMode    `json:"mode"`
+	Language     string      `json:"language,omitempty"`
+	Time         int64       `json:"time"`
+	Clicks       int         `json:"clicks"`
+	Steps        []GhostStep `json:"steps"`
+	RecordedAt   time.Time   `json:"recordedAt"`
+}
+
+// recordGhost captures a just-finished player's run. Ghosts themselves,
+// relay legs, arcade races, late joiners, and runs on another edition in
+// cross-language races aren't recorded. Caller must hold room.mu.
+func (r *Room) recordGhost(player *Player) *Ghost {
+	if player.virtual() || player.Late || r.Config.Relay || r.Config.Arcade || !player.Finished || r.playerLanguage(player) != r.Language {
+		return nil
+	}
+	return &Ghost{
+		ID:           uuid.New().String(),
+		PlayerName:   player.Name,
+		StartArticle: r.StartArticle,
+		EndArticle:   r.EndArticle,
+		Checkpoints:  r.Config.Checkpoints,
+		Mode:         r.Mode,
+		Language:     r.Language,
+		Time:         player.FinishTime,
+		Clicks:       player.Clicks,
+		Steps:        append([]GhostStep(nil), player.steps...),
+		RecordedAt:   time.Now(),
+	}
+}
+
+// saveGhost persists a recorded run and tells its player the ghost ID
+// they can share
+func (h *Hub) saveGhost(client *Client, ghost *Ghost) {
+	if ghost == nil {
+		return
+	}
+	if err := h.store.Put(ghostCollection, ghost.ID, ghost); err != nil {
+		log.Printf("Failed to save ghost for %s: %v", ghost.PlayerName, err)
+		return
+	}
+	client.sendMessage(Message{
+		Type: MsgTypeGhostSaved,
+		Payload: mustMarshal(map[string]interface{}{
+			"ghostId": ghost.ID,
+			"time":    ghost.Time,
+			"clicks":  ghost.Clicks,
+		}),
+	})
+}
+
+// Ghost loads a recorded run by ID
+func (h *Hub) Ghost(id string) (*Ghost, error) {
+	var ghost Ghost
+	found, err := h.store.Get(ghostCollection, id, &ghost)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrGhostNotFound
+	}
+	return &ghost, nil
+}
+
+// addGhost seats a recorded run in the room as an always-ready virtual
+// player. Caller must hold room.mu.
+func (r *Room) addGhost(ghost *Ghost) {
+	r.ghost = ghost
+	r.Players[ghostPlayerID(ghost)] = &Player{
+		ID:             ghostPlayerID(ghost),
+		Name:           ghost.PlayerName + " (ghost)",
+		CurrentArticle: r.StartArticle,
+		Path:           []string{r.StartArticle},
+		Ready:          true,
+		Ghost:          true,
+	}
+}
+
+func ghostPlayerID(ghost *Ghost) string {
+	return "ghost:" + ghost.ID
+}
+
+// humanCount returns how many players in the room aren't ghosts or bots.
+// Caller must hold room.mu.
+func (r *Room) humanCount() int {
+	n := 0
+	for _, p := range r.Players {
+		if !p.virtual() {
+			n++
+		}
+	}
+	return n
+}
+
+// replayGhost walks the room's ghost through its recorded steps on the
+// race clock, broadcasting each move like a real player's navigate
+func (h *Hub) replayGhost(room *Room) {
+	room.mu.RLock()
+	ghost := room.ghost
+	room.mu.RUnlock()
+	if ghost == nil {
+		return
+	}
+
+	id := ghostPlayerID(ghost)
+	for i, step := range ghost.Steps {
+		if !h.waitRaceTime(room, step.At) {
+			return
+		}
+
+		if !h.moveVirtual(room, id, step.Article, i == len(ghost.Steps)-1) {
+			return
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package hub
+
+import (
+	"encoding/json"
+	"log"
+)
+
+const (
+	maxHandicapSeconds = 600
+	maxHandicapClicks  = 20
+)
+
+// Handicap evens out a mixed-skill race. The bonus comes off a player's
+// finish time and the extra clicks off their click count when scoring;
+// the race itself is unchanged.
+type Handicap struct {
+	TimeBonusSeconds int `json:"timeBonusSeconds,omitempty"`
+	ExtraClicks      int `json:"extraClicks,omitempty"`
+}
+
+type SetHandicapPayload struct {
+	PlayerID string `json:"playerId"`
+	Handicap
+}
+
+// handleSetHandicap lets the host give a player a handicap before the
+// race. Zero values clear it.
+func (h *Hub) handleSetHandicap(room *Room, client *Client, payload json.RawMessage) {
+	var p SetHandicapPayload
+	if err := json.Unmarshal(payload, &p); err != nil || p.PlayerID == "" {
+		client.sendError(CodeBadRequest, "Invalid set_handicap payload")
+		return
+	}
+	if p.TimeBonusSeconds < 0 || p.TimeBonusSeconds > maxHandicapSeconds ||
+		p.ExtraClicks < 0 || p.ExtraClicks > maxHandicapClicks {
+		client.sendError(CodeInvalidSettings, "Handicaps allow up to 600 bonus seconds and 20 extra clicks")
+		return
+	}
+
+	if !isHost(room, client) {
+		client.sendError(CodeNotHost, "Only host can set handicaps")
+		return
+	}
+
+	room.mu.Lock()
+	player, exists := room.Players[p.PlayerID]
+	switch {
+	case room.Started:
+		room.mu.Unlock()
+		client.sendError(CodeRaceStarted, "Cannot change handicaps after race has started")
+		return
+	case room.Ranked:
+		room.mu.Unlock()
+		client.sendError(CodeNotAllowed, "Ranked races can't use handicaps")
+		return
+	case !exists || player.virtual():
+		room.mu.Unlock()
+		client.sendError(CodeNotFound, "Player not found")
+		return
+	}
+	if p.Handicap == (Handicap{}) {
+		player.Handicap = nil
+	} else {
+		handicap := p.Handicap
+		player.Handicap = &handicap
+	}
+	state := mustMarshal(room)
+	room.mu.Unlock()
+
+	log.Printf("Room %s: handicap for %s set to %+v", room.ID, p.PlayerID, p.Handicap)
+
+	h.broadcastToRoom(room, Message{
+		Type:    MsgTypeRoomState,
+		Payload: state,
+	}, nil)
+}
+
+// scored returns the finish time (ms) and clicks a player is scored on,
+// after their handicap
+func (p *Player) scored() (int64, int) {
+	if p.Handicap == nil {
+		return p.FinishTime, p.Clicks
+	}
+	finishTime := p.FinishTime - int64(p.Handicap.TimeBonusSeconds)*1000
+	if finishTime < 0 {
+		finishTime = 0
+	}
+	clicks := p.Clicks - p.Handicap.ExtraClicks
+	if clicks < 0 {
+		clicks = 0
+	}
+	return finishTime, clicks
+}
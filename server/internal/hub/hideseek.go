@@ -0,0 +1,187 @@
+package hub
+
+import (
+	"encoding/json"
+	"math/rand"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+// hideHeadStart is how long seekers are frozen at the start of a hide and
+// seek race, so the hider can get away from the start article
+const hideHeadStart = 20 * time.Second
+
+// hideAndSeekCheck rejects room setups hide and seek can't support,
+// returning the reason or "". Without a time limit the hider could never
+// win, and bots and ghosts race to the end article instead of seeking.
+// Caller must hold room.mu.
+func (r *Room) hideAndSeekCheck() string {
+	if !r.Config.HideAndSeek {
+		return ""
+	}
+	switch {
+	case r.Config.Relay || len(r.Config.Checkpoints) > 0:
+		return "Hide and seek can't use checkpoints or relay"
+	case r.Config.CrossLanguage || r.Config.Philosophy || r.Config.clickBudget() > 0:
+		return "Hide and seek can't be combined with other race rules"
+	case r.Config.timeLimit() == 0:
+		return "Hide and seek needs a time limit"
+	case r.StartArticle == "":
+		return "Pick a start article first"
+	case r.humanCount() < 2:
+		return "Hide and seek needs at least two players"
+	}
+	for _, p := range r.Players {
+		if p.virtual() {
+			return "Bots and ghosts can't play hide and seek"
+		}
+	}
+	return ""
+}
+
+// startHideAndSeek picks a random player to hide and freezes everyone
+// else for the head start. Caller must hold room.mu.
+func (r *Room) startHideAndSeek() {
+	if !r.Config.HideAndSeek {
+		return
+	}
+	ids := make([]string, 0, len(r.Players))
+	for id := range r.Players {
+		ids = append(ids, id)
+	}
+	r.Hider = ids[rand.Intn(len(ids))]
+	until := time.Now().Add(hideHeadStart)
+	for id, p := range r.Players {
+		if id != r.Hider {
+			p.frozenUntil = until
+		}
+	}
+}
+
+// hiding reports whether a player's position is kept from the rest of
+// the room: they're the hider and the race is on. Caller must hold
+// room.mu.
+func (r *Room) hiding(id string) bool {
+	return r.Config.HideAndSeek && r.Started && !r.Ended && id == r.Hider
+}
+
+// caught reports whether a seeker just landed on the hider's article.
+// Caller must hold room.mu.
+func (r *Room) caught(seeker *Player) bool {
+	hider, ok := r.Players[r.Hider]
+	return ok && seeker.ID != r.Hider && !hider.Forfeited &&
+		wiki.SameArticleIn(r.Language, seeker.CurrentArticle, hider.CurrentArticle)
+}
+
+// catchMessage is the player_caught broadcast, which reveals where the
+// hider was. Caller must hold room.mu.
+func (r *Room) catchMessage(seeker *Player) Message {
+	return Message{
+		Type: MsgTypePlayerCaught,
+		Payload: mustMarshal(map[string]interface{}{
+			"seekerId": seeker.ID,
+			"hiderId":  r.Hider,
+			"article":  seeker.CurrentArticle,
+			"time":     r.elapsed(),
+		}),
+	}
+}
+
+// hiderMovedMessage tells seekers the hider clicked, without saying
+// where to. Caller must hold room.mu.
+func (r *Room) hiderMovedMessage(hider *Player) Message {
+	return Message{
+		Type: MsgTypeHiderMoved,
+		Payload: mustMarshal(map[string]interface{}{
+			"playerId": hider.ID,
+			"clicks":   hider.Clicks,
+		}),
+	}
+}
+
+// escape finishes a hider nobody caught when the race ends, ranking them
+// first. Caller must hold room.mu.
+func (r *Room) escape() {
+	if !r.Config.HideAndSeek {
+		return
+	}
+	hider, ok := r.Players[r.Hider]
+	if !ok || hider.Forfeited {
+		return
+	}
+	for _, p := range r.Players {
+		if p.Finished {
+			return
+		}
+	}
+	r.markFinished(hider)
+}
+
+// MarshalJSON leaves the hider's article and path out of the room state
+// while they're hiding. The hider learns their own position from their
+// player_update, and seekers from proximity_update how close they are.
+func (r *Room) MarshalJSON() ([]byte, error) {
+	type plain Room
+	hider, ok := r.Players[r.Hider]
+	if !ok || !r.hiding(r.Hider) {
+		return json.Marshal((*plain)(r))
+	}
+
+	hidden := *hider
+	hidden.CurrentArticle, hidden.Path = "", nil
+	players := make(map[string]*Player, len(r.Players))
+	for id, p := range r.Players {
+		players[id] = p
+	}
+	players[r.Hider] = &hidden
+	return json.Marshal(struct {
+		*plain
+		Players map[string]*Player `json:"players"`
+	}{(*plain)(r), players})
+}
+
+// Proximity is how many links a seeker is from the hider, -1 if unknown
+type Proximity struct {
+	PlayerID string `json:"playerId"`
+	Distance int    `json:"distance"`
+}
+
+// proximityClients returns who gets proximity updates: the hider, and
+// each seeker by ID. Caller must hold room.mu.
+func (r *Room) proximityClients() (*Client, map[string]*Client) {
+	var hider *Client
+	seekers := make(map[string]*Client, len(r.Players))
+	for id, p := range r.Players {
+		switch {
+		case p.client == nil || p.Forfeited:
+		case id == r.Hider:
+			hider = p.client
+		default:
+			seekers[id] = p.client
+		}
+	}
+	return hider, seekers
+}
+
+// sendProximity tells each seeker how far they are from the hider, and
+// the hider how far every seeker is, from distances sendProgress measured.
+// Like progress updates it needs the offline graph.
+func sendProximity(hider *Client, seekers map[string]*Client, progress []Progress) {
+	all := make([]Proximity, 0, len(progress))
+	for _, p := range progress {
+		all = append(all, Proximity{PlayerID: p.PlayerID, Distance: p.Distance})
+		if c, ok := seekers[p.PlayerID]; ok {
+			c.sendMessage(Message{
+				Type:    MsgTypeProximity,
+				Payload: mustMarshal(map[string]interface{}{"distance": p.Distance}),
+			})
+		}
+	}
+	if hider != nil {
+		hider.sendMessage(Message{
+			Type:    MsgTypeProximity,
+			Payload: mustMarshal(map[string]interface{}{"seekers": all}),
+		})
+	}
+}
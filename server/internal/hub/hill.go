@@ -0,0 +1,200 @@
+package hub
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+const (
+	// maxHillMinutes caps how long a king of the hill target lasts
+	maxHillMinutes = 60
+	// hillCheckInterval is how often running hills are checked for a
+	// target that's due to rotate
+	hillCheckInterval = 2 * time.Second
+	// hillFirstPoints is what the first player to reach a target scores.
+	// Each later player scores one less, down to hillMinPoints.
+	hillFirstPoints = 5
+	hillMinPoints   = 1
+)
+
+// hillInterval returns how long each king of the hill target lasts, or 0
+// when the room isn't a hill
+func (c RoomConfig) hillInterval() time.Duration {
+	switch {
+	case c.HillMinutes <= 0:
+		return 0
+	case c.HillMinutes > maxHillMinutes:
+		return maxHillMinutes * time.Minute
+	}
+	return time.Duration(c.HillMinutes) * time.Minute
+}
+
+// hillCheck rejects room setups king of the hill can't support, returning
+// the reason or "". Caller must hold room.mu.
+func (r *Room) hillCheck() string {
+	if r.Config.hillInterval() == 0 {
+		return ""
+	}
+	switch {
+	case r.Config.Relay || len(r.Config.Checkpoints) > 0:
+		return "King of the hill can't use checkpoints or relay"
+	case r.Config.CrossLanguage || r.Config.Philosophy || r.Config.clickBudget() > 0 || r.Config.HideAndSeek:
+		return "King of the hill can't be combined with other race rules"
+	case r.StartArticle == "" || r.EndArticle == "":
+		return "Pick start and end articles first"
+	}
+	for _, p := range r.Players {
+		if p.virtual() {
+			return "Bots and ghosts can't play king of the hill"
+		}
+	}
+	return ""
+}
+
+// startHill makes the room's end article the first target. Caller must
+// hold room.mu.
+func (r *Room) startHill() {
+	if interval := r.Config.hillInterval(); interval > 0 {
+		r.Round = 1
+		r.NextRotation = interval.Milliseconds()
+	}
+}
+
+// scoreHill awards points to a player on the current target who hasn't
+// scored it yet, fewer the more players got there first. Caller must
+// hold room.mu.
+func (r *Room) scoreHill(player *Player) bool {
+	if player.scoredRound == r.Round || !wiki.SameArticleIn(r.Language, player.CurrentArticle, r.EndArticle) {
+		return false
+	}
+	before := 0
+	for _, p := range r.Players {
+		if p.scoredRound == r.Round {
+			before++
+		}
+	}
+	player.scoredRound = r.Round
+	player.Points += max(hillFirstPoints-before, hillMinPoints)
+	return true
+}
+
+// HillScore is one player's line on a king of the hill scoreboard
+type HillScore struct {
+	PlayerID   string `json:"playerId"`
+	PlayerName string `json:"playerName"`
+	Points     int    `json:"points"`
+	Scored     bool   `json:"scored"` // reached the current target
+}
+
+// hillScores ranks players by points, then name. Caller must hold
+// room.mu.
+func (r *Room) hillScores() []HillScore {
+	scores := make([]HillScore, 0, len(r.Players))
+	for _, p := range r.Players {
+		scores = append(scores, HillScore{
+			PlayerID:   p.ID,
+			PlayerName: p.Name,
+			Points:     p.Points,
+			Scored:     p.scoredRound == r.Round,
+		})
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].Points != scores[j].Points {
+			return scores[i].Points > scores[j].Points
+		}
+		return scores[i].PlayerName < scores[j].PlayerName
+	})
+	return scores
+}
+
+// scoreboardMessage is the scoreboard broadcast after every score and
+// rotation. Caller must hold room.mu.
+func (r *Room) scoreboardMessage() Message {
+	return Message{
+		Type: MsgTypeScoreboard,
+		Payload: mustMarshal(map[string]interface{}{
+			"round":        r.Round,
+			"target":       r.EndArticle,
+			"nextRotation": r.NextRotation,
+			"elapsed":      r.elapsed(),
+			"scores":       r.hillScores(),
+		}),
+	}
+}
+
+// hillStandings ranks a finished hill by points, with no DNFs: players
+// drop in and out, so everyone keeps what they scored. Caller must hold
+// room.mu.
+func (r *Room) hillStandings() []Standing {
+	scores := r.hillScores()
+	result := make([]Standing, 0, len(scores))
+	for i, s := range scores {
+		p := r.Players[s.PlayerID]
+		result = append(result, Standing{
+			PlayerID:   s.PlayerID,
+			PlayerName: s.PlayerName,
+			Rank:       i + 1,
+			Clicks:     p.Clicks,
+			Points:     s.Points,
+		})
+	}
+	return result
+}
+
+// watchHills rotates the target of every king of the hill room once its
+// time is up. Due times are in race time, so pauses and restarts don't
+// cut a target short.
+func (h *Hub) watchHills() {
+	ticker := time.NewTicker(hillCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, room := range h.rooms.all() {
+			room.mu.RLock()
+			due := room.Config.hillInterval() > 0 && room.Started && !room.Ended && !room.Paused &&
+				room.elapsed() >= room.NextRotation
+			round, lang, current := room.Round, room.Language, room.EndArticle
+			room.mu.RUnlock()
+			if due {
+				h.rotateHill(room, round, lang, current)
+			}
+		}
+	}
+}
+
+// rotateHill picks the next target and hands it to the room. If Wikipedia
+// can't be reached the current target stays until the next check.
+func (h *Hub) rotateHill(room *Room, round int, lang, current string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	a, b, err := h.randomPair(ctx, lang, "")
+	cancel()
+	if err != nil {
+		log.Printf("Failed to pick the next hill target for room %s: %v", room.ID, err)
+		return
+	}
+	target := b
+	if wiki.SameArticleIn(lang, target, current) {
+		target = a
+	}
+
+	room.post(func() {
+		room.mu.Lock()
+		// Another check may have rotated it already
+		if room.Round != round || room.Ended {
+			room.mu.Unlock()
+			return
+		}
+		room.EndArticle = target
+		room.Round++
+		room.NextRotation = room.elapsed() + room.Config.hillInterval().Milliseconds()
+		msg := room.scoreboardMessage()
+		room.mu.Unlock()
+
+		log.Printf("Room %s hill target is now %s", room.ID, target)
+		h.broadcastToRoom(room, msg, nil)
+	})
+}
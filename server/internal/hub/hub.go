@@ -1,35 +1,142 @@
 package hub
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/achievement"
+	"github.com/markotsymbaluk/wiki-racing/internal/analytics"
+	"github.com/markotsymbaluk/wiki-racing/internal/auth"
+	"github.com/markotsymbaluk/wiki-racing/internal/edge"
+	"github.com/markotsymbaluk/wiki-racing/internal/graph"
+	"github.com/markotsymbaluk/wiki-racing/internal/moderation"
+	"github.com/markotsymbaluk/wiki-racing/internal/push"
+	"github.com/markotsymbaluk/wiki-racing/internal/rating"
+	"github.com/markotsymbaluk/wiki-racing/internal/recording"
+	"github.com/markotsymbaluk/wiki-racing/internal/social"
+	"github.com/markotsymbaluk/wiki-racing/internal/stats"
+	"github.com/markotsymbaluk/wiki-racing/internal/store"
+	"github.com/markotsymbaluk/wiki-racing/internal/webhook"
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Message types
 const (
-	MsgTypeJoinRoom      = "join_room"
-	MsgTypeRejoinRoom    = "rejoin_room"
-	MsgTypeLeaveRoom     = "leave_room"
-	MsgTypeUpdateRoom    = "update_room"
-	MsgTypeStartRace     = "start_race"
-	MsgTypeNavigate      = "navigate"
-	MsgTypeFinish        = "finish"
-	MsgTypeCursor        = "cursor"
-	MsgTypeRoomState     = "room_state"
-	MsgTypePlayerJoined  = "player_joined"
-	MsgTypePlayerLeft    = "player_left"
-	MsgTypeRaceStarted   = "race_started"
-	MsgTypePlayerUpdate  = "player_update"
-	MsgTypePlayerFinish  = "player_finish"
-	MsgTypeCursorUpdate  = "cursor_update"
-	MsgTypeError         = "error"
+	MsgTypeJoinRoom       = "join_room"
+	MsgTypeRejoinRoom     = "rejoin_room"
+	MsgTypeLeaveRoom      = "leave_room"
+	MsgTypeUpdateRoom     = "update_room"
+	MsgTypeStartRace      = "start_race"
+	MsgTypeNavigate       = "navigate"
+	MsgTypeFinish         = "finish"
+	MsgTypeCursor         = "cursor"
+	MsgTypeRoomState      = "room_state"
+	MsgTypePlayerJoined   = "player_joined"
+	MsgTypePlayerLeft     = "player_left"
+	MsgTypeRaceStarted    = "race_started"
+	MsgTypePlayerUpdate   = "player_update"
+	MsgTypePlayerFinish   = "player_finish"
+	MsgTypeCursorUpdate   = "cursor_update"
+	MsgTypeCursorBatch    = "cursor_batch"
+	MsgTypeRaceSummary    = "race_summary"
+	MsgTypeRuleViolation  = "rule_violation"
+	MsgTypeRoomClosed     = "room_closed"
+	MsgTypeListRooms      = "list_rooms"
+	MsgTypeRoomListUpdate = "room_list_update"
+	MsgTypeFindMatch      = "find_match"
+	MsgTypeCancelMatch    = "cancel_match"
+	MsgTypeMatchStatus    = "match_status"
+	MsgTypeMatchFound     = "match_found"
+	MsgTypePing           = "ping"
+	MsgTypePong           = "pong"
+	MsgTypeStateResync    = "state_resync"
+	MsgTypeRequestSync    = "request_sync"
+	MsgTypeRaceEnded      = "race_ended"
+	MsgTypeForfeit        = "forfeit"
+	MsgTypePlayerForfeit  = "player_forfeit"
+	MsgTypeSetReady       = "set_ready"
+	MsgTypeReadyState     = "ready_state"
+	MsgTypeSetTeam        = "set_team"
+	MsgTypeTeamUpdate     = "team_update"
+	MsgTypeGhostSaved     = "ghost_saved"
+	MsgTypeAddBot         = "add_bot"
+	MsgTypeRemoveBot      = "remove_bot"
+	MsgTypePauseRace      = "pause_race"
+	MsgTypeResumeRace     = "resume_race"
+	MsgTypeRacePaused     = "race_paused"
+	MsgTypeRaceResumed    = "race_resumed"
+	MsgTypeRematch        = "rematch"
+	MsgTypeRoomReset      = "room_reset"
+	MsgTypePreloadHints   = "preload_hints"
+	MsgTypeUsePowerUp     = "use_power_up"
+	MsgTypePowerUpGranted = "power_up_granted"
+	MsgTypePowerUpUsed    = "power_up_used"
+	MsgTypePeekResult     = "peek_result"
+	MsgTypeSetHandicap    = "set_handicap"
+	MsgTypeAfkWarning     = "afk_warning"
+	MsgTypeKickPlayer     = "kick_player"
+	MsgTypeKicked         = "kicked"
+	MsgTypeAchievement    = "achievement_unlocked"
+	MsgTypeHello          = "hello"
+	MsgTypeWelcome        = "welcome"
+	MsgTypeAnnouncement   = "announcement"
+	MsgTypeRequestJoin    = "request_join_race"
+	MsgTypeJoinRequest    = "join_race_request"
+	MsgTypeApproveJoin    = "approve_join_race"
+	MsgTypeJoinAnswer     = "join_race_answer"
+	MsgTypeSetAppearance  = "set_appearance"
+	MsgTypeAppearance     = "player_appearance"
+	MsgTypeViewport       = "viewport"
+	MsgTypeViewports      = "viewport_batch"
+	MsgTypeProgressUpdate = "progress_update"
+	MsgTypeRaceClock      = "race_clock"
+	MsgTypeHiderMoved     = "hider_moved"
+	MsgTypePlayerCaught   = "player_caught"
+	MsgTypeProximity      = "proximity_update"
+	MsgTypeScoreboard     = "scoreboard"
+	MsgTypeStartVote      = "start_vote"
+	MsgTypeVote           = "vote"
+	MsgTypeVoteStarted    = "vote_started"
+	MsgTypeVoteUpdate     = "vote_update"
+	MsgTypeVoteEnded      = "vote_ended"
+	MsgTypeBanPair        = "ban_pair"
+	MsgTypeVetoState      = "veto_state"
+	MsgTypeVetoEnded      = "veto_ended"
+	MsgTypeStartSeries    = "start_series"
+	MsgTypeSeriesState    = "series_state"
+	MsgTypePartyInvite    = "party_invite"
+	MsgTypePartyAccept    = "party_accept"
+	MsgTypePartyDecline   = "party_decline"
+	MsgTypePartyLeave     = "party_leave"
+	MsgTypePartyInvited   = "party_invited"
+	MsgTypePartyState     = "party_state"
+	MsgTypePartyLeft      = "party_left"
+	MsgTypeFriendRequest  = "friend_request"
+	MsgTypeFriendStatus   = "friend_status"
+	MsgTypeInvitePlayer   = "invite_player"
+	MsgTypeInviteAccept   = "invite_accept"
+	MsgTypeInviteDecline  = "invite_decline"
+	MsgTypePlayerInvited  = "player_invited"
+	MsgTypeInviteAnswered = "invite_answered"
+	MsgTypeRaceReminder   = "race_reminder"
+	MsgTypeRaceCancelled  = "race_cancelled"
+	MsgTypeMigrate        = "migrate"
+	MsgTypeResume         = "resume"
+	MsgTypeError          = "error"
 )
 
-// Message is the base structure for all WebSocket messages
+// Message is the base structure for all WebSocket messages. Seq numbers
+// a room's broadcasts in order, see seq.go; other messages leave it 0.
 type Message struct {
 	Type    string          `json:"type"`
 	Payload json.RawMessage `json:"payload"`
+	Seq     uint64          `json:"seq,omitempty"`
 }
 
 // Room represents a racing room
@@ -39,189 +146,708 @@ type Room struct {
 	HostID       string             `json:"hostId"` // ID of the player who created the room
 	StartArticle string             `json:"startArticle"`
 	EndArticle   string             `json:"endArticle"`
+	Mode         GameMode           `json:"mode"`
+	Language     string             `json:"language"` // Wikipedia edition, fixed at creation
+	Config       RoomConfig         `json:"config"`
+	Theme        *Theme             `json:"theme,omitempty"`
+	Private      bool               `json:"private"` // hidden from the room browser
+	Locked       bool               `json:"locked"`  // joining needs the room password
+	Ranked       bool               `json:"ranked"`  // results update player ratings
 	Started      bool               `json:"started"`
+	StartedAt    time.Time          `json:"startedAt,omitempty"`
+	Ended        bool               `json:"ended"`
+	Paused       bool               `json:"paused,omitempty"`
+	Teams        map[string]*Team   `json:"teams,omitempty"`        // relay teams by name
+	Hider        string             `json:"hider,omitempty"`        // player the others seek, see hideseek.go
+	Round        int                `json:"round,omitempty"`        // king of the hill target number, see hill.go
+	NextRotation int64              `json:"nextRotation,omitempty"` // race time (ms) the hill target changes
+	Vote         *Vote              `json:"vote,omitempty"`         // running poll over article pairs, see vote.go
+	Veto         *Veto              `json:"veto,omitempty"`         // ranked 1v1 ban phase, see veto.go
+	Series       *Series            `json:"series,omitempty"`       // best-of-N match this room is playing, see series.go
+	ScheduledFor time.Time          `json:"scheduledFor,omitempty"` // a scheduled race starts itself then, see schedule.go
+	Event        string             `json:"event,omitempty"`        // title of the scheduled race or event this room runs
 	mu           sync.RWMutex
+	timer        *time.Timer     // fires when the race time limit expires
+	ghost        *Ghost          // recorded run replayed against this room
+	optimal      []string        // shortest route through the race, see planOptimal
+	banned       map[string]bool // rating keys of players the host banned
+	passwordHash []byte          // bcrypt hash, nil for open rooms
+	eventID      string          // recurring event the room's race belongs to, see events.go
+
+	// Clients watching without racing, see spectators.go
+	Spectators map[string]*Spectator `json:"spectators,omitempty"`
+
+	// Pause bookkeeping: elapsed() subtracts pausedFor, and resume is
+	// closed when a paused race picks back up
+	pausedAt  time.Time
+	pausedFor time.Duration
+	resume    chan struct{}
+
+	// Latest cursor per player, flushed as one cursor_batch per tick
+	pendingCursors map[string]CursorUpdate
+	cursorMu       sync.Mutex
+
+	// Idle tracking, also guarded by cursorMu: the last message each
+	// player sent during the race and who has had an afk_warning
+	lastActive map[string]time.Time
+	afkWarned  map[string]bool
+
+	// Latest viewport per player, flushed as one viewport_batch per
+	// tick. Also guarded by cursorMu.
+	viewports map[string]ViewportUpdate
+
+	events     eventLog
+	broadcasts chan roomBroadcast
+	seq        uint64      // last broadcast's Seq, owned by the fan-out goroutine
+	history    []Message   // recent sequenced broadcasts, see remember
+	mailbox    chan func() // commands run by the room's actor, see post
+	done       chan struct{}
+	stopOnce   sync.Once
+	closed     bool // removed from the hub, guarded by mu
+	// handling is the span of the command being run, see traced
+	handling atomic.Pointer[trace.SpanContext]
 }
 
 // Player represents a player in a room
 type Player struct {
-	ID             string   `json:"id"`
-	Name           string   `json:"name"`
-	CurrentArticle string   `json:"currentArticle"`
-	Clicks         int      `json:"clicks"`
-	Path           []string `json:"path"`
-	Finished       bool     `json:"finished"`
-	FinishTime     int64    `json:"finishTime,omitempty"`
-	client         *Client
+	ID             string        `json:"id"`
+	Name           string        `json:"name"`
+	CurrentArticle string        `json:"currentArticle"`
+	Clicks         int           `json:"clicks"`
+	Path           []string      `json:"path"`
+	Checkpoint     int           `json:"checkpoint"`
+	Finished       bool          `json:"finished"`
+	FinishTime     int64         `json:"finishTime,omitempty"`
+	Late           bool          `json:"late,omitempty"`
+	Forfeited      bool          `json:"forfeited,omitempty"`
+	OutOfClicks    bool          `json:"outOfClicks,omitempty"` // used the room's click budget without finishing
+	Shortfall      int           `json:"shortfall,omitempty"`   // links left to the target when out of clicks, -1 if unknown
+	Ready          bool          `json:"ready"`
+	Team           string        `json:"team,omitempty"`
+	Ghost          bool          `json:"ghost,omitempty"` // replayed recording, not a live player
+	Bot            bool          `json:"bot,omitempty"`
+	Difficulty     BotDifficulty `json:"difficulty,omitempty"`
+	Handicap       *Handicap     `json:"handicap,omitempty"` // applied when scoring, set by the host
+	AccountID      string        `json:"accountId,omitempty"`
+	Rating         int           `json:"rating"`
+	Provisional    bool          `json:"provisional,omitempty"` // rating still in placement races
+	Latency        int           `json:"latency,omitempty"`     // round trip to the server in ms, 0 if unknown
+
+	// Lifetime record for players with a stable identity, and the ID it
+	// is served under at /api/players/{id}/stats
+	ProfileID string         `json:"profileId,omitempty"`
+	Stats     *stats.Summary `json:"stats,omitempty"`
+
+	// Cross-language races: the player's edition, when it isn't the
+	// room's, and the equivalent articles they race between there
+	Language     string `json:"language,omitempty"`
+	StartArticle string `json:"startArticle,omitempty"`
+	EndArticle   string `json:"endArticle,omitempty"`
+
+	// Arcade races: held power-ups, when each kind can next be used, and
+	// until when a freeze blocks this player's clicks
+	PowerUps    []PowerUp `json:"powerUps,omitempty"`
+	cooldowns   map[PowerUp]time.Time
+	frozenUntil time.Time
+
+	// King of the hill: points so far, and the last round whose target
+	// the player reached
+	Points      int `json:"points,omitempty"`
+	scoredRound int
+
+	// How the UI draws the player, see appearance.go
+	Appearance
+
+	guestID  string
+	steps    []GhostStep // timed navigations since the race started
+	joinedAt int64       // race time a late joiner started at
+	eventIDs []string    // recent applied navigate event IDs, see applied
+	distance distanceCache
+	client   *Client
 }
 
 // Hub maintains the set of active clients and rooms
 type Hub struct {
-	clients    map[*Client]bool
-	rooms      map[string]*Room
-	register   chan *Client
-	unregister chan *Client
-	mu         sync.RWMutex
+	clients     map[*Client]bool
+	browsers    map[*Client]bool // clients subscribed to room list updates
+	rooms       *roomDirectory
+	register    chan *Client
+	unregister  chan *Client
+	probes      chan struct{} // readiness checks, received by Run
+	wiki        *wiki.Client
+	matchmaker  *matchmaker
+	graph       *graph.Graph
+	ratings     *rating.Service
+	stats       *stats.Service
+	awards      *achievement.Service
+	analytics   *analytics.Service
+	social      *social.Service
+	store       *store.Store
+	auth        *auth.Service
+	moderation  *moderation.Service
+	edge        *edge.Policy
+	webhooks    *webhook.Notifier
+	push        *push.Service
+	recorder    *recording.Recorder
+	tracer      trace.Tracer
+	listeners   []func(webhook.Event)
+	listenersMu sync.Mutex
+	maxPlayers  int
+	maxRooms    int
+	pongWait    time.Duration
+	pingPeriod  time.Duration
+	idleTimeout time.Duration
+
+	compressionLevel     int
+	compressionThreshold int
+
+	pinned      *Announcement // sent to clients as they connect
+	draining    atomic.Bool   // set by Drain, new connections are refused
+	closedLogs  map[string]*eventLog
+	closedOrder []string // closedLogs keys, oldest first
+	mu          sync.RWMutex
+
+	logsMu   sync.Mutex // guards closedLogs and closedOrder
+	browseMu sync.Mutex // guards browsers, taken after any other lock
+
+	parties map[string]*Party  // by party ID, see party.go
+	partyOf map[*Client]*Party // each member's party
+	partyMu sync.Mutex         // guards parties, partyOf and every Party; taken before the matchmaker's lock
+
+	directInvites map[string]*directInvite // by token, see directinvite.go
+	directMu      sync.Mutex               // guards directInvites
+
+	scheduleMu sync.Mutex // serializes changes to scheduled races, see schedule.go
+}
+
+// Options tunes hub behaviour. Zero values select defaults.
+type Options struct {
+	MatchSize  int                 // players grouped into each quick match
+	MaxPlayers int                 // players allowed per room
+	MaxRooms   int                 // concurrent rooms, 0 for unlimited
+	Store      *store.Store        // persistent storage, memory-only if nil
+	Auth       *auth.Service       // verifies session tokens, guests only if nil
+	Moderation *moderation.Service // server-wide bans, none enforced if nil
+	Edge       *edge.Policy        // trusted proxies and origins, none and any if nil
+	Webhooks   *webhook.Notifier   // race lifecycle webhooks, none sent if nil
+	Push       *push.Service       // Web Push to offline players, none sent if nil
+	Recorder   *recording.Recorder // uploads room event logs, memory only if nil
+	Tracer     trace.Tracer        // spans for messages and broadcasts, none if nil
+	Wiki       *wiki.Client        // Wikipedia API client, a default one if nil
+	Graph      *graph.Graph        // offline link graph, API lookups only if nil
+	// PongWait is how long a connection may stay silent before it is
+	// treated as dead. Pings are sent at 9/10 of this interval.
+	PongWait time.Duration
+	// IdleTimeout is how long a racer may send nothing before they are
+	// forfeited, 0 to never forfeit idle players
+	IdleTimeout time.Duration
+	// Announcement is pinned from startup, e.g. a maintenance notice
+	Announcement *Announcement
+	// CompressionLevel is the permessage-deflate level from 1 (fastest)
+	// to 9 (smallest), 0 to leave compression off
+	CompressionLevel int
+	// CompressionThreshold is the smallest frame compressed, in bytes
+	CompressionThreshold int
+	// Seasons schedules ranked seasons, none for one endless season
+	Seasons rating.Schedule
 }
 
 // New creates a new Hub
-func New() *Hub {
+func New(opts Options) *Hub {
+	if opts.Store == nil {
+		opts.Store, _ = store.Open("")
+	}
+	if opts.Wiki == nil {
+		opts.Wiki = wiki.NewClient()
+	}
+	if opts.MaxPlayers <= 0 {
+		opts.MaxPlayers = defaultMaxPlayers
+	}
+	if opts.PongWait <= 0 {
+		opts.PongWait = defaultPongWait
+	}
+	if opts.CompressionLevel < 0 || opts.CompressionLevel > 9 {
+		log.Printf("Compression level %d out of range, using 1", opts.CompressionLevel)
+		opts.CompressionLevel = 1
+	}
+	if opts.CompressionThreshold <= 0 {
+		opts.CompressionThreshold = defaultCompressionThreshold
+	}
+	if a := opts.Announcement; a != nil {
+		severity, ok := parseSeverity(a.Severity)
+		if !ok {
+			log.Printf("Announcement severity %q unknown, using info", a.Severity)
+			severity = SeverityInfo
+		}
+		opts.Announcement = &Announcement{Message: a.Message, Severity: severity, Pinned: true}
+	}
 	return &Hub{
-		clients:    make(map[*Client]bool),
-		rooms:      make(map[string]*Room),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
+		clients:     make(map[*Client]bool),
+		browsers:    make(map[*Client]bool),
+		parties:     make(map[string]*Party),
+		partyOf:     make(map[*Client]*Party),
+		rooms:       newRoomDirectory(),
+		register:    make(chan *Client),
+		unregister:  make(chan *Client),
+		probes:      make(chan struct{}),
+		wiki:        opts.Wiki,
+		graph:       opts.Graph,
+		matchmaker:  newMatchmaker(opts.MatchSize),
+		ratings:     rating.NewService(opts.Store, opts.Seasons),
+		stats:       stats.NewService(opts.Store),
+		awards:      achievement.NewService(opts.Store),
+		analytics:   analytics.NewService(opts.Store),
+		social:      social.NewService(opts.Store),
+		store:       opts.Store,
+		auth:        opts.Auth,
+		moderation:  opts.Moderation,
+		edge:        opts.Edge,
+		webhooks:    opts.Webhooks,
+		push:        opts.Push,
+		recorder:    opts.Recorder,
+		tracer:      opts.Tracer,
+		maxPlayers:  opts.MaxPlayers,
+		maxRooms:    opts.MaxRooms,
+		pongWait:    opts.PongWait,
+		pingPeriod:  opts.PongWait * 9 / 10,
+		idleTimeout: opts.IdleTimeout,
+		pinned:      opts.Announcement,
+
+		compressionLevel:     opts.CompressionLevel,
+		compressionThreshold: opts.CompressionThreshold,
+		directInvites:        make(map[string]*directInvite),
 	}
 }
 
 // Run starts the hub's main loop
 func (h *Hub) Run() {
+	h.restoreRooms()
+	go h.watchSnapshots()
+	go h.flushCursors()
+	go h.flushViewports()
+	go h.watchRaceClock()
+	go h.watchHills()
+	go h.watchSeasons()
+	go h.watchSchedule()
+	go h.watchEvents()
+	if h.graph != nil {
+		go h.watchProgress()
+	}
+	if h.idleTimeout > 0 {
+		go h.watchIdle()
+	}
+	if h.auth != nil {
+		go h.watchPresence()
+	}
+	if h.recorder != nil {
+		go h.watchRecordings()
+	}
+
+	roomListTicker := time.NewTicker(roomListInterval)
+	defer roomListTicker.Stop()
+	matchTicker := time.NewTicker(matchStatusInterval)
+	defer matchTicker.Stop()
+
 	for {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
 			h.clients[client] = true
+			h.sendPinned(client)
 			h.mu.Unlock()
-			log.Printf("Client connected: %s", client.id)
+			log.Printf("Client connected: %s (%s)", client.id, client.addr)
 
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
+			_, ok := h.clients[client]
+			if ok {
 				delete(h.clients, client)
-				close(client.send)
-				h.removeClientFromRoom(client)
+				// Drop subscriptions before closing send so no one writes to it
+				h.stopBrowsing(client)
+				h.matchmaker.remove(client)
+				client.close()
 			}
 			h.mu.Unlock()
+			// Queued behind the client's last commands, without holding up
+			// the loop if the room is busy
+			if room := client.currentRoom(); ok && room != nil {
+				go room.post(func() { h.removeClientFromRoom(room, client) })
+			}
+			if ok {
+				go h.leaveParty(client)
+			}
 			log.Printf("Client disconnected: %s", client.id)
+
+		case <-roomListTicker.C:
+			h.broadcastRoomList()
+
+		case <-matchTicker.C:
+			h.matchQueued()
+			h.matchmaker.broadcastStatus()
+
+		case <-h.probes:
 		}
 	}
 }
 
+// Ready reports whether the hub can take new clients: Run's loop must
+// pick up a probe before ctx is done, and the hub mustn't be draining
+func (h *Hub) Ready(ctx context.Context) error {
+	if h.draining.Load() {
+		return ErrDraining
+	}
+	select {
+	case h.probes <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return errors.New("hub loop not responding")
+	}
+}
+
 // HandleMessage processes incoming messages from clients
 func (h *Hub) HandleMessage(client *Client, msg Message) {
+	span := h.traceMessage(client, msg)
+	h.logIncoming(client, msg)
+	if h.routeToRoom(client, msg, span) {
+		return
+	}
+	defer endMessageSpan(span, client)
 	switch msg.Type {
 	case MsgTypeJoinRoom:
 		h.handleJoinRoom(client, msg.Payload)
 	case MsgTypeRejoinRoom:
 		h.handleRejoinRoom(client, msg.Payload)
-	case MsgTypeLeaveRoom:
-		h.handleLeaveRoom(client)
-	case MsgTypeUpdateRoom:
-		h.handleUpdateRoom(client, msg.Payload)
-	case MsgTypeStartRace:
-		h.handleStartRace(client)
-	case MsgTypeNavigate:
-		h.handleNavigate(client, msg.Payload)
-	case MsgTypeFinish:
-		h.handleFinish(client, msg.Payload)
+	case MsgTypeResume:
+		h.handleResume(client, msg.Payload)
 	case MsgTypeCursor:
-		h.handleCursor(client, msg.Payload)
+		// Cursors and viewports only replace the room's pending batch,
+		// so they skip the mailbox
+		if room := client.currentRoom(); room != nil {
+			h.handleCursor(room, client, msg.Payload)
+		}
+	case MsgTypeViewport:
+		if room := client.currentRoom(); room != nil {
+			h.handleViewport(room, client, msg.Payload)
+		}
+	case MsgTypeListRooms:
+		h.handleListRooms(client)
+	case MsgTypeFindMatch:
+		h.handleFindMatch(client, msg.Payload)
+	case MsgTypeCancelMatch:
+		h.handleCancelMatch(client)
+	case MsgTypePartyInvite:
+		h.handlePartyInvite(client, msg.Payload)
+	case MsgTypePartyAccept:
+		h.handlePartyAccept(client, msg.Payload)
+	case MsgTypePartyDecline:
+		h.handlePartyDecline(client, msg.Payload)
+	case MsgTypePartyLeave:
+		h.leaveParty(client)
+	case MsgTypeInvitePlayer:
+		h.handleInvitePlayer(client, msg.Payload)
+	case MsgTypeInviteAccept:
+		h.handleInviteAnswer(client, msg.Payload, true)
+	case MsgTypeInviteDecline:
+		h.handleInviteAnswer(client, msg.Payload, false)
+	case MsgTypeHello:
+		h.handleHello(client, msg.Payload)
+	case MsgTypePing:
+		// Browsers can't see protocol-level pings, so clients send their
+		// own heartbeat to detect a dead server
+		client.sendMessage(Message{Type: MsgTypePong, Payload: msg.Payload})
 	default:
 		log.Printf("Unknown message type: %s", msg.Type)
 	}
 }
 
 type JoinRoomPayload struct {
-	RoomID       string `json:"roomId"`
-	PlayerName   string `json:"playerName"`
-	StartArticle string `json:"startArticle"`
-	EndArticle   string `json:"endArticle"`
+	RoomID       string     `json:"roomId"`
+	PlayerName   string     `json:"playerName"`
+	StartArticle string     `json:"startArticle"`
+	EndArticle   string     `json:"endArticle"`
+	Mode         string     `json:"mode,omitempty"`
+	Language     string     `json:"language,omitempty"` // Wikipedia edition, English if empty
+	Config       RoomConfig `json:"config"`
+	Private      bool       `json:"private,omitempty"`
+	Spectate     bool       `json:"spectate,omitempty"`
+	Appearance   Appearance `json:"appearance"`
+	Password     string     `json:"password,omitempty"`
+	Invite       string     `json:"invite,omitempty"`  // token from CreateInvite or invite_player, replaces the password
+	GhostID      string     `json:"ghostId,omitempty"` // race a recorded run in a new room
+	Seed         string     `json:"seed,omitempty"`    // race a shared challenge in a new room
+	Theme        *Theme     `json:"theme,omitempty"`   // draw a new room's articles from categories
 }
 
 func (h *Hub) handleJoinRoom(client *Client, payload json.RawMessage) {
 	var p JoinRoomPayload
 	if err := json.Unmarshal(payload, &p); err != nil {
-		client.sendError("Invalid join payload")
+		client.sendError(CodeBadRequest, "Invalid join payload")
+		return
+	}
+	if !p.Appearance.valid() {
+		client.sendError(CodeInvalidSettings, "Invalid color, avatar or emoji")
 		return
 	}
 
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	room, exists := h.rooms[p.RoomID]
-	if !exists {
-		// Create new room
-		room = &Room{
-			ID:           p.RoomID,
-			Players:      make(map[string]*Player),
-			HostID:       client.id, // First player is the host
-			StartArticle: p.StartArticle,
-			EndArticle:   p.EndArticle,
-			Started:      false,
+	// New rooms get their articles checked first, outside the lock since
+	// validation calls the Wikipedia API
+	invited := false
+	if p.Invite != "" {
+		roomID, err := h.checkInvite(client, p.Invite)
+		if err == nil && p.RoomID != "" && p.RoomID != roomID {
+			err = ErrInvalidInvite
 		}
-		h.rooms[p.RoomID] = room
+		if err != nil {
+			client.sendError(CodeInvalidInvite, "This invite is invalid or has expired")
+			return
+		}
+		p.RoomID, invited = roomID, true
 	}
 
-	if room.Started {
-		client.sendError("Race already started")
+	// Joining or spectating takes the client out of the match queue, so a
+	// match can't pull them out of this room later
+	h.leaveQueue(client)
+
+	existing, exists := h.rooms.get(p.RoomID)
+	if !exists && (invited || p.Spectate) {
+		// Invites and spectators are for a room that has been set up,
+		// never a new one
+		client.sendError(CodeRoomNotFound, "Room not found")
 		return
 	}
-
-	player := &Player{
-		ID:             client.id,
-		Name:           p.PlayerName,
-		CurrentArticle: p.StartArticle,
-		Clicks:         0,
-		Path:           []string{p.StartArticle},
-		Finished:       false,
-		client:         client,
+	if p.Spectate {
+		// Spectators watch without racing, see spectators.go
+		if !invited && !existing.admits(p.Password) {
+			client.sendError(CodeWrongPassword, "Wrong room password")
+			return
+		}
+		h.handleSpectate(existing, client, p.PlayerName)
+		return
+	}
+	if !exists && p.Seed != "" {
+		// A seed replaces whatever race the payload asked for
+		seed, err := DecodeSeed(p.Seed)
+		if err != nil {
+			client.sendError(codeFor(err), "Invalid seed")
+			return
+		}
+		p.StartArticle, p.EndArticle = seed.StartArticle, seed.EndArticle
+		p.Mode, p.Language, p.Config = seed.Mode, seed.Language, seed.Config
+		p.Theme = nil
+	}
+	if _, ok := parseLanguage(p.Language); !ok {
+		client.sendError(CodeInvalidLanguage, "Unsupported Wikipedia language")
+		return
+	}
+	if !exists && len(p.Password) > maxPasswordLength {
+		client.sendError(CodeInvalidSettings, "Room password is too long")
+		return
+	}
+	var ghost *Ghost
+	if !exists && p.GhostID != "" {
+		// A ghost room inherits the recorded run's race, already validated
+		var err error
+		ghost, err = h.Ghost(p.GhostID)
+		if err != nil {
+			client.sendError(CodeNotFound, "Ghost not found")
+			return
+		}
+		p.StartArticle, p.EndArticle = ghost.StartArticle, ghost.EndArticle
+		p.Mode = string(ghost.Mode)
+		p.Language = ghost.Language
+		p.Config.Checkpoints = ghost.Checkpoints
+		p.Config.Relay = false
+		p.Theme = nil
+	} else if !exists {
+		var err error
+		p.Theme, p.StartArticle, p.EndArticle, err = h.applyTheme(p.Language, p.Theme, p.StartArticle, p.EndArticle)
+		if err != nil {
+			client.sendError(codeFor(err), themeError(err))
+			return
+		}
+		if p.EndArticle, err = h.philosophyTarget(p.Language, p.Config, p.EndArticle); err != nil {
+			client.sendError(codeFor(err), err.Error())
+			return
+		}
+		start, end, err := h.validateArticles(p.Language, p.StartArticle, p.EndArticle)
+		if err != nil {
+			client.sendError(codeFor(err), err.Error())
+			return
+		}
+		p.StartArticle, p.EndArticle = start, end
+		p.Config.Checkpoints, err = h.validateCheckpoints(p.Language, p.Config.Checkpoints, start, end)
+		if err != nil {
+			client.sendError(codeFor(err), err.Error())
+			return
+		}
 	}
 
-	room.mu.Lock()
-	room.Players[client.id] = player
-	room.mu.Unlock()
+	// Other joins can change the room as soon as it's unlocked, so the
+	// messages are encoded before unlocking
+	var room *Room
+	var joined, state json.RawMessage
+	var late *Message
+	for state == nil {
+		room, exists = h.rooms.get(p.RoomID)
+		// The player who creates a room chose its password
+		created := !exists
+		if !exists {
+			if invited {
+				client.sendError(CodeRoomNotFound, "Room not found")
+				return
+			}
+			if h.roomLimitReached() {
+				client.sendError(CodeServerFull, "Server is full, try again later")
+				return
+			}
 
-	client.roomID = p.RoomID
+			// Create new room, first player is the host
+			var err error
+			room, err = newRoom(p.RoomID, client.id, RoomOptions{
+				StartArticle: p.StartArticle,
+				EndArticle:   p.EndArticle,
+				Mode:         p.Mode,
+				Language:     p.Language,
+				Config:       p.Config,
+				Theme:        p.Theme,
+				Private:      p.Private,
+				Password:     p.Password,
+			})
+			if err != nil {
+				client.sendError(CodeInvalidMode, "Invalid game mode")
+				return
+			}
+			if ghost != nil {
+				room.addGhost(ghost)
+			}
+			switch err := h.rooms.add(room, h.maxRooms); err {
+			case ErrRoomExists:
+				// Someone else created it first, join theirs instead
+				room.stop()
+				continue
+			case ErrRoomLimit:
+				room.stop()
+				client.sendError(CodeServerFull, "Server is full, try again later")
+				return
+			}
+		}
+
+		if !created && !invited && !room.admits(p.Password) {
+			client.sendError(CodeWrongPassword, "Wrong room password")
+			return
+		}
+
+		room.mu.Lock()
+		if room.closed {
+			// Emptied and deleted since the lookup, start over
+			room.mu.Unlock()
+			h.rooms.remove(room)
+			continue
+		}
+		if room.Started && !room.admitsLate() {
+			room.mu.Unlock()
+			client.sendError(CodeRaceStarted, "Race already started")
+			return
+		}
+		if room.isBanned(client, p.PlayerName) {
+			room.mu.Unlock()
+			client.sendError(CodeBanned, "You've been banned from this room")
+			return
+		}
+		if len(room.Players) >= h.maxPlayers {
+			room.mu.Unlock()
+			client.sendError(CodeRoomFull, "Room is full")
+			return
+		}
+		// Rooms created through the API have no host until someone joins
+		if room.HostID == "" {
+			room.HostID = client.id
+		}
+		player := newPlayer(client, p.PlayerName, room.StartArticle)
+		h.loadRecord(player)
+		player.Appearance = p.Appearance
+		// Articles on other editions are matched at the start, so late
+		// joiners race on the room's
+		if room.Config.CrossLanguage && p.Language != "" && p.Language != room.Language && !room.Started {
+			player.Language = p.Language
+		}
+		if room.Started {
+			msg := room.joinLate(player)
+			late = &msg
+		}
+		room.Players[client.id] = player
+		client.room.Store(room)
+		joined, state = mustMarshal(player), mustMarshal(room)
+		room.mu.Unlock()
+	}
+	h.stopBrowsing(client)
 
 	// Notify other players
 	h.broadcastToRoom(room, Message{
 		Type:    MsgTypePlayerJoined,
-		Payload: mustMarshal(player),
+		Payload: joined,
 	}, client)
 
 	// Send room state to new player
-	client.sendMessage(Message{
+	h.sendInOrder(room, client, Message{
 		Type:    MsgTypeRoomState,
-		Payload: mustMarshal(room),
+		Payload: state,
 	})
-}
-
-func (h *Hub) handleLeaveRoom(client *Client) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	h.removeClientFromRoom(client)
+	if late != nil {
+		log.Printf("Player %s joined the race in room %s late", p.PlayerName, room.ID)
+		h.sendInOrder(room, client, *late)
+	}
 }
 
 type RejoinRoomPayload struct {
 	RoomID     string `json:"roomId"`
 	PlayerName string `json:"playerName"`
+	Password   string `json:"password,omitempty"` // only checked for players not already in the room
 }
 
 // handleRejoinRoom allows a player to reconnect to an in-progress race
 func (h *Hub) handleRejoinRoom(client *Client, payload json.RawMessage) {
 	var p RejoinRoomPayload
 	if err := json.Unmarshal(payload, &p); err != nil {
-		client.sendError("Invalid rejoin payload")
+		client.sendError(CodeBadRequest, "Invalid rejoin payload")
 		return
 	}
 
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	room, exists := h.rooms[p.RoomID]
+	room, exists := h.rooms.get(p.RoomID)
 	if !exists {
-		client.sendError("Room not found")
+		client.sendError(CodeRoomNotFound, "Room not found")
 		return
 	}
 
+	h.leaveQueue(client)
+
+	// Checked up front, bcrypt is too slow to run holding the lock
+	admitted := room.admits(p.Password)
+
+	// A rejoin is broadcast after unlocking, see reattach
+	var rejoined *Message
+	defer func() {
+		if rejoined != nil {
+			h.broadcastToRoom(room, *rejoined, nil)
+		}
+	}()
 	room.mu.Lock()
 	defer room.mu.Unlock()
 
+	if room.closed {
+		client.sendError(CodeRoomNotFound, "Room not found")
+		return
+	}
+	if room.isBanned(client, p.PlayerName) {
+		client.sendError(CodeBanned, "You've been banned from this room")
+		return
+	}
+
 	// Find the player by name and update their client reference
 	var existingPlayer *Player
 	var oldClientID string
 	for id, player := range room.Players {
-		if player.Name == p.PlayerName {
+		if player.matches(client, p.PlayerName) {
 			existingPlayer = player
 			oldClientID = id
 			break
@@ -229,89 +855,130 @@ func (h *Hub) handleRejoinRoom(client *Client, payload json.RawMessage) {
 	}
 
 	if existingPlayer != nil {
-		// Update the player's client and ID
-		delete(room.Players, oldClientID)
-		existingPlayer.ID = client.id
-		existingPlayer.client = client
-		room.Players[client.id] = existingPlayer
-		client.roomID = p.RoomID
-
+		state := h.reattach(room, client, existingPlayer, oldClientID)
+		rejoined = &state
 		log.Printf("Player %s rejoined room %s", p.PlayerName, p.RoomID)
+		return
+	}
 
-		// Broadcast updated room state to ALL players so they know the player's new ID
-		// Run in a goroutine to avoid deadlock since we currently hold room.mu.Lock
-		// and broadcastToRoom needs to acquire room.mu.RLock
-		go h.broadcastToRoom(room, Message{
-			Type:    MsgTypeRoomState,
-			Payload: mustMarshal(room),
-		}, nil)
+	// If player not found and race is started, they can't join unless
+	// the room takes late joiners
+	if room.Started && !room.admitsLate() {
+		client.sendError(CodeRaceStarted, "Race already started and you're not a participant")
 		return
 	}
 
-	// If player not found and race is started, they can't join
-	if room.Started {
-		client.sendError("Race already started and you're not a participant")
+	if !admitted {
+		client.sendError(CodeWrongPassword, "Wrong room password")
+		return
+	}
+	if len(room.Players) >= h.maxPlayers {
+		client.sendError(CodeRoomFull, "Room is full")
 		return
 	}
 
-	// Otherwise, add as new player (race not started yet)
-	player := &Player{
-		ID:             client.id,
-		Name:           p.PlayerName,
-		CurrentArticle: room.StartArticle,
-		Clicks:         0,
-		Path:           []string{room.StartArticle},
-		Finished:       false,
-		client:         client,
+	// Otherwise, add as new player
+	player := newPlayer(client, p.PlayerName, room.StartArticle)
+	h.loadRecord(player)
+	var late *Message
+	if room.Started {
+		msg := room.joinLate(player)
+		late = &msg
 	}
 	room.Players[client.id] = player
-	client.roomID = p.RoomID
+	client.room.Store(room)
+	h.stopBrowsing(client)
 
 	// Send room state
-	client.sendMessage(Message{
+	h.sendInOrder(room, client, Message{
 		Type:    MsgTypeRoomState,
 		Payload: mustMarshal(room),
 	})
+	if late != nil {
+		h.sendInOrder(room, client, *late)
+	}
+}
+
+// isHost reports whether client hosts the room. A rejoin can hand the
+// room to a new host at any time, so HostID is read under the lock;
+// callers already holding room.mu compare it directly.
+func isHost(room *Room, client *Client) bool {
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+	return room.HostID == client.id
 }
 
 type UpdateRoomPayload struct {
-	StartArticle string `json:"startArticle"`
-	EndArticle   string `json:"endArticle"`
+	StartArticle string      `json:"startArticle"`
+	EndArticle   string      `json:"endArticle"`
+	Config       *RoomConfig `json:"config,omitempty"`
 }
 
-func (h *Hub) handleUpdateRoom(client *Client, payload json.RawMessage) {
+// prepareUpdateRoom validates the new articles, which calls the
+// Wikipedia API, before the room applies them
+func (h *Hub) prepareUpdateRoom(room *Room, client *Client, payload json.RawMessage) func() {
 	var p UpdateRoomPayload
 	if err := json.Unmarshal(payload, &p); err != nil {
-		client.sendError("Invalid update payload")
-		return
+		client.sendError(CodeBadRequest, "Invalid update payload")
+		return nil
 	}
 
-	h.mu.RLock()
-	room, exists := h.rooms[client.roomID]
-	h.mu.RUnlock()
+	// Only host can update room settings
+	if !isHost(room, client) {
+		client.sendError(CodeNotHost, "Only host can update room settings")
+		return nil
+	}
 
-	if !exists {
-		client.sendError("Room not found")
-		return
+	// A Philosophy game always ends on Philosophy, whatever the host sent
+	room.mu.RLock()
+	config := room.Config
+	room.mu.RUnlock()
+	if p.Config != nil {
+		config = *p.Config
+	}
+	end, err := h.philosophyTarget(room.Language, config, p.EndArticle)
+	if err != nil {
+		client.sendError(codeFor(err), err.Error())
+		return nil
 	}
 
-	// Only host can update room settings
-	if room.HostID != client.id {
-		client.sendError("Only host can update room settings")
-		return
+	start, end, err := h.validateArticles(room.Language, p.StartArticle, end)
+	if err != nil {
+		client.sendError(codeFor(err), err.Error())
+		return nil
+	}
+	p.StartArticle, p.EndArticle = start, end
+	if p.Config != nil {
+		p.Config.Checkpoints, err = h.validateCheckpoints(room.Language, p.Config.Checkpoints, start, end)
+		if err != nil {
+			client.sendError(codeFor(err), err.Error())
+			return nil
+		}
 	}
+	return func() { h.updateRoom(room, client, p) }
+}
 
+func (h *Hub) updateRoom(room *Room, client *Client, p UpdateRoomPayload) {
 	// Don't allow updates after race has started
 	room.mu.Lock()
 	if room.Started {
 		room.mu.Unlock()
-		client.sendError("Cannot update room after race has started")
+		client.sendError(CodeRaceStarted, "Cannot update room after race has started")
+		return
+	}
+	if room.Veto != nil {
+		room.mu.Unlock()
+		client.sendError(CodeNotAllowed, "The ban phase picks this match's articles")
 		return
 	}
 
-	// Update room settings
+	// Articles set by hand replace any vote on them
+	room.cancelVote()
 	room.StartArticle = p.StartArticle
 	room.EndArticle = p.EndArticle
+	if p.Config != nil {
+		room.Config = *p.Config
+	}
 	room.mu.Unlock()
 
 	log.Printf("Room %s updated: %s -> %s", room.ID, p.StartArticle, p.EndArticle)
@@ -323,124 +990,376 @@ func (h *Hub) handleUpdateRoom(client *Client, payload json.RawMessage) {
 	}, nil)
 }
 
-func (h *Hub) handleStartRace(client *Client) {
-	h.mu.RLock()
-	room, exists := h.rooms[client.roomID]
-	h.mu.RUnlock()
+// prepareStartRace checks the sender is the host and, for cross-language
+// races, looks up every edition's articles, which takes API calls
+func (h *Hub) prepareStartRace(room *Room, client *Client, _ json.RawMessage) func() {
+	if !isHost(room, client) {
+		client.sendError(CodeNotHost, "Only host can start the race")
+		return nil
+	}
 
-	if !exists {
-		client.sendError("Room not found")
-		return
+	room.mu.RLock()
+	crossLanguage, reason := room.Config.CrossLanguage, room.startCheck()
+	if reason == "" && !room.ScheduledFor.IsZero() {
+		reason = "This race starts at its scheduled time"
+	}
+	room.mu.RUnlock()
+	if reason != "" {
+		client.sendError(CodeInvalidSettings, reason)
+		return nil
+	}
+	var pairs map[string]localizedPair
+	if crossLanguage {
+		var err error
+		if pairs, err = h.localizeRace(room); err != nil {
+			client.sendError(codeFor(err), err.Error())
+			return nil
+		}
+	}
+	return func() { h.startRace(room, client, pairs) }
+}
+
+// startCheck returns why the room's settings can't be raced, or "".
+// Caller must hold room.mu.
+func (r *Room) startCheck() string {
+	reason := r.crossLanguageCheck()
+	if reason == "" {
+		reason = r.philosophyCheck()
+	}
+	if reason == "" {
+		reason = r.budgetCheck()
+	}
+	if reason == "" {
+		reason = r.hideAndSeekCheck()
+	}
+	if reason == "" {
+		reason = r.hillCheck()
+	}
+	if reason == "" {
+		reason = r.seriesCheck()
+	}
+	return reason
+}
+
+func (h *Hub) startRace(room *Room, client *Client, pairs map[string]localizedPair) {
+	if code, reason := h.launchRace(room, pairs, true); reason != "" {
+		client.sendError(code, reason)
 	}
+}
 
+// launchRace starts the race and tells the room, or returns why it can't.
+// Scheduled races start at their time whether or not everyone is ready,
+// so they skip the ready check.
+func (h *Hub) launchRace(room *Room, pairs map[string]localizedPair, checkReady bool) (ErrorCode, string) {
 	room.mu.Lock()
 	if room.Started {
 		room.mu.Unlock()
-		client.sendError("Race already started")
-		return
+		return CodeRaceStarted, "Race already started"
+	}
+	if checkReady && !room.allReady() {
+		room.mu.Unlock()
+		return CodeNotReady, "Not all players are ready"
+	}
+	if room.Vote != nil {
+		room.mu.Unlock()
+		return CodeNotAllowed, "Wait for the vote to finish"
+	}
+	if room.Veto != nil {
+		room.mu.Unlock()
+		return CodeNotAllowed, "Finish banning pairs first"
+	}
+	if room.Config.Relay {
+		if reason := room.startRelay(); reason != "" {
+			room.mu.Unlock()
+			return CodeInvalidSettings, reason
+		}
+	}
+	if pairs != nil && !room.applyLocalized(pairs) {
+		room.mu.Unlock()
+		return CodeTryAgain, "The room changed while matching articles, try again"
 	}
 	room.Started = true
+	room.ScheduledFor = time.Time{}
+	room.StartedAt = time.Now()
+	room.startHideAndSeek()
+	room.startHill()
+	room.touchAll()
+	h.startRaceClock(room)
+	if room.ghost != nil {
+		go h.replayGhost(room)
+	}
+	for _, id := range room.botIDs() {
+		go h.runBot(room, id)
+	}
+	h.notifyRaceStarted(room)
 	room.mu.Unlock()
 
+	started := map[string]interface{}{
+		"startArticle": room.StartArticle,
+		"endArticle":   room.EndArticle,
+		"checkpoints":  room.Config.Checkpoints,
+	}
+	if pairs != nil {
+		started["articles"] = pairs
+	}
+	if room.Config.HideAndSeek {
+		started["hider"] = room.Hider
+		started["headStart"] = hideHeadStart.Milliseconds()
+	}
 	h.broadcastToRoom(room, Message{
 		Type:    MsgTypeRaceStarted,
-		Payload: mustMarshal(map[string]interface{}{
-			"startArticle": room.StartArticle,
-			"endArticle":   room.EndArticle,
-		}),
+		Payload: mustMarshal(started),
 	}, nil)
+
+	if room.Config.Relay {
+		room.mu.RLock()
+		msg := room.teamUpdateMessage()
+		room.mu.RUnlock()
+		h.broadcastToRoom(room, msg, nil)
+	}
+	go h.sendPreloadHints(room)
+	go h.planOptimal(room)
+	return "", ""
 }
 
+// NavigatePayload is a click. EventID, when the client sends one, makes
+// retransmits safe: a click whose ID already counted isn't applied again.
 type NavigatePayload struct {
 	Article string `json:"article"`
+	EventID string `json:"eventId,omitempty"`
 }
 
-func (h *Hub) handleNavigate(client *Client, payload json.RawMessage) {
+func (h *Hub) prepareNavigate(room *Room, client *Client, payload json.RawMessage) func() {
 	var p NavigatePayload
 	if err := json.Unmarshal(payload, &p); err != nil {
-		return
+		return nil
 	}
+	room.touch(client.id)
 
-	h.mu.RLock()
-	room, exists := h.rooms[client.roomID]
-	h.mu.RUnlock()
+	// Redirect and category lookups hit the Wikipedia API, so do them
+	// before the room applies the click. Paths store canonical titles so rules and finish
+	// checks aren't fooled by redirects like "USA" -> "United States".
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	if !exists {
-		return
+	room.mu.RLock()
+	needCategories := len(room.Config.BannedCategories) > 0
+	lang, from, target := room.Language, "", ""
+	if player, ok := room.Players[client.id]; ok {
+		lang = room.playerLanguage(player)
+		if room.Config.Philosophy && room.Started {
+			from = player.CurrentArticle
+		}
+		if room.lastClick(player) {
+			target = room.playerTarget(player)
+		}
+	}
+	room.mu.RUnlock()
+
+	article, err := h.canonical(ctx, lang, p.Article)
+	if err != nil {
+		log.Printf("Redirect lookup failed for %s: %v", p.Article, err)
+	}
+	p.Article = article
+
+	var categories []string
+	if needCategories {
+		categories, err = h.wikiFor(lang).Categories(ctx, p.Article)
+		if err != nil {
+			log.Printf("Category lookup failed for %s: %v", p.Article, err)
+		}
 	}
 
+	// Philosophy games only allow the first link on the player's article
+	var next *firstLink
+	if from != "" {
+		next = h.lookupFirstLink(ctx, lang, from)
+	}
+
+	// A player's last click in a budgeted race is scored by how far it
+	// leaves them from the target
+	shortfall := -1
+	if target != "" {
+		shortfall = h.measureShortfall(ctx, lang, p.Article, target)
+	}
+	return func() { h.navigate(room, client, p, categories, next, shortfall) }
+}
+
+func (h *Hub) navigate(room *Room, client *Client, p NavigatePayload, categories []string, next *firstLink, shortfall int) {
 	room.mu.Lock()
 	player, exists := room.Players[client.id]
-	if exists && !player.Finished {
-		player.CurrentArticle = p.Article
-		player.Clicks++
-		player.Path = append(player.Path, p.Article)
+	if !exists || player.Finished || player.Forfeited || player.OutOfClicks || room.Ended {
+		room.mu.Unlock()
+		return
+	}
+	if player.applied(p.EventID) {
+		// A retry of a click that counted; confirm where the player is
+		msg := room.progressMessage(player)
+		room.mu.Unlock()
+		client.sendMessage(msg)
+		return
+	}
+	if room.Paused {
+		room.mu.Unlock()
+		client.sendError(CodeRacePaused, "Race is paused")
+		return
+	}
+	if player.frozen() {
+		room.mu.Unlock()
+		client.sendError(CodePowerUp, "You're frozen")
+		return
+	}
+	if room.Started && room.Config.Relay && !room.isRunner(player) {
+		room.mu.Unlock()
+		client.sendError(CodeNotAllowed, "Wait for your relay leg")
+		return
+	}
+	violation := room.checkBudget(player, p.Article)
+	if violation == nil {
+		violation = room.checkNavigate(player, p.Article, categories)
+	}
+	if violation == nil {
+		violation = room.checkFirstLink(player, p.Article, next)
+	}
+	if violation == nil {
+		violation = h.checkLink(room.playerLanguage(player), player, p.Article)
+	}
+	if violation != nil {
+		room.mu.Unlock()
+		client.sendMessage(Message{
+			Type:    MsgTypeRuleViolation,
+			Payload: mustMarshal(violation),
+		})
+		return
+	}
+	player.CurrentArticle = p.Article
+	player.Clicks++
+	player.Path = append(player.Path, p.Article)
+	player.recordEvent(p.EventID)
+	if room.Started {
+		player.steps = append(player.steps, GhostStep{Article: p.Article, At: room.elapsed()})
+	}
+	grant := room.grantPowerUp(player)
+
+	// Reaching the target finishes the player, no finish message needed.
+	// Relay runners advance their team instead, and the team's progress
+	// goes out as a team_update.
+	var finishMsg *Message
+	var ghost *Ghost
+	raceOver, reason := false, RaceEndAllFinished
+	switch {
+	case room.Started && room.Config.HideAndSeek:
+		if room.caught(player) {
+			msg := room.catchMessage(player)
+			finishMsg = &msg
+			room.markFinished(player)
+			raceOver, reason = true, RaceEndCaught
+		}
+	case room.Started && room.Config.hillInterval() > 0:
+		if room.scoreHill(player) {
+			msg := room.scoreboardMessage()
+			finishMsg = &msg
+		}
+	case room.Started && room.Config.Relay:
+		room.advanceRelay(player, p.Article)
+		msg := room.teamUpdateMessage()
+		finishMsg = &msg
+		raceOver = room.allDone()
+	case room.Started:
+		room.advanceCheckpoint(player, p.Article)
+		if room.reachedTarget(player) {
+			msg := room.markFinished(player)
+			finishMsg = &msg
+			ghost = room.recordGhost(player)
+			raceOver = room.allDone()
+		} else if room.spendBudget(player, shortfall) {
+			raceOver = room.allDone()
+		}
+	}
+	update := room.progressMessage(player)
+	var hidden *Message
+	if room.hiding(player.ID) {
+		// Only the hider learns where they are, seekers just see a click
+		hidden = &update
+		update = room.hiderMovedMessage(player)
 	}
 	room.mu.Unlock()
 
-	if exists {
-		h.broadcastToRoom(room, Message{
-			Type: MsgTypePlayerUpdate,
-			Payload: mustMarshal(map[string]interface{}{
-				"playerId":       client.id,
-				"currentArticle": p.Article,
-				"clicks":         player.Clicks,
-			}),
-		}, nil)
+	if hidden != nil {
+		client.sendMessage(*hidden)
+	}
+	h.broadcastToRoom(room, update, nil)
+
+	if finishMsg != nil {
+		h.broadcastToRoom(room, *finishMsg, nil)
+	}
+	if grant != nil {
+		client.sendMessage(*grant)
+	}
+	h.saveGhost(client, ghost)
+	if raceOver {
+		h.endRace(room, reason)
 	}
 }
 
+// FinishPayload is sent by older clients on reaching the target. The time
+// is ignored, the server measures it.
 type FinishPayload struct {
 	Time int64 `json:"time"`
 }
 
-func (h *Hub) handleFinish(client *Client, payload json.RawMessage) {
+// handleFinish finishes a player who is on the target article but whose
+// finish wasn't detected on navigate, e.g. when the race started while
+// they were already there
+func (h *Hub) handleFinish(room *Room, client *Client, payload json.RawMessage) {
 	var p FinishPayload
 	if err := json.Unmarshal(payload, &p); err != nil {
 		return
 	}
 
-	h.mu.RLock()
-	room, exists := h.rooms[client.roomID]
-	h.mu.RUnlock()
-
-	if !exists {
-		return
-	}
-
 	room.mu.Lock()
 	player, exists := room.Players[client.id]
-	if exists && !player.Finished {
-		player.Finished = true
-		player.FinishTime = p.Time
+	if !exists || !room.Started || room.Config.Relay || room.Config.HideAndSeek || room.Config.hillInterval() > 0 || player.Finished || player.Forfeited || room.Ended {
+		room.mu.Unlock()
+		return
 	}
-	room.mu.Unlock()
-
-	if exists {
-		h.broadcastToRoom(room, Message{
-			Type: MsgTypePlayerFinish,
-			Payload: mustMarshal(map[string]interface{}{
-				"playerId":   client.id,
-				"playerName": player.Name,
-				"time":       p.Time,
-				"clicks":     player.Clicks,
-				"path":       player.Path,
-			}),
-		}, nil)
+	if room.Paused {
+		room.mu.Unlock()
+		client.sendError(CodeRacePaused, "Race is paused")
+		return
 	}
-}
-
-func (h *Hub) removeClientFromRoom(client *Client) {
-	if client.roomID == "" {
+	// The server decides whether the target was reached, not the client
+	if !room.reachedTarget(player) {
+		room.mu.Unlock()
+		client.sendError(CodeNotAllowed, "You haven't reached the target article")
 		return
 	}
+	msg := room.markFinished(player)
+	ghost := room.recordGhost(player)
+	raceOver := room.allDone()
+	room.mu.Unlock()
 
-	room, exists := h.rooms[client.roomID]
-	if !exists {
-		return
+	h.broadcastToRoom(room, msg, nil)
+	h.saveGhost(client, ghost)
+
+	// Once everyone is done, send the final ranking for the room's mode
+	if raceOver {
+		h.endRace(room, RaceEndAllFinished)
 	}
+}
 
+// removeClientFromRoom takes a departing client out of room, deleting the
+// room once no humans are left
+func (h *Hub) removeClientFromRoom(room *Room, client *Client) {
 	room.mu.Lock()
+	if _, ok := room.Spectators[client.id]; ok {
+		delete(room.Spectators, client.id)
+		state := mustMarshal(room)
+		room.mu.Unlock()
+		client.leftRoom(room)
+		h.broadcastToRoom(room, Message{Type: MsgTypeRoomState, Payload: state}, nil)
+		return
+	}
 	// Don't remove player if race has started - they're just transitioning to game page
 	// and will rejoin with a new WebSocket connection
 	if room.Started {
@@ -450,13 +1369,27 @@ func (h *Hub) removeClientFromRoom(client *Client) {
 			log.Printf("Player %s disconnected from started race, keeping in room", player.Name)
 		}
 		room.mu.Unlock()
-		client.roomID = ""
+		client.leftRoom(room)
 		return
 	}
 
+	player, ok := room.Players[client.id]
+	if !ok {
+		// Already gone, e.g. kicked
+		room.mu.Unlock()
+		client.leftRoom(room)
+		return
+	}
+	room.leaveTeam(player)
 	delete(room.Players, client.id)
-	playerCount := len(room.Players)
+	playerCount := room.humanCount()
+	watched := len(room.Spectators) > 0
+	if playerCount == 0 {
+		room.closed = true
+		room.releaseSpectators()
+	}
 	room.mu.Unlock()
+	client.leftRoom(room)
 
 	// Notify others
 	h.broadcastToRoom(room, Message{
@@ -468,83 +1401,14 @@ func (h *Hub) removeClientFromRoom(client *Client) {
 
 	// Clean up empty rooms only if race hasn't started
 	if playerCount == 0 {
-		delete(h.rooms, client.roomID)
-		log.Printf("Room deleted: %s", client.roomID)
-	}
-
-	client.roomID = ""
-}
-
-type CursorPayload struct {
-	X            float64 `json:"x"`
-	Y            float64 `json:"y"`
-	Article      string  `json:"article"`
-	CursorType   string  `json:"cursorType,omitempty"`
-	AnchorId     string  `json:"anchorId,omitempty"`
-	NextAnchorId string  `json:"nextAnchorId,omitempty"`
-	SectionRatio float64 `json:"sectionRatio,omitempty"`
-}
-
-func (h *Hub) handleCursor(client *Client, payload json.RawMessage) {
-	var p CursorPayload
-	if err := json.Unmarshal(payload, &p); err != nil {
-		return
-	}
-
-	h.mu.RLock()
-	room, exists := h.rooms[client.roomID]
-	h.mu.RUnlock()
-
-	if !exists {
-		return
-	}
-
-	room.mu.RLock()
-	player, exists := room.Players[client.id]
-	room.mu.RUnlock()
-
-	if !exists {
-		return
-	}
-
-	// Broadcast cursor position to other players (exclude sender)
-	h.broadcastToRoom(room, Message{
-		Type: MsgTypeCursorUpdate,
-		Payload: mustMarshal(map[string]interface{}{
-			"playerId":     client.id,
-			"playerName":   player.Name,
-			"x":            p.X,
-			"y":            p.Y,
-			"article":      p.Article,
-			"cursorType":   p.CursorType,
-			"anchorId":     p.AnchorId,
-			"nextAnchorId": p.NextAnchorId,
-			"sectionRatio": p.SectionRatio,
-		}),
-	}, client)
-}
-
-func (h *Hub) broadcastToRoom(room *Room, msg Message, exclude *Client) {
-	data, err := json.Marshal(msg)
-	if err != nil {
-		return
-	}
-
-	room.mu.RLock()
-	defer room.mu.RUnlock()
-
-	for _, player := range room.Players {
-		// Skip if player has no client (disconnected, waiting to rejoin)
-		if player.client == nil {
-			continue
-		}
-		if player.client != exclude {
-			select {
-			case player.client.send <- data:
-			default:
-				// Client buffer full, skip
-			}
+		if watched {
+			h.broadcastToRoom(room, Message{
+				Type:    MsgTypeRoomClosed,
+				Payload: mustMarshal(map[string]string{"roomId": room.ID}),
+			}, nil)
 		}
+		h.deleteRoom(room)
+		log.Printf("Room deleted: %s", room.ID)
 	}
 }
 
@@ -561,19 +1425,19 @@ type LobbyInfo struct {
 	HostCountry  string `json:"hostCountry"`
 	StartArticle string `json:"startArticle"`
 	EndArticle   string `json:"endArticle"`
+	Language     string `json:"language"`
 	Players      int    `json:"players"`
 	MaxPlayers   int    `json:"maxPlayers"`
 	Status       string `json:"status"`
+	Locked       bool   `json:"locked,omitempty"`
 }
 
-// GetLobbies returns a list of all public, non-started rooms
+// GetLobbies returns a list of all public rooms that have players
 func (h *Hub) GetLobbies() []LobbyInfo {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-
 	lobbies := make([]LobbyInfo, 0)
 
-	for id, room := range h.rooms {
+	for _, room := range h.rooms.all() {
+		id := room.ID
 		room.mu.RLock()
 		playerCount := len(room.Players)
 
@@ -599,20 +1463,25 @@ func (h *Hub) GetLobbies() []LobbyInfo {
 			status = "in_progress"
 		}
 
+		private := room.Private
+		start, end := room.StartArticle, room.EndArticle
+		language, locked := room.Language, room.Locked
 		room.mu.RUnlock()
 
-		// Include all rooms that have players (both waiting and in progress)
-		if playerCount > 0 {
+		// Include all public rooms that have players (both waiting and in progress)
+		if playerCount > 0 && !private {
 			lobbies = append(lobbies, LobbyInfo{
 				ID:           id,
 				Code:         id, // Using room ID as the code
 				HostName:     hostName,
 				HostCountry:  hostCountry,
-				StartArticle: room.StartArticle,
-				EndArticle:   room.EndArticle,
+				StartArticle: start,
+				EndArticle:   end,
+				Language:     language,
 				Players:      playerCount,
-				MaxPlayers:   8,
+				MaxPlayers:   h.maxPlayers,
 				Status:       status,
+				Locked:       locked,
 			})
 		}
 	}
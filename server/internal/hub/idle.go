@@ -0,0 +1,123 @@
+package hub
+
+import "time"
+
+const (
+	// idleCheckInterval is how often running races are scanned for idle
+	// players
+	idleCheckInterval = 5 * time.Second
+	// afkWarningLead is how long before the auto-forfeit afk_warning goes
+	// out, capped at half the idle timeout
+	afkWarningLead = 30 * time.Second
+)
+
+// touch records activity from a player so they aren't treated as idle
+func (r *Room) touch(id string) {
+	r.cursorMu.Lock()
+	defer r.cursorMu.Unlock()
+	if r.lastActive == nil {
+		r.lastActive = make(map[string]time.Time)
+	}
+	r.lastActive[id] = time.Now()
+	delete(r.afkWarned, id)
+}
+
+// touchAll restarts every player's idle clock, at race start and after a
+// pause. Caller must hold room.mu.
+func (r *Room) touchAll() {
+	for id := range r.Players {
+		r.touch(id)
+	}
+}
+
+// afkWarning is a player about to be forfeited and how long they have left
+type afkWarning struct {
+	player *Player
+	left   time.Duration
+}
+
+// idlePlayers returns the racers who should get an afk_warning and those
+// idle long enough to forfeit. Relay teammates waiting for their leg
+// aren't idle. Caller must hold room.mu.
+func (r *Room) idlePlayers(timeout time.Duration) (warn []afkWarning, forfeit []*Player) {
+	lead := afkWarningLead
+	if lead > timeout/2 {
+		lead = timeout / 2
+	}
+
+	r.cursorMu.Lock()
+	defer r.cursorMu.Unlock()
+	if r.afkWarned == nil {
+		r.afkWarned = make(map[string]bool)
+	}
+	now := time.Now()
+	for id, p := range r.Players {
+		if p.virtual() || p.Finished || p.Forfeited || p.OutOfClicks || (r.Config.Relay && !r.isRunner(p)) {
+			continue
+		}
+		last, ok := r.lastActive[id]
+		if !ok {
+			last = r.StartedAt
+		}
+		// Nobody is forfeited without a warning first, even if a short
+		// timeout let them skip the warning window between checks
+		switch idle := now.Sub(last); {
+		case idle >= timeout && r.afkWarned[id]:
+			forfeit = append(forfeit, p)
+		case idle >= timeout-lead && !r.afkWarned[id]:
+			r.afkWarned[id] = true
+			left := timeout - idle
+			if left < idleCheckInterval {
+				left = idleCheckInterval
+			}
+			warn = append(warn, afkWarning{player: p, left: left})
+		}
+	}
+	return warn, forfeit
+}
+
+// watchIdle periodically checks running races for idle players
+func (h *Hub) watchIdle() {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.checkIdle()
+	}
+}
+
+// checkIdle warns and then forfeits players who have gone quiet in a
+// running race, so rooms don't wait forever on someone who walked away
+func (h *Hub) checkIdle() {
+	for _, room := range h.rooms.all() {
+		room.mu.RLock()
+		if !room.Started || room.Ended || room.Paused {
+			room.mu.RUnlock()
+			continue
+		}
+		warn, forfeit := room.idlePlayers(h.idleTimeout)
+		warnings := make([]Message, 0, len(warn))
+		for _, w := range warn {
+			warnings = append(warnings, Message{
+				Type: MsgTypeAfkWarning,
+				Payload: mustMarshal(map[string]interface{}{
+					"playerId":    w.player.ID,
+					"playerName":  w.player.Name,
+					"forfeitInMs": w.left.Milliseconds(),
+				}),
+			})
+		}
+		ids := make([]string, 0, len(forfeit))
+		for _, p := range forfeit {
+			ids = append(ids, p.ID)
+		}
+		room.mu.RUnlock()
+
+		for _, msg := range warnings {
+			h.broadcastToRoom(room, msg, nil)
+		}
+		for _, id := range ids {
+			h.forfeitPlayer(room, id, "idle")
+		}
+	}
+}
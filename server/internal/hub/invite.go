@@ -0,0 +1,69 @@
+package hub
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	defaultInviteTTL = 24 * time.Hour
+	maxInviteTTL     = 7 * 24 * time.Hour
+)
+
+// ErrInvalidInvite is returned for invites that are forged, expired or
+// for another room
+var ErrInvalidInvite = errors.New("invalid or expired invite")
+
+// Invite is a signed token that lets its holder join a room without the
+// password. It names the room ID, so it also works for a later room that
+// reuses the ID before it expires.
+type Invite struct {
+	Token     string    `json:"token"`
+	RoomID    string    `json:"roomId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// CreateInvite issues an invite to a room, valid for ttl (a day if 0, at
+// most a week). Locked rooms need their password unless trusted, so
+// invites can't be used to get around it.
+func (h *Hub) CreateInvite(roomID, password string, ttl time.Duration, trusted bool) (Invite, error) {
+	if h.auth == nil {
+		return Invite{}, ErrInvalidInvite
+	}
+	room, exists := h.rooms.get(roomID)
+	if !exists {
+		return Invite{}, ErrRoomNotFound
+	}
+	if !trusted && !room.admits(password) {
+		return Invite{}, ErrWrongPassword
+	}
+
+	switch {
+	case ttl <= 0:
+		ttl = defaultInviteTTL
+	case ttl > maxInviteTTL:
+		ttl = maxInviteTTL
+	}
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	return Invite{
+		Token:     h.auth.IssueInvite(room.ID, expires),
+		RoomID:    room.ID,
+		ExpiresAt: expires,
+	}, nil
+}
+
+// checkInvite returns the room ID an invite admits the client to. Direct
+// invites from friends are spent here.
+func (h *Hub) checkInvite(client *Client, token string) (string, error) {
+	if roomID, ok, err := h.spendDirectInvite(client, token); ok {
+		return roomID, err
+	}
+	if h.auth == nil {
+		return "", ErrInvalidInvite
+	}
+	roomID, err := h.auth.VerifyInvite(token)
+	if err != nil {
+		return "", ErrInvalidInvite
+	}
+	return roomID, nil
+}
@@ -0,0 +1,31 @@
+package hub
+
+import (
+	"github.com/markotsymbaluk/wiki-racing/internal/graph"
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+// parseLanguage validates a room's Wikipedia edition, defaulting to English
+func parseLanguage(lang string) (string, bool) {
+	if lang == "" {
+		return wiki.DefaultLanguage, true
+	}
+	return lang, wiki.SupportedLanguage(lang)
+}
+
+// wikiFor returns the API client for a room's edition
+func (h *Hub) wikiFor(lang string) *wiki.Client {
+	return h.wiki.Language(lang)
+}
+
+// graphFor returns the offline link graph if it was built from the given
+// edition, or nil
+func (h *Hub) graphFor(lang string) *graph.Graph {
+	if lang == "" {
+		lang = wiki.DefaultLanguage
+	}
+	if h.graph == nil || h.graph.Language() != lang {
+		return nil
+	}
+	return h.graph
+}
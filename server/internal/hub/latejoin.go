@@ -0,0 +1,46 @@
+package hub
+
+import "time"
+
+// maxLatePenalty caps the time added to late joiners' finishes
+const maxLatePenalty = 30 * time.Minute
+
+// latePenalty returns the time added to a late joiner's finish
+func (c RoomConfig) latePenalty() time.Duration {
+	d := time.Duration(c.LatePenalty) * time.Second
+	if d <= 0 {
+		return 0
+	}
+	if d > maxLatePenalty {
+		return maxLatePenalty
+	}
+	return d
+}
+
+// admitsLate reports whether a running race takes new racers. Relay
+// teams are fixed at the start, and ranked results would reward skipping
+// part of the race, so neither does. King of the hill is always open to
+// drop-ins. Caller must hold room.mu.
+func (r *Room) admitsLate() bool {
+	return (r.Config.LateJoin || r.Config.hillInterval() > 0) && r.Started && !r.Ended && !r.Config.Relay && !r.Ranked
+}
+
+// joinLate starts a player who joined mid-race and returns their
+// race_started. Their clock runs from the race start like everyone
+// else's, and finishing adds the penalty on top. Caller must hold
+// room.mu.
+func (r *Room) joinLate(player *Player) Message {
+	player.Late = true
+	player.joinedAt = r.elapsed()
+	r.touch(player.ID)
+	return Message{
+		Type: MsgTypeRaceStarted,
+		Payload: mustMarshal(map[string]interface{}{
+			"startArticle": r.StartArticle,
+			"endArticle":   r.EndArticle,
+			"checkpoints":  r.Config.Checkpoints,
+			"elapsed":      r.elapsed(),
+			"latePenalty":  r.Config.latePenalty().Milliseconds(),
+		}),
+	}
+}
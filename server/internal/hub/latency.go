@@ -0,0 +1,59 @@
+package hub
+
+import (
+	"strconv"
+	"time"
+)
+
+// latencyWeight is how many rating points of difference matchmaking
+// trades for each millisecond of round trip difference between players
+const latencyWeight = 1
+
+// pingPayload stamps a heartbeat ping with its send time. Clients echo the
+// payload in their pong, so the round trip needs no per-client state.
+func pingPayload() []byte {
+	return strconv.AppendInt(nil, time.Now().UnixNano(), 10)
+}
+
+// recordPong measures the round trip of a heartbeat ping and folds it into
+// the client's smoothed latency. Pongs without a stamp are ignored.
+func (c *Client) recordPong(payload string) {
+	sent, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return
+	}
+	rtt := time.Since(time.Unix(0, sent)).Milliseconds()
+	if rtt < 0 {
+		return
+	}
+	if prev := c.rtt.Load(); prev > 0 {
+		rtt = (prev*3 + rtt) / 4
+	}
+	c.rtt.Store(rtt)
+
+	if room := c.currentRoom(); room != nil {
+		room.post(func() {
+			room.mu.Lock()
+			if p, ok := room.Players[c.id]; ok && p.client == c {
+				p.Latency = int(rtt)
+			}
+			room.mu.Unlock()
+		})
+	}
+}
+
+// latency returns the client's smoothed round trip in milliseconds, or 0
+// before the first pong and for stream clients, which have no heartbeat
+func (c *Client) latency() int {
+	return int(c.rtt.Load())
+}
+
+// latencyGap is how far apart two clients' round trips are, 0 if either
+// is unknown
+func latencyGap(a, b *Client) int {
+	la, lb := a.latency(), b.latency()
+	if la == 0 || lb == 0 {
+		return 0
+	}
+	return abs(la - lb)
+}
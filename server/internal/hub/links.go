@@ -0,0 +1,63 @@
+package hub
+
+import (
+	"context"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+// canonical resolves redirects on an edition from the offline graph when
+// it knows the title, falling back to the Wikipedia API
+func (h *Hub) canonical(ctx context.Context, lang, title string) (string, error) {
+	if g := h.graphFor(lang); g != nil {
+		if resolved, ok := g.Canonical(title); ok {
+			return resolved, nil
+		}
+	}
+	return h.wikiFor(lang).Canonical(ctx, title)
+}
+
+// outgoingLinks lists an article's links, preferring the offline graph
+func (h *Hub) outgoingLinks(ctx context.Context, lang, title string) ([]string, error) {
+	if g := h.graphFor(lang); g != nil {
+		if links, err := g.Links(title); err == nil {
+			return links, nil
+		}
+	}
+	return h.wikiFor(lang).Links(ctx, title)
+}
+
+// shortestPath plans a route between two articles, preferring the offline
+// graph since a search there takes milliseconds instead of API round trips
+func (h *Hub) shortestPath(ctx context.Context, lang, from, to string) ([]string, error) {
+	if g := h.graphFor(lang); g != nil {
+		if path, err := g.ShortestPath(from, to); err == nil {
+			return path, nil
+		}
+	}
+	return h.wikiFor(lang).ShortestPath(ctx, from, to)
+}
+
+// checkLink rejects a navigation the offline graph says isn't a link from
+// the player's current article. Going back to an article already in the
+// path is always allowed, and without a graph for the room's edition
+// nothing is checked. Caller must hold room.mu.
+func (h *Hub) checkLink(lang string, player *Player, article string) *RuleViolation {
+	g := h.graphFor(lang)
+	if g == nil || player.CurrentArticle == "" {
+		return nil
+	}
+	for _, visited := range player.Path {
+		if wiki.SameArticleIn(lang, visited, article) {
+			return nil
+		}
+	}
+	if g.Linked(player.CurrentArticle, article) {
+		return nil
+	}
+	return &RuleViolation{
+		Rule:    RuleInvalidLink,
+		Article: article,
+		Message: "That article isn't linked from your current page",
+	}
+}
@@ -0,0 +1,415 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+const (
+	defaultMatchSize    = 2
+	matchStatusInterval = 5 * time.Second
+	// defaultArrivalGap seeds the wait estimate before any arrivals are seen
+	defaultArrivalGap = 30 * time.Second
+)
+
+// matchmaker groups queued players into quick-match rooms
+type matchmaker struct {
+	size        int
+	queue       []*queuedPlayer
+	lastArrival time.Time
+	arrivalGap  time.Duration // moving average of time between arrivals
+	mu          sync.Mutex
+}
+
+type queuedPlayer struct {
+	client   *Client
+	name     string
+	rating   int
+	queuedAt time.Time
+	party    *Party // matched together with the rest of their party, nil when solo
+}
+
+func newMatchmaker(size int) *matchmaker {
+	if size < 2 {
+		size = defaultMatchSize
+	}
+	return &matchmaker{size: size, arrivalGap: defaultArrivalGap}
+}
+
+// enqueue adds players to the queue as one ticket, which is always matched
+// into the same group. It returns false if any of them is already queued.
+func (m *matchmaker) enqueue(ticket ...*queuedPlayer) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, q := range m.queue {
+		for _, t := range ticket {
+			if q.client == t.client {
+				return false
+			}
+		}
+	}
+
+	now := time.Now()
+	if !m.lastArrival.IsZero() {
+		m.arrivalGap = (m.arrivalGap*3 + now.Sub(m.lastArrival)) / 4
+	}
+	m.lastArrival = now
+
+	for _, t := range ticket {
+		t.queuedAt = now
+		m.queue = append(m.queue, t)
+	}
+	return true
+}
+
+// remove drops a client from the queue, along with their party, returning
+// whether it was queued
+func (m *matchmaker) remove(client *Client) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var leaving *queuedPlayer
+	for _, q := range m.queue {
+		if q.client == client {
+			leaving = q
+			break
+		}
+	}
+	if leaving == nil {
+		return false
+	}
+	remaining := m.queue[:0]
+	for _, q := range m.queue {
+		if q != leaving && (leaving.party == nil || q.party != leaving.party) {
+			remaining = append(remaining, q)
+		}
+	}
+	m.queue = remaining
+	return true
+}
+
+// queued reports whether a client is waiting for a match
+func (m *matchmaker) queued(client *Client) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, q := range m.queue {
+		if q.client == client {
+			return true
+		}
+	}
+	return false
+}
+
+// tickets splits the queue into the players that must be matched
+// together, in queue order. Caller must hold m.mu.
+func (m *matchmaker) tickets() [][]*queuedPlayer {
+	var tickets [][]*queuedPlayer
+	parties := make(map[*Party]int)
+	for _, q := range m.queue {
+		if q.party != nil {
+			if i, ok := parties[q.party]; ok {
+				tickets[i] = append(tickets[i], q)
+				continue
+			}
+			parties[q.party] = len(tickets)
+		}
+		tickets = append(tickets, []*queuedPlayer{q})
+	}
+	return tickets
+}
+
+// averageRating is a ticket's mean rating
+func averageRating(ticket []*queuedPlayer) int {
+	sum := 0
+	for _, q := range ticket {
+		sum += q.rating
+	}
+	return sum / len(ticket)
+}
+
+// takeGroup pops a full group from the queue, if available. The longest
+// waiting player who can be placed is always matched, alongside the
+// players closest to their rating and latency so groups stay balanced and
+// nobody races someone on the far side of the world when a closer match
+// is queued. Parties are placed whole, compared by their average rating
+// and their leader's latency.
+func (m *matchmaker) takeGroup() []*queuedPlayer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.queue) < m.size {
+		return nil
+	}
+
+	// Parties don't always fit around the longest waiting ticket, e.g. two
+	// parties of three for a group of four, so later tickets get a turn
+	tickets := m.tickets()
+	var group []*queuedPlayer
+	for i := range tickets {
+		if group = m.groupAround(tickets, i); group != nil {
+			break
+		}
+	}
+	if group == nil {
+		return nil
+	}
+
+	picked := make(map[*queuedPlayer]bool, len(group))
+	for _, q := range group {
+		picked[q] = true
+	}
+	remaining := m.queue[:0]
+	for _, q := range m.queue {
+		if !picked[q] {
+			remaining = append(remaining, q)
+		}
+	}
+	m.queue = remaining
+	return group
+}
+
+// groupAround fills a group around tickets[anchor] with the closest
+// tickets that add up to exactly the match size, or returns nil if none
+// do. Caller must hold m.mu.
+func (m *matchmaker) groupAround(tickets [][]*queuedPlayer, anchor int) []*queuedPlayer {
+	a := tickets[anchor]
+	need := m.size - len(a)
+	anchorRating := averageRating(a)
+	candidates := make([][]*queuedPlayer, 0, len(tickets)-1)
+	candidates = append(candidates, tickets[:anchor]...)
+	candidates = append(candidates, tickets[anchor+1:]...)
+	distance := func(t []*queuedPlayer) int {
+		return abs(averageRating(t)-anchorRating) + latencyWeight*latencyGap(t[0].client, a[0].client)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return distance(candidates[i]) < distance(candidates[j])
+	})
+
+	// fills[n] picks the closest candidates seen so far making up n
+	// players. Taking them greedily could leave a gap that only a party
+	// skipped earlier would have filled.
+	fills := make([][]int, need+1)
+	fills[0] = []int{}
+	for i, t := range candidates {
+		if fills[need] != nil {
+			break
+		}
+		for n := need - len(t); n >= 0; n-- {
+			if fills[n] != nil && fills[n+len(t)] == nil {
+				fills[n+len(t)] = append(append([]int(nil), fills[n]...), i)
+			}
+		}
+	}
+	if fills[need] == nil {
+		return nil
+	}
+
+	group := append([]*queuedPlayer(nil), a...)
+	for _, i := range fills[need] {
+		group = append(group, candidates[i]...)
+	}
+	return group
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// requeue puts a group back at the front of the queue after a failed match
+func (m *matchmaker) requeue(group []*queuedPlayer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queue = append(group, m.queue...)
+}
+
+// broadcastStatus tells every queued player their position and estimated wait
+func (m *matchmaker) broadcastStatus() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, q := range m.queue {
+		// Players needed to fill this player's group
+		needed := m.size - (i % m.size) - 1
+		behind := len(m.queue) - i - 1
+		missing := needed - behind
+		if missing < 0 {
+			missing = 0
+		}
+		q.client.sendMessage(Message{
+			Type: MsgTypeMatchStatus,
+			Payload: mustMarshal(map[string]interface{}{
+				"position":      i + 1,
+				"queued":        len(m.queue),
+				"matchSize":     m.size,
+				"waitedSeconds": int(time.Since(q.queuedAt).Seconds()),
+				"estimatedWait": int((time.Duration(missing) * m.arrivalGap).Seconds()),
+			}),
+		})
+	}
+}
+
+type FindMatchPayload struct {
+	PlayerName string `json:"playerName"`
+}
+
+func (h *Hub) handleFindMatch(client *Client, payload json.RawMessage) {
+	var p FindMatchPayload
+	if err := json.Unmarshal(payload, &p); err != nil || p.PlayerName == "" {
+		client.sendError(CodeBadRequest, "Invalid find_match payload")
+		return
+	}
+
+	if client.currentRoom() != nil {
+		client.sendError(CodeNotAllowed, "Leave your current room before matchmaking")
+		return
+	}
+
+	name := client.displayName(p.PlayerName)
+	if h.matchmaker.queued(client) {
+		return
+	}
+	if reason := h.queueTicket(client, name); reason != "" {
+		client.sendError(CodeNotAllowed, reason)
+		return
+	}
+	log.Printf("Player %s queued for quick match", name)
+
+	h.matchQueued()
+	h.matchmaker.broadcastStatus()
+}
+
+// matchQueued starts a match for every full group in the queue. It runs
+// on each arrival and on the status ticker, which retries groups
+// requeued after a failed start.
+func (h *Hub) matchQueued() {
+	for {
+		group := h.matchmaker.takeGroup()
+		if group == nil {
+			return
+		}
+		go h.startMatch(group)
+	}
+}
+
+func (h *Hub) handleCancelMatch(client *Client) {
+	if h.matchmaker.remove(client) {
+		h.matchmaker.broadcastStatus()
+	}
+}
+
+// leaveQueue takes a client out of matchmaking as they go into a room some
+// other way. Their party leaves the queue with them.
+func (h *Hub) leaveQueue(client *Client) {
+	if !h.matchmaker.remove(client) {
+		return
+	}
+	h.partyMu.Lock()
+	if party := h.partyOf[client]; party != nil {
+		for _, m := range party.members {
+			if m.client != client {
+				m.client.sendError(CodeNotAllowed, "A party member joined a room, so your party left the match queue")
+			}
+		}
+	}
+	h.partyMu.Unlock()
+	h.matchmaker.broadcastStatus()
+}
+
+// startMatch creates a room with a random article pair for a matched group
+func (h *Hub) startMatch(group []*queuedPlayer) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// A 1v1 bans its way down to a pair instead of getting one at random
+	var start, end string
+	var pairs []Candidate
+	var err error
+	if len(group) == 2 {
+		pairs, err = h.matchPairs(ctx)
+	} else {
+		start, end, err = h.randomPair(ctx, wiki.DefaultLanguage, "")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Players may have disconnected or gone into a room during the lookup
+	connected := make([]*queuedPlayer, 0, len(group))
+	for _, q := range group {
+		if h.clients[q.client] && q.client.currentRoom() == nil {
+			connected = append(connected, q)
+		}
+	}
+
+	var room *Room
+	if err == nil && len(connected) == len(group) {
+		room, err = h.rooms.addWithCode(h.maxRooms, func(id string) (*Room, error) {
+			room, err := newRoom(id, group[0].client.id, RoomOptions{
+				StartArticle: start,
+				EndArticle:   end,
+				Private:      true,
+			})
+			if err == nil {
+				room.Ranked = true
+			}
+			return room, err
+		})
+	}
+	if err != nil || len(connected) < len(group) {
+		if err != nil {
+			log.Printf("Quick match failed: %v", err)
+		}
+		h.matchmaker.requeue(connected)
+		for _, q := range connected {
+			q.client.sendError(CodeTryAgain, "Could not start your match, retrying")
+		}
+		return
+	}
+
+	id := room.ID
+	room.mu.Lock()
+	for _, q := range group {
+		player := newPlayer(q.client, q.name, room.StartArticle)
+		h.loadRecord(player)
+		room.Players[q.client.id] = player
+		q.client.room.Store(room)
+		h.stopBrowsing(q.client)
+	}
+	if pairs != nil {
+		h.startVeto(room, pairs, group[0].client.id, group[1].client.id)
+	}
+	state := mustMarshal(room)
+	room.mu.Unlock()
+
+	if pairs != nil {
+		log.Printf("Quick match room %s created with %d pairs to ban", id, len(pairs))
+	} else {
+		log.Printf("Quick match room %s created: %s -> %s", id, start, end)
+	}
+
+	for _, q := range group {
+		q.client.sendMessage(Message{
+			Type: MsgTypeMatchFound,
+			Payload: mustMarshal(map[string]interface{}{
+				"roomId":       id,
+				"startArticle": start,
+				"endArticle":   end,
+				"veto":         pairs != nil,
+			}),
+		})
+		q.client.sendMessage(Message{
+			Type:    MsgTypeRoomState,
+			Payload: state,
+		})
+	}
+}
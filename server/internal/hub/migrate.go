@@ -0,0 +1,180 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+)
+
+// resumeTTL is how long the resume token in a migrate message is valid
+const resumeTTL = 2 * time.Minute
+
+var (
+	// ErrDraining is returned for new connections once Drain has run
+	ErrDraining = errors.New("server is draining")
+	// ErrInvalidTarget is returned when a drain target isn't a WebSocket URL
+	ErrInvalidTarget = errors.New("migration target must be a ws:// or wss:// URL")
+)
+
+// ResumePayload carries the token from a migrate message
+type ResumePayload struct {
+	Token string `json:"token"`
+}
+
+// Drain hands this instance's clients over to the one at target, for
+// rolling deploys. Every occupied room is saved to the store, which the
+// instances must share, and each client gets a migrate message with the
+// URL to reconnect to. Players also get a resume token that takes their
+// place back in the room there. New connections are turned away from
+// then on. It returns how many clients were told to move.
+func (h *Hub) Drain(target string) (int, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+		return 0, ErrInvalidTarget
+	}
+	h.draining.Store(true)
+
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.mu.RUnlock()
+
+	// Rooms go to the store before anyone is told to move, so they are
+	// there when the first client arrives
+	saved := make(map[*Room]bool)
+	for _, c := range clients {
+		room := c.currentRoom()
+		if room == nil || saved[room] {
+			continue
+		}
+		room.mu.RLock()
+		raw := room.saved()
+		room.mu.RUnlock()
+		if err := h.store.Put(liveRoomCollection, room.ID, raw); err != nil {
+			return 0, err
+		}
+		saved[room] = true
+	}
+
+	expires := time.Now().Add(resumeTTL)
+	for _, c := range clients {
+		migrate := map[string]interface{}{"url": target}
+		if room := c.currentRoom(); room != nil {
+			migrate["roomId"] = room.ID
+			room.mu.RLock()
+			_, playing := room.Players[c.id]
+			room.mu.RUnlock()
+			if playing && h.auth != nil {
+				migrate["token"] = h.auth.IssueResume(room.ID, c.id, expires)
+			}
+		}
+		c.sendMessage(Message{Type: MsgTypeMigrate, Payload: mustMarshal(migrate)})
+	}
+
+	log.Printf("Draining to %s: %d clients in %d rooms told to migrate", target, len(clients), len(saved))
+	return len(clients), nil
+}
+
+// handleResume puts a migrated client back in its room, restoring the
+// room from the store if it hasn't arrived on this instance yet
+func (h *Hub) handleResume(client *Client, payload json.RawMessage) {
+	var p ResumePayload
+	if err := json.Unmarshal(payload, &p); err != nil || p.Token == "" {
+		client.sendError(CodeBadRequest, "Invalid resume payload")
+		return
+	}
+	if h.auth == nil {
+		client.sendError(CodeInvalidResume, "Resume isn't available")
+		return
+	}
+	roomID, playerID, err := h.auth.VerifyResume(p.Token)
+	if err != nil {
+		client.sendError(CodeInvalidResume, "Invalid or expired resume token")
+		return
+	}
+
+	room, err := h.resumeRoom(roomID)
+	if err != nil {
+		client.sendError(CodeRoomNotFound, "Room not found")
+		return
+	}
+	h.leaveQueue(client)
+
+	room.mu.Lock()
+	player, ok := room.Players[playerID]
+	if room.closed || !ok {
+		room.mu.Unlock()
+		client.sendError(CodeInvalidResume, "Nothing to resume in that room")
+		return
+	}
+	state := h.reattach(room, client, player, playerID)
+	room.mu.Unlock()
+	h.broadcastToRoom(room, state, nil)
+	log.Printf("Player %s resumed in room %s", player.Name, room.ID)
+}
+
+// resumeRoom finds a room on this instance, or restores the snapshot a
+// draining instance left for it
+func (h *Hub) resumeRoom(id string) (*Room, error) {
+	if room, ok := h.rooms.get(id); ok {
+		return room, nil
+	}
+	if err := h.store.Reload(liveRoomCollection); err != nil {
+		log.Printf("Reloading room snapshots failed: %v", err)
+	}
+	var s savedRoom
+	found, err := h.store.Get(liveRoomCollection, id, &s)
+	if err != nil || !found {
+		return nil, ErrRoomNotFound
+	}
+
+	room, err := h.restoreRoom(s)
+	if errors.Is(err, ErrRoomExists) {
+		// Another migrating player restored it first
+		if room, ok := h.rooms.get(id); ok {
+			return room, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Room %s migrated in (%d players)", room.ID, len(s.Players))
+	return room, nil
+}
+
+// reattach hands a player in the room over to a new connection, which
+// takes over their ID. Caller must hold room.mu, and broadcast the room
+// state it returns once it has let go: the fan-out goroutine needs the
+// lock to deliver, so sending under it can wedge a busy room.
+func (h *Hub) reattach(room *Room, client *Client, player *Player, oldID string) Message {
+	delete(room.Players, oldID)
+	player.ID = client.id
+	player.client = client
+	player.Latency = client.latency()
+	room.Players[client.id] = player
+	if room.HostID == oldID {
+		room.HostID = client.id
+	}
+	for _, team := range room.Teams {
+		for i, id := range team.Members {
+			if id == oldID {
+				team.Members[i] = client.id
+			}
+		}
+		if team.Runner == oldID {
+			team.Runner = client.id
+		}
+	}
+	client.room.Store(room)
+	h.stopBrowsing(client)
+
+	// Everyone needs the player's new ID
+	return Message{
+		Type:    MsgTypeRoomState,
+		Payload: mustMarshal(room),
+	}
+}
@@ -0,0 +1,171 @@
+package hub
+
+import "sort"
+
+// GameMode determines how finished players are ranked
+type GameMode string
+
+const (
+	ModeTime   GameMode = "time"   // fastest finish wins
+	ModeClicks GameMode = "clicks" // fewest clicks wins, time breaks ties
+	ModeHybrid GameMode = "hybrid" // time plus a fixed penalty per click
+)
+
+// hybridClickPenalty is the time (ms) each click adds to a hybrid score
+const hybridClickPenalty = 10000
+
+// parseMode validates a requested mode, defaulting to time-based scoring
+func parseMode(s string) (GameMode, bool) {
+	switch GameMode(s) {
+	case "":
+		return ModeTime, true
+	case ModeTime, ModeClicks, ModeHybrid:
+		return GameMode(s), true
+	}
+	return "", false
+}
+
+// score returns the player's score under the mode (lower is better),
+// after any handicap
+func (m GameMode) score(p *Player) int64 {
+	return m.scoreOf(p.scored())
+}
+
+// scoreOf scores a finish time (ms) and click count under the mode
+func (m GameMode) scoreOf(finishTime int64, clicks int) int64 {
+	switch m {
+	case ModeClicks:
+		return int64(clicks)
+	case ModeHybrid:
+		return finishTime + int64(clicks)*hybridClickPenalty
+	default:
+		return finishTime
+	}
+}
+
+// less reports whether a ranks ahead of b
+func (m GameMode) less(a, b *Player) bool {
+	sa, sb := m.score(a), m.score(b)
+	if sa != sb {
+		return sa < sb
+	}
+	ta, ca := a.scored()
+	tb, cb := b.scored()
+	if ta != tb {
+		return ta < tb
+	}
+	return ca < cb
+}
+
+// Standing is a player's position in the race results
+type Standing struct {
+	PlayerID   string `json:"playerId"`
+	PlayerName string `json:"playerName"`
+	Rank       int    `json:"rank"`
+	Time       int64  `json:"time"`
+	Clicks     int    `json:"clicks"`
+	Score      int64  `json:"score"`
+	Finished   bool   `json:"finished"`
+	DNF        bool   `json:"dnf,omitempty"` // forfeited, or still racing when the race ended
+	// Shortfall is how many links from the target a player who ran out
+	// of clicks was left, -1 if unknown
+	Shortfall int `json:"shortfall,omitempty"`
+	// Points is a king of the hill player's score, see hill.go
+	Points int `json:"points,omitempty"`
+	// Handicap is what was taken off Time and Clicks to get Score
+	Handicap *Handicap `json:"handicap,omitempty"`
+}
+
+// standings ranks finished players by the room's mode, then players who
+// ran out of clicks by how close they got, followed by unfinished
+// players. King of the hill ranks by points instead. Caller must hold
+// room.mu.
+func (r *Room) standings() []Standing {
+	if r.Config.hillInterval() > 0 {
+		return r.hillStandings()
+	}
+	finished := make([]*Player, 0, len(r.Players))
+	outOfClicks := make([]*Player, 0)
+	unfinished := make([]*Player, 0)
+	for _, p := range r.Players {
+		switch {
+		case p.Finished:
+			finished = append(finished, p)
+		case p.OutOfClicks:
+			outOfClicks = append(outOfClicks, p)
+		default:
+			unfinished = append(unfinished, p)
+		}
+	}
+	sort.SliceStable(finished, func(i, j int) bool {
+		return r.Mode.less(finished[i], finished[j])
+	})
+	sort.SliceStable(outOfClicks, func(i, j int) bool {
+		return closer(outOfClicks[i], outOfClicks[j])
+	})
+	sort.SliceStable(unfinished, func(i, j int) bool {
+		return unfinished[i].Name < unfinished[j].Name
+	})
+
+	result := make([]Standing, 0, len(r.Players))
+	for i, p := range finished {
+		result = append(result, Standing{
+			PlayerID:   p.ID,
+			PlayerName: p.Name,
+			Rank:       i + 1,
+			Time:       p.FinishTime,
+			Clicks:     p.Clicks,
+			Score:      r.Mode.score(p),
+			Finished:   true,
+			Handicap:   p.Handicap,
+		})
+	}
+	for i, p := range outOfClicks {
+		result = append(result, Standing{
+			PlayerID:   p.ID,
+			PlayerName: p.Name,
+			Rank:       len(finished) + i + 1,
+			Clicks:     p.Clicks,
+			Shortfall:  p.Shortfall,
+			Handicap:   p.Handicap,
+		})
+	}
+	for _, p := range unfinished {
+		result = append(result, Standing{
+			PlayerID:   p.ID,
+			PlayerName: p.Name,
+			Clicks:     p.Clicks,
+			DNF:        p.Forfeited,
+			Handicap:   p.Handicap,
+		})
+	}
+	return result
+}
+
+// rankOf returns the 1-based rank of a ranked player, or 0
+func rankOf(standings []Standing, playerID string) int {
+	for _, s := range standings {
+		if s.PlayerID == playerID {
+			return s.Rank
+		}
+	}
+	return 0
+}
+
+// allDone reports whether every player in the room has finished,
+// forfeited or run out of clicks, or the hider has given up. Ghosts and
+// bots don't hold the race open. Caller must hold room.mu.
+func (r *Room) allDone() bool {
+	if r.humanCount() == 0 {
+		return false
+	}
+	if hider, ok := r.Players[r.Hider]; ok && r.Config.HideAndSeek && hider.Forfeited {
+		return true
+	}
+	for _, p := range r.Players {
+		if !p.virtual() && !p.Finished && !p.Forfeited && !p.OutOfClicks {
+			return false
+		}
+	}
+	return true
+}
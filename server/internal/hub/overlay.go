@@ -0,0 +1,105 @@
+package hub
+
+// Overlay is a simplified, read-only view of a room for stream overlays
+// such as OBS browser sources. It carries nothing a spectator couldn't
+// see, and leaves out the hider's article in hide and seek so a stream
+// can't give them away.
+type Overlay struct {
+	RoomID       string         `json:"roomId"`
+	Event        string         `json:"event,omitempty"`
+	Mode         GameMode       `json:"mode"`
+	Language     string         `json:"language"`
+	StartArticle string         `json:"startArticle"`
+	EndArticle   string         `json:"endArticle"`
+	Checkpoints  []string       `json:"checkpoints,omitempty"`
+	Started      bool           `json:"started"`
+	Ended        bool           `json:"ended"`
+	Paused       bool           `json:"paused,omitempty"`
+	Elapsed      int64          `json:"elapsed"`             // ms of race time
+	TimeLimit    int64          `json:"timeLimit,omitempty"` // ms, 0 for none
+	Racers       []OverlayRacer `json:"racers"`              // in standings order
+}
+
+// OverlayRacer is one player's line in an overlay
+type OverlayRacer struct {
+	Name       string `json:"name"`
+	Rank       int    `json:"rank,omitempty"` // 0 until they finish or run out of clicks
+	Article    string `json:"article,omitempty"`
+	Clicks     int    `json:"clicks"`
+	Checkpoint int    `json:"checkpoint,omitempty"`
+	Finished   bool   `json:"finished"`
+	FinishTime int64  `json:"finishTime,omitempty"`
+	DNF        bool   `json:"dnf,omitempty"`
+	Team       string `json:"team,omitempty"`
+	// Distance is the last measured number of links to the player's next
+	// target, absent until the link graph has measured it
+	Distance *int `json:"distance,omitempty"`
+}
+
+// CheckRoomPassword returns ErrWrongPassword if password doesn't open a
+// locked room
+func (h *Hub) CheckRoomPassword(roomID, password string) error {
+	room, exists := h.rooms.get(roomID)
+	if !exists {
+		return ErrRoomNotFound
+	}
+	if !room.admits(password) {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// Overlay returns a room's overlay view. It doesn't check the room
+// password; callers do that once with CheckRoomPassword.
+func (h *Hub) Overlay(roomID string) (Overlay, error) {
+	room, exists := h.rooms.get(roomID)
+	if !exists {
+		return Overlay{}, ErrRoomNotFound
+	}
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+	if room.closed {
+		return Overlay{}, ErrRoomNotFound
+	}
+
+	o := Overlay{
+		RoomID:       room.ID,
+		Event:        room.Event,
+		Mode:         room.Mode,
+		Language:     room.Language,
+		StartArticle: room.StartArticle,
+		EndArticle:   room.EndArticle,
+		Checkpoints:  room.Config.Checkpoints,
+		Started:      room.Started,
+		Ended:        room.Ended,
+		Paused:       room.Paused,
+		Elapsed:      room.elapsed(),
+		TimeLimit:    room.Config.timeLimit().Milliseconds(),
+	}
+	standings := room.standings()
+	o.Racers = make([]OverlayRacer, 0, len(standings))
+	for _, s := range standings {
+		p := room.Players[s.PlayerID]
+		if p == nil {
+			continue
+		}
+		racer := OverlayRacer{
+			Name:       p.Name,
+			Rank:       s.Rank,
+			Article:    p.CurrentArticle,
+			Clicks:     p.Clicks,
+			Checkpoint: p.Checkpoint,
+			Finished:   p.Finished,
+			FinishTime: p.FinishTime,
+			DNF:        s.DNF,
+			Team:       p.Team,
+		}
+		if room.Config.HideAndSeek && p.ID == room.Hider && !room.Ended {
+			racer.Article = ""
+		} else if d := p.distanceIfCurrent(p.CurrentArticle, room.nextTarget(p)); d != unmeasured && !p.Finished {
+			racer.Distance = &d
+		}
+		o.Racers = append(o.Racers, racer)
+	}
+	return o, nil
+}
@@ -0,0 +1,273 @@
+package hub
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// maxPartySize caps how many players can queue together
+const maxPartySize = 4
+
+// Party is a group of players who queue for matches together. It lives
+// outside rooms: members stay in it across races until they leave or
+// disconnect.
+type Party struct {
+	ID      string
+	leader  *Client
+	members []*partyMember
+	invited map[string]bool // client IDs with an open invitation
+}
+
+type partyMember struct {
+	client *Client
+	name   string
+}
+
+// PartyMember is a member as shown in party_state
+type PartyMember struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type PartyInvitePayload struct {
+	PlayerID   string `json:"playerId"`   // client ID of the player to invite
+	PlayerName string `json:"playerName"` // the inviter's name, shown to the invitee
+}
+
+type PartyAnswerPayload struct {
+	PartyID    string `json:"partyId"`
+	PlayerName string `json:"playerName,omitempty"` // the name to join under when accepting
+}
+
+// clientByID finds a connected client
+func (h *Hub) clientByID(id string) *Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.clients {
+		if c.id == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// handlePartyInvite invites another online player into the sender's
+// party, starting one with the sender as leader if they aren't in one
+func (h *Hub) handlePartyInvite(client *Client, payload json.RawMessage) {
+	var p PartyInvitePayload
+	if err := json.Unmarshal(payload, &p); err != nil || p.PlayerID == "" || p.PlayerName == "" {
+		client.sendError(CodeBadRequest, "Invalid party_invite payload")
+		return
+	}
+	target := h.clientByID(p.PlayerID)
+	if target == nil || target == client {
+		client.sendError(CodeNotAllowed, "That player isn't online")
+		return
+	}
+
+	h.partyMu.Lock()
+	party := h.partyOf[client]
+	switch {
+	case party == nil:
+		party = &Party{
+			ID:      uuid.New().String(),
+			leader:  client,
+			members: []*partyMember{{client: client, name: client.displayName(p.PlayerName)}},
+			invited: make(map[string]bool),
+		}
+		h.parties[party.ID] = party
+		h.partyOf[client] = party
+	case party.leader != client:
+		h.partyMu.Unlock()
+		client.sendError(CodeNotHost, "Only the party leader can invite")
+		return
+	case h.partyOf[target] == party:
+		h.partyMu.Unlock()
+		client.sendError(CodeNotAllowed, "They're already in your party")
+		return
+	case len(party.members)+len(party.invited) >= maxPartySize:
+		h.partyMu.Unlock()
+		client.sendError(CodeNotAllowed, "Your party is full")
+		return
+	}
+	party.invited[target.id] = true
+	invite := Message{
+		Type: MsgTypePartyInvited,
+		Payload: mustMarshal(map[string]interface{}{
+			"partyId":  party.ID,
+			"fromId":   client.id,
+			"fromName": client.displayName(p.PlayerName),
+		}),
+	}
+	h.sendPartyState(party)
+	h.partyMu.Unlock()
+
+	target.sendMessage(invite)
+}
+
+// handlePartyAccept joins a party the client was invited to
+func (h *Hub) handlePartyAccept(client *Client, payload json.RawMessage) {
+	var p PartyAnswerPayload
+	if err := json.Unmarshal(payload, &p); err != nil || p.PlayerName == "" {
+		client.sendError(CodeBadRequest, "Invalid party_accept payload")
+		return
+	}
+
+	h.partyMu.Lock()
+	defer h.partyMu.Unlock()
+	party := h.parties[p.PartyID]
+	switch {
+	case party == nil:
+		client.sendError(CodeNotAllowed, "That party no longer exists")
+		return
+	case h.partyOf[client] != nil:
+		client.sendError(CodeNotAllowed, "Leave your party first")
+		return
+	case h.matchmaker.queued(party.leader):
+		client.sendError(CodeNotAllowed, "That party is in the match queue")
+		return
+	case h.matchmaker.queued(client):
+		client.sendError(CodeNotAllowed, "Leave the match queue first")
+		return
+	}
+	if !party.invited[client.id] {
+		client.sendError(CodeNotAllowed, "You haven't been invited to that party")
+		return
+	}
+	delete(party.invited, client.id)
+	party.members = append(party.members, &partyMember{client: client, name: client.displayName(p.PlayerName)})
+	h.partyOf[client] = party
+	log.Printf("Client %s joined party %s", client.id, party.ID)
+	h.sendPartyState(party)
+}
+
+// handlePartyDecline turns down an invitation
+func (h *Hub) handlePartyDecline(client *Client, payload json.RawMessage) {
+	var p PartyAnswerPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		client.sendError(CodeBadRequest, "Invalid party_decline payload")
+		return
+	}
+
+	h.partyMu.Lock()
+	defer h.partyMu.Unlock()
+	party := h.parties[p.PartyID]
+	if party == nil {
+		return
+	}
+	if party.invited[client.id] {
+		delete(party.invited, client.id)
+		h.sendPartyState(party)
+	}
+}
+
+// leaveParty takes a client out of their party, on request or when they
+// disconnect, and drops their open invitations. A queued party leaves the
+// queue, since it no longer fits the group it was matched as. The longest
+// standing member takes over from a leader who leaves, and an empty party
+// is dropped.
+func (h *Hub) leaveParty(client *Client) {
+	h.partyMu.Lock()
+	defer h.partyMu.Unlock()
+	for _, other := range h.parties {
+		if other.invited[client.id] {
+			delete(other.invited, client.id)
+			h.sendPartyState(other)
+		}
+	}
+	party := h.partyOf[client]
+	if party == nil {
+		return
+	}
+	if h.matchmaker.remove(client) {
+		for _, m := range party.members {
+			if m.client != client {
+				m.client.sendError(CodeNotAllowed, "A party member left, so your party left the match queue")
+			}
+		}
+		go h.matchmaker.broadcastStatus()
+	}
+
+	delete(h.partyOf, client)
+	for i, m := range party.members {
+		if m.client == client {
+			party.members = append(party.members[:i], party.members[i+1:]...)
+			break
+		}
+	}
+	client.sendMessage(Message{
+		Type:    MsgTypePartyLeft,
+		Payload: mustMarshal(map[string]interface{}{"partyId": party.ID}),
+	})
+	if len(party.members) == 0 {
+		delete(h.parties, party.ID)
+		return
+	}
+	if party.leader == client {
+		party.leader = party.members[0].client
+	}
+	h.sendPartyState(party)
+}
+
+// sendPartyState tells every member who's in the party and who's been
+// invited. Caller must hold h.partyMu.
+func (h *Hub) sendPartyState(party *Party) {
+	members := make([]PartyMember, 0, len(party.members))
+	for _, m := range party.members {
+		members = append(members, PartyMember{ID: m.client.id, Name: m.name})
+	}
+	invited := make([]string, 0, len(party.invited))
+	for id := range party.invited {
+		invited = append(invited, id)
+	}
+	msg := Message{
+		Type: MsgTypePartyState,
+		Payload: mustMarshal(map[string]interface{}{
+			"partyId":  party.ID,
+			"leaderId": party.leader.id,
+			"members":  members,
+			"invited":  invited,
+		}),
+	}
+	for _, m := range party.members {
+		m.client.sendMessage(msg)
+	}
+}
+
+// queueTicket queues the client for a match: alone, or with their whole
+// party if they lead one. It returns the reason they can't queue, or ""
+// once queued. name is the client's own name for the match.
+func (h *Hub) queueTicket(client *Client, name string) string {
+	// Held until queued, so nobody joins or leaves the party in between
+	h.partyMu.Lock()
+	defer h.partyMu.Unlock()
+	party := h.partyOf[client]
+	if party == nil {
+		h.matchmaker.enqueue(&queuedPlayer{client: client, name: name, rating: h.currentRating(client.ratingKey(name))})
+		return ""
+	}
+	switch {
+	case party.leader != client:
+		return "Only the party leader can queue"
+	case len(party.members) > h.matchmaker.size:
+		return "Your party is bigger than a quick match"
+	}
+	ticket := make([]*queuedPlayer, 0, len(party.members))
+	for _, m := range party.members {
+		if m.client.currentRoom() != nil {
+			return m.name + " is still in a room"
+		}
+		q := &queuedPlayer{client: m.client, name: m.name, party: party}
+		if m.client == client {
+			q.name = name
+		}
+		q.rating = h.currentRating(m.client.ratingKey(q.name))
+		ticket = append(ticket, q)
+	}
+	if !h.matchmaker.enqueue(ticket...) {
+		return "Someone in your party is already queued"
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordLength stays under bcrypt's 72 byte input limit
+const maxPasswordLength = 64
+
+var (
+	// ErrInvalidPassword is returned for room passwords bcrypt can't take
+	ErrInvalidPassword = errors.New("room password must be at most 64 bytes")
+	// ErrWrongPassword is returned when a locked room's password doesn't match
+	ErrWrongPassword = errors.New("wrong room password")
+)
+
+// hashPassword hashes a room password, nil for rooms without one
+func hashPassword(password string) ([]byte, error) {
+	if password == "" {
+		return nil, nil
+	}
+	if len(password) > maxPasswordLength {
+		return nil, ErrInvalidPassword
+	}
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// admits reports whether password opens the room. The hash is set when
+// the room is created and never changes, so no lock is needed, and
+// callers should check before taking room.mu since bcrypt is slow.
+func (r *Room) admits(password string) bool {
+	if r.passwordHash == nil {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword(r.passwordHash, []byte(password)) == nil
+}
+
+// withoutPassword strips the password from a join payload before it goes
+// into an event log admins can read
+func withoutPassword(payload json.RawMessage) json.RawMessage {
+	if !bytes.Contains(payload, []byte(`"password"`)) {
+		return payload
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil
+	}
+	delete(fields, "password")
+	return mustMarshal(fields)
+}
@@ -0,0 +1,114 @@
+package hub
+
+import (
+	"log"
+	"time"
+)
+
+// handlePauseRace freezes the race clock until the host resumes
+func (h *Hub) handlePauseRace(room *Room, client *Client) {
+	if !isHost(room, client) {
+		client.sendError(CodeNotHost, "Only host can pause the race")
+		return
+	}
+
+	room.mu.Lock()
+	switch {
+	case !room.Started || room.Ended:
+		room.mu.Unlock()
+		client.sendError(CodeRaceNotRunning, "No race in progress")
+		return
+	case room.Ranked:
+		room.mu.Unlock()
+		client.sendError(CodeNotAllowed, "Ranked races can't be paused")
+		return
+	case room.Paused:
+		room.mu.Unlock()
+		return
+	}
+	room.Paused = true
+	room.pausedAt = time.Now()
+	room.resume = make(chan struct{})
+	if room.timer != nil {
+		room.timer.Stop()
+		room.timer = nil
+	}
+	elapsed := room.elapsed()
+	room.mu.Unlock()
+
+	log.Printf("Race in room %s paused at %dms", room.ID, elapsed)
+
+	h.broadcastToRoom(room, Message{
+		Type: MsgTypeRacePaused,
+		Payload: mustMarshal(map[string]interface{}{
+			"elapsed":    elapsed,
+			"serverTime": time.Now().UnixMilli(),
+		}),
+	}, nil)
+}
+
+// handleResumeRace restarts the race clock where it was paused
+func (h *Hub) handleResumeRace(room *Room, client *Client) {
+	if !isHost(room, client) {
+		client.sendError(CodeNotHost, "Only host can resume the race")
+		return
+	}
+
+	room.mu.Lock()
+	if !room.Paused || room.Ended {
+		room.mu.Unlock()
+		return
+	}
+	room.pausedFor += time.Since(room.pausedAt)
+	room.Paused = false
+	room.pausedAt = time.Time{}
+	close(room.resume)
+	room.resume = nil
+	room.touchAll()
+	h.startRaceClock(room)
+	elapsed := room.elapsed()
+	room.mu.Unlock()
+
+	log.Printf("Race in room %s resumed at %dms", room.ID, elapsed)
+
+	h.broadcastToRoom(room, Message{
+		Type: MsgTypeRaceResumed,
+		Payload: mustMarshal(map[string]interface{}{
+			"elapsed":    elapsed,
+			"serverTime": time.Now().UnixMilli(),
+		}),
+	}, nil)
+}
+
+// waitRaceTime blocks until the race clock reaches at (ms), so ghosts and
+// bots hold still while the race is paused. It reports false if the room
+// closes first.
+func (h *Hub) waitRaceTime(room *Room, at int64) bool {
+	for {
+		room.mu.RLock()
+		resume := room.resume
+		remaining := time.Duration(at-room.elapsed()) * time.Millisecond
+		room.mu.RUnlock()
+
+		if resume != nil {
+			select {
+			case <-resume:
+				continue
+			case <-room.done:
+				return false
+			}
+		}
+		if remaining <= 0 {
+			return true
+		}
+
+		// A pause during the wait just means another lap once it resumes
+		timer := time.NewTimer(remaining)
+		select {
+		case <-timer.C:
+		case <-room.done:
+			timer.Stop()
+			return false
+		}
+	}
+}
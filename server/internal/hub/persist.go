@@ -0,0 +1,257 @@
+package hub
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+const (
+	// liveRoomCollection holds a snapshot of every race in progress
+	liveRoomCollection = "live_rooms"
+	// snapshotInterval is how often running races are saved, and so
+	// about how much progress a crash can lose
+	snapshotInterval = 15 * time.Second
+	// maxSnapshotAge skips restoring races saved longer ago than this;
+	// after a long outage nobody is coming back to them
+	maxSnapshotAge = 30 * time.Minute
+	// restoreGrace closes restored rooms that no player rejoins in time
+	restoreGrace = 5 * time.Minute
+)
+
+// savedRoom is what survives a restart or a migration between instances.
+// Race time is kept as elapsed rather than a start time so the downtime
+// isn't counted against the racers.
+type savedRoom struct {
+	ID           string           `json:"id"`
+	HostID       string           `json:"hostId"`
+	StartArticle string           `json:"startArticle"`
+	EndArticle   string           `json:"endArticle"`
+	Mode         GameMode         `json:"mode"`
+	Language     string           `json:"language"`
+	Config       RoomConfig       `json:"config"`
+	Theme        *Theme           `json:"theme,omitempty"`
+	Private      bool             `json:"private"`
+	Ranked       bool             `json:"ranked"`
+	Started      bool             `json:"started"`
+	Ended        bool             `json:"ended,omitempty"`
+	Paused       bool             `json:"paused,omitempty"`
+	Elapsed      int64            `json:"elapsed"` // ms of race time at the snapshot
+	PasswordHash []byte           `json:"passwordHash,omitempty"`
+	Teams        map[string]*Team `json:"teams,omitempty"`
+	Hider        string           `json:"hider,omitempty"`
+	Round        int              `json:"round,omitempty"`
+	NextRotation int64            `json:"nextRotation,omitempty"`
+	Series       *Series          `json:"series,omitempty"`
+	Event        string           `json:"event,omitempty"`
+	EventID      string           `json:"eventId,omitempty"`
+	Players      []savedPlayer    `json:"players"`
+	SavedAt      time.Time        `json:"savedAt"`
+}
+
+// savedPlayer adds the progress Player keeps out of its JSON
+type savedPlayer struct {
+	Player
+	GuestID  string      `json:"guestId,omitempty"`
+	Steps    []GhostStep `json:"steps,omitempty"`
+	JoinedAt int64       `json:"joinedAt,omitempty"`
+	// ScoredRound is the last king of the hill target the player reached
+	ScoredRound int `json:"scoredRound,omitempty"`
+}
+
+// saved encodes the room for the store. Caller must hold room.mu.
+func (r *Room) saved() json.RawMessage {
+	s := savedRoom{
+		ID:           r.ID,
+		HostID:       r.HostID,
+		StartArticle: r.StartArticle,
+		EndArticle:   r.EndArticle,
+		Mode:         r.Mode,
+		Language:     r.Language,
+		Config:       r.Config,
+		Theme:        r.Theme,
+		Private:      r.Private,
+		Ranked:       r.Ranked,
+		Started:      r.Started,
+		Ended:        r.Ended,
+		Paused:       r.Paused,
+		Elapsed:      r.elapsed(),
+		PasswordHash: r.passwordHash,
+		Teams:        r.Teams,
+		Hider:        r.Hider,
+		Round:        r.Round,
+		NextRotation: r.NextRotation,
+		Series:       r.Series,
+		Event:        r.Event,
+		EventID:      r.eventID,
+		Players:      make([]savedPlayer, 0, len(r.Players)),
+		SavedAt:      time.Now().UTC(),
+	}
+	for _, p := range r.Players {
+		s.Players = append(s.Players, savedPlayer{
+			Player:   *p,
+			GuestID:  p.guestID,
+			Steps:    p.steps,
+			JoinedAt: p.joinedAt,
+
+			ScoredRound: p.scoredRound,
+		})
+	}
+	return mustMarshal(s)
+}
+
+// watchSnapshots saves every running race each interval and drops the
+// snapshots of races that have ended or closed since, in one store write
+// per pass. A draining instance leaves the store to the one its rooms are
+// moving to.
+func (h *Hub) watchSnapshots() {
+	ticker := time.NewTicker(snapshotInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if h.draining.Load() {
+			continue
+		}
+		live := make(map[string]interface{})
+		for _, room := range h.rooms.all() {
+			room.mu.RLock()
+			if room.Started && !room.Ended && !room.closed {
+				live[room.ID] = room.saved()
+			}
+			room.mu.RUnlock()
+		}
+		if err := h.store.Replace(liveRoomCollection, live); err != nil {
+			log.Printf("Room snapshots not saved: %v", err)
+		}
+	}
+}
+
+// forgetRoom drops a room's snapshot once its race is over, so a crash
+// before the next pass doesn't bring it back
+func (h *Hub) forgetRoom(room *Room) {
+	if h.draining.Load() {
+		return
+	}
+	if err := h.store.Delete(liveRoomCollection, room.ID); err != nil {
+		log.Printf("Snapshot of room %s not deleted: %v", room.ID, err)
+	}
+}
+
+// restoreRooms brings back the races that were running when the server
+// last stopped. Players rejoin them with rejoin_room as usual. Bots and
+// ghosts can't pick up where they were, so unfinished ones are marked
+// forfeited.
+func (h *Hub) restoreRooms() {
+	var saved []savedRoom
+	h.store.Each(liveRoomCollection, func(id string, raw json.RawMessage) error {
+		var s savedRoom
+		if err := json.Unmarshal(raw, &s); err != nil {
+			log.Printf("Snapshot of room %s unreadable: %v", id, err)
+			return nil
+		}
+		saved = append(saved, s)
+		return nil
+	})
+
+	for _, s := range saved {
+		if time.Since(s.SavedAt) > maxSnapshotAge {
+			log.Printf("Snapshot of room %s too old to restore", s.ID)
+			h.store.Delete(liveRoomCollection, s.ID)
+			continue
+		}
+		room, err := h.restoreRoom(s)
+		if err != nil {
+			log.Printf("Room %s not restored: %v", s.ID, err)
+			h.store.Delete(liveRoomCollection, s.ID)
+			continue
+		}
+		log.Printf("Restored room %s (%d players, %dms in)", room.ID, len(s.Players), s.Elapsed)
+	}
+}
+
+// restoreRoom rebuilds a room from its snapshot and adds it to the hub.
+// The room closes after restoreGrace unless someone has come back to it.
+func (h *Hub) restoreRoom(s savedRoom) (*Room, error) {
+	room, err := newRoom(s.ID, s.HostID, RoomOptions{
+		StartArticle: s.StartArticle,
+		EndArticle:   s.EndArticle,
+		Mode:         string(s.Mode),
+		Language:     s.Language,
+		Config:       s.Config,
+		Theme:        s.Theme,
+		Private:      s.Private,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	room.mu.Lock()
+	room.passwordHash = s.PasswordHash
+	room.Locked = s.PasswordHash != nil
+	room.Ranked = s.Ranked
+	room.Teams = s.Teams
+	room.Hider = s.Hider
+	room.Round, room.NextRotation = s.Round, s.NextRotation
+	room.Series = s.Series
+	room.Event, room.eventID = s.Event, s.EventID
+	room.Started = s.Started
+	room.Ended = s.Ended
+	now := time.Now()
+	if s.Started {
+		room.StartedAt = now.Add(-time.Duration(s.Elapsed) * time.Millisecond)
+	}
+	if s.Paused {
+		room.Paused = true
+		room.pausedAt = now
+		room.resume = make(chan struct{})
+	}
+	for _, sp := range s.Players {
+		p := sp.Player
+		p.guestID = sp.GuestID
+		p.steps = sp.Steps
+		p.joinedAt = sp.JoinedAt
+		p.scoredRound = sp.ScoredRound
+		if p.virtual() && !p.Finished {
+			p.Forfeited = true
+		}
+		room.Players[p.ID] = &p
+	}
+	running := room.Started && !room.Ended && !room.Paused
+	if running {
+		// Idle clocks start over, everyone needs time to reconnect
+		room.touchAll()
+		h.startRaceClock(room)
+	}
+	room.mu.Unlock()
+
+	if err := h.rooms.add(room, 0); err != nil {
+		room.stop()
+		return nil, err
+	}
+	if running {
+		go h.planOptimal(room)
+	}
+	time.AfterFunc(restoreGrace, func() { h.closeIfAbandoned(room) })
+	return room, nil
+}
+
+// closeIfAbandoned closes a restored room if nobody has come back to it
+func (h *Hub) closeIfAbandoned(room *Room) {
+	if current, ok := h.rooms.get(room.ID); !ok || current != room {
+		return
+	}
+	room.mu.RLock()
+	rejoined := len(room.Spectators) > 0
+	for _, p := range room.Players {
+		if p.client != nil {
+			rejoined = true
+			break
+		}
+	}
+	room.mu.RUnlock()
+
+	if !rejoined {
+		log.Printf("Restored room %s closed, nobody rejoined", room.ID)
+		h.CloseRoom(room.ID)
+	}
+}
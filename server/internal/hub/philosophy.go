@@ -0,0 +1,96 @@
+package hub
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+// philosophyArticle is the Philosophy game's target on English Wikipedia.
+// Other editions race to its interlanguage equivalent.
+const philosophyArticle = "Philosophy"
+
+// firstLink is the only click a Philosophy game allows from one article
+type firstLink struct {
+	from, to string
+}
+
+// philosophyTarget returns the end article a room config races to:
+// Philosophy on the room's edition for a Philosophy game, end otherwise
+func (h *Hub) philosophyTarget(lang string, cfg RoomConfig, end string) (string, error) {
+	if !cfg.Philosophy {
+		return end, nil
+	}
+	if lang, _ = parseLanguage(lang); lang == wiki.DefaultLanguage {
+		return philosophyArticle, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	title, err := h.wikiFor(wiki.DefaultLanguage).LangLink(ctx, philosophyArticle, lang)
+	if err != nil {
+		return "", langLinkError(err, philosophyArticle, lang)
+	}
+	return title, nil
+}
+
+// philosophyCheck rejects room setups a Philosophy game can't support,
+// returning the reason or "". Bots and ghosts follow routes the first
+// link rule would reject. Caller must hold room.mu.
+func (r *Room) philosophyCheck() string {
+	if !r.Config.Philosophy {
+		return ""
+	}
+	switch {
+	case r.Config.Relay || len(r.Config.Checkpoints) > 0:
+		return "The Philosophy game can't use checkpoints or relay"
+	case r.Config.CrossLanguage:
+		return "The Philosophy game can't be raced across languages"
+	case r.StartArticle == "":
+		return "Pick a start article first"
+	}
+	for _, p := range r.Players {
+		if p.virtual() {
+			return "Bots and ghosts can't play the Philosophy game"
+		}
+	}
+	return ""
+}
+
+// lookupFirstLink finds the click a Philosophy game allows from an
+// article, resolving redirects so it compares with the player's
+// canonical click. It returns nil if Wikipedia can't be reached, which
+// leaves the click unchecked, as with failed category lookups.
+func (h *Hub) lookupFirstLink(ctx context.Context, lang, from string) *firstLink {
+	to, err := h.wikiFor(lang).FirstLink(ctx, from)
+	if err != nil {
+		log.Printf("First link lookup failed for %s: %v", from, err)
+		return nil
+	}
+	to, err = h.canonical(ctx, lang, to)
+	if err != nil {
+		log.Printf("Redirect lookup failed for %s: %v", to, err)
+	}
+	return &firstLink{from: from, to: to}
+}
+
+// checkFirstLink rejects a Philosophy game click that isn't the first
+// link on the player's article. next was looked up before the lock was
+// taken, so it only counts if the player hasn't moved since. Caller must
+// hold room.mu.
+func (r *Room) checkFirstLink(player *Player, article string, next *firstLink) *RuleViolation {
+	if !r.Config.Philosophy || !r.Started || next == nil {
+		return nil
+	}
+	lang := r.playerLanguage(player)
+	if wiki.SameArticleIn(lang, next.from, player.CurrentArticle) && wiki.SameArticleIn(lang, next.to, article) {
+		return nil
+	}
+	return &RuleViolation{
+		Rule:    RuleFirstLink,
+		Article: article,
+		Message: "Only the first link outside parentheses and italics counts",
+	}
+}
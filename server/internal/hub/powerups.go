@@ -0,0 +1,193 @@
+package hub
+
+import (
+	"encoding/json"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// PowerUp is an arcade-mode item granted by the server during a race
+type PowerUp string
+
+const (
+	PowerUpPeek     PowerUp = "peek"      // see an opponent's current article
+	PowerUpFreeze   PowerUp = "freeze"    // block an opponent's clicks briefly
+	PowerUpBackStep PowerUp = "back_step" // return to the previous article without a click
+)
+
+const (
+	// powerUpEvery grants a power-up each time a player's click count
+	// reaches a multiple of it
+	powerUpEvery = 3
+	// maxPowerUpsHeld caps a player's inventory; grants past it are lost
+	maxPowerUpsHeld = 2
+	freezeDuration  = 5 * time.Second
+)
+
+var powerUps = []PowerUp{PowerUpPeek, PowerUpFreeze, PowerUpBackStep}
+
+// powerUpCooldown is how long a player waits between uses of each kind
+var powerUpCooldown = map[PowerUp]time.Duration{
+	PowerUpPeek:     20 * time.Second,
+	PowerUpFreeze:   30 * time.Second,
+	PowerUpBackStep: 15 * time.Second,
+}
+
+type UsePowerUpPayload struct {
+	PowerUp  PowerUp `json:"powerUp"`
+	TargetID string  `json:"targetId,omitempty"` // opponent for peek and freeze
+}
+
+// grantPowerUp hands a live player a random power-up on every
+// powerUpEvery-th click in an arcade race, returning the grant message to
+// send them. Caller must hold room.mu.
+func (r *Room) grantPowerUp(player *Player) *Message {
+	if !r.Config.Arcade || !r.Started || player.virtual() ||
+		player.Clicks%powerUpEvery != 0 || len(player.PowerUps) >= maxPowerUpsHeld {
+		return nil
+	}
+	granted := powerUps[rand.Intn(len(powerUps))]
+	player.PowerUps = append(player.PowerUps, granted)
+	return &Message{
+		Type: MsgTypePowerUpGranted,
+		Payload: mustMarshal(map[string]interface{}{
+			"powerUp":  granted,
+			"powerUps": player.PowerUps,
+		}),
+	}
+}
+
+// takePowerUp removes one of kind from the player's inventory, reporting
+// whether they had it. Caller must hold room.mu.
+func (p *Player) takePowerUp(kind PowerUp) bool {
+	for i, held := range p.PowerUps {
+		if held == kind {
+			p.PowerUps = append(p.PowerUps[:i], p.PowerUps[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// frozen reports whether a freeze is blocking the player's clicks.
+// Caller must hold room.mu.
+func (p *Player) frozen() bool {
+	return time.Now().Before(p.frozenUntil)
+}
+
+func (h *Hub) handleUsePowerUp(room *Room, client *Client, payload json.RawMessage) {
+	var p UsePowerUpPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		client.sendError(CodeBadRequest, "Invalid use_power_up payload")
+		return
+	}
+	if _, ok := powerUpCooldown[p.PowerUp]; !ok {
+		client.sendError(CodeBadRequest, "Unknown power-up")
+		return
+	}
+
+	room.touch(client.id)
+
+	room.mu.Lock()
+	player, exists := room.Players[client.id]
+	switch {
+	case !room.Config.Arcade:
+		room.mu.Unlock()
+		client.sendError(CodePowerUp, "Power-ups are only available in arcade races")
+		return
+	case !room.Started || room.Ended || room.Paused:
+		room.mu.Unlock()
+		client.sendError(CodeRaceNotRunning, "No race in progress")
+		return
+	case !exists || player.Finished || player.Forfeited:
+		room.mu.Unlock()
+		return
+	}
+
+	var target *Player
+	if p.PowerUp != PowerUpBackStep {
+		target = room.Players[p.TargetID]
+		if target == nil || target == player || target.Ghost || target.Finished || target.Forfeited {
+			room.mu.Unlock()
+			client.sendError(CodePowerUp, "Pick an opponent still racing")
+			return
+		}
+	}
+	if p.PowerUp == PowerUpFreeze && target.frozen() {
+		room.mu.Unlock()
+		client.sendError(CodePowerUp, "That player is already frozen")
+		return
+	}
+	if p.PowerUp == PowerUpBackStep && len(player.Path) < 2 {
+		room.mu.Unlock()
+		client.sendError(CodePowerUp, "There's no article to step back to")
+		return
+	}
+	if ready := player.cooldowns[p.PowerUp]; time.Now().Before(ready) {
+		room.mu.Unlock()
+		client.sendError(CodePowerUp, "That power-up is cooling down")
+		return
+	}
+	if !player.takePowerUp(p.PowerUp) {
+		room.mu.Unlock()
+		client.sendError(CodePowerUp, "You don't have that power-up")
+		return
+	}
+	if player.cooldowns == nil {
+		player.cooldowns = make(map[PowerUp]time.Time)
+	}
+	player.cooldowns[p.PowerUp] = time.Now().Add(powerUpCooldown[p.PowerUp])
+
+	effect := map[string]interface{}{
+		"playerId": player.ID,
+		"powerUp":  p.PowerUp,
+	}
+	var direct, update *Message
+	switch p.PowerUp {
+	case PowerUpPeek:
+		effect["targetId"] = target.ID
+		direct = &Message{
+			Type: MsgTypePeekResult,
+			Payload: mustMarshal(map[string]interface{}{
+				"targetId":       target.ID,
+				"currentArticle": target.CurrentArticle,
+				"clicks":         target.Clicks,
+			}),
+		}
+	case PowerUpFreeze:
+		target.frozenUntil = time.Now().Add(freezeDuration)
+		effect["targetId"] = target.ID
+		effect["durationMs"] = freezeDuration.Milliseconds()
+	case PowerUpBackStep:
+		// The step back is a move but not a click, so it bypasses the
+		// no-back-button rule and costs nothing
+		previous := player.Path[len(player.Path)-2]
+		player.CurrentArticle = previous
+		player.Path = append(player.Path, previous)
+		player.steps = append(player.steps, GhostStep{Article: previous, At: room.elapsed()})
+		update = &Message{
+			Type: MsgTypePlayerUpdate,
+			Payload: mustMarshal(map[string]interface{}{
+				"playerId":       player.ID,
+				"currentArticle": previous,
+				"clicks":         player.Clicks,
+			}),
+		}
+	}
+	name := player.Name
+	room.mu.Unlock()
+
+	log.Printf("Player %s used %s in room %s", name, p.PowerUp, room.ID)
+
+	if direct != nil {
+		client.sendMessage(*direct)
+	}
+	h.broadcastToRoom(room, Message{
+		Type:    MsgTypePowerUpUsed,
+		Payload: mustMarshal(effect),
+	}, nil)
+	if update != nil {
+		h.broadcastToRoom(room, *update, nil)
+	}
+}
@@ -0,0 +1,80 @@
+package hub
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+// preloadHintCount is how many link titles go out in preload_hints
+const preloadHintCount = 20
+
+// sendPreloadHints fetches the start article's outgoing links and
+// broadcasts the likeliest first clicks so clients can warm their caches
+// while players read the start page
+func (h *Hub) sendPreloadHints(room *Room) {
+	room.mu.RLock()
+	start, lang := room.StartArticle, room.Language
+	targets := append([]string{}, room.Config.Checkpoints...)
+	targets = append(targets, room.EndArticle)
+	room.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	links, err := h.outgoingLinks(ctx, lang, start)
+	if err != nil {
+		log.Printf("Preload hints for %s skipped: %v", start, err)
+		return
+	}
+
+	h.broadcastToRoom(room, Message{
+		Type: MsgTypePreloadHints,
+		Payload: mustMarshal(map[string]interface{}{
+			"article":  start,
+			"language": lang,
+			"links":    rankHints(lang, links, targets, preloadHintCount),
+		}),
+	}, nil)
+}
+
+// rankHints picks up to n links worth preloading: any that are race
+// targets first, then the rest in API order, skipping bare years and
+// "List of" pages that players rarely open from the start page
+func rankHints(lang string, links, targets []string, n int) []string {
+	hints := make([]string, 0, n)
+	rest := make([]string, 0, len(links))
+	for _, link := range links {
+		isTarget := false
+		for _, target := range targets {
+			if wiki.SameArticleIn(lang, link, target) {
+				isTarget = true
+				break
+			}
+		}
+		switch {
+		case isTarget:
+			hints = append(hints, link)
+		case strings.HasPrefix(link, "List of"):
+		default:
+			if _, err := strconv.Atoi(link); err != nil {
+				rest = append(rest, link)
+			}
+		}
+	}
+
+	for _, link := range rest {
+		if len(hints) >= n {
+			break
+		}
+		hints = append(hints, link)
+	}
+	if len(hints) > n {
+		hints = hints[:n]
+	}
+	return hints
+}
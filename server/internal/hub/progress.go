@@ -0,0 +1,174 @@
+package hub
+
+import (
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+// progressInterval is how often running races get a progress_update
+const progressInterval = 3 * time.Second
+
+// Progress is how far a racer is from their next target on the link
+// graph. Distance is -1 when the graph has no route or doesn't know
+// one of the articles.
+type Progress struct {
+	PlayerID string `json:"playerId"`
+	Article  string `json:"article"`
+	Target   string `json:"target"`
+	Distance int    `json:"distance"`
+}
+
+// progressQuery is what a distance needs, copied out of the room so the
+// searches run without its lock
+type progressQuery struct {
+	player *Player
+	lang   string
+	Progress
+}
+
+// watchProgress periodically sends each running race's standings by
+// distance. It only runs with an offline graph; searching through the API
+// every few seconds would be far too slow.
+func (h *Hub) watchProgress() {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, room := range h.rooms.all() {
+			h.sendProgress(room)
+		}
+	}
+}
+
+// sendProgress measures every racer still running and sends the result
+// to the room's audience
+func (h *Hub) sendProgress(room *Room) {
+	room.mu.RLock()
+	if !room.Started || room.Ended || room.Paused {
+		room.mu.RUnlock()
+		return
+	}
+	audience := room.progressAudience()
+	hideAndSeek := room.Config.HideAndSeek
+	if len(audience) == 0 && !hideAndSeek {
+		room.mu.RUnlock()
+		return
+	}
+	var hider *Client
+	var seekers map[string]*Client
+	if hideAndSeek {
+		hider, seekers = room.proximityClients()
+	}
+	queries := make([]progressQuery, 0, len(room.Players))
+	for _, p := range room.Players {
+		if p.Finished || p.Forfeited || p.OutOfClicks || (hideAndSeek && p.ID == room.Hider) {
+			continue
+		}
+		target := room.nextTarget(p)
+		queries = append(queries, progressQuery{
+			player: p,
+			lang:   room.playerLanguage(p),
+			Progress: Progress{
+				PlayerID: p.ID,
+				Article:  p.CurrentArticle,
+				Target:   target,
+				Distance: p.distanceIfCurrent(p.CurrentArticle, target),
+			},
+		})
+	}
+	room.mu.RUnlock()
+
+	progress := make([]Progress, 0, len(queries))
+	for i := range queries {
+		q := &queries[i]
+		if q.Distance == unmeasured {
+			q.Distance = h.distance(q.lang, q.Article, q.Target)
+		}
+		progress = append(progress, q.Progress)
+	}
+
+	// Keep the distances so the next tick only searches for players who
+	// have moved since
+	room.mu.Lock()
+	for _, q := range queries {
+		q.player.distance = distanceCache{article: q.Article, target: q.Target, clicks: q.Distance}
+	}
+	room.mu.Unlock()
+
+	msg := Message{
+		Type:    MsgTypeProgressUpdate,
+		Payload: mustMarshal(map[string]interface{}{"progress": progress}),
+	}
+	for _, c := range audience {
+		c.sendMessage(msg)
+	}
+	if hideAndSeek {
+		sendProximity(hider, seekers, progress)
+	}
+}
+
+// progressAudience lists who may see distances: spectators, and players
+// who are done racing. Telling a racer how far they are from the target
+// would give away whether their last click helped. Caller must hold
+// room.mu.
+func (r *Room) progressAudience() []*Client {
+	clients := make([]*Client, 0, len(r.Spectators))
+	for _, s := range r.Spectators {
+		clients = append(clients, s.client)
+	}
+	for _, p := range r.Players {
+		if p.client != nil && (p.Finished || p.Forfeited || p.OutOfClicks) {
+			clients = append(clients, p.client)
+		}
+	}
+	return clients
+}
+
+// nextTarget is the article the player is heading for: their next
+// checkpoint, or the end once those are done. Seekers head for wherever
+// the hider is. Caller must hold room.mu.
+func (r *Room) nextTarget(p *Player) string {
+	if hider, ok := r.Players[r.Hider]; ok && r.Config.HideAndSeek {
+		return hider.CurrentArticle
+	}
+	if p.Checkpoint < len(r.Config.Checkpoints) {
+		return r.Config.Checkpoints[p.Checkpoint]
+	}
+	return r.playerTarget(p)
+}
+
+// distance counts the clicks on the shortest route between two articles,
+// or -1 without one
+func (h *Hub) distance(lang, from, to string) int {
+	g := h.graphFor(lang)
+	if g == nil {
+		return -1
+	}
+	if wiki.SameArticleIn(lang, from, to) {
+		return 0
+	}
+	path, err := g.ShortestPath(from, to)
+	if err != nil {
+		return -1
+	}
+	return len(path) - 1
+}
+
+// unmeasured marks a distance that still needs a search
+const unmeasured = -2
+
+// distanceCache is the last distance measured for a player
+type distanceCache struct {
+	article, target string
+	clicks          int
+}
+
+// distanceIfCurrent returns the cached distance if it was measured from
+// article to target, otherwise unmeasured. Caller must hold room.mu.
+func (p *Player) distanceIfCurrent(article, target string) int {
+	if p.distance.article != article || p.distance.target != target || article == "" {
+		return unmeasured
+	}
+	return p.distance.clicks
+}
@@ -0,0 +1,121 @@
+package hub
+
+import (
+	"encoding/json"
+	"log"
+)
+
+const (
+	// ProtocolVersion is the protocol this server speaks. Version 2 added
+	// hello, error codes and batched cursors, version 3 broadcast sequence
+	// numbers and request_sync replays.
+	ProtocolVersion = 3
+	// minProtocolVersion is the oldest client protocol still served.
+	// Clients that never send hello are treated as version 1.
+	minProtocolVersion = 1
+)
+
+// Feature is an optional protocol behaviour a client opts into with hello
+type Feature string
+
+const (
+	// FeatureCursorBatch receives every cursor_batch as is. Clients
+	// without it get one cursor_update per player instead.
+	FeatureCursorBatch Feature = "cursor_batch"
+	// FeatureMsgpack confirms binary MessagePack frames. The encoding is
+	// fixed when the connection opens, so it is only granted to clients
+	// that asked for it then.
+	FeatureMsgpack Feature = "msgpack"
+	// FeatureCompression keeps permessage-deflate on for large messages.
+	// It needs the extension negotiated in the handshake; clients that
+	// send hello without it get uncompressed frames.
+	FeatureCompression Feature = "compression"
+)
+
+// featureBits maps features to bits in Client.features
+var featureBits = map[Feature]uint32{
+	FeatureCursorBatch: 1 << 0,
+	FeatureMsgpack:     1 << 1,
+	FeatureCompression: 1 << 2,
+}
+
+type HelloPayload struct {
+	Version  int       `json:"version"`
+	Features []Feature `json:"features,omitempty"`
+}
+
+// has reports whether the client negotiated f
+func (c *Client) has(f Feature) bool {
+	return c.features.Load()&featureBits[f] != 0
+}
+
+// supports reports whether the server can enable f on this connection
+func (c *Client) supports(f Feature) bool {
+	switch f {
+	case FeatureCursorBatch:
+		return true
+	case FeatureMsgpack:
+		return c.encoding == encodingMsgpack
+	case FeatureCompression:
+		return c.deflate
+	default:
+		return false
+	}
+}
+
+// handleHello negotiates the protocol version and features. The reply
+// carries the version the server will speak, which is lower than the
+// client's when the client is newer, and the features granted.
+func (h *Hub) handleHello(client *Client, payload json.RawMessage) {
+	var p HelloPayload
+	if err := json.Unmarshal(payload, &p); err != nil || p.Version < 1 {
+		client.sendError(CodeBadRequest, "Invalid hello payload")
+		return
+	}
+	if p.Version < minProtocolVersion {
+		log.Printf("Client %s speaks protocol %d, closing", client.id, p.Version)
+		client.sendError(CodeOldVersion, "This version of the game is out of date, please reload")
+		go client.disconnect(CloseUnsupportedProtocol, "unsupported protocol version")
+		return
+	}
+
+	var bits uint32
+	granted := make([]Feature, 0, len(p.Features))
+	for _, f := range p.Features {
+		bit, known := featureBits[f]
+		if !known || bits&bit != 0 || !client.supports(f) {
+			continue
+		}
+		bits |= bit
+		granted = append(granted, f)
+	}
+	client.features.Store(bits)
+	client.compress.Store(client.has(FeatureCompression))
+
+	version := p.Version
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+	welcome := map[string]interface{}{
+		"version":  version,
+		"features": granted,
+		"clientId": client.id,
+	}
+	// Guests keep this and send it when they reconnect, so their stats
+	// follow them even where the guest cookie doesn't
+	if client.guestID != "" && h.auth != nil {
+		welcome["identity"] = h.auth.GuestIdentity(client.guestID)
+	}
+	client.sendMessage(Message{Type: MsgTypeWelcome, Payload: mustMarshal(welcome)})
+}
+
+// featureNames lists the client's negotiated features, for operators
+func (c *Client) featureNames() []Feature {
+	names := make([]Feature, 0, len(featureBits))
+	for _, f := range []Feature{FeatureCursorBatch, FeatureMsgpack, FeatureCompression} {
+		if c.has(f) {
+			names = append(names, f)
+		}
+	}
+	return names
+}
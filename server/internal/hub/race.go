@@ -0,0 +1,218 @@
+package hub
+
+import (
+	"log"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/rating"
+)
+
+// Reasons reported in race_ended
+const (
+	RaceEndAllFinished = "all_finished"
+	RaceEndTimeLimit   = "time_limit"
+	RaceEndCaught      = "caught" // a seeker found the hider
+)
+
+// maxTimeLimit caps host-configured race time limits
+const maxTimeLimit = 4 * time.Hour
+
+// timeLimit returns the configured race duration, or 0 for no limit
+func (c RoomConfig) timeLimit() time.Duration {
+	d := time.Duration(c.TimeLimitSeconds) * time.Second
+	if d <= 0 {
+		return 0
+	}
+	if d > maxTimeLimit {
+		return maxTimeLimit
+	}
+	return d
+}
+
+// startRaceClock arms the room's time limit, if any, for whatever race
+// time is left. Caller must hold room.mu.
+func (h *Hub) startRaceClock(room *Room) {
+	if limit := room.Config.timeLimit(); limit > 0 {
+		remaining := limit - time.Duration(room.elapsed())*time.Millisecond
+		room.timer = time.AfterFunc(remaining, func() {
+			h.endRace(room, RaceEndTimeLimit)
+		})
+	}
+}
+
+// markFinished records a player reaching the target using the server's
+// race clock and returns the player_finish broadcast. Caller must hold
+// room.mu.
+func (r *Room) markFinished(player *Player) Message {
+	player.Finished = true
+	player.FinishTime = r.elapsed()
+	if player.Late {
+		player.FinishTime += r.Config.latePenalty().Milliseconds()
+	}
+
+	return Message{
+		Type: MsgTypePlayerFinish,
+		Payload: mustMarshal(map[string]interface{}{
+			"playerId":   player.ID,
+			"playerName": player.Name,
+			"time":       player.FinishTime,
+			"clicks":     player.Clicks,
+			"path":       player.Path,
+			"rank":       rankOf(r.standings(), player.ID),
+		}),
+	}
+}
+
+// endRace concludes a race exactly once: unfinished players are ranked as
+// DNF, ranked rooms update ratings, and race_ended plus race_summary are
+// broadcast. The summary breaks every player's run into timed hops, for
+// the post-game screen.
+func (h *Hub) endRace(room *Room, reason string) {
+	room.mu.Lock()
+	if !room.Started || room.Ended {
+		room.mu.Unlock()
+		return
+	}
+	room.Ended = true
+	if room.timer != nil {
+		room.timer.Stop()
+		room.timer = nil
+	}
+	if room.resume != nil {
+		// Release ghosts and bots waiting out a pause so they can exit
+		close(room.resume)
+		room.resume = nil
+	}
+
+	room.escape()
+	standings := room.standings()
+	for i := range standings {
+		standings[i].DNF = standings[i].Rank == 0
+	}
+	// Ratings are saved once the room is unlocked
+	ranked := room.Ranked
+	var placements []rating.Placement
+	var ratingKeys map[string]string
+	if ranked {
+		placements, ratingKeys = rankedPlacements(room, standings)
+	}
+	var series *Message
+	if room.scoreSeries(standings) {
+		msg := room.seriesMessage()
+		series = &msg
+		h.afterSeriesRace(room)
+	}
+	var teams []TeamStanding
+	if room.Config.Relay {
+		teams = room.teamStandings()
+		for i := range teams {
+			teams[i].DNF = !teams[i].Finished
+		}
+	}
+	mode := room.Mode
+	hops := make(map[string][]Hop, len(standings))
+	slowest := make(map[string]*Hop, len(standings))
+	for _, s := range standings {
+		if p, ok := room.Players[s.PlayerID]; ok {
+			hops[s.PlayerID] = room.hops(p)
+			if hop := slowestHop(hops[s.PlayerID]); hop != nil {
+				slowest[s.PlayerID] = hop
+			}
+		}
+	}
+	divergences := room.divergences(standings)
+	paths := room.comparePaths(standings)
+	h.notifyRaceEnded(room, reason, standings)
+	results := room.raceResults(standings)
+	record := room.raceRecord(reason, standings)
+	room.mu.Unlock()
+
+	log.Printf("Race in room %s ended: %s", room.ID, reason)
+
+	var ratingChanges map[string]rating.Change
+	if ranked {
+		ratingChanges = h.applyRatings(room, placements, ratingKeys)
+	}
+
+	ended := map[string]interface{}{
+		"raceId":    record.ID,
+		"reason":    reason,
+		"standings": standings,
+	}
+	summary := map[string]interface{}{
+		"raceId":      record.ID,
+		"mode":        mode,
+		"standings":   standings,
+		"ratings":     ratingChanges,
+		"hops":        hops,
+		"slowestHops": slowest,
+		"divergences": divergences,
+		"paths":       paths,
+	}
+	if teams != nil {
+		ended["teams"] = teams
+		summary["teams"] = teams
+	}
+	h.broadcastToRoom(room, Message{Type: MsgTypeRaceEnded, Payload: mustMarshal(ended)}, nil)
+	h.broadcastToRoom(room, Message{Type: MsgTypeRaceSummary, Payload: mustMarshal(summary)}, nil)
+	if series != nil {
+		h.broadcastToRoom(room, *series, nil)
+	}
+	h.saveRace(record)
+	h.forgetRoom(room)
+	h.recordResults(room, results)
+}
+
+// handleForfeit lets a stuck player concede. They are ranked DNF and the
+// race ends once everyone else has finished or forfeited too.
+func (h *Hub) handleForfeit(room *Room, client *Client) {
+	h.forfeitPlayer(room, client.id, "")
+}
+
+// forfeitPlayer drops a player from the race and ends it if nobody is
+// left racing. reason is included in player_forfeit when set, e.g. "idle"
+// for players the server gave up on.
+func (h *Hub) forfeitPlayer(room *Room, id, reason string) {
+	room.mu.Lock()
+	player, exists := room.Players[id]
+	if !exists || !room.Started || room.Ended || player.Finished || player.Forfeited || player.OutOfClicks {
+		room.mu.Unlock()
+		return
+	}
+	player.Forfeited = true
+	var teamMsg *Message
+	if room.Config.Relay {
+		// One runner dropping out ends the relay for their whole team
+		room.forfeitTeam(player)
+		msg := room.teamUpdateMessage()
+		teamMsg = &msg
+	}
+	raceOver := room.allDone()
+	name := player.Name
+	room.mu.Unlock()
+
+	if reason != "" {
+		log.Printf("Player %s forfeited in room %s (%s)", name, room.ID, reason)
+	} else {
+		log.Printf("Player %s forfeited in room %s", name, room.ID)
+	}
+
+	forfeit := map[string]interface{}{
+		"playerId":   id,
+		"playerName": name,
+	}
+	if reason != "" {
+		forfeit["reason"] = reason
+	}
+	h.broadcastToRoom(room, Message{
+		Type:    MsgTypePlayerForfeit,
+		Payload: mustMarshal(forfeit),
+	}, nil)
+	if teamMsg != nil {
+		h.broadcastToRoom(room, *teamMsg, nil)
+	}
+
+	if raceOver {
+		h.endRace(room, RaceEndAllFinished)
+	}
+}
@@ -0,0 +1,116 @@
+package hub
+
+import (
+	"math"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/rating"
+)
+
+// ratingKey identifies a player in the rating store: registered players
+// by account, guests by their guest cookie, and cookieless guests by name
+func ratingKey(accountID, guestID, name string) string {
+	switch {
+	case accountID != "":
+		return "account:" + accountID
+	case guestID != "":
+		return "guest:" + guestID
+	default:
+		return name
+	}
+}
+
+func (p *Player) ratingKey() string {
+	return ratingKey(p.AccountID, p.guestID, p.Name)
+}
+
+func (c *Client) ratingKey(name string) string {
+	return ratingKey(c.accountID, c.guestID, c.displayName(name))
+}
+
+// currentRating looks up the stored rating for a rating key
+func (h *Hub) currentRating(key string) int {
+	return int(math.Round(h.ratings.Get(key).Rating))
+}
+
+// AccountRating returns a registered player's rating and confidence
+func (h *Hub) AccountRating(accountID string) rating.Summary {
+	return h.ratings.Get(ratingKey(accountID, "", "")).Summary()
+}
+
+// GuestRating returns a guest's rating and confidence
+func (h *Hub) GuestRating(guestID string) rating.Summary {
+	return h.ratings.Get(ratingKey("", guestID, "")).Summary()
+}
+
+// rankedPlacements turns a ranked race's final standings into rating
+// placements, along with the player ID behind each rating key. Unranked
+// players share last place. Caller must hold room.mu.
+func rankedPlacements(room *Room, standings []Standing) ([]rating.Placement, map[string]string) {
+	last := len(standings) + 1
+	placements := make([]rating.Placement, 0, len(standings))
+	keys := make(map[string]string, len(standings))
+	for _, s := range standings {
+		player, ok := room.Players[s.PlayerID]
+		if !ok {
+			continue
+		}
+		place := s.Rank
+		if place == 0 {
+			place = last
+		}
+		keys[player.ratingKey()] = s.PlayerID
+		placements = append(placements, rating.Placement{Player: player.ratingKey(), Name: player.Name, Place: place})
+	}
+	return placements, keys
+}
+
+// applyRatings updates ratings from a race's placements and returns the
+// changes keyed by player ID. Saving them writes the store, so the caller
+// must not hold room.mu; it's taken afterwards to update the players.
+func (h *Hub) applyRatings(room *Room, placements []rating.Placement, keys map[string]string) map[string]rating.Change {
+	updates := h.ratings.Update(placements)
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	changes := make(map[string]rating.Change, len(updates))
+	for key, change := range updates {
+		id := keys[key]
+		changes[id] = change
+		if player, ok := room.Players[id]; ok {
+			player.Rating = change.New
+			player.Provisional = change.Provisional
+		}
+	}
+	return changes
+}
+
+// seasonCheckInterval is how often the rating service checks whether a
+// season has ended or begun
+const seasonCheckInterval = time.Minute
+
+// watchSeasons rolls ratings over between seasons
+func (h *Hub) watchSeasons() {
+	h.ratings.Rollover(time.Now())
+	ticker := time.NewTicker(seasonCheckInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		h.ratings.Rollover(now)
+	}
+}
+
+// Seasons returns the configured seasons and the one running now, if any
+func (h *Hub) Seasons() ([]rating.Season, *rating.Season) {
+	return h.ratings.Seasons(time.Now())
+}
+
+// Leaderboard returns the top rated players of the running season
+func (h *Hub) Leaderboard(limit int) []rating.Entry {
+	return h.ratings.Leaderboard(limit)
+}
+
+// SeasonLeaderboard returns an ended season's archived leaderboard
+func (h *Hub) SeasonLeaderboard(id string, limit int) (rating.Archive, error) {
+	return h.ratings.SeasonLeaderboard(id, limit)
+}
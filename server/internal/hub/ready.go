@@ -0,0 +1,54 @@
+package hub
+
+import "encoding/json"
+
+type SetReadyPayload struct {
+	Ready bool `json:"ready"`
+}
+
+// handleSetReady toggles a player's ready flag in the lobby
+func (h *Hub) handleSetReady(room *Room, client *Client, payload json.RawMessage) {
+	var p SetReadyPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		client.sendError(CodeBadRequest, "Invalid ready payload")
+		return
+	}
+
+	room.mu.Lock()
+	player, exists := room.Players[client.id]
+	if !exists || room.Started {
+		room.mu.Unlock()
+		return
+	}
+	player.Ready = p.Ready
+	msg := room.readyStateMessage()
+	room.mu.Unlock()
+
+	h.broadcastToRoom(room, msg, nil)
+}
+
+// allReady reports whether every player has toggled ready. Caller must
+// hold room.mu.
+func (r *Room) allReady() bool {
+	for _, p := range r.Players {
+		if !p.Ready {
+			return false
+		}
+	}
+	return len(r.Players) > 0
+}
+
+// readyStateMessage lists each player's ready flag. Caller must hold room.mu.
+func (r *Room) readyStateMessage() Message {
+	ready := make(map[string]bool, len(r.Players))
+	for id, p := range r.Players {
+		ready[id] = p.Ready
+	}
+	return Message{
+		Type: MsgTypeReadyState,
+		Payload: mustMarshal(map[string]interface{}{
+			"players":  ready,
+			"allReady": r.allReady(),
+		}),
+	}
+}
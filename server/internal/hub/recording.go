@@ -0,0 +1,81 @@
+package hub
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+)
+
+// recordingInterval is how often rooms upload the log entries added since
+// their last chunk. A closing room uploads whatever is left.
+const recordingInterval = time.Minute
+
+// watchRecordings uploads every room's new log entries each interval, so
+// a long race is stored as it goes rather than all at the end
+func (h *Hub) watchRecordings() {
+	ticker := time.NewTicker(recordingInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, room := range h.rooms.all() {
+			h.recordChunk(room)
+		}
+	}
+}
+
+// recordChunk uploads the room's entries since its last chunk as gzipped
+// JSON lines, one RoomEvent each. Chunks are keyed
+// rooms/{room}/{first entry time}/{chunk}.jsonl.gz so a reused room ID
+// starts a new recording and a room's chunks list in order.
+func (h *Hub) recordChunk(room *Room) {
+	if h.recorder == nil {
+		return
+	}
+	events, opened, n := room.events.nextChunk()
+	if len(events) == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			log.Printf("Recording chunk for room %s skipped: %v", room.ID, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("Recording chunk for room %s skipped: %v", room.ID, err)
+		return
+	}
+
+	key := fmt.Sprintf("rooms/%s/%s/%05d.jsonl.gz",
+		url.PathEscape(room.ID), opened.UTC().Format("20060102T150405Z"), n)
+	h.recorder.Put(key, buf.Bytes())
+}
+
+// nextChunk returns the entries after the last chunk along with the time
+// of the log's first entry and the new chunk's number, and moves the
+// upload mark past them
+func (l *eventLog) nextChunk() ([]RoomEvent, time.Time, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var events []RoomEvent
+	for _, e := range l.events {
+		if e.Seq > l.uploaded {
+			events = append(events, e)
+		}
+	}
+	if len(events) == 0 {
+		return nil, l.opened, l.chunks
+	}
+	l.uploaded = events[len(events)-1].Seq
+	l.chunks++
+	return events, l.opened, l.chunks
+}
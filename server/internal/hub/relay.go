@@ -0,0 +1,273 @@
+package hub
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+// maxTeamNameLength caps team names chosen by players
+const maxTeamNameLength = 24
+
+// Team is a group of players sharing one relay run. Members race the legs
+// in the order they joined, wrapping around if there are more legs than
+// teammates.
+type Team struct {
+	Name       string   `json:"name"`
+	Members    []string `json:"members"` // player IDs in leg order
+	Leg        int      `json:"leg"`     // index of the leg being run
+	Runner     string   `json:"runner,omitempty"`
+	Clicks     int      `json:"clicks"`
+	Finished   bool     `json:"finished"`
+	FinishTime int64    `json:"finishTime,omitempty"`
+	Forfeited  bool     `json:"forfeited,omitempty"`
+}
+
+// TeamStanding is a team's position in the relay results
+type TeamStanding struct {
+	Team     string `json:"team"`
+	Rank     int    `json:"rank"`
+	Time     int64  `json:"time"`
+	Clicks   int    `json:"clicks"`
+	Score    int64  `json:"score"`
+	Leg      int    `json:"leg"`
+	Legs     int    `json:"legs"`
+	Finished bool   `json:"finished"`
+	DNF      bool   `json:"dnf,omitempty"`
+}
+
+type SetTeamPayload struct {
+	Team string `json:"team"` // empty leaves the current team
+}
+
+// handleSetTeam moves a player between teams in the lobby
+func (h *Hub) handleSetTeam(room *Room, client *Client, payload json.RawMessage) {
+	var p SetTeamPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		client.sendError(CodeBadRequest, "Invalid team payload")
+		return
+	}
+	name := strings.TrimSpace(p.Team)
+	if utf8.RuneCountInString(name) > maxTeamNameLength {
+		client.sendError(CodeInvalidSettings, "Team name is too long")
+		return
+	}
+
+	room.mu.Lock()
+	player, exists := room.Players[client.id]
+	if !exists {
+		room.mu.Unlock()
+		return
+	}
+	if room.Started {
+		room.mu.Unlock()
+		client.sendError(CodeRaceStarted, "Cannot change teams after race has started")
+		return
+	}
+	room.leaveTeam(player)
+	if name != "" {
+		room.joinTeam(player, name)
+	}
+	msg := room.teamUpdateMessage()
+	room.mu.Unlock()
+
+	h.broadcastToRoom(room, msg, nil)
+}
+
+// joinTeam adds the player to the named team, creating it if needed.
+// Caller must hold room.mu.
+func (r *Room) joinTeam(player *Player, name string) {
+	if r.Teams == nil {
+		r.Teams = make(map[string]*Team)
+	}
+	team, exists := r.Teams[name]
+	if !exists {
+		team = &Team{Name: name}
+		r.Teams[name] = team
+	}
+	team.Members = append(team.Members, player.ID)
+	player.Team = name
+}
+
+// leaveTeam removes the player from their team, dropping the team once
+// it's empty. Caller must hold room.mu.
+func (r *Room) leaveTeam(player *Player) {
+	team, exists := r.Teams[player.Team]
+	player.Team = ""
+	if !exists {
+		return
+	}
+	for i, id := range team.Members {
+		if id == player.ID {
+			team.Members = append(team.Members[:i], team.Members[i+1:]...)
+			break
+		}
+	}
+	if len(team.Members) == 0 {
+		delete(r.Teams, team.Name)
+	}
+}
+
+// relayLegs returns each leg's target: the checkpoints in order, then the
+// end article. Caller must hold room.mu.
+func (r *Room) relayLegs() []string {
+	legs := make([]string, 0, len(r.Config.Checkpoints)+1)
+	legs = append(legs, r.Config.Checkpoints...)
+	return append(legs, r.EndArticle)
+}
+
+// legStart returns the article a leg begins on, which is the previous
+// leg's target. Caller must hold room.mu.
+func (r *Room) legStart(leg int) string {
+	if leg == 0 {
+		return r.StartArticle
+	}
+	return r.relayLegs()[leg-1]
+}
+
+// startRelay hands the first leg to each team's first member and parks
+// everyone else until their turn. Caller must hold room.mu.
+func (r *Room) startRelay() string {
+	for _, p := range r.Players {
+		if r.Teams[p.Team] == nil {
+			return "Every player must join a team for a relay race"
+		}
+	}
+	for _, team := range r.Teams {
+		team.Leg = 0
+		team.Clicks = 0
+		team.Runner = team.Members[0]
+	}
+	for _, p := range r.Players {
+		if r.Teams[p.Team].Runner != p.ID {
+			p.CurrentArticle = ""
+			p.Path = nil
+		}
+	}
+	return ""
+}
+
+// isRunner reports whether the player is running their team's current
+// leg. Caller must hold room.mu.
+func (r *Room) isRunner(player *Player) bool {
+	team, exists := r.Teams[player.Team]
+	return exists && !team.Finished && !team.Forfeited && team.Runner == player.ID
+}
+
+// advanceRelay records a runner's navigation against their team. When the
+// leg target is reached the next teammate takes over from it, and after
+// the last leg every member is marked finished. Caller must hold room.mu.
+func (r *Room) advanceRelay(player *Player, article string) {
+	team := r.Teams[player.Team]
+	team.Clicks++
+
+	legs := r.relayLegs()
+	if !wiki.SameArticleIn(r.Language, article, legs[team.Leg]) {
+		return
+	}
+	team.Leg++
+	if team.Leg == len(legs) {
+		team.Finished = true
+		team.FinishTime = r.elapsed()
+		team.Runner = ""
+		for _, id := range team.Members {
+			if member, ok := r.Players[id]; ok {
+				member.Finished = true
+				member.FinishTime = team.FinishTime
+			}
+		}
+		return
+	}
+
+	team.Runner = team.Members[team.Leg%len(team.Members)]
+	r.touch(team.Runner)
+	if next, ok := r.Players[team.Runner]; ok {
+		next.CurrentArticle = legs[team.Leg-1]
+		next.Path = append(next.Path, next.CurrentArticle)
+	}
+}
+
+// forfeitTeam drops the player's whole team from a relay race. Caller
+// must hold room.mu.
+func (r *Room) forfeitTeam(player *Player) {
+	team, exists := r.Teams[player.Team]
+	if !exists {
+		return
+	}
+	team.Forfeited = true
+	team.Runner = ""
+	for _, id := range team.Members {
+		if member, ok := r.Players[id]; ok && !member.Finished {
+			member.Forfeited = true
+		}
+	}
+}
+
+// teamStandings ranks finished teams by the room's mode, followed by
+// teams still racing. Caller must hold room.mu.
+func (r *Room) teamStandings() []TeamStanding {
+	teams := make([]*Team, 0, len(r.Teams))
+	for _, t := range r.Teams {
+		teams = append(teams, t)
+	}
+	sort.Slice(teams, func(i, j int) bool {
+		a, b := teams[i], teams[j]
+		if a.Finished != b.Finished {
+			return a.Finished
+		}
+		if a.Finished {
+			sa, sb := r.Mode.scoreOf(a.FinishTime, a.Clicks), r.Mode.scoreOf(b.FinishTime, b.Clicks)
+			if sa != sb {
+				return sa < sb
+			}
+			if a.FinishTime != b.FinishTime {
+				return a.FinishTime < b.FinishTime
+			}
+		} else if a.Leg != b.Leg {
+			return a.Leg > b.Leg
+		}
+		return a.Name < b.Name
+	})
+
+	legs := len(r.Config.Checkpoints) + 1
+	result := make([]TeamStanding, 0, len(teams))
+	for i, t := range teams {
+		s := TeamStanding{
+			Team:     t.Name,
+			Clicks:   t.Clicks,
+			Leg:      t.Leg,
+			Legs:     legs,
+			Finished: t.Finished,
+			DNF:      t.Forfeited,
+		}
+		if t.Finished {
+			s.Rank = i + 1
+			s.Time = t.FinishTime
+			s.Score = r.Mode.scoreOf(t.FinishTime, t.Clicks)
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+// teamUpdateMessage reports every team's roster and relay progress.
+// Caller must hold room.mu.
+func (r *Room) teamUpdateMessage() Message {
+	teams := make([]*Team, 0, len(r.Teams))
+	for _, t := range r.Teams {
+		teams = append(teams, t)
+	}
+	sort.Slice(teams, func(i, j int) bool {
+		return teams[i].Name < teams[j].Name
+	})
+	return Message{
+		Type: MsgTypeTeamUpdate,
+		Payload: mustMarshal(map[string]interface{}{
+			"teams":     teams,
+			"standings": r.teamStandings(),
+		}),
+	}
+}
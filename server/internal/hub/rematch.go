@@ -0,0 +1,206 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/graph"
+)
+
+type RematchPayload struct {
+	// Random picks a fresh article pair; otherwise StartArticle and
+	// EndArticle replace the current pair when set
+	Random       bool   `json:"random,omitempty"`
+	StartArticle string `json:"startArticle,omitempty"`
+	EndArticle   string `json:"endArticle,omitempty"`
+	// Difficulty asks for a random pair in a tier when the link graph is
+	// loaded. It implies Random.
+	Difficulty string `json:"difficulty,omitempty"`
+	// Theme switches the room to new categories and picks a pair from
+	// them. A plain random rematch in a themed room stays on its theme.
+	Theme *Theme `json:"theme,omitempty"`
+}
+
+// prepareRematch checks a rematch can happen and looks up any new
+// articles, returning the reset to run on the room
+func (h *Hub) prepareRematch(room *Room, client *Client, payload json.RawMessage) func() {
+	var p RematchPayload
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &p); err != nil {
+			client.sendError(CodeBadRequest, "Invalid rematch payload")
+			return nil
+		}
+	}
+
+	if !isHost(room, client) {
+		client.sendError(CodeNotHost, "Only host can start a rematch")
+		return nil
+	}
+
+	room.mu.RLock()
+	ended := room.Ended
+	checkpoints := room.Config.Checkpoints
+	currentStart, currentEnd := room.StartArticle, room.EndArticle
+	theme := room.Theme
+	philosophy := room.Config.Philosophy
+	room.mu.RUnlock()
+	if !ended {
+		client.sendError(CodeRaceInProgress, "Race hasn't ended yet")
+		return nil
+	}
+
+	// New articles get the same checks as a fresh room, outside the lock
+	start, end := p.StartArticle, p.EndArticle
+	if p.Theme != nil {
+		var err error
+		if theme, err = validTheme(p.Theme); err != nil {
+			client.sendError(codeFor(err), err.Error())
+			return nil
+		}
+	}
+	if p.Theme != nil || (p.Random && p.Difficulty == "" && theme != nil) {
+		var err error
+		start, end, err = h.themedPair(room.Language, *theme)
+		if err != nil {
+			log.Printf("Failed to pick themed rematch articles: %v", err)
+			client.sendError(codeFor(err), themeError(err))
+			return nil
+		}
+	} else if p.Random || p.Difficulty != "" {
+		var tier graph.Tier
+		if p.Difficulty != "" {
+			t, err := graph.ParseTier(p.Difficulty)
+			if err != nil {
+				client.sendError(CodeInvalidSettings, "Difficulty must be easy, medium or hard")
+				return nil
+			}
+			tier = t
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		randomStart, randomEnd, err := h.randomPair(ctx, room.Language, tier)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to pick rematch articles: %v", err)
+			client.sendError(CodeTryAgain, "Couldn't pick new articles, try again")
+			return nil
+		}
+		start, end = randomStart, randomEnd
+	}
+	if philosophy {
+		// Philosophy games keep their target, only the start changes
+		end = ""
+	}
+	changed := start != "" || end != ""
+	if changed {
+		if start == "" {
+			start = currentStart
+		}
+		if end == "" {
+			end = currentEnd
+		}
+		var err error
+		start, end, err = h.validateArticles(room.Language, start, end)
+		if err == nil {
+			checkpoints, err = h.validateCheckpoints(room.Language, checkpoints, start, end)
+		}
+		if err != nil {
+			client.sendError(codeFor(err), err.Error())
+			return nil
+		}
+	}
+
+	return func() { h.rematch(room, changed, start, end, checkpoints, theme) }
+}
+
+// rematch resets the room, switching to the new articles when changed
+func (h *Hub) rematch(room *Room, changed bool, start, end string, checkpoints []string, theme *Theme) {
+	room.mu.Lock()
+	if !room.Ended {
+		room.mu.Unlock()
+		return
+	}
+	if changed {
+		room.StartArticle, room.EndArticle = start, end
+		room.Config.Checkpoints = checkpoints
+		room.Theme = theme
+		// A ghost only knows its own article pair
+		if room.ghost != nil {
+			delete(room.Players, ghostPlayerID(room.ghost))
+			room.ghost = nil
+		}
+	}
+	room.reset()
+	h.promoteApproved(room)
+	msg := Message{
+		Type:    MsgTypeRoomReset,
+		Payload: mustMarshal(room),
+	}
+	start, end = room.StartArticle, room.EndArticle
+	room.mu.Unlock()
+
+	room.cursorMu.Lock()
+	room.pendingCursors = nil
+	room.viewports = nil
+	room.cursorMu.Unlock()
+
+	log.Printf("Room %s reset for a rematch: %s -> %s", room.ID, start, end)
+
+	h.broadcastToRoom(room, msg, nil)
+}
+
+// reset returns a finished room to the lobby: race state and player
+// progress are cleared, and players who left during the race are dropped.
+// Caller must hold room.mu.
+func (r *Room) reset() {
+	r.Started = false
+	r.StartedAt = time.Time{}
+	r.Ended = false
+	r.Paused = false
+	r.pausedAt = time.Time{}
+	r.pausedFor = 0
+	r.optimal = nil
+	r.Hider = ""
+	r.Round, r.NextRotation = 0, 0
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+
+	for id, p := range r.Players {
+		if !p.virtual() && p.client == nil {
+			r.leaveTeam(p)
+			delete(r.Players, id)
+			continue
+		}
+		p.StartArticle, p.EndArticle = "", ""
+		p.CurrentArticle = r.StartArticle
+		p.Clicks = 0
+		p.Path = []string{r.StartArticle}
+		p.Checkpoint = 0
+		p.Finished = false
+		p.FinishTime = 0
+		p.Late = false
+		p.Forfeited = false
+		p.OutOfClicks = false
+		p.Shortfall = 0
+		p.Points = 0
+		p.scoredRound = 0
+		p.Ready = p.virtual()
+		p.steps = nil
+		p.joinedAt = 0
+		p.PowerUps = nil
+		p.cooldowns = nil
+		p.frozenUntil = time.Time{}
+	}
+
+	for _, t := range r.Teams {
+		t.Leg = 0
+		t.Runner = ""
+		t.Clicks = 0
+		t.Finished = false
+		t.FinishTime = 0
+		t.Forfeited = false
+	}
+}
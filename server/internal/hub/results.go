@@ -0,0 +1,134 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	raceCollection = "races"
+	// maxStoredRaces bounds the race history; the oldest records go first
+	maxStoredRaces = 1000
+)
+
+// ErrRaceNotFound is returned for race IDs with no stored record
+var ErrRaceNotFound = errors.New("race not found")
+
+// RaceRecord is the stored outcome of one race, kept so results can be
+// exported after the room is gone
+type RaceRecord struct {
+	ID           string       `json:"id"`
+	RoomID       string       `json:"roomId"`
+	Mode         GameMode     `json:"mode"`
+	Language     string       `json:"language"`
+	StartArticle string       `json:"startArticle"`
+	EndArticle   string       `json:"endArticle"`
+	Checkpoints  []string     `json:"checkpoints,omitempty"`
+	Ranked       bool         `json:"ranked,omitempty"`
+	Reason       string       `json:"reason"` // why the race ended, see RaceEnd*
+	StartedAt    time.Time    `json:"startedAt"`
+	EndedAt      time.Time    `json:"endedAt"`
+	Results      []RaceResult `json:"results"`
+}
+
+// RaceResult is one player's line in a RaceRecord, in standings order
+type RaceResult struct {
+	Rank       int      `json:"rank,omitempty"` // 0 for players who didn't finish
+	PlayerID   string   `json:"playerId"`
+	PlayerName string   `json:"playerName"`
+	AccountID  string   `json:"accountId,omitempty"`
+	Finished   bool     `json:"finished"`
+	DNF        bool     `json:"dnf,omitempty"`
+	Time       int64    `json:"time,omitempty"` // ms
+	Clicks     int      `json:"clicks"`
+	Score      int64    `json:"score"`
+	Path       []string `json:"path"`
+}
+
+// raceRecord builds the record of a race that just ended. Caller must
+// hold room.mu.
+func (r *Room) raceRecord(reason string, standings []Standing) RaceRecord {
+	record := RaceRecord{
+		ID:           uuid.New().String(),
+		RoomID:       r.ID,
+		Mode:         r.Mode,
+		Language:     r.Language,
+		StartArticle: r.StartArticle,
+		EndArticle:   r.EndArticle,
+		Checkpoints:  r.Config.Checkpoints,
+		Ranked:       r.Ranked,
+		Reason:       reason,
+		StartedAt:    r.StartedAt,
+		EndedAt:      time.Now(),
+		Results:      make([]RaceResult, 0, len(standings)),
+	}
+	for _, s := range standings {
+		res := RaceResult{
+			Rank:       s.Rank,
+			PlayerID:   s.PlayerID,
+			PlayerName: s.PlayerName,
+			Finished:   s.Finished,
+			DNF:        s.DNF,
+			Time:       s.Time,
+			Clicks:     s.Clicks,
+			Score:      s.Score,
+		}
+		if p, ok := r.Players[s.PlayerID]; ok {
+			res.AccountID = p.AccountID
+			res.Path = append([]string{}, p.Path...)
+		}
+		record.Results = append(record.Results, res)
+	}
+	return record
+}
+
+// saveRace stores a race record, dropping the oldest once there are more
+// than maxStoredRaces
+func (h *Hub) saveRace(record RaceRecord) {
+	if err := h.store.Put(raceCollection, record.ID, record); err != nil {
+		log.Printf("Failed to save race %s: %v", record.ID, err)
+		return
+	}
+
+	type stored struct {
+		id      string
+		endedAt time.Time
+	}
+	var races []stored
+	h.store.Each(raceCollection, func(key string, raw json.RawMessage) error {
+		var r struct {
+			EndedAt time.Time `json:"endedAt"`
+		}
+		if err := json.Unmarshal(raw, &r); err == nil {
+			races = append(races, stored{id: key, endedAt: r.EndedAt})
+		}
+		return nil
+	})
+	if len(races) <= maxStoredRaces {
+		return
+	}
+	sort.Slice(races, func(i, j int) bool { return races[i].endedAt.Before(races[j].endedAt) })
+	for _, r := range races[:len(races)-maxStoredRaces] {
+		if err := h.store.Delete(raceCollection, r.id); err != nil {
+			log.Printf("Failed to prune race %s: %v", r.id, err)
+		}
+	}
+}
+
+// Race loads a stored race record by ID
+func (h *Hub) Race(id string) (RaceRecord, error) {
+	var record RaceRecord
+	found, err := h.store.Get(raceCollection, id, &record)
+	if err != nil {
+		return RaceRecord{}, err
+	}
+	if !found {
+		return RaceRecord{}, ErrRaceNotFound
+	}
+	return record, nil
+}
@@ -0,0 +1,52 @@
+package hub
+
+// recentEventIDs is how many applied navigate event IDs a player keeps.
+// Clients retry within seconds of a hiccup, so a few clicks back is
+// plenty.
+const recentEventIDs = 32
+
+// applied reports whether the player's click with this event ID already
+// counted. Clicks without an ID are never treated as retries.
+func (p *Player) applied(eventID string) bool {
+	if eventID == "" {
+		return false
+	}
+	for _, id := range p.eventIDs {
+		if id == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+// recordEvent remembers an applied click's event ID
+func (p *Player) recordEvent(eventID string) {
+	if eventID == "" {
+		return
+	}
+	if len(p.eventIDs) == recentEventIDs {
+		p.eventIDs = append(p.eventIDs[:0], p.eventIDs[1:]...)
+	}
+	p.eventIDs = append(p.eventIDs, eventID)
+}
+
+// progressMessage is the player_update for a player's current position,
+// including where they ended up once out of clicks. Caller must hold
+// room.mu.
+func (r *Room) progressMessage(p *Player) Message {
+	update := map[string]interface{}{
+		"playerId":       p.ID,
+		"currentArticle": p.CurrentArticle,
+		"clicks":         p.Clicks,
+		"checkpoint":     p.Checkpoint,
+		"checkpoints":    len(r.Config.Checkpoints),
+	}
+	if p.OutOfClicks {
+		update["outOfClicks"] = true
+		update["shortfall"] = p.Shortfall
+	}
+	return Message{
+		Type:    MsgTypePlayerUpdate,
+		Payload: mustMarshal(update),
+	}
+}
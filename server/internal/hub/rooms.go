@@ -0,0 +1,279 @@
+package hub
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Errors returned by the room management API
+var (
+	ErrRoomExists   = errors.New("room already exists")
+	ErrRoomNotFound = errors.New("room not found")
+	ErrInvalidMode  = errors.New("invalid game mode")
+	ErrRoomLimit    = errors.New("room limit reached")
+
+	ErrInvalidLanguage = errors.New("unsupported Wikipedia language")
+)
+
+// defaultMaxPlayers caps room size when no limit is configured
+const defaultMaxPlayers = 8
+
+// RoomOptions describes a room created outside of a WebSocket join
+type RoomOptions struct {
+	ID           string     `json:"roomId,omitempty"`
+	StartArticle string     `json:"startArticle"`
+	EndArticle   string     `json:"endArticle"`
+	Mode         string     `json:"mode,omitempty"`
+	Language     string     `json:"language,omitempty"` // Wikipedia edition, English if empty
+	Config       RoomConfig `json:"config"`
+	Theme        *Theme     `json:"theme,omitempty"` // replaces the articles with a themed pair
+	Private      bool       `json:"private,omitempty"`
+	Password     string     `json:"password,omitempty"`
+}
+
+// RoomSnapshot is a point-in-time copy of a room that is safe to read
+// without holding any locks
+type RoomSnapshot struct {
+	ID           string     `json:"id"`
+	HostID       string     `json:"hostId"`
+	StartArticle string     `json:"startArticle"`
+	EndArticle   string     `json:"endArticle"`
+	Mode         GameMode   `json:"mode"`
+	Language     string     `json:"language"`
+	Config       RoomConfig `json:"config"`
+	Theme        *Theme     `json:"theme,omitempty"`
+	Private      bool       `json:"private"`
+	Locked       bool       `json:"locked"`
+	Started      bool       `json:"started"`
+	PlayerCount  int        `json:"playerCount"`
+	Players      []Player   `json:"players"`
+	Seed         string     `json:"seed"` // code that recreates this race, see Seed
+}
+
+// newRoom builds an empty room. hostID may be empty, in which case the
+// first player to join becomes the host.
+func newRoom(id, hostID string, opts RoomOptions) (*Room, error) {
+	mode, ok := parseMode(opts.Mode)
+	if !ok {
+		return nil, ErrInvalidMode
+	}
+	lang, ok := parseLanguage(opts.Language)
+	if !ok {
+		return nil, ErrInvalidLanguage
+	}
+	hash, err := hashPassword(opts.Password)
+	if err != nil {
+		return nil, err
+	}
+	room := &Room{
+		ID:           id,
+		Players:      make(map[string]*Player),
+		HostID:       hostID,
+		StartArticle: opts.StartArticle,
+		EndArticle:   opts.EndArticle,
+		Mode:         mode,
+		Language:     lang,
+		Config:       opts.Config,
+		Theme:        opts.Theme,
+		Private:      opts.Private,
+		Locked:       hash != nil,
+		Started:      false,
+		broadcasts:   make(chan roomBroadcast, roomBroadcastBuffer),
+		mailbox:      make(chan func(), roomMailboxSize),
+		done:         make(chan struct{}),
+		passwordHash: hash,
+	}
+	go room.runBroadcasts()
+	go room.runMailbox()
+	return room, nil
+}
+
+// newPlayer creates a player positioned on the start article. Signed-in
+// clients always play under their account name.
+func newPlayer(client *Client, name, startArticle string) *Player {
+	return &Player{
+		ID:             client.id,
+		Name:           client.displayName(name),
+		AccountID:      client.accountID,
+		guestID:        client.guestID,
+		CurrentArticle: startArticle,
+		Clicks:         0,
+		Path:           []string{startArticle},
+		Finished:       false,
+		Latency:        client.latency(),
+		client:         client,
+	}
+}
+
+// matches reports whether a reconnecting client is this player: accounts
+// match by ID, guests by their signed guest ID, falling back to name for
+// clients without cookies
+func (p *Player) matches(client *Client, name string) bool {
+	if p.virtual() {
+		return false
+	}
+	if client.accountID != "" {
+		return p.AccountID == client.accountID
+	}
+	if p.AccountID != "" {
+		return false
+	}
+	if client.guestID != "" && p.guestID != "" {
+		return p.guestID == client.guestID
+	}
+	return p.Name == name
+}
+
+// newRoomCode generates a short shareable room code
+func newRoomCode() string {
+	return strings.ToUpper(strings.ReplaceAll(uuid.New().String(), "-", "")[:6])
+}
+
+// snapshot copies the room's state. Caller must hold room.mu.
+func (r *Room) snapshot() RoomSnapshot {
+	players := make([]Player, 0, len(r.Players))
+	for _, p := range r.Players {
+		cp := *p
+		cp.Path = append([]string(nil), p.Path...)
+		cp.client = nil
+		players = append(players, cp)
+	}
+	return RoomSnapshot{
+		ID:           r.ID,
+		HostID:       r.HostID,
+		StartArticle: r.StartArticle,
+		EndArticle:   r.EndArticle,
+		Mode:         r.Mode,
+		Language:     r.Language,
+		Config:       r.Config,
+		Theme:        r.Theme,
+		Private:      r.Private,
+		Locked:       r.Locked,
+		Started:      r.Started,
+		PlayerCount:  len(r.Players),
+		Players:      players,
+		Seed:         r.seed().Code(),
+	}
+}
+
+// CreateRoom creates an empty room that players can join by ID
+func (h *Hub) CreateRoom(opts RoomOptions) (RoomSnapshot, error) {
+	if _, ok := parseLanguage(opts.Language); !ok {
+		return RoomSnapshot{}, ErrInvalidLanguage
+	}
+	var err error
+	opts.Theme, opts.StartArticle, opts.EndArticle, err = h.applyTheme(opts.Language, opts.Theme, opts.StartArticle, opts.EndArticle)
+	if err != nil {
+		return RoomSnapshot{}, err
+	}
+	if opts.EndArticle, err = h.philosophyTarget(opts.Language, opts.Config, opts.EndArticle); err != nil {
+		return RoomSnapshot{}, err
+	}
+	start, end, err := h.validateArticles(opts.Language, opts.StartArticle, opts.EndArticle)
+	if err != nil {
+		return RoomSnapshot{}, err
+	}
+	opts.StartArticle, opts.EndArticle = start, end
+	opts.Config.Checkpoints, err = h.validateCheckpoints(opts.Language, opts.Config.Checkpoints, start, end)
+	if err != nil {
+		return RoomSnapshot{}, err
+	}
+
+	var room *Room
+	if opts.ID == "" {
+		room, err = h.rooms.addWithCode(h.maxRooms, func(id string) (*Room, error) {
+			return newRoom(id, "", opts)
+		})
+	} else if room, err = newRoom(opts.ID, "", opts); err == nil {
+		if err = h.rooms.add(room, h.maxRooms); err != nil {
+			room.stop()
+		}
+	}
+	if err != nil {
+		return RoomSnapshot{}, err
+	}
+	log.Printf("Room created via API: %s", room.ID)
+
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+
+	return room.snapshot(), nil
+}
+
+// roomLimitReached reports whether another room would exceed MaxRooms.
+// Adding to the directory checks again, this only saves building a room
+// that can't be added.
+func (h *Hub) roomLimitReached() bool {
+	return h.maxRooms > 0 && h.rooms.len() >= h.maxRooms
+}
+
+// Room returns a snapshot of a single room
+func (h *Hub) Room(id string) (RoomSnapshot, error) {
+	room, exists := h.rooms.get(id)
+	if !exists {
+		return RoomSnapshot{}, ErrRoomNotFound
+	}
+
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+	return room.snapshot(), nil
+}
+
+// Rooms returns snapshots of all rooms, including private ones
+func (h *Hub) Rooms() []RoomSnapshot {
+	return h.snapshotRooms(true)
+}
+
+// PublicRooms returns snapshots of rooms listed in the room browser
+func (h *Hub) PublicRooms() []RoomSnapshot {
+	return h.snapshotRooms(false)
+}
+
+func (h *Hub) snapshotRooms(includePrivate bool) []RoomSnapshot {
+	rooms := h.rooms.all()
+	snapshots := make([]RoomSnapshot, 0, len(rooms))
+	for _, room := range rooms {
+		room.mu.RLock()
+		if includePrivate || !room.Private {
+			snapshots = append(snapshots, room.snapshot())
+		}
+		room.mu.RUnlock()
+	}
+	return snapshots
+}
+
+// CloseRoom removes a room and notifies everyone still connected to it
+func (h *Hub) CloseRoom(id string) error {
+	room, exists := h.rooms.get(id)
+	if !exists {
+		return ErrRoomNotFound
+	}
+
+	room.mu.Lock()
+	if room.closed {
+		room.mu.Unlock()
+		return ErrRoomNotFound
+	}
+	room.closed = true
+	for _, player := range room.Players {
+		if player.client != nil {
+			player.client.leftRoom(room)
+		}
+	}
+	room.releaseSpectators()
+	room.mu.Unlock()
+
+	h.broadcastToRoom(room, Message{
+		Type: MsgTypeRoomClosed,
+		Payload: mustMarshal(map[string]string{
+			"roomId": id,
+		}),
+	}, nil)
+
+	h.deleteRoom(room)
+	log.Printf("Room closed via API: %s", id)
+	return nil
+}
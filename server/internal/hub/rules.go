@@ -0,0 +1,88 @@
+package hub
+
+import (
+	"strings"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+// RoomConfig holds the optional rules chosen by the host
+type RoomConfig struct {
+	NoBackButton     bool     `json:"noBackButton,omitempty"`     // reject revisiting articles already in the path
+	BannedArticles   []string `json:"bannedArticles,omitempty"`   // exact titles players may not visit
+	BannedCategories []string `json:"bannedCategories,omitempty"` // category terms, e.g. "Countries" or "births"
+	TimeLimitSeconds int      `json:"timeLimitSeconds,omitempty"` // race ends with DNFs after this long
+	Checkpoints      []string `json:"checkpoints,omitempty"`      // ordered targets to visit before the end article
+	Relay            bool     `json:"relay,omitempty"`            // teams split the checkpoints into legs run in turn
+	CrossLanguage    bool     `json:"crossLanguage,omitempty"`    // each player races the equivalent articles on their own edition
+	Arcade           bool     `json:"arcade,omitempty"`           // clicks earn power-ups to use on opponents
+	LateJoin         bool     `json:"lateJoin,omitempty"`         // players may join once the race has started
+	LatePenalty      int      `json:"latePenalty,omitempty"`      // seconds added to a late joiner's finish time
+	Philosophy       bool     `json:"philosophy,omitempty"`       // only each article's first link counts, and the target is Philosophy
+	ClickBudget      int      `json:"clickBudget,omitempty"`      // clicks each racer gets; running out ranks them by distance left
+	HideAndSeek      bool     `json:"hideAndSeek,omitempty"`      // one player hides, the rest race to land on their article
+	HillMinutes      int      `json:"hillMinutes,omitempty"`      // king of the hill: the target rotates this often and each one reached scores
+}
+
+// Rule identifiers reported in rule_violation messages
+const (
+	RuleNoBackButton   = "no_back_button"
+	RuleBannedArticle  = "banned_article"
+	RuleBannedCategory = "banned_category"
+	RuleInvalidLink    = "invalid_link"
+	RuleFirstLink      = "first_link"
+	RuleClickBudget    = "click_budget"
+)
+
+// RuleViolation describes a navigation rejected by a room rule
+type RuleViolation struct {
+	Rule    string `json:"rule"`
+	Article string `json:"article"`
+	Message string `json:"message"`
+}
+
+// checkNavigate applies the room's rules to a player's next article and
+// returns the violation, if any. categories are the article's Wikipedia
+// categories, only needed when the room bans categories. Caller must hold
+// room.mu.
+func (r *Room) checkNavigate(player *Player, article string, categories []string) *RuleViolation {
+	if r.Config.NoBackButton {
+		for _, visited := range player.Path {
+			if wiki.SameArticleIn(r.playerLanguage(player), visited, article) {
+				return &RuleViolation{
+					Rule:    RuleNoBackButton,
+					Article: article,
+					Message: "You have already visited this article",
+				}
+			}
+		}
+	}
+
+	normalized := wiki.NormalizeTitleIn(r.Language, article)
+	for _, banned := range r.Config.BannedArticles {
+		if strings.EqualFold(wiki.NormalizeTitleIn(r.Language, banned), normalized) {
+			return &RuleViolation{
+				Rule:    RuleBannedArticle,
+				Article: article,
+				Message: "This article is banned in this room",
+			}
+		}
+	}
+
+	for _, banned := range r.Config.BannedCategories {
+		term := strings.ToLower(strings.TrimSpace(banned))
+		if term == "" {
+			continue
+		}
+		for _, category := range categories {
+			if strings.Contains(strings.ToLower(category), term) {
+				return &RuleViolation{
+					Rule:    RuleBannedCategory,
+					Article: article,
+					Message: "Articles in category \"" + category + "\" are banned in this room",
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,383 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// scheduleCollection is the store collection holding scheduled races
+	scheduleCollection = "scheduled_races"
+	// scheduleInterval is how often scheduled races are checked
+	scheduleInterval = time.Second
+
+	defaultOpenBefore = 10 * time.Minute
+	maxOpenBefore     = 2 * time.Hour
+	maxScheduleAhead  = 90 * 24 * time.Hour
+	defaultMinPlayers = 2
+	maxTitleLength    = 100
+	// scheduleRetention keeps started and cancelled races listed this
+	// long after their start time
+	scheduleRetention = 24 * time.Hour
+)
+
+// Errors returned by the scheduled race API
+var (
+	ErrScheduleNotFound = errors.New("scheduled race not found")
+	ErrInvalidSchedule  = errors.New("invalid scheduled race")
+	ErrScheduleClosed   = errors.New("that race has already started or been cancelled")
+)
+
+// ScheduleStatus is where a scheduled race is in its life
+type ScheduleStatus string
+
+const (
+	ScheduleWaiting   ScheduleStatus = "scheduled" // room not open yet
+	ScheduleOpen      ScheduleStatus = "open"      // room open for joining
+	ScheduleStarted   ScheduleStatus = "started"
+	ScheduleCancelled ScheduleStatus = "cancelled"
+)
+
+// ScheduleOptions describes a race to run at a set time
+type ScheduleOptions struct {
+	Title    string    `json:"title"`
+	StartsAt time.Time `json:"startsAt"`
+	// OpenMinutes is how long before the start the room opens, 10 if 0
+	OpenMinutes int `json:"openMinutes,omitempty"`
+	// MinPlayers cancels the race if fewer are in the room at the start,
+	// 2 if 0
+	MinPlayers int         `json:"minPlayers,omitempty"`
+	Room       RoomOptions `json:"room"`
+}
+
+// ScheduledRace is a race that opens its room ahead of time and starts
+// itself. Players register to be reminded when the room opens.
+type ScheduledRace struct {
+	ScheduleOptions
+	ID         string         `json:"id"`
+	Status     ScheduleStatus `json:"status"`
+	RoomID     string         `json:"roomId,omitempty"` // set once the room opens
+	Registered []string       `json:"registered"`       // account IDs
+	Reason     string         `json:"reason,omitempty"` // why it was cancelled
+	// EventID is the recurring event this is an occurrence of, see events.go
+	EventID string `json:"eventId,omitempty"`
+}
+
+// opensAt is when the race's room opens
+func (s *ScheduledRace) opensAt() time.Time {
+	return s.StartsAt.Add(-time.Duration(s.OpenMinutes) * time.Minute)
+}
+
+// ScheduleRace validates and stores a race to run later
+func (h *Hub) ScheduleRace(opts ScheduleOptions) (ScheduledRace, error) {
+	return h.scheduleRace(opts, "")
+}
+
+func (h *Hub) scheduleRace(opts ScheduleOptions, eventID string) (ScheduledRace, error) {
+	switch {
+	case opts.OpenMinutes == 0:
+		opts.OpenMinutes = int(defaultOpenBefore.Minutes())
+	case opts.OpenMinutes < 0 || opts.OpenMinutes > int(maxOpenBefore.Minutes()):
+		return ScheduledRace{}, fmt.Errorf("%w: rooms open between 1 and %d minutes ahead", ErrInvalidSchedule, int(maxOpenBefore.Minutes()))
+	}
+	if opts.MinPlayers == 0 {
+		opts.MinPlayers = defaultMinPlayers
+	}
+	now := time.Now()
+	switch {
+	case opts.Title == "" || len(opts.Title) > maxTitleLength:
+		return ScheduledRace{}, fmt.Errorf("%w: a title of up to %d characters is required", ErrInvalidSchedule, maxTitleLength)
+	case !opts.StartsAt.After(now):
+		return ScheduledRace{}, fmt.Errorf("%w: the start must be in the future", ErrInvalidSchedule)
+	case opts.StartsAt.After(now.Add(maxScheduleAhead)):
+		return ScheduledRace{}, fmt.Errorf("%w: races can be scheduled up to %d days ahead", ErrInvalidSchedule, int(maxScheduleAhead.Hours()/24))
+	case opts.MinPlayers < 1 || opts.MinPlayers > h.maxPlayers:
+		return ScheduledRace{}, fmt.Errorf("%w: the minimum must be between 1 and %d players", ErrInvalidSchedule, h.maxPlayers)
+	case opts.Room.Password != "":
+		// Scheduled races are public events, and their options are listed
+		return ScheduledRace{}, fmt.Errorf("%w: scheduled races can't have a password", ErrInvalidSchedule)
+	}
+	if _, ok := parseMode(opts.Room.Mode); !ok {
+		return ScheduledRace{}, ErrInvalidMode
+	}
+	if _, ok := parseLanguage(opts.Room.Language); !ok {
+		return ScheduledRace{}, ErrInvalidLanguage
+	}
+	if opts.Room.Theme == nil {
+		// Themed races draw their pair when the room opens
+		start, end, err := h.validateArticles(opts.Room.Language, opts.Room.StartArticle, opts.Room.EndArticle)
+		if err != nil {
+			return ScheduledRace{}, err
+		}
+		opts.Room.StartArticle, opts.Room.EndArticle = start, end
+	}
+	opts.Room.ID = ""
+	opts.StartsAt = opts.StartsAt.UTC().Truncate(time.Second)
+
+	race := ScheduledRace{
+		ScheduleOptions: opts,
+		ID:              uuid.New().String(),
+		Status:          ScheduleWaiting,
+		Registered:      []string{},
+		EventID:         eventID,
+	}
+	h.scheduleMu.Lock()
+	defer h.scheduleMu.Unlock()
+	if err := h.store.Put(scheduleCollection, race.ID, race); err != nil {
+		return ScheduledRace{}, err
+	}
+	log.Printf("Race %q scheduled for %s", race.Title, race.StartsAt.Format(time.RFC3339))
+	return race, nil
+}
+
+// ScheduledRaces lists scheduled races by start time, including recently
+// started and cancelled ones
+func (h *Hub) ScheduledRaces() ([]ScheduledRace, error) {
+	races := []ScheduledRace{}
+	err := h.store.Each(scheduleCollection, func(_ string, raw json.RawMessage) error {
+		var race ScheduledRace
+		if err := json.Unmarshal(raw, &race); err != nil {
+			return err
+		}
+		races = append(races, race)
+		return nil
+	})
+	sort.Slice(races, func(i, j int) bool { return races[i].StartsAt.Before(races[j].StartsAt) })
+	return races, err
+}
+
+// ScheduledRace returns one scheduled race
+func (h *Hub) ScheduledRace(id string) (ScheduledRace, error) {
+	var race ScheduledRace
+	found, err := h.store.Get(scheduleCollection, id, &race)
+	if err != nil {
+		return ScheduledRace{}, err
+	}
+	if !found {
+		return ScheduledRace{}, ErrScheduleNotFound
+	}
+	return race, nil
+}
+
+// updateSchedule applies fn to a stored race and saves it, unless fn
+// fails
+func (h *Hub) updateSchedule(id string, fn func(*ScheduledRace) error) (ScheduledRace, error) {
+	h.scheduleMu.Lock()
+	defer h.scheduleMu.Unlock()
+	race, err := h.ScheduledRace(id)
+	if err != nil {
+		return ScheduledRace{}, err
+	}
+	if err := fn(&race); err != nil {
+		return ScheduledRace{}, err
+	}
+	return race, h.store.Put(scheduleCollection, id, race)
+}
+
+// RegisterForRace signs an account up for a race's reminders, or takes it
+// off with register false
+func (h *Hub) RegisterForRace(id, accountID string, register bool) (ScheduledRace, error) {
+	return h.updateSchedule(id, func(race *ScheduledRace) error {
+		if race.Status == ScheduleStarted || race.Status == ScheduleCancelled {
+			return ErrScheduleClosed
+		}
+		kept := race.Registered[:0]
+		for _, a := range race.Registered {
+			if a != accountID {
+				kept = append(kept, a)
+			}
+		}
+		race.Registered = kept
+		if register {
+			race.Registered = append(race.Registered, accountID)
+		}
+		return nil
+	})
+}
+
+// CancelScheduledRace calls off a race that hasn't started, closing its
+// room if it's open
+func (h *Hub) CancelScheduledRace(id string) error {
+	_, err := h.cancelSchedule(id, "Cancelled by the organizer")
+	return err
+}
+
+// cancelSchedule marks a race cancelled and closes its room
+func (h *Hub) cancelSchedule(id, reason string) (ScheduledRace, error) {
+	race, err := h.updateSchedule(id, func(race *ScheduledRace) error {
+		if race.Status == ScheduleStarted || race.Status == ScheduleCancelled {
+			return ErrScheduleClosed
+		}
+		race.Status, race.Reason = ScheduleCancelled, reason
+		return nil
+	})
+	if err != nil {
+		return race, err
+	}
+	log.Printf("Scheduled race %q cancelled: %s", race.Title, reason)
+	if room, ok := h.rooms.get(race.RoomID); race.RoomID != "" && ok {
+		h.broadcastToRoom(room, Message{
+			Type:    MsgTypeRaceCancelled,
+			Payload: mustMarshal(map[string]string{"scheduleId": race.ID, "reason": reason}),
+		}, nil)
+		h.CloseRoom(race.RoomID)
+	}
+	return race, nil
+}
+
+// watchSchedule opens rooms for scheduled races, starts them on time, and
+// drops old entries
+func (h *Hub) watchSchedule() {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		races, err := h.ScheduledRaces()
+		if err != nil {
+			log.Printf("Failed to load scheduled races: %v", err)
+			continue
+		}
+		for _, race := range races {
+			h.advanceSchedule(race, now)
+		}
+	}
+}
+
+// advanceSchedule moves a race on to its next step if it's due
+func (h *Hub) advanceSchedule(race ScheduledRace, now time.Time) {
+	_, roomOpen := h.rooms.get(race.RoomID)
+	switch {
+	case race.Status == ScheduleStarted || race.Status == ScheduleCancelled:
+		if now.Sub(race.StartsAt) > scheduleRetention {
+			h.scheduleMu.Lock()
+			h.store.Delete(scheduleCollection, race.ID)
+			h.scheduleMu.Unlock()
+		}
+	case !now.Before(race.StartsAt):
+		h.startScheduled(race)
+	case race.Status == ScheduleWaiting && !now.Before(race.opensAt()),
+		// An open race's room is gone after a restart, or when everyone
+		// who joined early left
+		race.Status == ScheduleOpen && !roomOpen:
+		h.openScheduled(race)
+	}
+}
+
+// openScheduled creates a race's room and reminds its registered players
+func (h *Hub) openScheduled(race ScheduledRace) {
+	snapshot, err := h.CreateRoom(race.Room)
+	if err != nil {
+		h.cancelSchedule(race.ID, "The race couldn't be set up: "+err.Error())
+		return
+	}
+	room, _ := h.rooms.get(snapshot.ID)
+	room.mu.Lock()
+	room.ScheduledFor = race.StartsAt
+	room.Event, room.eventID = race.Title, race.EventID
+	room.mu.Unlock()
+
+	reopened := race.Status == ScheduleOpen
+	race, err = h.updateSchedule(race.ID, func(r *ScheduledRace) error {
+		if r.Status != ScheduleWaiting && r.Status != ScheduleOpen {
+			return ErrScheduleClosed
+		}
+		r.Status, r.RoomID = ScheduleOpen, snapshot.ID
+		return nil
+	})
+	if err != nil {
+		// Cancelled while the room was being set up
+		h.CloseRoom(snapshot.ID)
+		return
+	}
+	log.Printf("Scheduled race %q opened in room %s", race.Title, race.RoomID)
+	if reopened {
+		return
+	}
+
+	reminder := Message{
+		Type: MsgTypeRaceReminder,
+		Payload: mustMarshal(map[string]interface{}{
+			"scheduleId": race.ID,
+			"title":      race.Title,
+			"roomId":     race.RoomID,
+			"startsAt":   race.StartsAt,
+		}),
+	}
+	for _, account := range race.Registered {
+		h.sendToAccount(account, reminder)
+	}
+	h.NotifyStarting(race.Registered, race.RoomID, race.Title, race.StartsAt)
+}
+
+// startScheduled starts a race at its time, or cancels it if too few
+// players turned up
+func (h *Hub) startScheduled(race ScheduledRace) {
+	room, ok := h.rooms.get(race.RoomID)
+	if !ok || race.RoomID == "" {
+		h.cancelSchedule(race.ID, "Not enough players joined")
+		return
+	}
+	room.mu.RLock()
+	players := 0
+	for _, p := range room.Players {
+		if !p.virtual() {
+			players++
+		}
+	}
+	crossLanguage, reason := room.Config.CrossLanguage, room.startCheck()
+	room.mu.RUnlock()
+	if players < race.MinPlayers {
+		h.cancelSchedule(race.ID, fmt.Sprintf("Not enough players joined, %d needed", race.MinPlayers))
+		return
+	}
+	if reason != "" {
+		h.cancelSchedule(race.ID, reason)
+		return
+	}
+
+	// Claim the start so the next tick leaves it alone
+	if _, err := h.updateSchedule(race.ID, func(r *ScheduledRace) error {
+		if r.Status != ScheduleOpen {
+			return ErrScheduleClosed
+		}
+		r.Status = ScheduleStarted
+		return nil
+	}); err != nil {
+		return
+	}
+	var pairs map[string]localizedPair
+	if crossLanguage {
+		var err error
+		if pairs, err = h.localizeRace(room); err != nil {
+			h.failScheduled(race, room, err.Error())
+			return
+		}
+	}
+	room.post(func() {
+		if _, reason := h.launchRace(room, pairs, false); reason != "" {
+			h.failScheduled(race, room, reason)
+			return
+		}
+		log.Printf("Scheduled race %q started in room %s", race.Title, room.ID)
+	})
+}
+
+// failScheduled cancels a race that was claimed for starting but couldn't
+// start
+func (h *Hub) failScheduled(race ScheduledRace, room *Room, reason string) {
+	h.updateSchedule(race.ID, func(r *ScheduledRace) error {
+		r.Status, r.Reason = ScheduleCancelled, reason
+		return nil
+	})
+	log.Printf("Scheduled race %q failed to start: %s", race.Title, reason)
+	h.broadcastToRoom(room, Message{
+		Type:    MsgTypeRaceCancelled,
+		Payload: mustMarshal(map[string]string{"scheduleId": race.ID, "reason": reason}),
+	}, nil)
+	h.CloseRoom(room.ID)
+}
@@ -0,0 +1,119 @@
+package hub
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrInvalidSeed is returned for codes that don't decode to a race
+var ErrInvalidSeed = errors.New("invalid seed")
+
+const (
+	// seedVersion prefixes every code so the format can change without
+	// breaking codes already shared
+	seedVersion = "1"
+	// maxSeedLength bounds codes and what they inflate to, so a crafted
+	// code can't make the server decompress megabytes
+	maxSeedLength = 2048
+)
+
+// Seed is a race's articles and rules, shareable as a short code that
+// recreates the same challenge in a new room
+type Seed struct {
+	StartArticle string     `json:"startArticle"`
+	EndArticle   string     `json:"endArticle"`
+	Mode         string     `json:"mode,omitempty"`
+	Language     string     `json:"language,omitempty"`
+	Config       RoomConfig `json:"config"`
+}
+
+// seedWire is a Seed with short keys, to keep codes short
+type seedWire struct {
+	S string          `json:"s"`
+	E string          `json:"e"`
+	M string          `json:"m,omitempty"`
+	L string          `json:"l,omitempty"`
+	C json.RawMessage `json:"c,omitempty"`
+}
+
+// Code encodes the seed as deflated JSON in URL-safe base64
+func (s Seed) Code() string {
+	w := seedWire{S: s.StartArticle, E: s.EndArticle, M: s.Mode, L: s.Language}
+	if config := mustMarshal(s.Config); string(config) != "{}" {
+		w.C = config
+	}
+	var buf bytes.Buffer
+	zw, _ := flate.NewWriter(&buf, flate.BestCompression)
+	zw.Write(mustMarshal(w))
+	zw.Close()
+	return seedVersion + base64.RawURLEncoding.EncodeToString(buf.Bytes())
+}
+
+// DecodeSeed parses a code made by Seed.Code. The articles aren't checked
+// against Wikipedia; joining with the seed validates them like any other
+// new room.
+func DecodeSeed(code string) (Seed, error) {
+	if len(code) > maxSeedLength || !strings.HasPrefix(code, seedVersion) {
+		return Seed{}, ErrInvalidSeed
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(code[len(seedVersion):])
+	if err != nil {
+		return Seed{}, ErrInvalidSeed
+	}
+	var w seedWire
+	zr := flate.NewReader(bytes.NewReader(raw))
+	defer zr.Close()
+	if err := json.NewDecoder(io.LimitReader(zr, 16*maxSeedLength)).Decode(&w); err != nil {
+		return Seed{}, ErrInvalidSeed
+	}
+
+	s := Seed{StartArticle: w.S, EndArticle: w.E, Mode: w.M, Language: w.L}
+	if len(w.C) > 0 {
+		if err := json.Unmarshal(w.C, &s.Config); err != nil {
+			return Seed{}, ErrInvalidSeed
+		}
+	}
+	if err := s.validate(); err != nil {
+		return Seed{}, err
+	}
+	return s, nil
+}
+
+// validate does the checks that don't need Wikipedia
+func (s Seed) validate() error {
+	if strings.TrimSpace(s.StartArticle) == "" || strings.TrimSpace(s.EndArticle) == "" {
+		return ErrInvalidSeed
+	}
+	if _, ok := parseMode(s.Mode); !ok {
+		return ErrInvalidMode
+	}
+	if _, ok := parseLanguage(s.Language); !ok {
+		return ErrInvalidLanguage
+	}
+	return nil
+}
+
+// NewSeed checks a seed built by hand, e.g. by a community challenge
+// page, and returns its code
+func NewSeed(s Seed) (string, error) {
+	if err := s.validate(); err != nil {
+		return "", err
+	}
+	return s.Code(), nil
+}
+
+// seed returns the room's race as a Seed. Caller must hold room.mu.
+func (r *Room) seed() Seed {
+	return Seed{
+		StartArticle: r.StartArticle,
+		EndArticle:   r.EndArticle,
+		Mode:         string(r.Mode),
+		Language:     r.Language,
+		Config:       r.Config,
+	}
+}
@@ -0,0 +1,80 @@
+package hub
+
+// Every broadcast a room sends, apart from cursor and viewport batches,
+// carries the next Seq. A client that sees a gap missed messages, usually
+// because its send queue overflowed, and sends request_sync with the last
+// seq it applied. Snapshots sent to a single client, like the room_state on join
+// or a state_resync, carry the seq of the last broadcast they cover, so
+// the client knows where to continue from.
+
+// roomHistorySize is how many sequenced broadcasts a room keeps to replay
+// to clients that missed some
+const roomHistorySize = 256
+
+// RequestSyncPayload optionally names the last seq the client applied.
+// Messages after it are replayed when the room still has them, otherwise
+// the client gets a full state_resync.
+type RequestSyncPayload struct {
+	Since uint64 `json:"since,omitempty"`
+}
+
+// remember keeps a sequenced broadcast for replays. Only the fan-out
+// goroutine calls it.
+func (r *Room) remember(msg Message) {
+	if r.history == nil {
+		r.history = make([]Message, roomHistorySize)
+	}
+	r.history[msg.Seq%roomHistorySize] = msg
+}
+
+// missedSince returns the broadcasts after since, and false if some of
+// them are no longer kept. Only the fan-out goroutine calls it.
+func (r *Room) missedSince(since uint64) ([]Message, bool) {
+	if since > r.seq || r.seq-since > roomHistorySize {
+		return nil, false
+	}
+	missed := make([]Message, 0, r.seq-since)
+	for seq := since + 1; seq <= r.seq; seq++ {
+		missed = append(missed, r.history[seq%roomHistorySize])
+	}
+	return missed, true
+}
+
+// deliverTo handles a message for a single client. It is skipped if the
+// client left the room while it was queued.
+func (r *Room) deliverTo(b roomBroadcast) {
+	if b.to.currentRoom() != r {
+		return
+	}
+	if b.resync {
+		if missed, ok := r.missedSince(b.since); ok && b.since > 0 {
+			for _, msg := range missed {
+				b.to.sendMessage(msg)
+			}
+			return
+		}
+		r.mu.RLock()
+		b.msg = r.syncMessage()
+		r.mu.RUnlock()
+	}
+	b.msg.Seq = r.seq
+	b.to.sendMessage(b.msg)
+}
+
+// sendInOrder queues a snapshot for one client behind the broadcasts
+// already queued, stamped with the seq of the last one
+func (h *Hub) sendInOrder(room *Room, client *Client, msg Message) {
+	select {
+	case room.broadcasts <- roomBroadcast{msg: msg, to: client}:
+	case <-room.done:
+	}
+}
+
+// queueResync catches a client up on the broadcasts after since, or sends
+// it the full room state when since is 0 or too far back
+func (h *Hub) queueResync(room *Room, client *Client, since uint64) {
+	select {
+	case room.broadcasts <- roomBroadcast{to: client, resync: true, since: since}:
+	case <-room.done:
+	}
+}
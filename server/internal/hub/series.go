@@ -0,0 +1,235 @@
+package hub
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+)
+
+const (
+	defaultSeriesLength = 3
+	maxSeriesLength     = 9
+	defaultWinPoints    = 3
+	defaultClickPoints  = 1
+	maxSeriesPoints     = 10
+	// seriesIntermission is how long the results of one race in a series
+	// stay up before the room resets onto the next pair
+	seriesIntermission = 10 * time.Second
+)
+
+// Series is a best-of-N match: races in the same room, each on a fresh
+// pair, scored until one player can't be caught
+type Series struct {
+	BestOf      int           `json:"bestOf"`
+	WinPoints   int           `json:"winPoints"`   // for winning a race
+	ClickPoints int           `json:"clickPoints"` // for the fewest clicks among finishers, shared on ties
+	Played      int           `json:"played"`
+	Scores      []SeriesScore `json:"scores"`
+	Winner      string        `json:"winner,omitempty"` // player ID, once someone clinches
+	NextRaceAt  time.Time     `json:"nextRaceAt,omitempty"`
+}
+
+// SeriesScore is one player's running total in a series
+type SeriesScore struct {
+	PlayerID   string `json:"playerId"`
+	PlayerName string `json:"playerName"`
+	Points     int    `json:"points"`
+	Wins       int    `json:"wins"`
+}
+
+type StartSeriesPayload struct {
+	BestOf      int `json:"bestOf,omitempty"`      // races in the series, 3 if unset
+	WinPoints   int `json:"winPoints,omitempty"`   // 3 if unset
+	ClickPoints int `json:"clickPoints,omitempty"` // 1 if unset, -1 for none
+}
+
+// seriesCheck rejects room setups a series can't support, returning the
+// reason or "". Those modes either have their own scoring or need
+// articles the series can't rotate. Caller must hold room.mu.
+func (r *Room) seriesCheck() string {
+	if r.Series == nil {
+		return ""
+	}
+	switch {
+	case r.Config.Relay || len(r.Config.Checkpoints) > 0:
+		return "A series can't use checkpoints or relay"
+	case r.Config.hillInterval() > 0 || r.Config.HideAndSeek:
+		return "A series can't be king of the hill or hide and seek"
+	case r.ghost != nil:
+		return "A ghost race keeps its articles"
+	}
+	return ""
+}
+
+// handleStartSeries turns the room into a series. Starting one while
+// another is still undecided replaces it.
+func (h *Hub) handleStartSeries(room *Room, client *Client, payload json.RawMessage) {
+	var p StartSeriesPayload
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &p); err != nil {
+			client.sendError(CodeBadRequest, "Invalid start_series payload")
+			return
+		}
+	}
+	if p.BestOf == 0 {
+		p.BestOf = defaultSeriesLength
+	}
+	if p.WinPoints == 0 {
+		p.WinPoints = defaultWinPoints
+	}
+	switch p.ClickPoints {
+	case 0:
+		p.ClickPoints = defaultClickPoints
+	case -1:
+		p.ClickPoints = 0
+	}
+	switch {
+	case p.BestOf < 2 || p.BestOf > maxSeriesLength:
+		client.sendError(CodeInvalidSettings, "A series is between 2 and 9 races")
+		return
+	case p.WinPoints < 1 || p.WinPoints > maxSeriesPoints || p.ClickPoints < 0 || p.ClickPoints > maxSeriesPoints:
+		client.sendError(CodeInvalidSettings, "Series points must be between 1 and 10")
+		return
+	}
+
+	room.mu.Lock()
+	switch {
+	case room.HostID != client.id:
+		room.mu.Unlock()
+		client.sendError(CodeNotHost, "Only host can start a series")
+		return
+	case room.Started && !room.Ended:
+		room.mu.Unlock()
+		client.sendError(CodeRaceInProgress, "Wait for the race to end")
+		return
+	}
+	previous := room.Series
+	room.Series = &Series{BestOf: p.BestOf, WinPoints: p.WinPoints, ClickPoints: p.ClickPoints}
+	if reason := room.seriesCheck(); reason != "" {
+		room.Series = previous
+		room.mu.Unlock()
+		client.sendError(CodeInvalidSettings, reason)
+		return
+	}
+	msg := room.seriesMessage()
+	room.mu.Unlock()
+
+	log.Printf("Room %s started a best of %d series", room.ID, p.BestOf)
+	h.broadcastToRoom(room, msg, nil)
+}
+
+// scoreSeries adds a finished race to the series and reports whether it
+// counted. Caller must hold room.mu.
+func (r *Room) scoreSeries(standings []Standing) bool {
+	s := r.Series
+	if s == nil || s.Winner != "" {
+		return false
+	}
+	s.Played++
+
+	fewest := -1
+	for _, st := range standings {
+		if st.Finished && (fewest < 0 || st.Clicks < fewest) {
+			fewest = st.Clicks
+		}
+	}
+	for _, st := range standings {
+		score := s.score(st.PlayerID, st.PlayerName)
+		if st.Rank == 1 && st.Finished {
+			score.Points += s.WinPoints
+			score.Wins++
+		}
+		if st.Finished && st.Clicks == fewest {
+			score.Points += s.ClickPoints
+		}
+	}
+	sort.SliceStable(s.Scores, func(i, j int) bool {
+		return s.Scores[i].Points > s.Scores[j].Points
+	})
+	s.clinch()
+	return true
+}
+
+// score returns a player's line, adding one for players new to the series
+func (s *Series) score(id, name string) *SeriesScore {
+	for i := range s.Scores {
+		if s.Scores[i].PlayerID == id {
+			s.Scores[i].PlayerName = name
+			return &s.Scores[i]
+		}
+	}
+	s.Scores = append(s.Scores, SeriesScore{PlayerID: id, PlayerName: name})
+	return &s.Scores[len(s.Scores)-1]
+}
+
+// clinch names the leader the winner once the races left can't close the
+// gap. A tie after the last scheduled race plays on until it's broken.
+func (s *Series) clinch() {
+	if len(s.Scores) == 0 {
+		return
+	}
+	lead := s.Scores[0].Points
+	runnerUp := 0
+	if len(s.Scores) > 1 {
+		runnerUp = s.Scores[1].Points
+	}
+	left := max(s.BestOf-s.Played, 0)
+	if lead > runnerUp+left*(s.WinPoints+s.ClickPoints) {
+		s.Winner = s.Scores[0].PlayerID
+	}
+}
+
+// seriesMessage is the series_state broadcast. Caller must hold room.mu.
+func (r *Room) seriesMessage() Message {
+	return Message{Type: MsgTypeSeriesState, Payload: mustMarshal(r.Series)}
+}
+
+// afterSeriesRace schedules the next race of an undecided series once the
+// intermission is over. Caller must hold room.mu.
+func (h *Hub) afterSeriesRace(room *Room) {
+	s := room.Series
+	if s.Winner != "" {
+		return
+	}
+	s.NextRaceAt = time.Now().Add(seriesIntermission)
+	played := s.Played
+	time.AfterFunc(seriesIntermission, func() { h.nextSeriesRace(room, s, played) })
+}
+
+// nextSeriesRace picks a fresh pair and resets the room onto it. The host
+// may have rematched or started another series in the meantime, which
+// takes over.
+func (h *Hub) nextSeriesRace(room *Room, s *Series, played int) {
+	room.mu.RLock()
+	stale := room.Series != s || s.Played != played || !room.Ended
+	lang, config, theme := room.Language, room.Config, room.Theme
+	room.mu.RUnlock()
+	if stale {
+		return
+	}
+
+	start, end, err := h.candidatePair(lang, theme, "")
+	if err == nil {
+		end, err = h.philosophyTarget(lang, config, end)
+	}
+	if err == nil {
+		start, end, err = h.validateArticles(lang, start, end)
+	}
+	if err != nil {
+		// The room stays on its results; the host can still rematch
+		log.Printf("Failed to pick the next series pair for room %s: %v", room.ID, err)
+		return
+	}
+
+	room.post(func() {
+		room.mu.Lock()
+		if room.Series != s || s.Played != played {
+			room.mu.Unlock()
+			return
+		}
+		s.NextRaceAt = time.Time{}
+		room.mu.Unlock()
+		h.rematch(room, true, start, end, nil, theme)
+	})
+}
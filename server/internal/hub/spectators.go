@@ -0,0 +1,183 @@
+package hub
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// maxSpectators caps how many clients may watch a room besides its players
+const maxSpectators = 50
+
+// Spectator watches a room's broadcasts without racing. A spectator can
+// ask the host to race; once approved they become a player right away in
+// the lobby, or at the rematch if a race is under way.
+type Spectator struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Requested bool   `json:"requested,omitempty"` // waiting for the host to answer
+	Approved  bool   `json:"approved,omitempty"`  // races from the next round
+	client    *Client
+}
+
+type ApproveJoinRacePayload struct {
+	SpectatorID string `json:"spectatorId"`
+	Approve     bool   `json:"approve"`
+}
+
+// handleSpectate adds a client to a room as a spectator. Passwords and
+// invites apply as for players, and have been checked by the caller.
+func (h *Hub) handleSpectate(room *Room, client *Client, name string) {
+	room.mu.Lock()
+	if room.closed {
+		room.mu.Unlock()
+		client.sendError(CodeRoomNotFound, "Room not found")
+		return
+	}
+	if _, racing := room.Players[client.id]; racing {
+		room.mu.Unlock()
+		client.sendError(CodeNotAllowed, "You're already racing in this room")
+		return
+	}
+	if room.isBanned(client, name) {
+		room.mu.Unlock()
+		client.sendError(CodeBanned, "You've been banned from this room")
+		return
+	}
+	if len(room.Spectators) >= maxSpectators {
+		room.mu.Unlock()
+		client.sendError(CodeRoomFull, "Too many spectators")
+		return
+	}
+	if room.Spectators == nil {
+		room.Spectators = make(map[string]*Spectator)
+	}
+	room.Spectators[client.id] = &Spectator{
+		ID:     client.id,
+		Name:   client.displayName(name),
+		client: client,
+	}
+	client.room.Store(room)
+	state := mustMarshal(room)
+	room.mu.Unlock()
+	h.stopBrowsing(client)
+
+	log.Printf("Spectator %s is watching room %s", name, room.ID)
+	// Everyone's room_state now lists the spectator, the spectator's own
+	// included
+	h.broadcastToRoom(room, Message{Type: MsgTypeRoomState, Payload: state}, nil)
+}
+
+// handleRequestJoinRace asks the host to let a spectator race
+func (h *Hub) handleRequestJoinRace(room *Room, client *Client) {
+	room.mu.Lock()
+	spectator, ok := room.Spectators[client.id]
+	if !ok {
+		room.mu.Unlock()
+		client.sendError(CodeNotAllowed, "Only spectators can ask to race")
+		return
+	}
+	if spectator.Requested || spectator.Approved {
+		room.mu.Unlock()
+		return
+	}
+	spectator.Requested = true
+	var host *Client
+	if p, ok := room.Players[room.HostID]; ok {
+		host = p.client
+	}
+	room.mu.Unlock()
+
+	if host != nil {
+		host.sendMessage(Message{
+			Type: MsgTypeJoinRequest,
+			Payload: mustMarshal(map[string]string{
+				"spectatorId": spectator.ID,
+				"name":        spectator.Name,
+			}),
+		})
+	}
+}
+
+// handleApproveJoinRace is the host's answer to a spectator's request
+func (h *Hub) handleApproveJoinRace(room *Room, client *Client, payload json.RawMessage) {
+	var p ApproveJoinRacePayload
+	if err := json.Unmarshal(payload, &p); err != nil || p.SpectatorID == "" {
+		client.sendError(CodeBadRequest, "Invalid approve payload")
+		return
+	}
+
+	room.mu.Lock()
+	if room.HostID != client.id {
+		room.mu.Unlock()
+		client.sendError(CodeNotHost, "Only the host can let spectators race")
+		return
+	}
+	spectator, ok := room.Spectators[p.SpectatorID]
+	if !ok || !spectator.Requested {
+		room.mu.Unlock()
+		client.sendError(CodeNotFound, "No such request to race")
+		return
+	}
+	spectator.Requested = false
+	if !p.Approve {
+		room.mu.Unlock()
+		spectator.client.sendMessage(joinRaceAnswer(false, false))
+		return
+	}
+	if room.Started {
+		spectator.Approved = true
+		room.mu.Unlock()
+		spectator.client.sendMessage(joinRaceAnswer(true, true))
+		return
+	}
+	if len(room.Players) >= h.maxPlayers {
+		spectator.Requested = true
+		room.mu.Unlock()
+		client.sendError(CodeRoomFull, "Room is full")
+		return
+	}
+	h.promote(room, spectator)
+	state := mustMarshal(room)
+	room.mu.Unlock()
+
+	spectator.client.sendMessage(joinRaceAnswer(true, false))
+	h.broadcastToRoom(room, Message{Type: MsgTypeRoomState, Payload: state}, nil)
+}
+
+func joinRaceAnswer(approved, nextRound bool) Message {
+	return Message{
+		Type: MsgTypeJoinAnswer,
+		Payload: mustMarshal(map[string]bool{
+			"approved":  approved,
+			"nextRound": nextRound,
+		}),
+	}
+}
+
+// promote turns a spectator into a player in the lobby. Caller must hold
+// room.mu.
+func (h *Hub) promote(room *Room, s *Spectator) {
+	player := newPlayer(s.client, s.Name, room.StartArticle)
+	h.loadRecord(player)
+	delete(room.Spectators, s.ID)
+	room.Players[s.ID] = player
+	log.Printf("Spectator %s joined the race in room %s", s.Name, room.ID)
+}
+
+// promoteApproved seats the spectators approved during the last race, as
+// far as the room has space. Caller must hold room.mu.
+func (h *Hub) promoteApproved(room *Room) {
+	for _, s := range room.Spectators {
+		if s.Approved && len(room.Players) < h.maxPlayers {
+			h.promote(room, s)
+		}
+	}
+}
+
+// releaseSpectators detaches every spectator from a room that is closing.
+// Caller must hold room.mu.
+func (r *Room) releaseSpectators() {
+	for _, s := range r.Spectators {
+		s.client.leftRoom(r)
+	}
+}
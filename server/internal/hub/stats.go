@@ -0,0 +1,163 @@
+package hub
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/achievement"
+	"github.com/markotsymbaluk/wiki-racing/internal/analytics"
+	"github.com/markotsymbaluk/wiki-racing/internal/stats"
+)
+
+// playerResult is a race result waiting to be recorded for a player
+type playerResult struct {
+	id     string
+	player string // rating key
+	name   string
+	result stats.Result
+	path   []string
+}
+
+// raceResults collects each human player's result from the final
+// standings. Caller must hold room.mu.
+func (r *Room) raceResults(standings []Standing) []playerResult {
+	now := time.Now()
+	humans := r.humanCount()
+	results := make([]playerResult, 0, len(standings))
+	for _, s := range standings {
+		p, ok := r.Players[s.PlayerID]
+		if !ok || p.virtual() {
+			continue
+		}
+		res := stats.Result{
+			RoomID:       r.ID,
+			Mode:         string(r.Mode),
+			Language:     r.playerLanguage(p),
+			StartArticle: r.playerStart(p),
+			EndArticle:   r.playerTarget(p),
+			Players:      humans,
+			Finished:     s.Finished,
+			Clicks:       s.Clicks,
+			At:           now,
+		}
+		if s.Finished {
+			res.Rank, res.Time = s.Rank, s.Time
+		}
+		results = append(results, playerResult{
+			id:     p.ID,
+			player: p.ratingKey(),
+			name:   p.Name,
+			result: res,
+			path:   append([]string{}, p.Path...),
+		})
+	}
+	return results
+}
+
+// GuestProfilePrefix marks a guest's profile ID, which is otherwise an
+// account ID
+const GuestProfilePrefix = "guest:"
+
+// loadRecord fills in a new player's rating and, for accounts and guests
+// whose identity outlives the connection, their lifetime record. Players
+// known only by name share stats with anyone using it, so they get none.
+func (h *Hub) loadRecord(p *Player) {
+	key := p.ratingKey()
+	rec := h.ratings.Get(key)
+	p.Rating, p.Provisional = int(math.Round(rec.Rating)), rec.Provisional()
+	switch {
+	case p.AccountID != "":
+		p.ProfileID = p.AccountID
+	case p.guestID != "":
+		p.ProfileID = GuestProfilePrefix + p.guestID
+	default:
+		return
+	}
+	if profile, ok := h.stats.Get(key); ok {
+		summary := profile.Summary()
+		p.Stats = &summary
+	}
+}
+
+// recordResults saves each player's race result and announces any
+// achievements it unlocked to the room
+func (h *Hub) recordResults(room *Room, results []playerResult) {
+	for _, r := range results {
+		profile, err := h.stats.Record(r.player, r.name, r.result)
+		if err != nil {
+			log.Printf("Failed to record stats for %s: %v", r.player, err)
+			continue
+		}
+		room.mu.Lock()
+		if p, ok := room.Players[r.id]; ok && p.ProfileID != "" {
+			summary := profile.Summary()
+			p.Stats = &summary
+		}
+		room.mu.Unlock()
+		unlocks, err := h.awards.Evaluate(r.player, achievement.Race{
+			Result:   r.result,
+			Path:     r.path,
+			Lifetime: profile,
+		})
+		if err != nil {
+			log.Printf("Failed to evaluate achievements for %s: %v", r.player, err)
+			continue
+		}
+		for _, u := range unlocks {
+			log.Printf("Player %s unlocked %s in room %s", r.name, u.ID, room.ID)
+			h.broadcastToRoom(room, Message{
+				Type: MsgTypeAchievement,
+				Payload: mustMarshal(map[string]interface{}{
+					"playerId":    r.id,
+					"playerName":  r.name,
+					"achievement": u,
+				}),
+			}, nil)
+		}
+	}
+	h.recordPaths(results)
+}
+
+// recordPaths adds a race's paths to the hot article index. Paths are
+// grouped by edition and articles, since cross-language players race
+// between other titles.
+func (h *Hub) recordPaths(results []playerResult) {
+	type race struct{ language, start, end string }
+	paths := make(map[race][][]string)
+	for _, r := range results {
+		k := race{r.result.Language, r.result.StartArticle, r.result.EndArticle}
+		paths[k] = append(paths[k], r.path)
+	}
+	for k, p := range paths {
+		if err := h.analytics.Record(k.language, k.start, k.end, p); err != nil {
+			log.Printf("Failed to record paths for %s: %v", k.language, err)
+		}
+	}
+}
+
+// HotArticles returns the intermediate articles most race paths on an
+// edition went through, and how many paths were counted
+func (h *Hub) HotArticles(lang string, limit int) ([]analytics.HotArticle, int, error) {
+	return h.analytics.HotArticles(lang, limit)
+}
+
+// PlayerAchievements returns the achievements an account has unlocked
+func (h *Hub) PlayerAchievements(accountID string) ([]achievement.Unlock, error) {
+	return h.awards.Unlocked(ratingKey(accountID, "", ""))
+}
+
+// PlayerStats returns an account's lifetime race statistics
+func (h *Hub) PlayerStats(accountID string) (stats.Profile, bool) {
+	return h.stats.Get(ratingKey(accountID, "", ""))
+}
+
+// GuestAchievements returns the achievements a guest has unlocked
+func (h *Hub) GuestAchievements(guestID string) ([]achievement.Unlock, error) {
+	return h.awards.Unlocked(ratingKey("", guestID, ""))
+}
+
+// GuestStats returns a guest's lifetime race statistics
+func (h *Hub) GuestStats(guestID string) (stats.Profile, bool) {
+	return h.stats.Get(ratingKey("", guestID, ""))
+}
@@ -0,0 +1,127 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// StreamConn is a client connection over a transport other than
+// WebSocket, such as the gRPC API. Each frame is one JSON-encoded Message
+// like a WebSocket text frame, without the newline batching. Recv and Send
+// are each called from a single goroutine.
+type StreamConn interface {
+	Recv() ([]byte, error)
+	Send([]byte) error
+}
+
+// StreamIdentity is what a stream transport knows about who is on the
+// other end. Token is a session token and GuestIdentity a guest identity
+// from a previous welcome; both are verified here like on the WebSocket.
+type StreamIdentity struct {
+	Addr          string
+	Token         string
+	GuestIdentity string
+}
+
+// StreamClosed is why the server ended a stream, carrying the close code
+// a WebSocket client would have seen
+type StreamClosed struct {
+	Code   int
+	Reason string
+}
+
+func (e *StreamClosed) Error() string {
+	return fmt.Sprintf("closed by server (%d): %s", e.Code, e.Reason)
+}
+
+// ServeStream runs a client over conn until either side ends it. The
+// error is a *StreamClosed when the server closed the connection,
+// ErrDraining when it is turning new clients away, and whatever ended the
+// stream otherwise.
+func ServeStream(ctx context.Context, hub *Hub, conn StreamConn, who StreamIdentity) error {
+	if hub.draining.Load() {
+		return ErrDraining
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	client := &Client{
+		hub:    hub,
+		send:   make(chan []byte, 256),
+		id:     uuid.New().String(),
+		addr:   who.Addr,
+		cancel: cancel,
+	}
+	if hub.auth != nil {
+		if claims, err := hub.auth.Verify(who.Token); err == nil {
+			client.accountID = claims.Subject
+			client.accountName = claims.Username
+		} else if id, ok := hub.auth.VerifyGuest(who.GuestIdentity); ok {
+			client.guestID = id
+		} else {
+			// The new identity goes out with the welcome
+			client.guestID, _ = hub.auth.NewGuest()
+		}
+	}
+	if hub.moderation != nil {
+		if ban, ok := hub.moderation.Check(client.addr, client.accountID, client.guestID); ok {
+			log.Printf("Rejected banned stream (%s %s)", ban.Kind, ban.Value)
+			return &StreamClosed{Code: CloseBanned, Reason: "banned"}
+		}
+	}
+
+	hub.register <- client
+	go client.streamWrites(ctx, conn)
+	go client.streamReads(conn)
+
+	<-ctx.Done()
+	return context.Cause(ctx)
+}
+
+// streamReads hands incoming frames to the hub like readPump. Recv fails
+// once ServeStream returns, and the client is unregistered then.
+func (c *Client) streamReads(conn StreamConn) {
+	defer func() {
+		c.hub.unregister <- c
+	}()
+
+	for {
+		data, err := conn.Recv()
+		if err != nil {
+			c.cancel(err)
+			return
+		}
+		msg, err := decodeMessage(data, encodingJSON)
+		if err != nil {
+			log.Printf("Invalid message: %v", err)
+			continue
+		}
+		if !c.admit() {
+			continue
+		}
+		c.hub.HandleMessage(c, msg)
+	}
+}
+
+// streamWrites sends queued messages one frame each until the hub closes
+// the send queue or the stream ends
+func (c *Client) streamWrites(ctx context.Context, conn StreamConn) {
+	for {
+		select {
+		case message, ok := <-c.send:
+			if !ok {
+				c.cancel(nil)
+				return
+			}
+			if err := conn.Send(message); err != nil {
+				c.cancel(err)
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
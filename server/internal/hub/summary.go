@@ -0,0 +1,206 @@
+package hub
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// summaryRivals caps how many of the top finishers are compared pairwise
+// for divergence points, since the pairs grow with the square
+const summaryRivals = 5
+
+// Hop is one click in the post-race breakdown
+type Hop struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Duration int64  `json:"duration"` // ms spent on From before clicking
+}
+
+// Divergence is where two players' paths split: the last article they
+// shared, both reached it in the same number of moves, and where each
+// went next. Next is empty for a player whose path ended there.
+type Divergence struct {
+	Players [2]string `json:"players"`
+	Article string    `json:"article"`
+	Step    int       `json:"step"` // index of Article in both paths
+	Next    [2]string `json:"next"`
+}
+
+// hops breaks a player's race into timed clicks. A late joiner's first
+// hop is timed from when they joined. Caller must hold room.mu.
+func (r *Room) hops(p *Player) []Hop {
+	hops := make([]Hop, 0, len(p.steps))
+	from, at := r.playerStart(p), p.joinedAt
+	for _, step := range p.steps {
+		hops = append(hops, Hop{From: from, To: step.Article, Duration: step.At - at})
+		from, at = step.Article, step.At
+	}
+	return hops
+}
+
+// slowestHop returns the hop a player spent longest on, if they made any
+func slowestHop(hops []Hop) *Hop {
+	var slowest *Hop
+	for i := range hops {
+		if slowest == nil || hops[i].Duration > slowest.Duration {
+			slowest = &hops[i]
+		}
+	}
+	return slowest
+}
+
+// divergences compares the paths of the top of the standings pairwise.
+// Pairs whose paths are identical never split and are left out. Caller
+// must hold room.mu.
+func (r *Room) divergences(standings []Standing) []Divergence {
+	var rivals []*Player
+	for _, s := range standings {
+		if len(rivals) == summaryRivals {
+			break
+		}
+		if p, ok := r.Players[s.PlayerID]; ok && len(p.Path) > 0 {
+			rivals = append(rivals, p)
+		}
+	}
+
+	var splits []Divergence
+	for i, a := range rivals {
+		for _, b := range rivals[i+1:] {
+			if d, ok := diverge(a, b); ok {
+				splits = append(splits, d)
+			}
+		}
+	}
+	return splits
+}
+
+// diverge finds where a's and b's paths split, if they ever shared a
+// start and didn't end identical
+func diverge(a, b *Player) (Divergence, bool) {
+	step := 0
+	for step+1 < len(a.Path) && step+1 < len(b.Path) && a.Path[step+1] == b.Path[step+1] {
+		step++
+	}
+	if a.Path[0] != b.Path[0] || len(a.Path) == len(b.Path) && step == len(a.Path)-1 {
+		return Divergence{}, false
+	}
+	d := Divergence{Players: [2]string{a.ID, b.ID}, Article: a.Path[step], Step: step}
+	if step+1 < len(a.Path) {
+		d.Next[0] = a.Path[step+1]
+	}
+	if step+1 < len(b.Path) {
+		d.Next[1] = b.Path[step+1]
+	}
+	return d, true
+}
+
+// PathNode is an article in the tree of every path in a race merged from
+// the start, so paths share nodes for as long as they agree
+type PathNode struct {
+	Article  string      `json:"article"`
+	Players  []string    `json:"players"`           // IDs of players whose path passes here
+	Optimal  bool        `json:"optimal,omitempty"` // on the shortest route
+	Children []*PathNode `json:"children,omitempty"`
+}
+
+// PathComparison is the structure clients draw the path comparison from.
+// Roots has one tree per start article, which is only more than one in
+// cross-language races.
+type PathComparison struct {
+	CommonPrefix []string    `json:"commonPrefix"` // articles every player's path starts with
+	Optimal      []string    `json:"optimal,omitempty"`
+	Roots        []*PathNode `json:"roots"`
+}
+
+// comparePaths merges the players' paths and the optimal route, when it
+// was found in time, into a PathComparison. Caller must hold room.mu.
+func (r *Room) comparePaths(standings []Standing) PathComparison {
+	var paths [][]string
+	var ids []string
+	for _, s := range standings {
+		if p, ok := r.Players[s.PlayerID]; ok && len(p.Path) > 0 {
+			paths = append(paths, p.Path)
+			ids = append(ids, p.ID)
+		}
+	}
+
+	c := PathComparison{CommonPrefix: commonPrefix(paths), Optimal: r.optimal}
+	for i, path := range paths {
+		c.Roots = addPath(c.Roots, path, func(n *PathNode) {
+			n.Players = append(n.Players, ids[i])
+		})
+	}
+	if len(r.optimal) > 0 {
+		c.Roots = addPath(c.Roots, r.optimal, func(n *PathNode) {
+			n.Optimal = true
+		})
+	}
+	return c
+}
+
+// addPath walks path down the trees in roots, creating nodes it doesn't
+// find, and calls mark on every node along it
+func addPath(roots []*PathNode, path []string, mark func(*PathNode)) []*PathNode {
+	siblings := &roots
+	for _, article := range path {
+		var node *PathNode
+		for _, n := range *siblings {
+			if n.Article == article {
+				node = n
+				break
+			}
+		}
+		if node == nil {
+			node = &PathNode{Article: article, Players: []string{}}
+			*siblings = append(*siblings, node)
+		}
+		mark(node)
+		siblings = &node.Children
+	}
+	return roots
+}
+
+// commonPrefix returns the articles all paths start with
+func commonPrefix(paths [][]string) []string {
+	if len(paths) == 0 {
+		return []string{}
+	}
+	prefix := paths[0]
+	for _, path := range paths[1:] {
+		n := 0
+		for n < len(prefix) && n < len(path) && prefix[n] == path[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return append([]string{}, prefix...)
+}
+
+// planOptimal looks up the shortest route through the race's targets
+// while it runs, so the summary can compare paths against it without
+// waiting on Wikipedia when the race ends
+func (h *Hub) planOptimal(room *Room) {
+	room.mu.RLock()
+	startedAt, lang := room.StartedAt, room.Language
+	targets := []string{room.StartArticle}
+	targets = append(targets, room.Config.Checkpoints...)
+	targets = append(targets, room.EndArticle)
+	room.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	route, err := h.botRoute(ctx, lang, targets)
+	if err != nil {
+		log.Printf("No optimal path for room %s: %v", room.ID, err)
+		return
+	}
+
+	room.mu.Lock()
+	// A rematch may have started another race meanwhile
+	if room.StartedAt.Equal(startedAt) {
+		room.optimal = route
+	}
+	room.mu.Unlock()
+}
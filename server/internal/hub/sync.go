@@ -0,0 +1,46 @@
+package hub
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// elapsed returns the race time so far in milliseconds, 0 before the
+// start. Time spent paused doesn't count. Caller must hold room.mu.
+func (r *Room) elapsed() int64 {
+	if !r.Started || r.StartedAt.IsZero() {
+		return 0
+	}
+	now := time.Now()
+	if r.Paused {
+		now = r.pausedAt
+	}
+	return (now.Sub(r.StartedAt) - r.pausedFor).Milliseconds()
+}
+
+// syncMessage builds a state_resync carrying everything a client needs to
+// reconcile after missed broadcasts. Caller must hold room.mu.
+func (r *Room) syncMessage() Message {
+	return Message{
+		Type: MsgTypeStateResync,
+		Payload: mustMarshal(map[string]interface{}{
+			"room":       r,
+			"elapsed":    r.elapsed(),
+			"serverTime": time.Now().UnixMilli(),
+		}),
+	}
+}
+
+// handleRequestSync answers a client's explicit request to catch up,
+// after since when the payload names it and with the full room state
+// otherwise
+func (h *Hub) handleRequestSync(room *Room, client *Client, payload json.RawMessage) {
+	var p RequestSyncPayload
+	if len(payload) > 0 && string(payload) != "null" {
+		if err := json.Unmarshal(payload, &p); err != nil {
+			client.sendError(CodeBadRequest, "Invalid request_sync payload")
+			return
+		}
+	}
+	h.queueResync(room, client, p.Since)
+}
@@ -0,0 +1,134 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+// ErrInvalidTheme is returned for themes whose categories can't supply a
+// race
+var ErrInvalidTheme = errors.New("invalid theme")
+
+const (
+	// themeTimeout bounds walking both category trees, which can take a
+	// few dozen API requests when nothing is cached
+	themeTimeout = 10 * time.Second
+	// themePicks is how many end articles are tried before giving up on
+	// one that differs from the start
+	themePicks = 10
+)
+
+// Theme draws a race's articles from Wikipedia category trees instead of
+// all of Wikipedia, e.g. from "1990s films" to "Nobel laureates in
+// Physics". Rooms keep their theme, so random rematches stay on topic.
+type Theme struct {
+	StartCategory string `json:"startCategory"`
+	EndCategory   string `json:"endCategory,omitempty"` // the start category if empty
+	// Depth is how many levels of subcategories are searched, 0 for the
+	// categories' own articles only
+	Depth int `json:"depth,omitempty"`
+}
+
+// validTheme trims a theme and fills in its defaults, or returns nil for
+// no theme
+func validTheme(t *Theme) (*Theme, error) {
+	if t == nil {
+		return nil, nil
+	}
+	v := Theme{
+		StartCategory: strings.TrimSpace(t.StartCategory),
+		EndCategory:   strings.TrimSpace(t.EndCategory),
+		Depth:         t.Depth,
+	}
+	if v.StartCategory == "" {
+		return nil, fmt.Errorf("%w: a start category is required", ErrInvalidTheme)
+	}
+	if v.EndCategory == "" {
+		v.EndCategory = v.StartCategory
+	}
+	if v.Depth < 0 || v.Depth > wiki.MaxCategoryDepth {
+		return nil, fmt.Errorf("%w: depth must be between 0 and %d", ErrInvalidTheme, wiki.MaxCategoryDepth)
+	}
+	return &v, nil
+}
+
+// applyTheme replaces a new room's articles with a pair from its theme,
+// if it has one, and returns the theme the room should keep
+func (h *Hub) applyTheme(lang string, t *Theme, start, end string) (*Theme, string, string, error) {
+	theme, err := validTheme(t)
+	if err != nil || theme == nil {
+		return nil, start, end, err
+	}
+	start, end, err = h.themedPair(lang, *theme)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return theme, start, end, nil
+}
+
+// themeError is the message for a player whose theme didn't work out
+func themeError(err error) string {
+	if errors.Is(err, ErrInvalidTheme) {
+		return err.Error()
+	}
+	return "Couldn't pick articles from those categories, try again"
+}
+
+// themedPair picks a start article from the theme's start category tree
+// and a different end article from its end tree. With a link graph for
+// the edition, articles it knows are preferred so moves can be checked.
+func (h *Hub) themedPair(lang string, t Theme) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), themeTimeout)
+	defer cancel()
+
+	starts, err := h.themeArticles(ctx, lang, t.StartCategory, t.Depth)
+	if err != nil {
+		return "", "", err
+	}
+	ends := starts
+	if !wiki.SameArticleIn(lang, t.StartCategory, t.EndCategory) {
+		if ends, err = h.themeArticles(ctx, lang, t.EndCategory, t.Depth); err != nil {
+			return "", "", err
+		}
+	}
+
+	start := starts[rand.Intn(len(starts))]
+	for i := 0; i < themePicks; i++ {
+		if end := ends[rand.Intn(len(ends))]; !wiki.SameArticleIn(lang, start, end) {
+			return start, end, nil
+		}
+	}
+	return "", "", fmt.Errorf("%w: the categories need at least two articles between them", ErrInvalidTheme)
+}
+
+// themeArticles lists the candidates from one category tree
+func (h *Hub) themeArticles(ctx context.Context, lang, category string, depth int) ([]string, error) {
+	titles, err := h.wikiFor(lang).CategoryArticles(ctx, category, depth)
+	if errors.Is(err, wiki.ErrEmptyCategory) {
+		return nil, fmt.Errorf("%w: no articles in category %q", ErrInvalidTheme, category)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	g := h.graphFor(lang)
+	if g == nil {
+		return titles, nil
+	}
+	known := make([]string, 0, len(titles))
+	for _, title := range titles {
+		if resolved, ok := g.Canonical(title); ok {
+			known = append(known, resolved)
+		}
+	}
+	if len(known) == 0 {
+		return titles, nil
+	}
+	return known, nil
+}
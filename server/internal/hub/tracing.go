@@ -0,0 +1,101 @@
+package hub
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span attributes
+const (
+	attrMessageType = attribute.Key("wikirace.message.type")
+	attrRoomID      = attribute.Key("wikirace.room.id")
+	attrPlayerID    = attribute.Key("wikirace.player.id")
+	attrRecipients  = attribute.Key("wikirace.broadcast.recipients")
+	attrQueued      = attribute.Key("wikirace.queued_ms")
+)
+
+// untraced messages arrive many times a second and skip the mailbox, so
+// their spans would only be noise
+var untraced = map[string]bool{
+	MsgTypeCursor:   true,
+	MsgTypeViewport: true,
+	MsgTypePing:     true,
+}
+
+// noSpan stands in when tracing is off; its methods do nothing
+var noSpan = trace.SpanFromContext(context.Background())
+
+// traceMessage starts the span for an inbound message. It is ended once
+// the message has been handled, on the room's goroutine for room commands.
+func (h *Hub) traceMessage(client *Client, msg Message) trace.Span {
+	if h.tracer == nil || untraced[msg.Type] {
+		return noSpan
+	}
+	attrs := []attribute.KeyValue{
+		attrMessageType.String(msg.Type),
+		attrPlayerID.String(client.id),
+	}
+	if room := client.currentRoom(); room != nil {
+		attrs = append(attrs, attrRoomID.String(room.ID))
+	}
+	_, span := h.tracer.Start(context.Background(), "handle "+msg.Type,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attrs...))
+	return span
+}
+
+// endMessageSpan ends the span of a message handled off the mailbox,
+// noting the room it joined if it had none before
+func endMessageSpan(span trace.Span, client *Client) {
+	if !span.IsRecording() {
+		return
+	}
+	if room := client.currentRoom(); room != nil {
+		span.SetAttributes(attrRoomID.String(room.ID))
+	}
+	span.End()
+}
+
+// traced wraps a room command so its span covers the wait in the mailbox
+// as well as the run. Broadcasts the command makes become children of
+// its span.
+func (r *Room) traced(span trace.Span, fn func()) func() {
+	if !span.IsRecording() {
+		return fn
+	}
+	queued := time.Now()
+	return func() {
+		span.SetAttributes(attrQueued.Int64(time.Since(queued).Milliseconds()))
+		sc := span.SpanContext()
+		r.handling.Store(&sc)
+		defer func() {
+			r.handling.Store(nil)
+			span.End()
+		}()
+		fn()
+	}
+}
+
+// traceBroadcast starts the span for a broadcast, ended by the fan-out
+// goroutine once every recipient has it queued. A timer firing while a
+// command runs is counted as that command's broadcast; that's rare
+// enough not to be worth threading contexts through every handler.
+func (h *Hub) traceBroadcast(room *Room, msg Message) trace.Span {
+	if h.tracer == nil {
+		return noSpan
+	}
+	ctx := context.Background()
+	if sc := room.handling.Load(); sc != nil {
+		ctx = trace.ContextWithSpanContext(ctx, *sc)
+	}
+	_, span := h.tracer.Start(ctx, "broadcast "+msg.Type,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attrMessageType.String(msg.Type),
+			attrRoomID.String(room.ID),
+		))
+	return span
+}
@@ -0,0 +1,60 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrInvalidArticle wraps the reason a start or end article was rejected
+var ErrInvalidArticle = errors.New("invalid article")
+
+// validateArticles checks a start/end pair against Wikipedia and returns
+// their canonical titles. Empty titles are left for the host to fill in
+// later. If Wikipedia can't be reached the titles are accepted as given,
+// so an API outage doesn't block room creation.
+func (h *Hub) validateArticles(lang, start, end string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	titles := [2]string{start, end}
+	for i, title := range titles {
+		if title == "" {
+			continue
+		}
+
+		resolved, err := h.resolveArticle(ctx, lang, title)
+		if err != nil {
+			return "", "", err
+		}
+		titles[i] = resolved
+	}
+
+	if titles[0] != "" && titles[0] == titles[1] {
+		if start != end {
+			return "", "", fmt.Errorf("%w: %q redirects to %q", ErrInvalidArticle, start, end)
+		}
+		return "", "", fmt.Errorf("%w: start and end articles must differ", ErrInvalidArticle)
+	}
+	return titles[0], titles[1], nil
+}
+
+// resolveArticle returns the canonical title for a race article on the
+// given edition, rejecting missing and disambiguation pages. Lookup
+// failures fall back to the title as given.
+func (h *Hub) resolveArticle(ctx context.Context, lang, title string) (string, error) {
+	article, err := h.wikiFor(lang).Resolve(ctx, title)
+	if err != nil {
+		log.Printf("Article validation for %q skipped: %v", title, err)
+		return title, nil
+	}
+	switch {
+	case article.Missing:
+		return "", fmt.Errorf("%w: %q does not exist on Wikipedia", ErrInvalidArticle, title)
+	case article.Disambiguation:
+		return "", fmt.Errorf("%w: %q is a disambiguation page, pick a specific article", ErrInvalidArticle, title)
+	}
+	return article.Title, nil
+}
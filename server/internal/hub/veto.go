@@ -0,0 +1,160 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
+)
+
+const (
+	// vetoPairs is how many pairs a ranked 1v1 bans down from
+	vetoPairs = 5
+	// vetoTurn is how long each player has to ban before the server bans
+	// a random pair for them
+	vetoTurn = 15 * time.Second
+)
+
+// Veto is a ranked 1v1's ban phase: the two players take turns banning
+// offered pairs until one is left to race
+type Veto struct {
+	Pairs      []Candidate `json:"pairs"`
+	Banned     []bool      `json:"banned"`
+	Turn       string      `json:"turn"` // ID of the player to ban next
+	TurnEndsAt time.Time   `json:"turnEndsAt"`
+	order      [2]string
+	bans       int
+	timer      *time.Timer
+}
+
+type BanPairPayload struct {
+	Choice int `json:"choice"` // index into the veto's pairs
+}
+
+// matchPairs picks the pairs a ranked 1v1 bans from
+func (h *Hub) matchPairs(ctx context.Context) ([]Candidate, error) {
+	pairs := make([]Candidate, 0, vetoPairs)
+	for len(pairs) < vetoPairs {
+		start, end, err := h.randomPair(ctx, wiki.DefaultLanguage, "")
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, Candidate{StartArticle: start, EndArticle: end})
+	}
+	return pairs, nil
+}
+
+// startVeto opens the ban phase with a random player banning first.
+// Caller must hold room.mu.
+func (h *Hub) startVeto(room *Room, pairs []Candidate, a, b string) {
+	if rand.Intn(2) == 1 {
+		a, b = b, a
+	}
+	room.Veto = &Veto{
+		Pairs:  pairs,
+		Banned: make([]bool, len(pairs)),
+		order:  [2]string{a, b},
+	}
+	h.nextBan(room, room.Veto)
+}
+
+// nextBan hands the turn to whoever bans next and arms their timer.
+// Caller must hold room.mu.
+func (h *Hub) nextBan(room *Room, veto *Veto) {
+	veto.Turn = veto.order[veto.bans%2]
+	veto.TurnEndsAt = time.Now().Add(vetoTurn)
+	bans := veto.bans
+	veto.timer = time.AfterFunc(vetoTurn, func() {
+		room.post(func() { h.banTimedOut(room, veto, bans) })
+	})
+}
+
+// handleBanPair bans a pair for the player whose turn it is
+func (h *Hub) handleBanPair(room *Room, client *Client, payload json.RawMessage) {
+	var p BanPairPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		client.sendError(CodeBadRequest, "Invalid ban payload")
+		return
+	}
+
+	room.mu.Lock()
+	veto := room.Veto
+	switch {
+	case veto == nil:
+		room.mu.Unlock()
+		client.sendError(CodeNotAllowed, "There's nothing to ban")
+		return
+	case veto.Turn != client.id:
+		room.mu.Unlock()
+		client.sendError(CodeNotAllowed, "It's not your turn to ban")
+		return
+	case p.Choice < 0 || p.Choice >= len(veto.Pairs) || veto.Banned[p.Choice]:
+		room.mu.Unlock()
+		client.sendError(CodeBadRequest, "That pair can't be banned")
+		return
+	}
+	h.ban(room, veto, p.Choice)
+}
+
+// banTimedOut bans a random pair for a player who let their turn run
+// out, unless they banned in the meantime
+func (h *Hub) banTimedOut(room *Room, veto *Veto, bans int) {
+	room.mu.Lock()
+	if room.Veto != veto || veto.bans != bans {
+		room.mu.Unlock()
+		return
+	}
+	left := make([]int, 0, len(veto.Pairs))
+	for i, banned := range veto.Banned {
+		if !banned {
+			left = append(left, i)
+		}
+	}
+	log.Printf("Ban turn timed out in room %s", room.ID)
+	h.ban(room, veto, left[rand.Intn(len(left))])
+}
+
+// ban applies one ban and either passes the turn or, with one pair left,
+// makes it the race. Caller must hold room.mu, which ban releases.
+func (h *Hub) ban(room *Room, veto *Veto, choice int) {
+	veto.timer.Stop()
+	veto.Banned[choice] = true
+	veto.bans++
+
+	left := -1
+	remaining := 0
+	for i, banned := range veto.Banned {
+		if !banned {
+			left = i
+			remaining++
+		}
+	}
+	if remaining > 1 {
+		h.nextBan(room, veto)
+		msg := Message{Type: MsgTypeVetoState, Payload: mustMarshal(veto)}
+		room.mu.Unlock()
+		h.broadcastToRoom(room, msg, nil)
+		return
+	}
+
+	pair := veto.Pairs[left]
+	room.Veto = nil
+	room.StartArticle, room.EndArticle = pair.StartArticle, pair.EndArticle
+	for _, p := range room.Players {
+		p.CurrentArticle = pair.StartArticle
+		p.Path = []string{pair.StartArticle}
+	}
+	ended := Message{
+		Type:    MsgTypeVetoEnded,
+		Payload: mustMarshal(map[string]interface{}{"pair": pair, "choice": left}),
+	}
+	state := Message{Type: MsgTypeRoomState, Payload: mustMarshal(room)}
+	room.mu.Unlock()
+
+	log.Printf("Ban phase in room %s left %s -> %s", room.ID, pair.StartArticle, pair.EndArticle)
+	h.broadcastToRoom(room, ended, nil)
+	h.broadcastToRoom(room, state, nil)
+}
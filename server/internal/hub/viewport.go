@@ -0,0 +1,84 @@
+package hub
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// viewportFlushInterval batches scroll positions at 2 Hz. Where someone
+// is reading changes far slower than their cursor moves.
+const viewportFlushInterval = 500 * time.Millisecond
+
+// ViewportPayload is the part of an article a racer has on screen, in
+// page pixels. PageHeight is optional and lets receivers show the
+// position as a fraction of the article.
+type ViewportPayload struct {
+	Article    string  `json:"article"`
+	ScrollY    float64 `json:"scrollY"`
+	Height     float64 `json:"height"`
+	PageHeight float64 `json:"pageHeight,omitempty"`
+}
+
+// ViewportUpdate is one player's viewport within a viewport_batch
+type ViewportUpdate struct {
+	PlayerID string `json:"playerId"`
+	ViewportPayload
+}
+
+// handleViewport keeps a player's latest viewport for the next flush
+func (h *Hub) handleViewport(room *Room, client *Client, payload json.RawMessage) {
+	var p ViewportPayload
+	if err := json.Unmarshal(payload, &p); err != nil || p.ScrollY < 0 || p.Height < 0 {
+		return
+	}
+
+	room.mu.RLock()
+	_, exists := room.Players[client.id]
+	hiding := room.hiding(client.id)
+	room.mu.RUnlock()
+	if !exists || hiding {
+		return
+	}
+
+	room.cursorMu.Lock()
+	if room.viewports == nil {
+		room.viewports = make(map[string]ViewportUpdate)
+	}
+	room.viewports[client.id] = ViewportUpdate{PlayerID: client.id, ViewportPayload: p}
+	room.cursorMu.Unlock()
+}
+
+// flushViewports periodically sends each room's latest viewports as one
+// viewport_batch. Like cursors, clients skip their own entry.
+func (h *Hub) flushViewports() {
+	ticker := time.NewTicker(viewportFlushInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, room := range h.rooms.all() {
+			room.cursorMu.Lock()
+			pending := room.viewports
+			room.viewports = nil
+			room.cursorMu.Unlock()
+
+			if len(pending) == 0 {
+				continue
+			}
+
+			viewports := make([]ViewportUpdate, 0, len(pending))
+			for _, v := range pending {
+				viewports = append(viewports, v)
+			}
+			msg := Message{
+				Type: MsgTypeViewports,
+				Payload: mustMarshal(map[string]interface{}{
+					"viewports": viewports,
+				}),
+			}
+			select {
+			case room.broadcasts <- roomBroadcast{msg: msg, transient: true}:
+			case <-room.done:
+			}
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/graph"
+)
+
+const (
+	defaultVoteCandidates = 3
+	maxVoteCandidates     = 5
+	defaultVoteDuration   = 20 * time.Second
+	minVoteDuration       = 5 * time.Second
+	maxVoteDuration       = time.Minute
+)
+
+// Candidate is an article pair players can vote for
+type Candidate struct {
+	StartArticle string `json:"startArticle"`
+	EndArticle   string `json:"endArticle"`
+}
+
+// Vote is a lobby poll over candidate pairs. Counts line up with
+// Candidates; who voted for what isn't shared.
+type Vote struct {
+	Candidates []Candidate    `json:"candidates"`
+	Counts     []int          `json:"counts"`
+	EndsAt     time.Time      `json:"endsAt"`
+	ballots    map[string]int // candidate index by player ID
+	timer      *time.Timer
+}
+
+type StartVotePayload struct {
+	Candidates int    `json:"candidates,omitempty"` // pairs to offer, 3 if unset
+	Seconds    int    `json:"seconds,omitempty"`    // voting window, 20 if unset
+	Difficulty string `json:"difficulty,omitempty"` // tier for the pairs when the link graph is loaded
+}
+
+type VotePayload struct {
+	Choice int `json:"choice"` // index into the vote's candidates
+}
+
+// prepareStartVote picks the candidate pairs, which takes API calls,
+// before the room opens the vote. Themed rooms draw them from their theme.
+func (h *Hub) prepareStartVote(room *Room, client *Client, payload json.RawMessage) func() {
+	var p StartVotePayload
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &p); err != nil {
+			client.sendError(CodeBadRequest, "Invalid start_vote payload")
+			return nil
+		}
+	}
+	if !isHost(room, client) {
+		client.sendError(CodeNotHost, "Only host can start a vote")
+		return nil
+	}
+	var tier graph.Tier
+	if p.Difficulty != "" {
+		t, err := graph.ParseTier(p.Difficulty)
+		if err != nil {
+			client.sendError(CodeInvalidSettings, "Difficulty must be easy, medium or hard")
+			return nil
+		}
+		tier = t
+	}
+	n := p.Candidates
+	switch {
+	case n <= 0:
+		n = defaultVoteCandidates
+	case n < 2 || n > maxVoteCandidates:
+		client.sendError(CodeInvalidSettings, "A vote needs between 2 and 5 candidates")
+		return nil
+	}
+	duration := time.Duration(p.Seconds) * time.Second
+	if p.Seconds == 0 {
+		duration = defaultVoteDuration
+	}
+	duration = min(max(duration, minVoteDuration), maxVoteDuration)
+
+	room.mu.RLock()
+	lang, config, theme := room.Language, room.Config, room.Theme
+	room.mu.RUnlock()
+
+	// A Philosophy game's pairs can come out with the target as their
+	// start, so a few spare picks are allowed
+	candidates := make([]Candidate, 0, n)
+	for picks := 0; len(candidates) < n; picks++ {
+		start, end, err := h.candidatePair(lang, theme, tier)
+		if err == nil {
+			end, err = h.philosophyTarget(lang, config, end)
+		}
+		if err == nil && picks == 2*n {
+			err = errors.New("too many candidates ended where they started")
+		}
+		if err != nil {
+			log.Printf("Failed to pick vote candidates: %v", err)
+			client.sendError(CodeTryAgain, "Couldn't pick articles to vote on, try again")
+			return nil
+		}
+		if start != end {
+			candidates = append(candidates, Candidate{StartArticle: start, EndArticle: end})
+		}
+	}
+	return func() { h.openVote(room, client, candidates, duration) }
+}
+
+// candidatePair picks one pair for a vote
+func (h *Hub) candidatePair(lang string, theme *Theme, tier graph.Tier) (string, string, error) {
+	if theme != nil {
+		return h.themedPair(lang, *theme)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return h.randomPair(ctx, lang, tier)
+}
+
+// openVote starts the poll and arms its deadline
+func (h *Hub) openVote(room *Room, client *Client, candidates []Candidate, duration time.Duration) {
+	room.mu.Lock()
+	switch {
+	case room.Started:
+		room.mu.Unlock()
+		client.sendError(CodeRaceStarted, "Cannot vote after race has started")
+		return
+	case room.Vote != nil:
+		room.mu.Unlock()
+		client.sendError(CodeNotAllowed, "A vote is already running")
+		return
+	case room.ghost != nil:
+		room.mu.Unlock()
+		client.sendError(CodeNotAllowed, "A ghost race keeps its articles")
+		return
+	case room.Veto != nil:
+		room.mu.Unlock()
+		client.sendError(CodeNotAllowed, "The ban phase picks this match's articles")
+		return
+	}
+	vote := &Vote{
+		Candidates: candidates,
+		Counts:     make([]int, len(candidates)),
+		EndsAt:     time.Now().Add(duration),
+		ballots:    make(map[string]int),
+	}
+	vote.timer = time.AfterFunc(duration, func() {
+		room.post(func() { h.closeVote(room, vote) })
+	})
+	room.Vote = vote
+	msg := Message{Type: MsgTypeVoteStarted, Payload: mustMarshal(vote)}
+	room.mu.Unlock()
+
+	log.Printf("Vote started in room %s over %d pairs", room.ID, len(candidates))
+	h.broadcastToRoom(room, msg, nil)
+}
+
+// handleVote records or changes a player's ballot. The vote closes early
+// once every player has voted.
+func (h *Hub) handleVote(room *Room, client *Client, payload json.RawMessage) {
+	var p VotePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		client.sendError(CodeBadRequest, "Invalid vote payload")
+		return
+	}
+
+	room.mu.Lock()
+	vote := room.Vote
+	_, exists := room.Players[client.id]
+	switch {
+	case !exists:
+		room.mu.Unlock()
+		return
+	case vote == nil:
+		room.mu.Unlock()
+		client.sendError(CodeNotAllowed, "There's no vote running")
+		return
+	case p.Choice < 0 || p.Choice >= len(vote.Candidates):
+		room.mu.Unlock()
+		client.sendError(CodeBadRequest, "No such candidate")
+		return
+	}
+	if prev, ok := vote.ballots[client.id]; ok {
+		vote.Counts[prev]--
+	}
+	vote.ballots[client.id] = p.Choice
+	vote.Counts[p.Choice]++
+	everyone := len(vote.ballots) >= room.humanCount()
+	msg := Message{
+		Type: MsgTypeVoteUpdate,
+		Payload: mustMarshal(map[string]interface{}{
+			"counts": vote.Counts,
+			"voters": len(vote.ballots),
+		}),
+	}
+	room.mu.Unlock()
+
+	h.broadcastToRoom(room, msg, nil)
+	if everyone {
+		h.closeVote(room, vote)
+	}
+}
+
+// closeVote applies the winning pair, picking at random between ties, and
+// ends the vote. Ballots from players who have since left don't count.
+func (h *Hub) closeVote(room *Room, vote *Vote) {
+	room.mu.Lock()
+	if room.Vote != vote {
+		room.mu.Unlock()
+		return
+	}
+	vote.timer.Stop()
+	room.Vote = nil
+
+	counts := make([]int, len(vote.Candidates))
+	for id, choice := range vote.ballots {
+		if _, ok := room.Players[id]; ok {
+			counts[choice]++
+		}
+	}
+	best := 0
+	var leaders []int
+	for i, n := range counts {
+		switch {
+		case n > best:
+			best, leaders = n, []int{i}
+		case n == best:
+			leaders = append(leaders, i)
+		}
+	}
+	winner := leaders[rand.Intn(len(leaders))]
+	pair := vote.Candidates[winner]
+	room.StartArticle, room.EndArticle = pair.StartArticle, pair.EndArticle
+	ended := Message{
+		Type: MsgTypeVoteEnded,
+		Payload: mustMarshal(map[string]interface{}{
+			"winner":    winner,
+			"candidate": pair,
+			"counts":    counts,
+		}),
+	}
+	state := Message{Type: MsgTypeRoomState, Payload: mustMarshal(room)}
+	room.mu.Unlock()
+
+	log.Printf("Vote in room %s picked %s -> %s", room.ID, pair.StartArticle, pair.EndArticle)
+	h.broadcastToRoom(room, ended, nil)
+	h.broadcastToRoom(room, state, nil)
+}
+
+// cancelVote drops a running vote, e.g. when the host sets the articles
+// by hand. Caller must hold room.mu.
+func (r *Room) cancelVote() {
+	if r.Vote != nil {
+		r.Vote.timer.Stop()
+		r.Vote = nil
+	}
+}
@@ -0,0 +1,148 @@
+package hub
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/webhook"
+)
+
+// Webhook event types
+const (
+	EventRaceStarted   = "race.started"
+	EventRaceFinished  = "race.finished"
+	EventRaceAbandoned = "race.abandoned" // closed mid-race, or ended with no finishers
+)
+
+// RaceAbandonedRoomClosed is the abandon reason for rooms removed while
+// their race was still running
+const RaceAbandonedRoomClosed = "room_closed"
+
+// RaceEvent is the data of every race webhook
+type RaceEvent struct {
+	RoomID       string     `json:"roomId"`
+	Mode         GameMode   `json:"mode"`
+	Language     string     `json:"language"`
+	StartArticle string     `json:"startArticle"`
+	EndArticle   string     `json:"endArticle"`
+	Players      []string   `json:"players"`
+	Reason       string     `json:"reason,omitempty"`
+	Standings    []Standing `json:"standings,omitempty"`
+	// Event and EventID tag races run by the schedule, so feeds can
+	// publish an event's results
+	Event   string `json:"event,omitempty"`
+	EventID string `json:"eventId,omitempty"`
+}
+
+// raceEvent describes the room's race for a webhook, or returns false for
+// private rooms, which stay off community feeds. Caller must hold room.mu.
+func (r *Room) raceEvent() (RaceEvent, bool) {
+	if r.Private {
+		return RaceEvent{}, false
+	}
+	e := RaceEvent{
+		RoomID:       r.ID,
+		Mode:         r.Mode,
+		Language:     r.Language,
+		StartArticle: r.StartArticle,
+		EndArticle:   r.EndArticle,
+		Players:      make([]string, 0, len(r.Players)),
+		Event:        r.Event,
+		EventID:      r.eventID,
+	}
+	for _, p := range r.Players {
+		if !p.virtual() {
+			e.Players = append(e.Players, p.Name)
+		}
+	}
+	return e, true
+}
+
+// OnRaceEvent registers fn to receive every race event that goes to
+// webhooks, for integrations running in the same process. fn is called
+// with room locks held, so it must not block or call back into the hub.
+func (h *Hub) OnRaceEvent(fn func(webhook.Event)) {
+	h.listenersMu.Lock()
+	defer h.listenersMu.Unlock()
+	h.listeners = append(h.listeners, fn)
+}
+
+// emit sends an event to the webhooks and in-process listeners
+func (h *Hub) emit(e webhook.Event) {
+	h.webhooks.Send(e)
+
+	h.listenersMu.Lock()
+	defer h.listenersMu.Unlock()
+	for _, fn := range h.listeners {
+		fn(e)
+	}
+}
+
+// notifyRaceStarted fires race.started. Caller must hold room.mu.
+func (h *Hub) notifyRaceStarted(room *Room) {
+	e, ok := room.raceEvent()
+	if !ok {
+		return
+	}
+	h.emit(webhook.Event{
+		Type: EventRaceStarted,
+		Content: fmt.Sprintf("Race started in room %s: %s → %s with %s",
+			e.RoomID, e.StartArticle, e.EndArticle, strings.Join(e.Players, ", ")),
+		Data: e,
+	})
+}
+
+// notifyRaceEnded fires race.finished, or race.abandoned when no human
+// player finished. Caller must hold room.mu.
+func (h *Hub) notifyRaceEnded(room *Room, reason string, standings []Standing) {
+	e, ok := room.raceEvent()
+	if !ok {
+		return
+	}
+	e.Reason = reason
+	e.Standings = standings
+
+	var winner *Standing
+	for i, s := range standings {
+		if p := room.Players[s.PlayerID]; s.Finished && p != nil && !p.virtual() {
+			winner = &standings[i]
+			break
+		}
+	}
+	if winner == nil {
+		h.emit(webhook.Event{
+			Type:    EventRaceAbandoned,
+			Content: fmt.Sprintf("Race %s → %s in room %s ended with no finishers", e.StartArticle, e.EndArticle, e.RoomID),
+			Data:    e,
+		})
+		return
+	}
+	content := fmt.Sprintf("%s won %s → %s in %.1fs with %d clicks (room %s)",
+		winner.PlayerName, e.StartArticle, e.EndArticle, float64(winner.Time)/1000, winner.Clicks, e.RoomID)
+	if e.Event != "" {
+		content = e.Event + ": " + content
+	}
+	h.emit(webhook.Event{
+		Type:    EventRaceFinished,
+		Content: content,
+		Data:    e,
+	})
+}
+
+// notifyRaceAbandoned fires race.abandoned for a room removed mid-race.
+// Caller must hold room.mu.
+func (h *Hub) notifyRaceAbandoned(room *Room) {
+	if !room.Started || room.Ended {
+		return
+	}
+	e, ok := room.raceEvent()
+	if !ok {
+		return
+	}
+	e.Reason = RaceAbandonedRoomClosed
+	h.emit(webhook.Event{
+		Type:    EventRaceAbandoned,
+		Content: fmt.Sprintf("Race %s → %s in room %s was abandoned", e.StartArticle, e.EndArticle, e.RoomID),
+		Data:    e,
+	})
+}
@@ -0,0 +1,151 @@
+package moderation
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/store"
+)
+
+const collection = "bans"
+
+// Kind is what a ban matches a connection by
+type Kind string
+
+const (
+	KindIP      Kind = "ip"
+	KindAccount Kind = "account"
+	KindGuest   Kind = "guest" // the signed guest cookie ID
+)
+
+// Errors returned by the moderation service
+var (
+	ErrInvalidBan  = errors.New("ban needs a kind of ip, account or guest and a value")
+	ErrBanNotFound = errors.New("ban not found")
+)
+
+// Ban keeps a player or address off the server
+type Ban struct {
+	Kind      Kind      `json:"kind"`
+	Value     string    `json:"value"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// ExpiresAt lifts the ban automatically; nil bans permanently
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+func (b Ban) key() string {
+	return string(b.Kind) + ":" + b.Value
+}
+
+func (b Ban) expired(now time.Time) bool {
+	return b.ExpiresAt != nil && now.After(*b.ExpiresAt)
+}
+
+// Service stores server-wide bans and checks connections against them
+type Service struct {
+	store *store.Store
+}
+
+// NewService creates a moderation service backed by s
+func NewService(s *store.Store) *Service {
+	return &Service{store: s}
+}
+
+// Ban records a ban, replacing any existing one for the same kind and
+// value. IP values are normalized so "::1" and "0:0::1" match.
+func (s *Service) Ban(b Ban) (Ban, error) {
+	b.Value = strings.TrimSpace(b.Value)
+	switch b.Kind {
+	case KindIP:
+		ip := net.ParseIP(b.Value)
+		if ip == nil {
+			return Ban{}, ErrInvalidBan
+		}
+		b.Value = ip.String()
+	case KindAccount, KindGuest:
+		if b.Value == "" {
+			return Ban{}, ErrInvalidBan
+		}
+	default:
+		return Ban{}, ErrInvalidBan
+	}
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now()
+	}
+	if err := s.store.Put(collection, b.key(), b); err != nil {
+		return Ban{}, err
+	}
+	return b, nil
+}
+
+// Unban lifts a ban
+func (s *Service) Unban(kind Kind, value string) error {
+	key := Ban{Kind: kind, Value: value}.key()
+	if kind == KindIP {
+		if ip := net.ParseIP(value); ip != nil {
+			key = Ban{Kind: kind, Value: ip.String()}.key()
+		}
+	}
+	var b Ban
+	found, err := s.store.Get(collection, key, &b)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrBanNotFound
+	}
+	return s.store.Delete(collection, key)
+}
+
+// List returns the active bans, newest first
+func (s *Service) List() []Ban {
+	now := time.Now()
+	bans := make([]Ban, 0)
+	err := s.store.Each(collection, func(key string, raw json.RawMessage) error {
+		var b Ban
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return err
+		}
+		if !b.expired(now) {
+			bans = append(bans, b)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to list bans: %v", err)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].CreatedAt.After(bans[j].CreatedAt)
+	})
+	return bans
+}
+
+// Check returns the ban matching a connection's address, account or guest
+// ID, if any. Empty identities are skipped.
+func (s *Service) Check(ip, accountID, guestID string) (Ban, bool) {
+	now := time.Now()
+	for _, b := range []Ban{
+		{Kind: KindIP, Value: ip},
+		{Kind: KindAccount, Value: accountID},
+		{Kind: KindGuest, Value: guestID},
+	} {
+		if b.Value == "" {
+			continue
+		}
+		found, err := s.store.Get(collection, b.key(), &b)
+		if err != nil {
+			log.Printf("Failed to check ban %s: %v", b.key(), err)
+			continue
+		}
+		if found && !b.expired(now) {
+			return b, true
+		}
+	}
+	return Ban{}, false
+}
@@ -0,0 +1,292 @@
+package push
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/store"
+)
+
+const (
+	collection = "push_subscriptions"
+
+	// maxSubscriptions caps browsers per account; the oldest is replaced
+	maxSubscriptions = 10
+	queueSize        = 256
+	sendTimeout      = 10 * time.Second
+	// messageTTL is how long push services hold a notification for a
+	// device that's offline. Invites and start reminders go stale quickly.
+	messageTTL = 15 * time.Minute
+)
+
+// Errors returned by the push service
+var (
+	ErrMissingKeys         = errors.New("web push needs both VAPID keys")
+	ErrInvalidKey          = errors.New("VAPID private key must be a base64url P-256 scalar")
+	ErrInvalidSubscription = errors.New("invalid push subscription")
+	ErrNotSubscribed       = errors.New("no push subscription for that endpoint")
+)
+
+// Config holds the server's VAPID identity. Generate a key pair once with
+// any Web Push library, e.g. `npx web-push generate-vapid-keys`.
+type Config struct {
+	PublicKey  string // base64url uncompressed P-256 point, given to browsers
+	PrivateKey string // base64url 32-byte scalar
+	// Subject is a mailto: or https: contact for push services
+	Subject string
+}
+
+// Keys are a subscription's encryption keys, as in the browser's
+// PushSubscription.toJSON()
+type Keys struct {
+	P256dh string `json:"p256dh"`
+	Auth   string `json:"auth"`
+}
+
+// Subscription is one browser's push endpoint
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     Keys   `json:"keys"`
+}
+
+// Notification is the JSON payload the client's service worker shows
+type Notification struct {
+	Type  string      `json:"type"` // e.g. "room_invite", "race_starting"
+	Title string      `json:"title"`
+	Body  string      `json:"body"`
+	URL   string      `json:"url,omitempty"` // opened when the notification is clicked
+	Data  interface{} `json:"data,omitempty"`
+}
+
+type delivery struct {
+	account string
+	payload []byte
+}
+
+// Service stores push subscriptions per account and delivers
+// notifications to them from a background goroutine
+type Service struct {
+	store  *store.Store
+	cfg    Config
+	key    *ecdsa.PrivateKey
+	client *http.Client
+	queue  chan delivery
+	mu     sync.Mutex
+}
+
+// New starts a push service for cfg, or returns nil when no keys are set.
+// Sending to a nil service does nothing.
+func New(s *store.Store, cfg Config) (*Service, error) {
+	if cfg.PublicKey == "" && cfg.PrivateKey == "" {
+		return nil, nil
+	}
+	if cfg.PublicKey == "" || cfg.PrivateKey == "" {
+		return nil, ErrMissingKeys
+	}
+	key, err := parseKey(cfg.PrivateKey, cfg.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Subject == "" {
+		cfg.Subject = "https://github.com/mrktsm/wikispeedrun"
+	}
+	svc := &Service{
+		store:  s,
+		cfg:    cfg,
+		key:    key,
+		client: &http.Client{Timeout: sendTimeout},
+		queue:  make(chan delivery, queueSize),
+	}
+	go svc.run()
+	return svc, nil
+}
+
+// parseKey builds the VAPID signing key and checks it matches the public
+// key browsers are given
+func parseKey(private, public string) (*ecdsa.PrivateKey, error) {
+	d, err := base64.RawURLEncoding.DecodeString(private)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	k, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	point := k.PublicKey().Bytes()
+	if base64.RawURLEncoding.EncodeToString(point) != public {
+		return nil, errors.New("VAPID public key doesn't match the private key")
+	}
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(point[1:33]),
+			Y:     new(big.Int).SetBytes(point[33:]),
+		},
+		D: new(big.Int).SetBytes(d),
+	}, nil
+}
+
+// PublicKey returns the VAPID key browsers subscribe with
+func (s *Service) PublicKey() string {
+	return s.cfg.PublicKey
+}
+
+// Subscriptions returns an account's subscriptions
+func (s *Service) Subscriptions(account string) ([]Subscription, error) {
+	var subs []Subscription
+	if _, err := s.store.Get(collection, account, &subs); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// Subscribe adds a browser to an account, replacing an earlier
+// subscription with the same endpoint
+func (s *Service) Subscribe(account string, sub Subscription) error {
+	if !valid(sub) {
+		return ErrInvalidSubscription
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subs, err := s.Subscriptions(account)
+	if err != nil {
+		return err
+	}
+	subs = without(subs, sub.Endpoint)
+	if len(subs) >= maxSubscriptions {
+		subs = subs[len(subs)-maxSubscriptions+1:]
+	}
+	return s.store.Put(collection, account, append(subs, sub))
+}
+
+// Unsubscribe removes a browser from an account
+func (s *Service) Unsubscribe(account, endpoint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subs, err := s.Subscriptions(account)
+	if err != nil {
+		return err
+	}
+	kept := without(subs, endpoint)
+	if len(kept) == len(subs) {
+		return ErrNotSubscribed
+	}
+	if len(kept) == 0 {
+		return s.store.Delete(collection, account)
+	}
+	return s.store.Put(collection, account, kept)
+}
+
+// Send queues a notification to every browser an account subscribed,
+// dropping it if the queue is full
+func (s *Service) Send(account string, n Notification) {
+	if s == nil {
+		return
+	}
+	payload, err := json.Marshal(n)
+	if err != nil {
+		log.Printf("Push %s not sent: %v", n.Type, err)
+		return
+	}
+	select {
+	case s.queue <- delivery{account: account, payload: payload}:
+	default:
+		log.Printf("Push queue full, dropping %s", n.Type)
+	}
+}
+
+func (s *Service) run() {
+	for d := range s.queue {
+		subs, err := s.Subscriptions(d.account)
+		if err != nil {
+			log.Printf("Failed to load push subscriptions of %s: %v", d.account, err)
+			continue
+		}
+		for _, sub := range subs {
+			gone, err := s.deliver(sub, d.payload)
+			if err != nil {
+				log.Printf("Push to %s failed: %v", d.account, err)
+			}
+			if gone {
+				// The browser unsubscribed or the subscription expired
+				if err := s.Unsubscribe(d.account, sub.Endpoint); err != nil && !errors.Is(err, ErrNotSubscribed) {
+					log.Printf("Failed to drop push subscription of %s: %v", d.account, err)
+				}
+			}
+		}
+	}
+}
+
+// deliver encrypts and posts one message. gone reports a subscription
+// the push service no longer knows.
+func (s *Service) deliver(sub Subscription, payload []byte) (gone bool, err error) {
+	body, err := encrypt(sub, payload)
+	if err != nil {
+		return true, err
+	}
+	jwt, err := s.vapidToken(sub.Endpoint)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(messageTTL.Seconds())))
+	req.Header.Set("Urgency", "high")
+	req.Header.Set("Authorization", "vapid t="+jwt+", k="+s.cfg.PublicKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusGone:
+		return true, nil
+	case resp.StatusCode >= 300:
+		return false, fmt.Errorf("push service returned %s", resp.Status)
+	}
+	return false, nil
+}
+
+// valid checks a subscription's endpoint is HTTPS and its keys decode to
+// the sizes RFC 8291 requires
+func valid(sub Subscription) bool {
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return false
+	}
+	p256dh, err := base64.RawURLEncoding.DecodeString(sub.Keys.P256dh)
+	if err != nil || len(p256dh) != 65 {
+		return false
+	}
+	auth, err := base64.RawURLEncoding.DecodeString(sub.Keys.Auth)
+	return err == nil && len(auth) == 16
+}
+
+func without(subs []Subscription, endpoint string) []Subscription {
+	kept := make([]Subscription, 0, len(subs))
+	for _, sub := range subs {
+		if sub.Endpoint != endpoint {
+			kept = append(kept, sub)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,262 @@
+package rating
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/store"
+)
+
+const (
+	// DefaultRating is assigned to players without a recorded rating
+	DefaultRating = 1200
+	// DefaultDeviation is a new player's rating deviation: their rating
+	// is anywhere within about 700 points of DefaultRating
+	DefaultDeviation = 350
+	// PlacementGames is how many ranked races a player's rating stays
+	// provisional for. Provisional players are left off leaderboards.
+	PlacementGames = 5
+	// legacyDeviation is assumed for players rated before deviations were
+	// recorded, who have games behind them
+	legacyDeviation   = 150
+	defaultVolatility = 0.06
+	// tau limits how fast volatility changes; Glickman suggests 0.3 to 1.2
+	tau = 0.5
+	// glickoScale converts between ratings and the Glicko-2 scale
+	glickoScale = 173.7178
+	// idlePeriod is how long without a ranked race counts as one Glicko-2
+	// rating period, over which a player's deviation grows back
+	idlePeriod = 24 * time.Hour
+	collection = "ratings"
+)
+
+// Record is a player's persisted rating
+type Record struct {
+	Rating      float64   `json:"rating"`
+	Deviation   float64   `json:"deviation,omitempty"`
+	Volatility  float64   `json:"volatility,omitempty"`
+	Games       int       `json:"games"`
+	SeasonGames int       `json:"seasonGames,omitempty"` // games since the season began
+	Name        string    `json:"name,omitempty"`        // from the latest ranked race, for leaderboards
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// fillDefaults sets the Glicko-2 parameters of records saved without them
+func (r *Record) fillDefaults() {
+	switch {
+	case r.Deviation > 0:
+	case r.Games > 0:
+		r.Deviation = legacyDeviation
+	default:
+		r.Deviation = DefaultDeviation
+	}
+	if r.Volatility == 0 {
+		r.Volatility = defaultVolatility
+	}
+}
+
+// Provisional reports whether the player is still playing placement races
+func (r Record) Provisional() bool {
+	return r.Games < PlacementGames
+}
+
+// Summary is a player's rating with its 95% confidence interval
+type Summary struct {
+	Rating      int  `json:"rating"`
+	Deviation   int  `json:"deviation"`
+	Low         int  `json:"low"`
+	High        int  `json:"high"`
+	Games       int  `json:"games"`
+	Provisional bool `json:"provisional,omitempty"`
+}
+
+// Summary rounds the record for display
+func (r Record) Summary() Summary {
+	return Summary{
+		Rating:      int(math.Round(r.Rating)),
+		Deviation:   int(math.Round(r.Deviation)),
+		Low:         int(math.Round(r.Rating - 2*r.Deviation)),
+		High:        int(math.Round(r.Rating + 2*r.Deviation)),
+		Games:       r.Games,
+		Provisional: r.Provisional(),
+	}
+}
+
+// Placement is a player's finishing position in a ranked race. Players
+// who share a place (e.g. all DNFs) are treated as a draw.
+type Placement struct {
+	Player string
+	Name   string
+	Place  int
+}
+
+// Change reports how a race moved a player's rating
+type Change struct {
+	Old         int  `json:"old"`
+	New         int  `json:"new"`
+	Deviation   int  `json:"deviation"`
+	Provisional bool `json:"provisional,omitempty"`
+}
+
+// Service reads and updates ratings in the persistent store
+type Service struct {
+	store    *store.Store
+	schedule Schedule
+	mu       sync.Mutex
+}
+
+// NewService creates a rating service backed by s. Ratings run as one
+// endless season when schedule lists none.
+func NewService(s *store.Store, schedule Schedule) *Service {
+	return &Service{store: s, schedule: schedule}
+}
+
+// Get returns a player's rating record, or the default for new players.
+// Deviation includes the uncertainty added since their last ranked race.
+func (s *Service) Get(player string) Record {
+	rec := Record{Rating: DefaultRating}
+	if _, err := s.store.Get(collection, player, &rec); err != nil {
+		log.Printf("Failed to load rating for %s: %v", player, err)
+	}
+	rec.fillDefaults()
+	if !rec.UpdatedAt.IsZero() {
+		periods := float64(time.Since(rec.UpdatedAt) / idlePeriod)
+		phi := rec.Deviation / glickoScale
+		phi = math.Sqrt(phi*phi + periods*rec.Volatility*rec.Volatility)
+		rec.Deviation = math.Min(phi*glickoScale, DefaultDeviation)
+	}
+	return rec
+}
+
+// Update applies a multiplayer Glicko-2 update: the race is one rating
+// period in which each pair of players is scored as a win, loss or draw
+// by place. Each pairing is weighted by the field size so a race against
+// many opponents moves ratings about as much as a 1v1.
+func (s *Service) Update(placements []Placement) map[string]Change {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changes := make(map[string]Change)
+	if len(placements) < 2 {
+		return changes
+	}
+
+	records := make([]Record, len(placements))
+	for i, p := range placements {
+		records[i] = s.Get(p.Player)
+	}
+
+	weight := 1 / float64(len(placements)-1)
+	updated := make([]Record, len(placements))
+	for i := range placements {
+		var opponents []outcome
+		for j := range placements {
+			if i == j {
+				continue
+			}
+			score := 0.5
+			if placements[i].Place < placements[j].Place {
+				score = 1
+			} else if placements[i].Place > placements[j].Place {
+				score = 0
+			}
+			opponents = append(opponents, outcome{records[j], score})
+		}
+		updated[i] = glicko2(records[i], opponents, weight)
+	}
+
+	now := time.Now()
+	for i, p := range placements {
+		old := records[i].Rating
+		rec := updated[i]
+		rec.Games++
+		rec.SeasonGames++
+		if p.Name != "" {
+			rec.Name = p.Name
+		}
+		rec.UpdatedAt = now
+		if err := s.store.Put(collection, p.Player, rec); err != nil {
+			log.Printf("Failed to save rating for %s: %v", p.Player, err)
+		}
+		changes[p.Player] = Change{
+			Old:         int(math.Round(old)),
+			New:         int(math.Round(rec.Rating)),
+			Deviation:   int(math.Round(rec.Deviation)),
+			Provisional: rec.Provisional(),
+		}
+	}
+	return changes
+}
+
+// outcome is one pairing in a rating period
+type outcome struct {
+	opponent Record
+	score    float64 // 1 win, 0.5 draw, 0 loss
+}
+
+// glicko2 rates a player over one period, following Glickman's "Example
+// of the Glicko-2 system" with each outcome scaled by weight
+func glicko2(r Record, outcomes []outcome, weight float64) Record {
+	mu := (r.Rating - DefaultRating) / glickoScale
+	phi := r.Deviation / glickoScale
+	sigma := r.Volatility
+
+	var vInv, sum float64
+	for _, o := range outcomes {
+		muJ := (o.opponent.Rating - DefaultRating) / glickoScale
+		g := 1 / math.Sqrt(1+3*math.Pow(o.opponent.Deviation/glickoScale, 2)/(math.Pi*math.Pi))
+		e := 1 / (1 + math.Exp(-g*(mu-muJ)))
+		vInv += weight * g * g * e * (1 - e)
+		sum += weight * g * (o.score - e)
+	}
+	v := 1 / vInv
+	delta := v * sum
+
+	sigma = newVolatility(phi, sigma, v, delta)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu += phi * phi * sum
+
+	r.Rating = mu*glickoScale + DefaultRating
+	r.Deviation = math.Min(phi*glickoScale, DefaultDeviation)
+	r.Volatility = sigma
+	return r
+}
+
+// newVolatility solves for the period's volatility with the Illinois
+// algorithm (step 5 of Glickman's example)
+func newVolatility(phi, sigma, v, delta float64) float64 {
+	const epsilon = 1e-6
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-d)/(2*d*d) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
@@ -0,0 +1,220 @@
+package rating
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	stateCollection   = "rating_seasons"
+	stateKey          = "state"
+	archiveCollection = "season_archives"
+)
+
+// ErrSeasonNotFound is returned for seasons that aren't configured or
+// haven't been archived yet
+var ErrSeasonNotFound = errors.New("season not found")
+
+// Season is a stretch of ranked play with its own leaderboard
+type Season struct {
+	ID    string    `json:"id"`
+	Name  string    `json:"name,omitempty"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Schedule lists the configured seasons and how far ratings fall back to
+// DefaultRating when a new one begins: 0 keeps them, 1 resets them fully
+type Schedule struct {
+	Seasons   []Season
+	SoftReset float64
+}
+
+// at returns the season running at t, if any
+func (s Schedule) at(t time.Time) *Season {
+	for i := range s.Seasons {
+		if !t.Before(s.Seasons[i].Start) && t.Before(s.Seasons[i].End) {
+			return &s.Seasons[i]
+		}
+	}
+	return nil
+}
+
+// seasonState records which season the stored ratings belong to, so a
+// restart doesn't roll a season over twice
+type seasonState struct {
+	Season string `json:"season,omitempty"` // running season, "" between seasons
+	Last   string `json:"last,omitempty"`   // latest archived season
+}
+
+// Entry is one line of a leaderboard. Games counts the season's races
+// when seasons are configured.
+type Entry struct {
+	Rank   int    `json:"rank"`
+	Player string `json:"player"` // rating key
+	Name   string `json:"name,omitempty"`
+	Summary
+}
+
+// Archive is a season's final leaderboard
+type Archive struct {
+	Season     Season    `json:"season"`
+	Entries    []Entry   `json:"entries"`
+	ArchivedAt time.Time `json:"archivedAt"`
+}
+
+// Seasons returns the configured seasons and the one running now, if any
+func (s *Service) Seasons(now time.Time) ([]Season, *Season) {
+	return s.schedule.Seasons, s.schedule.at(now)
+}
+
+// Rollover archives a season once it's over and soft-resets ratings when
+// the next one begins. It's cheap when nothing has changed, so it can run
+// on a short interval.
+func (s *Service) Rollover(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var state seasonState
+	if _, err := s.store.Get(stateCollection, stateKey, &state); err != nil {
+		log.Printf("Failed to load season state: %v", err)
+		return
+	}
+	current := ""
+	if season := s.schedule.at(now); season != nil {
+		current = season.ID
+	}
+	if current == state.Season {
+		return
+	}
+
+	if state.Season != "" {
+		if err := s.archive(state.Season, now); err != nil {
+			log.Printf("Failed to archive season %s: %v", state.Season, err)
+			return
+		}
+		log.Printf("Season %s archived", state.Season)
+		state.Last = state.Season
+	}
+	if current != "" {
+		// The first season starts from the ratings players already have
+		reset := s.schedule.SoftReset
+		if state.Last == "" {
+			reset = 0
+		}
+		s.softReset(reset)
+		log.Printf("Season %s started", current)
+	}
+	state.Season = current
+	if err := s.store.Put(stateCollection, stateKey, state); err != nil {
+		log.Printf("Failed to save season state: %v", err)
+	}
+}
+
+// archive saves the current leaderboard as the season's final one.
+// Caller must hold s.mu.
+func (s *Service) archive(id string, now time.Time) error {
+	season := Season{ID: id}
+	for _, configured := range s.schedule.Seasons {
+		if configured.ID == id {
+			season = configured
+		}
+	}
+	return s.store.Put(archiveCollection, id, Archive{
+		Season:     season,
+		Entries:    s.leaderboard(0),
+		ArchivedAt: now,
+	})
+}
+
+// softReset pulls every rating and deviation the given fraction of the
+// way back to the defaults and clears season game counts. Caller must
+// hold s.mu.
+func (s *Service) softReset(fraction float64) {
+	records := s.all()
+	keep := 1 - math.Min(math.Max(fraction, 0), 1)
+	for player, rec := range records {
+		rec.Rating = DefaultRating + (rec.Rating-DefaultRating)*keep
+		rec.Deviation = DefaultDeviation + (rec.Deviation-DefaultDeviation)*keep
+		rec.SeasonGames = 0
+		if err := s.store.Put(collection, player, rec); err != nil {
+			log.Printf("Failed to reset rating for %s: %v", player, err)
+		}
+	}
+}
+
+// Leaderboard ranks players who have played this season, or ever when no
+// seasons are configured. Players still in placements aren't listed.
+// limit 0 returns everyone.
+func (s *Service) Leaderboard(limit int) []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.leaderboard(limit)
+}
+
+// SeasonLeaderboard returns an archived season's final leaderboard
+func (s *Service) SeasonLeaderboard(id string, limit int) (Archive, error) {
+	var archive Archive
+	ok, err := s.store.Get(archiveCollection, id, &archive)
+	if err != nil {
+		return Archive{}, err
+	}
+	if !ok {
+		return Archive{}, ErrSeasonNotFound
+	}
+	if limit > 0 && len(archive.Entries) > limit {
+		archive.Entries = archive.Entries[:limit]
+	}
+	return archive, nil
+}
+
+// leaderboard builds the current standings. Caller must hold s.mu.
+func (s *Service) leaderboard(limit int) []Entry {
+	seasonal := len(s.schedule.Seasons) > 0
+	entries := []Entry{}
+	for player, rec := range s.all() {
+		games := rec.Games
+		if seasonal {
+			games = rec.SeasonGames
+		}
+		if games == 0 || rec.Provisional() {
+			continue
+		}
+		summary := rec.Summary()
+		summary.Games = games
+		entries = append(entries, Entry{Player: player, Name: rec.Name, Summary: summary})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Rating != entries[j].Rating {
+			return entries[i].Rating > entries[j].Rating
+		}
+		return entries[i].Player < entries[j].Player
+	})
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+// all reads every stored rating by player
+func (s *Service) all() map[string]Record {
+	records := make(map[string]Record)
+	s.store.Each(collection, func(player string, raw json.RawMessage) error {
+		var rec Record
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			log.Printf("Rating for %s unreadable: %v", player, err)
+			return nil
+		}
+		rec.fillDefaults()
+		records[player] = rec
+		return nil
+	})
+	return records
+}
@@ -0,0 +1,160 @@
+// Package recording uploads room event logs to S3-compatible object
+// storage, so replays can be kept long term without growing the primary
+// store. Google Cloud Storage works through its S3 interoperability API
+// with an HMAC key and the endpoint https://storage.googleapis.com.
+package recording
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEndpoint = "https://s3.amazonaws.com"
+	defaultRegion   = "us-east-1"
+
+	queueSize     = 256
+	maxAttempts   = 4
+	uploadTimeout = 30 * time.Second
+)
+
+// ErrMissingCredentials is returned when a bucket is set without keys
+var ErrMissingCredentials = errors.New("recording bucket set without access and secret keys")
+
+// Config locates the bucket chunks are written to
+type Config struct {
+	Endpoint  string // scheme and host, AWS S3 if empty
+	Region    string // us-east-1 if empty; "auto" for GCS and R2
+	Bucket    string
+	Prefix    string // prepended to every object key
+	AccessKey string
+	SecretKey string
+}
+
+// Recorder writes chunks from a background goroutine so slow storage
+// never holds up a room
+type Recorder struct {
+	endpoint *url.URL
+	cfg      Config
+	client   *http.Client
+	queue    chan chunk
+}
+
+type chunk struct {
+	key  string
+	body []byte
+}
+
+// New starts a recorder for cfg, or returns nil when no bucket is set.
+// Putting to a nil recorder does nothing.
+func New(cfg Config) (*Recorder, error) {
+	if cfg.Bucket == "" {
+		return nil, nil
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, ErrMissingCredentials
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = defaultEndpoint
+	}
+	if cfg.Region == "" {
+		cfg.Region = defaultRegion
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid recording endpoint %q", cfg.Endpoint)
+	}
+	cfg.Prefix = strings.Trim(cfg.Prefix, "/")
+
+	r := &Recorder{
+		endpoint: endpoint,
+		cfg:      cfg,
+		client:   &http.Client{Timeout: uploadTimeout},
+		queue:    make(chan chunk, queueSize),
+	}
+	go r.run()
+	return r, nil
+}
+
+// Put queues body for upload under key, below the configured prefix. It
+// reports false if the queue is full and the chunk was dropped.
+func (r *Recorder) Put(key string, body []byte) bool {
+	if r == nil {
+		return false
+	}
+	if r.cfg.Prefix != "" {
+		key = r.cfg.Prefix + "/" + key
+	}
+	select {
+	case r.queue <- chunk{key: key, body: body}:
+		return true
+	default:
+		log.Printf("Recording queue full, dropping %s", key)
+		return false
+	}
+}
+
+func (r *Recorder) run() {
+	for c := range r.queue {
+		if err := r.upload(c); err != nil {
+			log.Printf("Recording %s not uploaded: %v", c.key, err)
+		}
+	}
+}
+
+// upload writes one chunk, retrying with backoff on network errors,
+// throttling and server errors
+func (r *Recorder) upload(c chunk) error {
+	var err error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt*attempt) * time.Second)
+		}
+		var retry bool
+		retry, err = r.put(c)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// put makes one PutObject request with a path-style URL, which every
+// S3-compatible service accepts, reporting whether a failure is worth
+// retrying
+func (r *Recorder) put(c chunk) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+
+	u := *r.endpoint
+	u.Path = "/" + r.cfg.Bucket + "/" + c.key
+	u.RawPath = "/" + uriEncode(r.cfg.Bucket) + "/" + uriEncode(c.key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(c.body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	sign(req, c.body, r.cfg.AccessKey, r.cfg.SecretKey, r.cfg.Region, time.Now())
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,190 @@
+package social
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/store"
+)
+
+const (
+	collection = "friends"
+	// maxFriends caps friends plus pending requests per account
+	maxFriends = 200
+)
+
+// Errors returned by the social service
+var (
+	ErrSelf           = errors.New("you can't add yourself as a friend")
+	ErrAlreadyFriends = errors.New("already friends")
+	ErrNoRequest      = errors.New("no friend request from that player")
+	ErrNotFriends     = errors.New("not friends")
+	ErrListFull       = errors.New("friend list is full")
+)
+
+// List is an account's friends and pending requests, by account ID
+type List struct {
+	Friends  []string `json:"friends"`
+	Incoming []string `json:"incoming"` // requests waiting on this account's answer
+	Outgoing []string `json:"outgoing"` // requests this account sent
+}
+
+func (l List) size() int {
+	return len(l.Friends) + len(l.Incoming) + len(l.Outgoing)
+}
+
+// Service stores friend lists. Friendships are mutual, so every change
+// updates both accounts' lists.
+type Service struct {
+	store *store.Store
+	mu    sync.Mutex
+}
+
+// NewService creates a social service backed by s
+func NewService(s *store.Store) *Service {
+	return &Service{store: s}
+}
+
+// Get returns an account's list, empty for accounts without one
+func (s *Service) Get(account string) (List, error) {
+	list := List{Friends: []string{}, Incoming: []string{}, Outgoing: []string{}}
+	if _, err := s.store.Get(collection, account, &list); err != nil {
+		return List{}, err
+	}
+	return list, nil
+}
+
+// AreFriends reports whether two accounts are friends
+func (s *Service) AreFriends(a, b string) (bool, error) {
+	list, err := s.Get(a)
+	if err != nil {
+		return false, err
+	}
+	return contains(list.Friends, b), nil
+}
+
+// Request asks to befriend another account. A request to someone who
+// already asked this account accepts theirs, reported by accepted.
+func (s *Service) Request(from, to string) (accepted bool, err error) {
+	if from == to {
+		return false, ErrSelf
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, b, err := s.pair(from, to)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case contains(a.Friends, to):
+		return false, ErrAlreadyFriends
+	case contains(a.Incoming, to):
+		return true, s.befriend(from, to, a, b)
+	case contains(a.Outgoing, to):
+		return false, nil
+	case a.size() >= maxFriends || b.size() >= maxFriends:
+		return false, ErrListFull
+	}
+	a.Outgoing = append(a.Outgoing, to)
+	b.Incoming = append(b.Incoming, from)
+	return false, s.save(from, to, a, b)
+}
+
+// Accept makes friends of an account and someone who sent it a request
+func (s *Service) Accept(account, from string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, b, err := s.pair(account, from)
+	if err != nil {
+		return err
+	}
+	if !contains(a.Incoming, from) {
+		return ErrNoRequest
+	}
+	return s.befriend(account, from, a, b)
+}
+
+// Decline drops a request someone sent the account
+func (s *Service) Decline(account, from string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, b, err := s.pair(account, from)
+	if err != nil {
+		return err
+	}
+	if !contains(a.Incoming, from) {
+		return ErrNoRequest
+	}
+	a.Incoming = without(a.Incoming, from)
+	b.Outgoing = without(b.Outgoing, account)
+	return s.save(account, from, a, b)
+}
+
+// Remove ends a friendship, or withdraws a request the account sent
+func (s *Service) Remove(account, friend string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, b, err := s.pair(account, friend)
+	if err != nil {
+		return err
+	}
+	if !contains(a.Friends, friend) && !contains(a.Outgoing, friend) {
+		return ErrNotFriends
+	}
+	a.Friends, a.Outgoing = without(a.Friends, friend), without(a.Outgoing, friend)
+	b.Friends, b.Incoming = without(b.Friends, account), without(b.Incoming, account)
+	return s.save(account, friend, a, b)
+}
+
+// befriend moves a pending request between a and b to a friendship.
+// Caller must hold s.mu.
+func (s *Service) befriend(a, b string, la, lb List) error {
+	la.Incoming, la.Outgoing = without(la.Incoming, b), without(la.Outgoing, b)
+	lb.Incoming, lb.Outgoing = without(lb.Incoming, a), without(lb.Outgoing, a)
+	la.Friends = append(la.Friends, b)
+	lb.Friends = append(lb.Friends, a)
+	return s.save(a, b, la, lb)
+}
+
+// pair loads both sides of a relationship
+func (s *Service) pair(a, b string) (List, List, error) {
+	la, err := s.Get(a)
+	if err != nil {
+		return List{}, List{}, err
+	}
+	lb, err := s.Get(b)
+	if err != nil {
+		return List{}, List{}, err
+	}
+	return la, lb, nil
+}
+
+func (s *Service) save(a, b string, la, lb List) error {
+	if err := s.store.Put(collection, a, la); err != nil {
+		return err
+	}
+	return s.store.Put(collection, b, lb)
+}
+
+func contains(ids []string, id string) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+func without(ids []string, id string) []string {
+	out := ids[:0]
+	for _, x := range ids {
+		if x != id {
+			out = append(out, x)
+		}
+	}
+	return out
+}
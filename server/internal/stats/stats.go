@@ -0,0 +1,189 @@
+package stats
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/store"
+)
+
+const (
+	collection = "player_stats"
+
+	recentRaces    = 20  // races kept in a player's history
+	fastestRuns    = 5   // personal bests kept
+	favoriteStarts = 5   // start articles reported
+	maxStarts      = 100 // start articles counted before rare ones are dropped
+)
+
+// Result is one player's outcome in one race
+type Result struct {
+	RoomID       string    `json:"roomId"`
+	Mode         string    `json:"mode"`
+	Language     string    `json:"language"`
+	StartArticle string    `json:"startArticle"`
+	EndArticle   string    `json:"endArticle"`
+	Rank         int       `json:"rank,omitempty"` // 0 for players who didn't finish
+	Players      int       `json:"players"`
+	Finished     bool      `json:"finished"`
+	Time         int64     `json:"time,omitempty"` // ms
+	Clicks       int       `json:"clicks"`
+	At           time.Time `json:"at"`
+}
+
+// won reports whether the result was a win against at least one
+// opponent
+func (r Result) won() bool {
+	return r.Finished && r.Rank == 1 && r.Players > 1
+}
+
+// Record is a player's persisted lifetime statistics
+type Record struct {
+	Name        string         `json:"name"`
+	Races       int            `json:"races"`
+	Wins        int            `json:"wins"`
+	Finishes    int            `json:"finishes"`
+	TotalClicks int            `json:"totalClicks"` // over finished races
+	Fastest     []Result       `json:"fastest"`     // quickest finishes, best first
+	Starts      map[string]int `json:"starts"`      // races per start article
+	Recent      []Result       `json:"recent"`      // newest first
+}
+
+// StartCount is how often a player raced from one article
+type StartCount struct {
+	Article string `json:"article"`
+	Races   int    `json:"races"`
+}
+
+// Profile is the aggregate view of a player's record
+type Profile struct {
+	Name           string       `json:"name"`
+	Races          int          `json:"races"`
+	Wins           int          `json:"wins"`
+	Finishes       int          `json:"finishes"`
+	AverageClicks  float64      `json:"averageClicks"`
+	Fastest        []Result     `json:"fastest"`
+	FavoriteStarts []StartCount `json:"favoriteStarts"`
+	Recent         []Result     `json:"recent"`
+}
+
+// Summary is the headline of a profile, small enough to show next to a
+// player in a room
+type Summary struct {
+	Races    int `json:"races"`
+	Wins     int `json:"wins"`
+	Finishes int `json:"finishes"`
+}
+
+// Summary returns the profile's headline numbers
+func (p Profile) Summary() Summary {
+	return Summary{Races: p.Races, Wins: p.Wins, Finishes: p.Finishes}
+}
+
+// Service records race results and summarizes them per player
+type Service struct {
+	store *store.Store
+	mu    sync.Mutex
+}
+
+// NewService creates a stats service backed by s
+func NewService(s *store.Store) *Service {
+	return &Service{store: s}
+}
+
+// Record adds a race result to a player's statistics, returning their
+// updated profile. player is the same key the rating service uses.
+func (s *Service) Record(player, name string, r Result) (Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rec Record
+	if _, err := s.store.Get(collection, player, &rec); err != nil {
+		return Profile{}, err
+	}
+	rec.Name = name
+	rec.Races++
+	if r.won() {
+		rec.Wins++
+	}
+	if r.Finished {
+		rec.Finishes++
+		rec.TotalClicks += r.Clicks
+		rec.Fastest = append(rec.Fastest, r)
+		sort.SliceStable(rec.Fastest, func(i, j int) bool {
+			return rec.Fastest[i].Time < rec.Fastest[j].Time
+		})
+		if len(rec.Fastest) > fastestRuns {
+			rec.Fastest = rec.Fastest[:fastestRuns]
+		}
+	}
+
+	if rec.Starts == nil {
+		rec.Starts = make(map[string]int)
+	}
+	rec.Starts[r.StartArticle]++
+	if len(rec.Starts) > maxStarts {
+		// Forget the least-used article other than this one
+		least := ""
+		for article, n := range rec.Starts {
+			if article != r.StartArticle && (least == "" || n < rec.Starts[least]) {
+				least = article
+			}
+		}
+		delete(rec.Starts, least)
+	}
+
+	rec.Recent = append([]Result{r}, rec.Recent...)
+	if len(rec.Recent) > recentRaces {
+		rec.Recent = rec.Recent[:recentRaces]
+	}
+
+	if err := s.store.Put(collection, player, rec); err != nil {
+		return Profile{}, err
+	}
+	return rec.profile(), nil
+}
+
+// Get summarizes a player's statistics, reporting whether they have raced
+func (s *Service) Get(player string) (Profile, bool) {
+	var rec Record
+	found, err := s.store.Get(collection, player, &rec)
+	if err != nil {
+		log.Printf("Failed to load stats for %s: %v", player, err)
+	}
+	if !found || err != nil {
+		return Profile{}, false
+	}
+	return rec.profile(), true
+}
+
+func (rec Record) profile() Profile {
+	p := Profile{
+		Name:           rec.Name,
+		Races:          rec.Races,
+		Wins:           rec.Wins,
+		Finishes:       rec.Finishes,
+		Fastest:        append([]Result{}, rec.Fastest...),
+		FavoriteStarts: make([]StartCount, 0, len(rec.Starts)),
+		Recent:         rec.Recent,
+	}
+	if rec.Finishes > 0 {
+		p.AverageClicks = float64(rec.TotalClicks) / float64(rec.Finishes)
+	}
+	for article, n := range rec.Starts {
+		p.FavoriteStarts = append(p.FavoriteStarts, StartCount{Article: article, Races: n})
+	}
+	sort.Slice(p.FavoriteStarts, func(i, j int) bool {
+		a, b := p.FavoriteStarts[i], p.FavoriteStarts[j]
+		if a.Races != b.Races {
+			return a.Races > b.Races
+		}
+		return a.Article < b.Article
+	})
+	if len(p.FavoriteStarts) > favoriteStarts {
+		p.FavoriteStarts = p.FavoriteStarts[:favoriteStarts]
+	}
+	return p
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store persists small JSON documents grouped into collections. The whole
+// data set is kept in memory and rewritten to a single file on each change,
+// which is plenty for the handful of records a racing server keeps.
+type Store struct {
+	path string
+	mu   sync.RWMutex
+	data map[string]map[string]json.RawMessage
+}
+
+// Open loads the store at path, creating it if needed. An empty path
+// gives a memory-only store.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path: path,
+		data: make(map[string]map[string]json.RawMessage),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &s.data); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get decodes the document at collection/key into v, reporting whether it exists
+func (s *Store) Get(collection, key string, v interface{}) (bool, error) {
+	s.mu.RLock()
+	raw, ok := s.data[collection][key]
+	s.mu.RUnlock()
+
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// Put stores v at collection/key
+func (s *Store) Put(collection, key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data[collection] == nil {
+		s.data[collection] = make(map[string]json.RawMessage)
+	}
+	s.data[collection][key] = raw
+	return s.flush()
+}
+
+// Delete removes the document at collection/key
+func (s *Store) Delete(collection, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data[collection][key]; !ok {
+		return nil
+	}
+	delete(s.data[collection], key)
+	return s.flush()
+}
+
+// Replace swaps a collection's documents for docs in a single write,
+// dropping any not in docs
+func (s *Store) Replace(collection string, docs map[string]interface{}) error {
+	raws := make(map[string]json.RawMessage, len(docs))
+	for key, v := range docs {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		raws[key] = raw
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(raws) == 0 && len(s.data[collection]) == 0 {
+		return nil
+	}
+	if len(raws) == 0 {
+		delete(s.data, collection)
+	} else {
+		s.data[collection] = raws
+	}
+	return s.flush()
+}
+
+// Each calls fn for every document in a collection. fn must not modify the store.
+func (s *Store) Each(collection string, fn func(key string, raw json.RawMessage) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for key, raw := range s.data[collection] {
+		if err := fn(key, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush writes the data set atomically. Caller must hold s.mu.
+func (s *Store) flush() error {
+	if s.path == "" {
+		return nil
+	}
+
+	raw, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Reload replaces a collection with its contents in the file, picking up
+// documents another process sharing the file has written since Open
+func (s *Store) Reload(collection string) error {
+	if s.path == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var onDisk map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &onDisk); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if docs, ok := onDisk[collection]; ok {
+		s.data[collection] = docs
+	} else {
+		delete(s.data, collection)
+	}
+	return nil
+}
+
+// Ping reports whether the directory holding the store's file is still
+// there, e.g. that a mounted volume hasn't gone away
+func (s *Store) Ping() error {
+	if s.path == "" {
+		return nil
+	}
+	_, err := os.Stat(filepath.Dir(s.path))
+	return err
+}
@@ -0,0 +1,56 @@
+// Package tracing exports OpenTelemetry spans over OTLP/gRPC, to an
+// OpenTelemetry Collector or any backend that accepts OTLP directly.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName = "wiki-racing-server"
+	tracerName  = "github.com/markotsymbaluk/wiki-racing"
+)
+
+// Config locates the OTLP receiver spans are sent to
+type Config struct {
+	Endpoint    string  // host:port of an OTLP gRPC receiver
+	Insecure    bool    // plaintext, for a collector on a private network
+	SampleRatio float64 // fraction of traces kept, all of them if 0
+}
+
+// New starts exporting spans to cfg.Endpoint and returns the tracer for
+// them, or nil when no endpoint is set. Spans are batched and sent from a
+// background goroutine.
+func New(cfg Config) (trace.Tracer, error) {
+	if cfg.Endpoint == "" {
+		return nil, nil
+	}
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	// Doesn't wait for the receiver, spans queue until it's reachable
+	exporter, err := otlptracegrpc.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio > 0 && cfg.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(cfg.SampleRatio)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+		)),
+	)
+	return provider.Tracer(tracerName), nil
+}
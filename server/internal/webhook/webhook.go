@@ -0,0 +1,137 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of the body, prefixed
+	// with "sha256=", when a secret is configured
+	SignatureHeader = "X-Webhook-Signature"
+
+	queueSize   = 256
+	maxAttempts = 3
+	sendTimeout = 10 * time.Second
+	userAgent   = "WikiSpeedrun/1.0 (https://github.com/mrktsm/wikispeedrun)"
+)
+
+// Event is the JSON body of every webhook request
+type Event struct {
+	Type      string    `json:"event"`
+	Timestamp time.Time `json:"timestamp"`
+	// Content is a one-line summary. Discord posts this field as the
+	// message, so its webhook URLs work without an adapter.
+	Content string      `json:"content,omitempty"`
+	Data    interface{} `json:"data"`
+}
+
+// Notifier posts events to a fixed list of URLs from a background
+// goroutine so slow endpoints never hold up a race
+type Notifier struct {
+	urls   []string
+	secret string
+	client *http.Client
+	queue  chan []byte
+}
+
+// New starts a notifier for urls, or returns nil when there are none.
+// Sending to a nil notifier does nothing.
+func New(urls []string, secret string) *Notifier {
+	if len(urls) == 0 {
+		return nil
+	}
+	n := &Notifier{
+		urls:   urls,
+		secret: secret,
+		client: &http.Client{Timeout: sendTimeout},
+		queue:  make(chan []byte, queueSize),
+	}
+	go n.run()
+	return n
+}
+
+// Send queues an event for delivery, dropping it if the queue is full
+func (n *Notifier) Send(e Event) {
+	if n == nil {
+		return
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Webhook %s not sent: %v", e.Type, err)
+		return
+	}
+	select {
+	case n.queue <- body:
+	default:
+		log.Printf("Webhook queue full, dropping %s", e.Type)
+	}
+}
+
+func (n *Notifier) run() {
+	for body := range n.queue {
+		for _, url := range n.urls {
+			if err := n.deliver(url, body); err != nil {
+				log.Printf("Webhook to %s failed: %v", url, err)
+			}
+		}
+	}
+}
+
+// deliver posts body to url, retrying with backoff on network errors,
+// rate limiting and server errors
+func (n *Notifier) deliver(url string, body []byte) error {
+	var err error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		var retry bool
+		retry, err = n.post(url, body)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// post makes one delivery attempt, reporting whether a failure is worth
+// retrying
+func (n *Notifier) post(url string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("status %d", resp.StatusCode)
+	}
+}
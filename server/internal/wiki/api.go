@@ -0,0 +1,304 @@
+package wiki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxConcurrent requests are in flight to Wikipedia at once, and new
+	// ones start at most every requestInterval, across every edition
+	maxConcurrent   = 4
+	requestInterval = 50 * time.Millisecond
+	requestTimeout  = 10 * time.Second
+
+	// maxAttempts includes the first try. Retries back off from
+	// retryBackoff, doubling, or wait as long as Retry-After asks up to
+	// maxRetryAfter.
+	maxAttempts   = 3
+	retryBackoff  = 250 * time.Millisecond
+	maxRetryAfter = 5 * time.Second
+
+	// breakerThreshold consecutive failed requests open the circuit for
+	// breakerCooldown, after which one request is let through to test it
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+
+	// Responses are kept briefly so bursts of identical lookups, like a
+	// room's worth of racers loading one article, cost one request. Large
+	// bodies are left to the typed caches.
+	responseCacheTTL   = time.Minute
+	maxResponsesCached = 2000
+	maxCachedBody      = 32 << 10
+	maxBody            = 16 << 20
+)
+
+// ErrUnavailable is returned without contacting Wikipedia while recent
+// requests have been failing
+var ErrUnavailable = errors.New("wikipedia api: unavailable, backing off")
+
+// api sends the MediaWiki requests of every edition. Wikipedia sees one
+// server IP whichever languages are in play, so the limits are shared.
+type api struct {
+	http    *http.Client
+	slots   chan struct{}
+	breaker breaker
+
+	mu        sync.Mutex
+	next      time.Time // when the next request may start
+	inflight  map[string]*call
+	responses map[string]responseEntry
+}
+
+// call is a request others asking for the same URL wait on
+type call struct {
+	done chan struct{}
+	body []byte
+	err  error
+}
+
+type responseEntry struct {
+	body    []byte
+	expires time.Time
+}
+
+func newAPI() *api {
+	return &api{
+		http:      &http.Client{Timeout: requestTimeout},
+		slots:     make(chan struct{}, maxConcurrent),
+		inflight:  make(map[string]*call),
+		responses: make(map[string]responseEntry),
+	}
+}
+
+// get returns the body of a successful GET of u. With cache set, recent
+// responses are reused and concurrent requests for u share one call.
+func (a *api) get(ctx context.Context, u string, cache bool) ([]byte, error) {
+	if !cache {
+		return a.do(ctx, u)
+	}
+
+	a.mu.Lock()
+	if entry, ok := a.responses[u]; ok && time.Now().Before(entry.expires) {
+		a.mu.Unlock()
+		return entry.body, nil
+	}
+	if cl, ok := a.inflight[u]; ok {
+		a.mu.Unlock()
+		select {
+		case <-cl.done:
+			return cl.body, cl.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	cl := &call{done: make(chan struct{})}
+	a.inflight[u] = cl
+	a.mu.Unlock()
+
+	cl.body, cl.err = a.do(ctx, u)
+
+	a.mu.Lock()
+	delete(a.inflight, u)
+	if cl.err == nil && len(cl.body) <= maxCachedBody {
+		if len(a.responses) >= maxResponsesCached {
+			a.responses = make(map[string]responseEntry)
+		}
+		a.responses[u] = responseEntry{body: cl.body, expires: time.Now().Add(responseCacheTTL)}
+	}
+	a.mu.Unlock()
+	close(cl.done)
+
+	return cl.body, cl.err
+}
+
+// do makes the request within the concurrency limit, retrying failures
+// that are worth another try
+func (a *api) do(ctx context.Context, u string) ([]byte, error) {
+	select {
+	case a.slots <- struct{}{}:
+		defer func() { <-a.slots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if !a.breaker.allow() {
+		return nil, ErrUnavailable
+	}
+
+	var body []byte
+	var err error
+	var retryAfter time.Duration
+	retry := false
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, backoff(attempt, retryAfter)); err != nil {
+				a.breaker.abandon()
+				return nil, err
+			}
+		}
+		if err := a.pace(ctx); err != nil {
+			a.breaker.abandon()
+			return nil, err
+		}
+		body, retryAfter, retry, err = a.once(ctx, u)
+		if !retry {
+			break
+		}
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		// The caller gave up, which says nothing about Wikipedia
+		a.breaker.abandon()
+	case retry:
+		a.breaker.record(false)
+	default:
+		a.breaker.record(true)
+	}
+	return body, err
+}
+
+// once makes a single request. retry reports failures that may pass on
+// another try: network errors, rate limiting and server errors.
+func (a *api) once(ctx context.Context, u string) (body []byte, retryAfter time.Duration, retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return nil, 0, ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("wikipedia api: %s", resp.Status)
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests,
+			resp.StatusCode == http.StatusServiceUnavailable:
+			return nil, parseRetryAfter(resp.Header.Get("Retry-After")), true, err
+		case resp.StatusCode >= 500:
+			return nil, 0, true, err
+		}
+		return nil, 0, false, err
+	}
+	body, err = io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return nil, 0, ctx.Err() == nil, err
+	}
+	return body, 0, false, nil
+}
+
+// pace waits until the next request may start
+func (a *api) pace(ctx context.Context) error {
+	a.mu.Lock()
+	now := time.Now()
+	at := a.next
+	if at.Before(now) {
+		at = now
+	}
+	a.next = at.Add(requestInterval)
+	a.mu.Unlock()
+
+	return sleep(ctx, time.Until(at))
+}
+
+// backoff is the wait before a retry, with jitter so retries from a
+// burst don't land together
+func backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		if retryAfter > maxRetryAfter {
+			return maxRetryAfter
+		}
+		return retryAfter
+	}
+	d := retryBackoff << (attempt - 1)
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds, which is
+// how Wikimedia sends it
+func parseRetryAfter(v string) time.Duration {
+	secs, err := strconv.Atoi(v)
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// breaker stops requests for a while once Wikipedia keeps failing, so
+// the server doesn't add to an outage or a rate limit it's already hit
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool // a request is testing whether the circuit can close
+}
+
+// allow reports whether a request may go out
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < breakerThreshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record notes how an allowed request went
+func (b *breaker) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if ok {
+		if b.failures >= breakerThreshold {
+			log.Printf("Wikipedia API recovered, resuming requests")
+		}
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= breakerThreshold {
+		if b.failures == breakerThreshold {
+			log.Printf("Wikipedia API failing, pausing requests for %s", breakerCooldown)
+		}
+		b.openUntil = time.Now().Add(breakerCooldown)
+	}
+}
+
+// abandon releases an allowed request that ended without an answer
+func (b *breaker) abandon() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
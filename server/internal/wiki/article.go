@@ -0,0 +1,258 @@
+package wiki
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	articleHTMLTTL       = time.Hour
+	maxArticleHTMLCached = 500
+)
+
+// ErrMissingArticle is returned when Wikipedia has no page for a title
+var ErrMissingArticle = errors.New("article not found")
+
+// Page is an article's rendered body, sanitized for the game client
+type Page struct {
+	Title string `json:"title"` // canonical title after redirects
+	HTML  string `json:"html"`
+}
+
+type pageEntry struct {
+	page    Page
+	expires time.Time
+}
+
+// ArticleHTML fetches an article's rendered HTML and sanitizes it for the
+// game client. Results are cached since every racer in a room loads the
+// same pages.
+func (c *Client) ArticleHTML(ctx context.Context, title string) (Page, error) {
+	key := c.normalize(title)
+
+	c.mu.Lock()
+	if entry, ok := c.pages[key]; ok && time.Now().Before(entry.expires) {
+		c.mu.Unlock()
+		return entry.page, nil
+	}
+	c.mu.Unlock()
+
+	var resp struct {
+		Error *struct {
+			Code string `json:"code"`
+		} `json:"error"`
+		Parse struct {
+			Title string `json:"title"`
+			Text  string `json:"text"`
+		} `json:"parse"`
+	}
+	err := c.get(ctx, url.Values{
+		"action":             {"parse"},
+		"page":               {key},
+		"prop":               {"text"},
+		"redirects":          {"1"},
+		"disableeditsection": {"1"},
+		"formatversion":      {"2"},
+	}, &resp)
+	if err != nil {
+		return Page{}, err
+	}
+	if resp.Error != nil {
+		return Page{}, ErrMissingArticle
+	}
+
+	body, err := sanitize(resp.Parse.Text, c.lang, c.namespaceNames(ctx))
+	if err != nil {
+		return Page{}, err
+	}
+	page := Page{Title: resp.Parse.Title, HTML: body}
+
+	c.mu.Lock()
+	if len(c.pages) >= maxArticleHTMLCached {
+		c.pages = make(map[string]pageEntry)
+	}
+	c.pages[key] = pageEntry{page: page, expires: time.Now().Add(articleHTMLTTL)}
+	c.mu.Unlock()
+
+	return page, nil
+}
+
+// strippedElements are removed along with everything inside them
+var strippedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Form:     true,
+	atom.Input:    true,
+	atom.Button:   true,
+	atom.Select:   true,
+	atom.Textarea: true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Link:     true,
+	atom.Meta:     true,
+}
+
+// strippedClasses mark MediaWiki chrome that has no place in a race
+var strippedClasses = []string{
+	"mw-editsection",
+	"searchbox",
+	"mw-searchButton",
+	"noprint",
+}
+
+// Sanitize strips scripts, search boxes and other interactive chrome from
+// article HTML, unwraps external links to plain text, and tags internal
+// links with data-article so the client can intercept every click the
+// same way. Links are read as English Wikipedia's.
+func Sanitize(fragment string) (string, error) {
+	return sanitize(fragment, DefaultLanguage, defaultNamespaces)
+}
+
+// sanitizer carries what link rewriting needs to know about an edition
+type sanitizer struct {
+	lang       string
+	namespaces map[string]bool
+}
+
+func sanitize(fragment, lang string, namespaces map[string]bool) (string, error) {
+	s := sanitizer{lang: lang, namespaces: namespaces}
+	root := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), root)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	for _, n := range nodes {
+		s.node(n)
+		if !removable(n) {
+			if err := html.Render(&buf, n); err != nil {
+				return "", err
+			}
+		}
+	}
+	return buf.String(), nil
+}
+
+func (s sanitizer) node(n *html.Node) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		if removable(child) {
+			n.RemoveChild(child)
+		} else {
+			s.node(child)
+			if child.DataAtom == atom.A && !s.rewriteLink(child) {
+				unwrap(child)
+			}
+		}
+		child = next
+	}
+
+	if n.Type == html.ElementNode {
+		attrs := n.Attr[:0]
+		for _, a := range n.Attr {
+			// Inline handlers and javascript: URLs would run in the game page
+			if strings.HasPrefix(strings.ToLower(a.Key), "on") {
+				continue
+			}
+			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(a.Val)), "javascript:") {
+				continue
+			}
+			attrs = append(attrs, a)
+		}
+		n.Attr = attrs
+	}
+}
+
+func removable(n *html.Node) bool {
+	switch n.Type {
+	case html.CommentNode:
+		return true
+	case html.ElementNode:
+	default:
+		return false
+	}
+	if strippedElements[n.DataAtom] {
+		return true
+	}
+	for _, a := range n.Attr {
+		if a.Key == "role" && a.Val == "search" {
+			return true
+		}
+		if a.Key == "class" {
+			for _, class := range strings.Fields(a.Val) {
+				for _, stripped := range strippedClasses {
+					if class == stripped {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// rewriteLink tags an article link with its target title and reports
+// whether it should be kept. In-page anchors are kept as they are;
+// external and non-article links are not.
+func (s sanitizer) rewriteLink(a *html.Node) bool {
+	href := attr(a, "href")
+	if strings.HasPrefix(href, "#") {
+		return true
+	}
+	if !strings.HasPrefix(href, "/wiki/") && !strings.HasPrefix(href, "./") {
+		return false
+	}
+
+	path := strings.TrimPrefix(strings.TrimPrefix(href, "/wiki/"), "./")
+	if i := strings.IndexByte(path, '#'); i >= 0 {
+		path = path[:i]
+	}
+	title, err := url.PathUnescape(path)
+	if err != nil || title == "" || !isArticleTitle(title, s.namespaces) {
+		return false
+	}
+	a.Attr = append(a.Attr, html.Attribute{Key: "data-article", Val: NormalizeTitleIn(s.lang, title)})
+	return true
+}
+
+// isArticleTitle reports whether a link target is an article rather than
+// a page in one of the edition's other namespaces, which aren't race moves
+func isArticleTitle(title string, namespaces map[string]bool) bool {
+	i := strings.IndexByte(title, ':')
+	if i <= 0 {
+		return true
+	}
+	prefix := strings.ToLower(strings.TrimSpace(title[:i]))
+	return !namespaces[prefix] && !strings.HasSuffix(prefix, " talk")
+}
+
+// unwrap replaces n with its children
+func unwrap(n *html.Node) {
+	parent := n.Parent
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		n.RemoveChild(child)
+		parent.InsertBefore(child, n)
+		child = next
+	}
+	parent.RemoveChild(n)
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
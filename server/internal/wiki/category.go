@@ -0,0 +1,143 @@
+package wiki
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxCategoryDepth caps how many levels of subcategories are searched
+	MaxCategoryDepth = 3
+	// maxCategoriesVisited bounds the requests one search makes, since
+	// trees like "Physics" fan out enormously within a few levels
+	maxCategoriesVisited = 40
+	// maxCategoryPages caps continuation requests per category
+	maxCategoryPages  = 2
+	maxCategoryCached = 500
+
+	categoryNamespace = "14"
+	// categoryPrefix is the canonical namespace name, which every edition
+	// accepts alongside its own
+	categoryPrefix = "Category:"
+)
+
+// ErrEmptyCategory is returned when a category tree holds no articles,
+// including when the category doesn't exist
+var ErrEmptyCategory = errors.New("no articles in category")
+
+// CategoryArticles returns the main-namespace articles in a category and
+// its subcategories down to depth levels, breadth first. Large trees are
+// cut short after maxCategoriesVisited categories. Results are cached per
+// category and depth.
+func (c *Client) CategoryArticles(ctx context.Context, category string, depth int) ([]string, error) {
+	if depth < 0 {
+		depth = 0
+	}
+	if depth > MaxCategoryDepth {
+		depth = MaxCategoryDepth
+	}
+	root := c.normalize(category)
+	root = c.normalize(strings.TrimPrefix(root, categoryPrefix))
+	key := strconv.Itoa(depth) + "|" + root
+
+	c.mu.Lock()
+	if entry, ok := c.trees[key]; ok && time.Now().Before(entry.expires) {
+		c.mu.Unlock()
+		return entry.values, nil
+	}
+	c.mu.Unlock()
+
+	seen := map[string]bool{root: true}
+	articles := make([]string, 0)
+	found := make(map[string]bool)
+	level := []string{root}
+	visited := 0
+	for d := 0; d <= depth && len(level) > 0; d++ {
+		var next []string
+		for _, cat := range level {
+			if visited == maxCategoriesVisited {
+				break
+			}
+			visited++
+			pages, subcats, err := c.categoryMembers(ctx, cat)
+			if err != nil {
+				return nil, err
+			}
+			for _, title := range pages {
+				if !found[title] {
+					found[title] = true
+					articles = append(articles, title)
+				}
+			}
+			for _, sub := range subcats {
+				if !seen[sub] {
+					seen[sub] = true
+					next = append(next, sub)
+				}
+			}
+		}
+		level = next
+	}
+	if len(articles) == 0 {
+		return nil, ErrEmptyCategory
+	}
+
+	c.mu.Lock()
+	if len(c.trees) >= maxCategoryCached {
+		c.trees = make(map[string]cacheEntry)
+	}
+	c.trees[key] = cacheEntry{values: articles, expires: time.Now().Add(cacheTTL)}
+	c.mu.Unlock()
+
+	return articles, nil
+}
+
+// categoryMembers lists one category's articles and subcategories, the
+// latter without their "Category:" prefix
+func (c *Client) categoryMembers(ctx context.Context, category string) (pages, subcats []string, err error) {
+	params := url.Values{
+		"action":      {"query"},
+		"list":        {"categorymembers"},
+		"cmtitle":     {categoryPrefix + category},
+		"cmnamespace": {"0|" + categoryNamespace},
+		"cmtype":      {"page|subcat"},
+		"cmlimit":     {"max"},
+	}
+	for page := 0; page < maxCategoryPages; page++ {
+		var resp struct {
+			Continue map[string]string `json:"continue"`
+			Query    struct {
+				Members []struct {
+					NS    int    `json:"ns"`
+					Title string `json:"title"`
+				} `json:"categorymembers"`
+			} `json:"query"`
+		}
+		if err := c.get(ctx, params, &resp); err != nil {
+			return nil, nil, err
+		}
+
+		for _, m := range resp.Query.Members {
+			if m.NS == 0 {
+				pages = append(pages, m.Title)
+				continue
+			}
+			// Subcategory titles come in the edition's own namespace name
+			if i := strings.Index(m.Title, ":"); i >= 0 {
+				subcats = append(subcats, m.Title[i+1:])
+			}
+		}
+
+		if len(resp.Continue) == 0 {
+			break
+		}
+		for k, v := range resp.Continue {
+			params.Set(k, v)
+		}
+	}
+	return pages, subcats, nil
+}
@@ -0,0 +1,103 @@
+package wiki
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrNoFirstLink is returned when an article's body text links nowhere
+var ErrNoFirstLink = errors.New("no first link in article")
+
+// bodyBlocks are the top-level elements holding an article's running
+// text. Infoboxes, hatnotes and thumbnails sit in tables and divs, so
+// they're never searched.
+var bodyBlocks = map[atom.Atom]bool{
+	atom.P:  true,
+	atom.Ul: true,
+	atom.Ol: true,
+}
+
+// skippedInline hold text that isn't part of the sentence it sits in:
+// italics (titles and foreign terms), citations and pronunciations
+var skippedInline = map[atom.Atom]bool{
+	atom.I:     true,
+	atom.Em:    true,
+	atom.Sup:   true,
+	atom.Sub:   true,
+	atom.Small: true,
+	atom.Table: true,
+	atom.Style: true,
+}
+
+// FirstLink returns the first article linked from a page's body text
+// outside parentheses and italics, the link the Philosophy game follows.
+// It reads the same sanitized HTML the game client shows, so the two
+// agree on what the first link is.
+func (c *Client) FirstLink(ctx context.Context, title string) (string, error) {
+	page, err := c.ArticleHTML(ctx, title)
+	if err != nil {
+		return "", err
+	}
+	return firstLink(page.HTML)
+}
+
+func firstLink(fragment string) (string, error) {
+	root := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), root)
+	if err != nil {
+		return "", err
+	}
+	// Parser output comes wrapped in a single mw-parser-output div
+	if len(nodes) == 1 && nodes[0].DataAtom == atom.Div {
+		var children []*html.Node
+		for n := nodes[0].FirstChild; n != nil; n = n.NextSibling {
+			children = append(children, n)
+		}
+		nodes = children
+	}
+
+	for _, n := range nodes {
+		if n.Type != html.ElementNode || !bodyBlocks[n.DataAtom] {
+			continue
+		}
+		depth := 0
+		if title := firstLinkIn(n, &depth); title != "" {
+			return title, nil
+		}
+	}
+	return "", ErrNoFirstLink
+}
+
+// firstLinkIn searches n in document order, tracking how deep in
+// parentheses the text so far has gone. Parentheses are counted per
+// block, so an unbalanced one can't hide the rest of the article.
+func firstLinkIn(n *html.Node, depth *int) string {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		switch child.Type {
+		case html.TextNode:
+			*depth += strings.Count(child.Data, "(") - strings.Count(child.Data, ")")
+			if *depth < 0 {
+				*depth = 0
+			}
+		case html.ElementNode:
+			if skippedInline[child.DataAtom] {
+				continue
+			}
+			if child.DataAtom == atom.A {
+				// Link text never opens or closes a parenthesis
+				if title := attr(child, "data-article"); title != "" && *depth == 0 {
+					return title
+				}
+				continue
+			}
+			if title := firstLinkIn(child, depth); title != "" {
+				return title
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,143 @@
+package wiki
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// DefaultLanguage is the edition used when a room doesn't pick one
+const DefaultLanguage = "en"
+
+// languages are the Wikipedia editions races can run on. The list is
+// closed because the code becomes part of the API hostname.
+var languages = map[string]bool{
+	"ar": true, "az": true, "ca": true, "cs": true, "da": true, "de": true,
+	"el": true, "en": true, "es": true, "fa": true, "fi": true, "fr": true,
+	"he": true, "hu": true, "id": true, "it": true, "ja": true, "ko": true,
+	"nl": true, "no": true, "pl": true, "pt": true, "ro": true, "ru": true,
+	"sv": true, "tr": true, "uk": true, "vi": true, "zh": true,
+}
+
+// turkicCase marks editions that upper-case i to İ
+var turkicCase = map[string]bool{"az": true, "tr": true}
+
+// SupportedLanguage reports whether races can run on an edition
+func SupportedLanguage(lang string) bool {
+	return languages[lang]
+}
+
+// Languages lists the supported edition codes in order
+func Languages() []string {
+	codes := make([]string, 0, len(languages))
+	for code := range languages {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// defaultNamespaces are English Wikipedia's non-article namespaces, used
+// until an edition's own names have been fetched
+var defaultNamespaces = map[string]bool{
+	"category": true, "draft": true, "file": true, "help": true, "image": true,
+	"mediawiki": true, "module": true, "portal": true, "special": true,
+	"talk": true, "template": true, "user": true, "wikipedia": true,
+}
+
+// namespaceNames returns the lower-cased names and aliases of every
+// non-article namespace on this edition, so "Datei:" is recognised on
+// German Wikipedia. They're fetched once; if the API is unavailable the
+// English names are used without caching.
+func (c *Client) namespaceNames(ctx context.Context) map[string]bool {
+	c.mu.Lock()
+	names := c.namespaces
+	c.mu.Unlock()
+	if names != nil {
+		return names
+	}
+
+	var resp struct {
+		Query struct {
+			Namespaces map[string]struct {
+				ID        int    `json:"id"`
+				Name      string `json:"name"`
+				Canonical string `json:"canonical"`
+			} `json:"namespaces"`
+			NamespaceAliases []struct {
+				ID    int    `json:"id"`
+				Alias string `json:"alias"`
+			} `json:"namespacealiases"`
+		} `json:"query"`
+	}
+	err := c.get(ctx, url.Values{
+		"action":        {"query"},
+		"meta":          {"siteinfo"},
+		"siprop":        {"namespaces|namespacealiases"},
+		"formatversion": {"2"},
+	}, &resp)
+	if err != nil || len(resp.Query.Namespaces) == 0 {
+		return defaultNamespaces
+	}
+
+	names = make(map[string]bool)
+	for _, ns := range resp.Query.Namespaces {
+		if ns.ID != 0 {
+			names[strings.ToLower(ns.Name)] = true
+			names[strings.ToLower(ns.Canonical)] = true
+		}
+	}
+	for _, alias := range resp.Query.NamespaceAliases {
+		if alias.ID != 0 {
+			names[strings.ToLower(alias.Alias)] = true
+		}
+	}
+	delete(names, "")
+
+	c.mu.Lock()
+	c.namespaces = names
+	c.mu.Unlock()
+	return names
+}
+
+// ErrNoLangLink is returned when an article has no equivalent on the
+// requested edition
+var ErrNoLangLink = errors.New("no interlanguage link")
+
+// LangLink returns the title of the article equivalent to title on
+// another language edition, following redirects on this one first
+func (c *Client) LangLink(ctx context.Context, title, lang string) (string, error) {
+	if lang == c.lang {
+		return c.Canonical(ctx, title)
+	}
+
+	var resp struct {
+		Query struct {
+			Pages []struct {
+				Missing   bool `json:"missing"`
+				LangLinks []struct {
+					Title string `json:"title"`
+				} `json:"langlinks"`
+			} `json:"pages"`
+		} `json:"query"`
+	}
+	err := c.get(ctx, url.Values{
+		"action":        {"query"},
+		"prop":          {"langlinks"},
+		"titles":        {c.normalize(title)},
+		"lllang":        {lang},
+		"redirects":     {"1"},
+		"formatversion": {"2"},
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	for _, page := range resp.Query.Pages {
+		if !page.Missing && len(page.LangLinks) > 0 {
+			return page.LangLinks[0].Title, nil
+		}
+	}
+	return "", ErrNoLangLink
+}
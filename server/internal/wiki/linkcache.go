@@ -0,0 +1,273 @@
+package wiki
+
+import (
+	"container/list"
+	"encoding/binary"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultLinkTTL        = cacheTTL
+	defaultMaxLinksCached = 20000
+	defaultMaxLinksOnDisk = 500000
+
+	// Disk writes are batched, a transaction per linkFlushInterval at most,
+	// so lookups never wait on an fsync
+	linkWriteQueue    = 1024
+	linkFlushInterval = time.Second
+	linkSweepInterval = time.Hour
+)
+
+// linkBucket holds link lists on disk, keyed like the memory tier
+var linkBucket = []byte("links")
+
+// LinkCacheConfig sizes the cache of article link lists
+type LinkCacheConfig struct {
+	TTL            time.Duration // how long a list is trusted, 6h if 0
+	MaxEntries     int           // lists kept in memory, 20000 if 0
+	Path           string        // bbolt file for a tier on disk, memory only if empty
+	MaxDiskEntries int           // lists kept on disk, 500000 if 0
+}
+
+// LinkCache keeps the link lists fetched for articles, shared by every
+// edition. Recently used lists stay in memory; with a path set the rest
+// go to disk, so restarts don't cost a fresh round of API requests.
+type LinkCache struct {
+	ttl        time.Duration
+	maxEntries int
+	maxDisk    int
+	db         *bolt.DB
+	writes     chan linkWrite
+
+	mu      sync.Mutex
+	order   *list.List // most recently used first
+	entries map[string]*list.Element
+}
+
+type linkEntry struct {
+	key     string
+	links   []string
+	expires time.Time
+}
+
+type linkWrite struct {
+	key   string
+	value []byte
+}
+
+// OpenLinkCache creates a link cache, opening its disk tier if configured
+func OpenLinkCache(cfg LinkCacheConfig) (*LinkCache, error) {
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultLinkTTL
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = defaultMaxLinksCached
+	}
+	if cfg.MaxDiskEntries <= 0 {
+		cfg.MaxDiskEntries = defaultMaxLinksOnDisk
+	}
+	lc := &LinkCache{
+		ttl:        cfg.TTL,
+		maxEntries: cfg.MaxEntries,
+		maxDisk:    cfg.MaxDiskEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+	if cfg.Path == "" {
+		return lc, nil
+	}
+
+	db, err := bolt.Open(cfg.Path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(linkBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	lc.db = db
+	lc.writes = make(chan linkWrite, linkWriteQueue)
+	go lc.writeLoop()
+	return lc, nil
+}
+
+// get returns a cached list, looking on disk when memory doesn't have it
+func (lc *LinkCache) get(key string) ([]string, bool) {
+	lc.mu.Lock()
+	if el, ok := lc.entries[key]; ok {
+		entry := el.Value.(*linkEntry)
+		if time.Now().Before(entry.expires) {
+			lc.order.MoveToFront(el)
+			lc.mu.Unlock()
+			return entry.links, true
+		}
+		lc.order.Remove(el)
+		delete(lc.entries, key)
+	}
+	lc.mu.Unlock()
+
+	if lc.db == nil {
+		return nil, false
+	}
+	var value []byte
+	lc.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(linkBucket).Get([]byte(key)); v != nil {
+			value = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	links, expires, ok := decodeLinks(value)
+	if !ok || !time.Now().Before(expires) {
+		return nil, false
+	}
+	lc.remember(key, links, expires)
+	return links, true
+}
+
+// put caches a freshly fetched list in memory and, if there is one, on disk
+func (lc *LinkCache) put(key string, links []string) {
+	expires := time.Now().Add(lc.ttl)
+	lc.remember(key, links, expires)
+	if lc.db == nil {
+		return
+	}
+	select {
+	case lc.writes <- linkWrite{key: key, value: encodeLinks(links, expires)}:
+	default:
+		// Disk is falling behind; memory still has it
+	}
+}
+
+// remember adds a list to the memory tier, evicting the least recently
+// used past maxEntries
+func (lc *LinkCache) remember(key string, links []string, expires time.Time) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	if el, ok := lc.entries[key]; ok {
+		entry := el.Value.(*linkEntry)
+		entry.links, entry.expires = links, expires
+		lc.order.MoveToFront(el)
+		return
+	}
+	lc.entries[key] = lc.order.PushFront(&linkEntry{key: key, links: links, expires: expires})
+	for lc.order.Len() > lc.maxEntries {
+		oldest := lc.order.Back()
+		lc.order.Remove(oldest)
+		delete(lc.entries, oldest.Value.(*linkEntry).key)
+	}
+}
+
+// writeLoop batches queued writes into one transaction and sweeps the
+// disk tier of expired lists and overflow
+func (lc *LinkCache) writeLoop() {
+	flush := time.NewTicker(linkFlushInterval)
+	defer flush.Stop()
+	sweep := time.NewTicker(linkSweepInterval)
+	defer sweep.Stop()
+
+	pending := make(map[string][]byte)
+	for {
+		select {
+		case w := <-lc.writes:
+			pending[w.key] = w.value
+		case <-flush.C:
+			if len(pending) == 0 {
+				continue
+			}
+			err := lc.db.Update(func(tx *bolt.Tx) error {
+				b := tx.Bucket(linkBucket)
+				for key, value := range pending {
+					if err := b.Put([]byte(key), value); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				log.Printf("Writing %d link lists to disk failed: %v", len(pending), err)
+			}
+			pending = make(map[string][]byte)
+		case <-sweep.C:
+			lc.sweep()
+		}
+	}
+}
+
+// sweep deletes expired lists from disk, then the soonest to expire
+// until at most maxDisk are left
+func (lc *LinkCache) sweep() {
+	type stored struct {
+		key     []byte
+		expires time.Time
+	}
+	var expired, live []stored
+	now := time.Now()
+	lc.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(linkBucket).ForEach(func(k, v []byte) error {
+			s := stored{key: append([]byte(nil), k...)}
+			_, s.expires, _ = decodeLinks(v)
+			if now.Before(s.expires) {
+				live = append(live, s)
+			} else {
+				expired = append(expired, s)
+			}
+			return nil
+		})
+	})
+	left := len(live)
+	if over := len(live) - lc.maxDisk; over > 0 {
+		sort.Slice(live, func(i, j int) bool { return live[i].expires.Before(live[j].expires) })
+		expired = append(expired, live[:over]...)
+		left = lc.maxDisk
+	}
+	if len(expired) == 0 {
+		return
+	}
+
+	err := lc.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(linkBucket)
+		for _, s := range expired {
+			if err := b.Delete(s.key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Sweeping link cache failed: %v", err)
+		return
+	}
+	log.Printf("Swept %d link lists from disk, %d left", len(expired), left)
+}
+
+// encodeLinks stores the expiry as unix seconds, then the titles one per
+// line; titles can't contain newlines
+func encodeLinks(links []string, expires time.Time) []byte {
+	body := strings.Join(links, "\n")
+	value := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint64(value, uint64(expires.Unix()))
+	return append(value, body...)
+}
+
+func decodeLinks(value []byte) ([]string, time.Time, bool) {
+	if len(value) < 8 {
+		return nil, time.Time{}, false
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(value)), 0)
+	links := make([]string, 0)
+	if len(value) > 8 {
+		links = strings.Split(string(value[8:]), "\n")
+	}
+	return links, expires, true
+}
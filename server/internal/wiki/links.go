@@ -0,0 +1,89 @@
+package wiki
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+)
+
+const (
+	// maxLinkPages caps continuation requests per article. Each page holds
+	// up to 500 links, which covers all but the largest articles.
+	maxLinkPages = 4
+)
+
+// Links returns the main-namespace articles a page links to. Results are
+// kept in the client's link cache.
+func (c *Client) Links(ctx context.Context, title string) ([]string, error) {
+	return c.linkList(ctx, title, "links", url.Values{
+		"plnamespace": {"0"},
+		"pllimit":     {"max"},
+	})
+}
+
+// LinksHere returns the main-namespace articles linking to a page. Results
+// are kept in the client's link cache.
+func (c *Client) LinksHere(ctx context.Context, title string) ([]string, error) {
+	return c.linkList(ctx, title, "linkshere", url.Values{
+		"lhnamespace": {"0"},
+		"lhprop":      {"title"},
+		"lhlimit":     {"max"},
+	})
+}
+
+// linkList fetches a link-style prop for one title, following continuation
+func (c *Client) linkList(ctx context.Context, title, prop string, extra url.Values) ([]string, error) {
+	title = c.normalize(title)
+	key := c.lang + "|" + prop + "|" + title
+
+	if links, ok := c.links.get(key); ok {
+		return links, nil
+	}
+
+	params := url.Values{
+		"action":    {"query"},
+		"prop":      {prop},
+		"titles":    {title},
+		"redirects": {"1"},
+	}
+	for k, v := range extra {
+		params[k] = v
+	}
+
+	titles := make([]string, 0)
+	for page := 0; page < maxLinkPages; page++ {
+		var resp struct {
+			Continue map[string]string `json:"continue"`
+			Query    struct {
+				Pages map[string]map[string]json.RawMessage `json:"pages"`
+			} `json:"query"`
+		}
+		if err := c.get(ctx, params, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, p := range resp.Query.Pages {
+			var links []struct {
+				Title string `json:"title"`
+			}
+			if raw, ok := p[prop]; ok {
+				if err := json.Unmarshal(raw, &links); err != nil {
+					return nil, err
+				}
+			}
+			for _, l := range links {
+				titles = append(titles, l.Title)
+			}
+		}
+
+		if len(resp.Continue) == 0 {
+			break
+		}
+		for k, v := range resp.Continue {
+			params.Set(k, v)
+		}
+	}
+
+	c.links.put(key, titles)
+	return titles, nil
+}
@@ -0,0 +1,82 @@
+package wiki
+
+import (
+	"context"
+	"errors"
+)
+
+// maxPathFetches bounds how many link lists one path search may request
+const maxPathFetches = 150
+
+// ErrNoPath is returned when no route is found within the search budget
+var ErrNoPath = errors.New("no path found")
+
+// ShortestPath finds a shortest chain of links between two articles with a
+// bidirectional breadth-first search: forward over outgoing links and
+// backward over links-here, always expanding the smaller frontier. The
+// result includes both endpoints.
+func (c *Client) ShortestPath(ctx context.Context, from, to string) ([]string, error) {
+	from, to = c.normalize(from), c.normalize(to)
+	if from == to {
+		return []string{from}, nil
+	}
+
+	// Each side maps a visited title to the title it was reached from
+	forward := map[string]string{from: ""}
+	backward := map[string]string{to: ""}
+	forwardFrontier := []string{from}
+	backwardFrontier := []string{to}
+	fetches := 0
+
+	for len(forwardFrontier) > 0 && len(backwardFrontier) > 0 {
+		expandForward := len(forwardFrontier) <= len(backwardFrontier)
+		frontier, seen, other := backwardFrontier, backward, forward
+		fetch := c.LinksHere
+		if expandForward {
+			frontier, seen, other = forwardFrontier, forward, backward
+			fetch = c.Links
+		}
+
+		var next []string
+		for _, title := range frontier {
+			if fetches >= maxPathFetches {
+				return nil, ErrNoPath
+			}
+			fetches++
+
+			links, err := fetch(ctx, title)
+			if err != nil {
+				return nil, err
+			}
+			for _, link := range links {
+				if _, ok := seen[link]; ok {
+					continue
+				}
+				seen[link] = title
+				if _, ok := other[link]; ok {
+					return joinPath(forward, backward, link), nil
+				}
+				next = append(next, link)
+			}
+		}
+
+		if expandForward {
+			forwardFrontier = next
+		} else {
+			backwardFrontier = next
+		}
+	}
+	return nil, ErrNoPath
+}
+
+// joinPath stitches the two search trees together at the meeting article
+func joinPath(forward, backward map[string]string, meet string) []string {
+	var path []string
+	for title := meet; title != ""; title = forward[title] {
+		path = append([]string{title}, path...)
+	}
+	for title := backward[meet]; title != ""; title = backward[title] {
+		path = append(path, title)
+	}
+	return path
+}
@@ -0,0 +1,403 @@
+package wiki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	userAgent = "WikiSpeedrun/1.0 (https://github.com/mrktsm/wikispeedrun)"
+	cacheTTL  = 6 * time.Hour
+
+	searchCacheTTL  = 10 * time.Minute
+	maxSearchCached = 5000
+
+	maxArticlesCached = 50000
+
+	// randomBatch titles are fetched at a time, so each race doesn't cost
+	// a request of its own
+	randomBatch = 20
+)
+
+// Client queries one language edition of Wikipedia through the MediaWiki
+// API, with a small in-memory cache. Requests from every edition share
+// one set of rate limits, see api.
+type Client struct {
+	lang     string
+	apiURL   string
+	api      *api
+	links    *LinkCache
+	editions *editions
+
+	mu         sync.Mutex
+	categories map[string]cacheEntry
+	trees      map[string]cacheEntry // CategoryArticles results by depth and category
+	searches   map[string]cacheEntry
+	articles   map[string]articleEntry
+	pages      map[string]pageEntry
+	namespaces map[string]bool
+	random     []string // fetched but not yet handed out
+}
+
+type articleEntry struct {
+	article Article
+	expires time.Time
+}
+
+type cacheEntry struct {
+	values  []string
+	expires time.Time
+}
+
+// editions holds the clients for every language used so far, shared by
+// all of them so any client can hand out another edition
+type editions struct {
+	mu      sync.Mutex
+	clients map[string]*Client
+}
+
+// NewClient creates a client for English Wikipedia that keeps link lists
+// in memory. Other editions come from Language.
+func NewClient() *Client {
+	links, _ := OpenLinkCache(LinkCacheConfig{})
+	return NewCachedClient(links)
+}
+
+// NewCachedClient creates a client for English Wikipedia whose editions
+// all keep link lists in links
+func NewCachedClient(links *LinkCache) *Client {
+	e := &editions{clients: make(map[string]*Client)}
+	c := newClient(DefaultLanguage, newAPI(), links, e)
+	e.clients[DefaultLanguage] = c
+	return c
+}
+
+func newClient(lang string, a *api, links *LinkCache, e *editions) *Client {
+	return &Client{
+		lang:       lang,
+		apiURL:     "https://" + lang + ".wikipedia.org/w/api.php",
+		api:        a,
+		links:      links,
+		editions:   e,
+		categories: make(map[string]cacheEntry),
+		trees:      make(map[string]cacheEntry),
+		searches:   make(map[string]cacheEntry),
+		articles:   make(map[string]articleEntry),
+		pages:      make(map[string]pageEntry),
+	}
+}
+
+// Language returns the client for another language edition, creating it
+// on first use. Empty means English; unsupported codes also fall back to
+// English so a bad value can never reach the API hostname.
+func (c *Client) Language(lang string) *Client {
+	if !SupportedLanguage(lang) {
+		lang = DefaultLanguage
+	}
+	if lang == c.lang {
+		return c
+	}
+
+	c.editions.mu.Lock()
+	defer c.editions.mu.Unlock()
+	client, ok := c.editions.clients[lang]
+	if !ok {
+		client = newClient(lang, c.api, c.links, c.editions)
+		c.editions.clients[lang] = client
+	}
+	return client
+}
+
+// Lang returns the client's language code
+func (c *Client) Lang() string {
+	return c.lang
+}
+
+// NormalizeTitle converts an English Wikipedia title to canonical form
+func NormalizeTitle(title string) string {
+	return NormalizeTitleIn(DefaultLanguage, title)
+}
+
+// NormalizeTitleIn converts a title to the canonical form of a language
+// edition: underscores become spaces and the first letter is upper-cased
+// with that language's case rules
+func NormalizeTitleIn(lang, title string) string {
+	title = strings.TrimSpace(strings.ReplaceAll(title, "_", " "))
+	title = strings.Join(strings.Fields(title), " ")
+	r, size := utf8.DecodeRuneInString(title)
+	if r == utf8.RuneError {
+		return title
+	}
+	if turkicCase[lang] {
+		return string(unicode.TurkishCase.ToUpper(r)) + title[size:]
+	}
+	return string(unicode.ToUpper(r)) + title[size:]
+}
+
+// normalize converts a title to this edition's canonical form
+func (c *Client) normalize(title string) string {
+	return NormalizeTitleIn(c.lang, title)
+}
+
+// Categories returns the visible categories of an article, without the
+// "Category:" prefix. Results are cached per title.
+func (c *Client) Categories(ctx context.Context, title string) ([]string, error) {
+	title = c.normalize(title)
+
+	c.mu.Lock()
+	if entry, ok := c.categories[title]; ok && time.Now().Before(entry.expires) {
+		c.mu.Unlock()
+		return entry.values, nil
+	}
+	c.mu.Unlock()
+
+	var resp struct {
+		Query struct {
+			Pages map[string]struct {
+				Categories []struct {
+					Title string `json:"title"`
+				} `json:"categories"`
+			} `json:"pages"`
+		} `json:"query"`
+	}
+	err := c.get(ctx, url.Values{
+		"action":    {"query"},
+		"prop":      {"categories"},
+		"titles":    {title},
+		"clshow":    {"!hidden"},
+		"cllimit":   {"max"},
+		"redirects": {"1"},
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := make([]string, 0)
+	for _, page := range resp.Query.Pages {
+		for _, cat := range page.Categories {
+			categories = append(categories, strings.TrimPrefix(cat.Title, "Category:"))
+		}
+	}
+
+	c.mu.Lock()
+	c.categories[title] = cacheEntry{values: categories, expires: time.Now().Add(cacheTTL)}
+	c.mu.Unlock()
+
+	return categories, nil
+}
+
+// get performs an API request and decodes the JSON response into v. An
+// identical request made moments ago or still in flight is reused.
+func (c *Client) get(ctx context.Context, params url.Values, v interface{}) error {
+	return c.fetch(ctx, params, v, true)
+}
+
+// getFresh is get for requests whose answer must not be reused
+func (c *Client) getFresh(ctx context.Context, params url.Values, v interface{}) error {
+	return c.fetch(ctx, params, v, false)
+}
+
+func (c *Client) fetch(ctx context.Context, params url.Values, v interface{}, cache bool) error {
+	params.Set("format", "json")
+	body, err := c.api.get(ctx, c.apiURL+"?"+params.Encode(), cache)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// Ping makes the cheapest API request there is, to check Wikipedia can
+// be reached
+func (c *Client) Ping(ctx context.Context) error {
+	params := url.Values{}
+	params.Set("action", "query")
+	params.Set("meta", "siteinfo")
+	var resp struct{}
+	return c.getFresh(ctx, params, &resp)
+}
+
+// RandomArticles returns n random main-namespace article titles. They are
+// drawn from a batch fetched ahead, and no title is handed out twice.
+func (c *Client) RandomArticles(ctx context.Context, n int) ([]string, error) {
+	c.mu.Lock()
+	if len(c.random) >= n {
+		titles := append([]string(nil), c.random[:n]...)
+		c.random = c.random[n:]
+		c.mu.Unlock()
+		return titles, nil
+	}
+	c.mu.Unlock()
+
+	batch := n
+	if batch < randomBatch {
+		batch = randomBatch
+	}
+	var resp struct {
+		Query struct {
+			Random []struct {
+				Title string `json:"title"`
+			} `json:"random"`
+		} `json:"query"`
+	}
+	err := c.getFresh(ctx, url.Values{
+		"action":      {"query"},
+		"list":        {"random"},
+		"rnnamespace": {"0"},
+		"rnlimit":     {strconv.Itoa(batch)},
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	titles := make([]string, 0, batch)
+	for _, page := range resp.Query.Random {
+		titles = append(titles, page.Title)
+	}
+	if len(titles) < n {
+		return nil, fmt.Errorf("wikipedia api: got %d random articles, want %d", len(titles), n)
+	}
+
+	c.mu.Lock()
+	if len(c.random) < randomBatch {
+		c.random = append(c.random, titles[n:]...)
+	}
+	c.mu.Unlock()
+	return titles[:n:n], nil
+}
+
+// Search returns up to limit article titles matching a prefix, using the
+// opensearch API. Results are cached briefly since lobby autocomplete
+// repeats the same prefixes constantly.
+func (c *Client) Search(ctx context.Context, query string, limit int) ([]string, error) {
+	key := strconv.Itoa(limit) + "|" + strings.ToLower(strings.TrimSpace(query))
+
+	c.mu.Lock()
+	if entry, ok := c.searches[key]; ok && time.Now().Before(entry.expires) {
+		c.mu.Unlock()
+		return entry.values, nil
+	}
+	c.mu.Unlock()
+
+	// opensearch responds with [query, [titles], [descriptions], [urls]]
+	var resp []json.RawMessage
+	err := c.get(ctx, url.Values{
+		"action":    {"opensearch"},
+		"search":    {query},
+		"limit":     {strconv.Itoa(limit)},
+		"namespace": {"0"},
+		"redirects": {"resolve"},
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	titles := make([]string, 0, limit)
+	if len(resp) > 1 {
+		if err := json.Unmarshal(resp[1], &titles); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	if len(c.searches) >= maxSearchCached {
+		// Cheap bound on memory: start over rather than track recency
+		c.searches = make(map[string]cacheEntry)
+	}
+	c.searches[key] = cacheEntry{values: titles, expires: time.Now().Add(searchCacheTTL)}
+	c.mu.Unlock()
+
+	return titles, nil
+}
+
+// Article describes how MediaWiki resolves a title
+type Article struct {
+	Title          string `json:"title"` // canonical title after normalization and redirects
+	Missing        bool   `json:"missing"`
+	Disambiguation bool   `json:"disambiguation"`
+	Redirected     bool   `json:"redirected"`
+}
+
+// Resolve looks up a title, following redirects. Results are cached so
+// repeated navigations through popular redirects ("USA") stay cheap.
+func (c *Client) Resolve(ctx context.Context, title string) (Article, error) {
+	key := c.normalize(title)
+
+	c.mu.Lock()
+	if entry, ok := c.articles[key]; ok && time.Now().Before(entry.expires) {
+		c.mu.Unlock()
+		return entry.article, nil
+	}
+	c.mu.Unlock()
+
+	var resp struct {
+		Query struct {
+			Redirects []struct {
+				From string `json:"from"`
+				To   string `json:"to"`
+			} `json:"redirects"`
+			Pages map[string]struct {
+				Title     string    `json:"title"`
+				Missing   *struct{} `json:"missing"`
+				Invalid   *struct{} `json:"invalid"`
+				PageProps struct {
+					Disambiguation *string `json:"disambiguation"`
+				} `json:"pageprops"`
+			} `json:"pages"`
+		} `json:"query"`
+	}
+	err := c.get(ctx, url.Values{
+		"action":    {"query"},
+		"titles":    {title},
+		"redirects": {"1"},
+		"prop":      {"pageprops"},
+		"ppprop":    {"disambiguation"},
+	}, &resp)
+	if err != nil {
+		return Article{}, err
+	}
+
+	article := Article{Title: c.normalize(title), Missing: true}
+	for _, page := range resp.Query.Pages {
+		article.Title = page.Title
+		article.Missing = page.Missing != nil || page.Invalid != nil
+		article.Disambiguation = page.PageProps.Disambiguation != nil
+	}
+	article.Redirected = len(resp.Query.Redirects) > 0
+
+	c.mu.Lock()
+	if len(c.articles) >= maxArticlesCached {
+		c.articles = make(map[string]articleEntry)
+	}
+	c.articles[key] = articleEntry{article: article, expires: time.Now().Add(cacheTTL)}
+	c.mu.Unlock()
+
+	return article, nil
+}
+
+// Canonical returns the title a link ends up on after redirects. If the
+// API is unavailable the normalized title is returned along with the error.
+func (c *Client) Canonical(ctx context.Context, title string) (string, error) {
+	article, err := c.Resolve(ctx, title)
+	if err != nil {
+		return c.normalize(title), err
+	}
+	return article.Title, nil
+}
+
+// SameArticle compares two English titles in canonical form
+func SameArticle(a, b string) bool {
+	return SameArticleIn(DefaultLanguage, a, b)
+}
+
+// SameArticleIn compares two titles in a language edition's canonical form
+func SameArticleIn(lang, a, b string) bool {
+	return NormalizeTitleIn(lang, a) == NormalizeTitleIn(lang, b)
+}
@@ -1,31 +1,215 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/markotsymbaluk/wiki-racing/internal/api"
+	"github.com/markotsymbaluk/wiki-racing/internal/auth"
+	"github.com/markotsymbaluk/wiki-racing/internal/config"
+	"github.com/markotsymbaluk/wiki-racing/internal/discord"
+	"github.com/markotsymbaluk/wiki-racing/internal/edge"
+	"github.com/markotsymbaluk/wiki-racing/internal/graph"
+	"github.com/markotsymbaluk/wiki-racing/internal/health"
 	"github.com/markotsymbaluk/wiki-racing/internal/hub"
+	"github.com/markotsymbaluk/wiki-racing/internal/moderation"
+	"github.com/markotsymbaluk/wiki-racing/internal/push"
+	"github.com/markotsymbaluk/wiki-racing/internal/rating"
+	"github.com/markotsymbaluk/wiki-racing/internal/recording"
+	"github.com/markotsymbaluk/wiki-racing/internal/store"
+	"github.com/markotsymbaluk/wiki-racing/internal/tracing"
+	"github.com/markotsymbaluk/wiki-racing/internal/webhook"
+	"github.com/markotsymbaluk/wiki-racing/internal/wiki"
 )
 
 func main() {
-	h := hub.New()
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to YAML config file")
+	flag.Parse()
+	if *configPath == "" {
+		*configPath = "config.yaml"
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal("Loading config:", err)
+	}
+
+	// Persistent data (ratings, accounts, etc.) lives in a JSON file
+	db, err := store.Open(cfg.Storage.DSN)
+	if err != nil {
+		log.Fatal("Opening store:", err)
+	}
+
+	authService := auth.NewService(db, cfg.Auth.Secret)
+	resultSigner, err := auth.NewResultSigner(cfg.Auth.SigningKey)
+	if err != nil {
+		log.Fatal("Loading signing key:", err)
+	}
+	moderationService := moderation.NewService(db)
+	for name, client := range map[string]config.OAuthClient{
+		"google":  cfg.Auth.OAuth.Google,
+		"discord": cfg.Auth.OAuth.Discord,
+		"github":  cfg.Auth.OAuth.GitHub,
+	} {
+		if client.ClientID == "" {
+			continue
+		}
+		if err := authService.EnableProvider(name, client.ClientID, client.ClientSecret); err != nil {
+			log.Fatalf("Enabling %s sign-in: %v", name, err)
+		}
+	}
+	// Link lists from the API are also kept on disk when a path is set
+	linkCache, err := wiki.OpenLinkCache(wiki.LinkCacheConfig{
+		TTL:            cfg.LinkCache.TTL,
+		MaxEntries:     cfg.LinkCache.MaxEntries,
+		Path:           cfg.LinkCache.Path,
+		MaxDiskEntries: cfg.LinkCache.MaxDiskEntries,
+	})
+	if err != nil {
+		log.Fatal("Opening link cache:", err)
+	}
+	wikiClient := wiki.NewCachedClient(linkCache)
+
+	// The offline link graph is optional; without it links come from the API
+	var linkGraph *graph.Graph
+	if cfg.Graph.Path != "" {
+		linkGraph, err = graph.Load(cfg.Graph.Path)
+		if err != nil {
+			log.Fatal("Loading link graph:", err)
+		}
+		log.Printf("Loaded link graph: %d articles, %d links", linkGraph.Articles(), linkGraph.LinkCount())
+	}
+
+	var announcement *hub.Announcement
+	if cfg.Announcement.Message != "" {
+		announcement = &hub.Announcement{
+			Message:  cfg.Announcement.Message,
+			Severity: hub.Severity(cfg.Announcement.Severity),
+		}
+	}
+
+	// Client addresses come from forwarding headers only via trusted proxies
+	edgePolicy, err := edge.New(cfg.Proxy.TrustedProxies, cfg.CORS.AllowedOrigins)
+	if err != nil {
+		log.Fatal("Proxy and CORS settings:", err)
+	}
+
+	// Spans for every inbound message and broadcast when a receiver is set
+	tracer, err := tracing.New(tracing.Config{
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.Fatal("Tracing:", err)
+	}
+
+	// Room event logs are also kept in object storage when a bucket is set
+	recorder, err := recording.New(recording.Config{
+		Endpoint:  cfg.Recording.Endpoint,
+		Region:    cfg.Recording.Region,
+		Bucket:    cfg.Recording.Bucket,
+		Prefix:    cfg.Recording.Prefix,
+		AccessKey: cfg.Recording.AccessKey,
+		SecretKey: cfg.Recording.SecretKey,
+	})
+	if err != nil {
+		log.Fatal("Recording:", err)
+	}
+
+	pushService, err := push.New(db, push.Config{
+		PublicKey:  cfg.Push.PublicKey,
+		PrivateKey: cfg.Push.PrivateKey,
+		Subject:    cfg.Push.Subject,
+	})
+	if err != nil {
+		log.Fatal("Web Push:", err)
+	}
+
+	seasons := rating.Schedule{SoftReset: cfg.Seasons.SoftReset}
+	for _, s := range cfg.Seasons.List {
+		if s.ID == "" || !s.End.After(s.Start) {
+			log.Fatalf("Season %q needs an ID and to end after it starts", s.ID)
+		}
+		seasons.Seasons = append(seasons.Seasons, rating.Season{ID: s.ID, Name: s.Name, Start: s.Start, End: s.End})
+	}
+
+	h := hub.New(hub.Options{
+		MatchSize:   cfg.Rooms.MatchSize,
+		MaxPlayers:  cfg.Rooms.MaxPlayers,
+		MaxRooms:    cfg.Rooms.MaxRooms,
+		Store:       db,
+		Auth:        authService,
+		Moderation:  moderationService,
+		Edge:        edgePolicy,
+		Wiki:        wikiClient,
+		Graph:       linkGraph,
+		PongWait:    cfg.HeartbeatTimeout,
+		IdleTimeout: cfg.Rooms.IdleTimeout,
+
+		Announcement: announcement,
+		Webhooks:     webhook.New(cfg.Webhooks.URLs, cfg.Webhooks.Secret),
+		Push:         pushService,
+		Recorder:     recorder,
+		Tracer:       tracer,
+
+		CompressionLevel:     cfg.Compression.Level,
+		CompressionThreshold: cfg.Compression.Threshold,
+		Seasons:              seasons,
+	})
+	for _, e := range cfg.Events {
+		if e.ID == "" {
+			log.Fatalf("Event %q needs an ID", e.Name)
+		}
+		_, err := h.AddEvent(hub.RecurringEvent{
+			ID:          e.ID,
+			Name:        e.Name,
+			Cron:        e.Cron,
+			OpenMinutes: e.OpenMinutes,
+			MinPlayers:  e.MinPlayers,
+			Tier:        graph.Tier(e.Tier),
+			Room: hub.RoomOptions{
+				StartArticle: e.StartArticle,
+				EndArticle:   e.EndArticle,
+				Mode:         e.Mode,
+				Language:     e.Language,
+			},
+		})
+		if err != nil {
+			log.Fatalf("Event %q: %v", e.ID, err)
+		}
+	}
 	go h.Run()
 
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+	// A mux of our own, since importing net/http/pprof registers open
+	// handlers on the default one
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		hub.ServeWs(h, w, r)
 	})
 
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("ok"))
-	})
+	// Liveness and readiness probes. /health stays as an alias of /healthz
+	// for deploys that still point at it.
+	probes := health.New(
+		health.Check{Name: "hub", Run: h.Ready},
+		health.Check{Name: "storage", Run: func(context.Context) error { return db.Ping() }},
+		health.Check{Name: "wikipedia", Run: wikiClient.Ping, CacheFor: 30 * time.Second},
+	)
+	mux.HandleFunc("/healthz", probes.Live)
+	mux.HandleFunc("/health", probes.Live)
+	mux.HandleFunc("/readyz", probes.Ready)
 
 	// Lobbies endpoint - returns list of available lobbies
-	http.HandleFunc("/lobbies", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/lobbies", func(w http.ResponseWriter, r *http.Request) {
 		// CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if origin := edgePolicy.CORSOrigin(r); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
 		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
@@ -39,21 +223,58 @@ func main() {
 		json.NewEncoder(w).Encode(lobbies)
 	})
 
-	// Get port from environment variable (Railway provides this)
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	log.Printf("Racing server starting on :%s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatal("ListenAndServe:", err)
-	}
-}
-
-
+	// Room management API for web lobbies and bots
+	api.New(api.Config{
+		Hub:   h,
+		Auth:  authService,
+		Wiki:  wikiClient,
+		Token: cfg.Auth.APIToken,
 
+		Moderation: moderationService,
+		Push:       pushService,
+		AdminToken: cfg.Auth.AdminToken,
+		Pprof:      cfg.Debug.Pprof,
+		Signer:     resultSigner,
+		Edge:       edgePolicy,
 
+		OAuthCallbackBase: cfg.Auth.OAuth.CallbackBase,
+		ClientURL:         cfg.Auth.OAuth.ClientURL,
+	}).Register(mux)
 
+	// Optional Discord bot that creates rooms from a slash command
+	if cfg.Discord.ApplicationID != "" && cfg.Discord.PublicKey != "" {
+		bot, err := discord.New(h, discord.Config{
+			ApplicationID: cfg.Discord.ApplicationID,
+			PublicKey:     cfg.Discord.PublicKey,
+			BotToken:      cfg.Discord.BotToken,
+			GuildID:       cfg.Discord.GuildID,
+			PublicURL:     cfg.Discord.PublicURL,
+		})
+		if err != nil {
+			log.Fatal("Discord integration:", err)
+		}
+		bot.Register(mux)
+		if cfg.Discord.BotToken != "" {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+				if err := bot.RegisterCommands(ctx); err != nil {
+					log.Printf("Registering Discord commands failed: %v", err)
+				}
+			}()
+		}
+	}
 
+	// Optional gRPC endpoint for bots and other headless clients
+	if cfg.GRPCPort != "" {
+		go func() {
+			if err := serveGRPC(cfg.GRPCPort, cfg.TLS, h); err != nil {
+				log.Fatal("gRPC server:", err)
+			}
+		}()
+	}
 
+	if err := serve(cfg.Port, cfg.TLS, mux); err != nil {
+		log.Fatal("ListenAndServe:", err)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/markotsymbaluk/wiki-racing/internal/config"
+)
+
+// serve starts the HTTP server. Without TLS settings it listens on port in
+// plain HTTP, as on Railway where the platform terminates TLS. With a
+// static certificate it serves HTTPS on port. With autocert domains it
+// serves HTTPS on :443 and answers ACME challenges on :80.
+func serve(port string, s config.TLSConfig, handler http.Handler) error {
+	switch {
+	case len(s.Domains) > 0:
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(s.Domains...),
+			Cache:      autocert.DirCache(s.CacheDir),
+		}
+
+		// ACME HTTP-01 challenges, everything else is redirected to HTTPS
+		go func() {
+			log.Printf("ACME challenge listener starting on :80")
+			if err := http.ListenAndServe(":80", m.HTTPHandler(nil)); err != nil {
+				log.Printf("ACME challenge listener: %v", err)
+			}
+		}()
+
+		srv := &http.Server{
+			Addr:      ":443",
+			Handler:   handler,
+			TLSConfig: &tls.Config{GetCertificate: m.GetCertificate, MinVersion: tls.VersionTLS12},
+		}
+		log.Printf("Racing server starting on :443 with autocert for %s", strings.Join(s.Domains, ", "))
+		return srv.ListenAndServeTLS("", "")
+
+	case s.CertFile != "" && s.KeyFile != "":
+		log.Printf("Racing server starting on :%s with TLS", port)
+		return http.ListenAndServeTLS(":"+port, s.CertFile, s.KeyFile, handler)
+
+	default:
+		log.Printf("Racing server starting on :%s", port)
+		return http.ListenAndServe(":"+port, handler)
+	}
+}